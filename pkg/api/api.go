@@ -18,25 +18,117 @@ limitations under the License.
 
 package api
 
-import "github.com/submariner-io/admiral/pkg/reporter"
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/submariner-io/admiral/pkg/reporter"
+)
 
 // PortSpec is a specification of port+protocol to open.
 type PortSpec struct {
-	Port     uint16
 	Protocol string
+	Port     uint16
+
+	// EndPort optionally extends the specification to the contiguous range of ports from Port to EndPort, inclusive.
+	// It's ignored unless it's greater than Port.
+	EndPort uint16
+}
+
+// LastPort returns the last port of the range, which is Port unless EndPort extends it.
+func (p PortSpec) LastPort() uint16 {
+	if p.EndPort > p.Port {
+		return p.EndPort
+	}
+
+	return p.Port
+}
+
+// IsRange returns whether the specification covers more than one port.
+func (p PortSpec) IsRange() bool {
+	return p.EndPort > p.Port
+}
+
+// String returns the specification as "port/protocol", or "port-endPort/protocol" for a range.
+func (p PortSpec) String() string {
+	if p.IsRange() {
+		return fmt.Sprintf("%d-%d/%s", p.Port, p.EndPort, p.Protocol)
+	}
+
+	return fmt.Sprintf("%d/%s", p.Port, p.Protocol)
 }
 
-// Cloud is a potential cloud for installing Submariner on.
+// PortError records a port which could not be opened along with the reason.
+type PortError struct {
+	Port PortSpec
+	Err  error
+}
+
+// PartialPortsError is returned by OpenPorts implementations which open ports individually when some of the ports
+// could not be opened. Callers may inspect it, via errors.As, to decide whether partial success is acceptable.
+type PartialPortsError struct {
+	// Opened lists the ports which were successfully opened.
+	Opened []PortSpec
+
+	// Failed lists the ports which could not be opened.
+	Failed []PortError
+}
+
+func (e *PartialPortsError) Error() string {
+	failures := make([]string, len(e.Failed))
+	for i := range e.Failed {
+		failures[i] = fmt.Sprintf("%s: %v", e.Failed[i].Port, e.Failed[i].Err)
+	}
+
+	return fmt.Sprintf("failed to open %d of %d ports: %s", len(e.Failed), len(e.Failed)+len(e.Opened),
+		strings.Join(failures, "; "))
+}
+
+// Cloud is a potential cloud for installing Submariner on. Cancelling the context passed to its methods aborts any
+// pending cloud operations.
 type Cloud interface {
 	// OpenPorts inside the cloud for submariner to communicate through.
-	OpenPorts(ports []PortSpec, status reporter.Interface) error
+	OpenPorts(ctx context.Context, ports []PortSpec, status reporter.Interface) error
 
 	// ClosePorts will close any internal ports that were opened, after Submariner is removed.
+	ClosePorts(ctx context.Context, status reporter.Interface) error
+
+	// Validate checks, without changing anything, that the prerequisites of OpenPorts and ClosePorts are met, so that
+	// problems are reported before any change is made. All the failed checks are returned together.
+	Validate(ctx context.Context, status reporter.Interface) error
+}
+
+// CloudWithoutContext is the previous form of Cloud, whose methods don't take a context.
+//
+// Deprecated: Use Cloud instead; this will be removed in the next release.
+type CloudWithoutContext interface {
+	OpenPorts(ports []PortSpec, status reporter.Interface) error
 	ClosePorts(status reporter.Interface) error
 }
 
+type cloudWithoutContext struct {
+	cloud Cloud
+}
+
+// WithoutContext adapts the given Cloud to CloudWithoutContext, running its operations with a background context.
+//
+// Deprecated: Pass a context to the Cloud methods instead; this will be removed in the next release.
+func WithoutContext(cloud Cloud) CloudWithoutContext {
+	return cloudWithoutContext{cloud: cloud}
+}
+
+func (c cloudWithoutContext) OpenPorts(ports []PortSpec, status reporter.Interface) error {
+	return c.cloud.OpenPorts(context.Background(), ports, status)
+}
+
+func (c cloudWithoutContext) ClosePorts(status reporter.Interface) error {
+	return c.cloud.ClosePorts(context.Background(), status)
+}
+
 type GatewayDeployInput struct {
 	// List of ports to open externally so that Submariner can reach and be reached by other Submariners.
+	// These are applied to the gateways only; the intra-cluster ports are passed to Cloud.OpenPorts instead.
 	PublicPorts []PortSpec
 
 	// Amount of gateways that are being deployed.
@@ -53,11 +145,40 @@ type GatewayDeployInput struct {
 	AirGapped bool
 }
 
-// GatewayDeployer will deploy and cleanup dedicated gateways according to the requested policy.
+// GatewayDeployer will deploy and cleanup dedicated gateways according to the requested policy. Cancelling the context
+// passed to its methods aborts any pending cloud operations.
 type GatewayDeployer interface {
 	// Deploy dedicated gateways as requested.
-	Deploy(input GatewayDeployInput, status reporter.Interface) error
+	Deploy(ctx context.Context, input GatewayDeployInput, status reporter.Interface) error
 
 	// Cleanup any dedicated gateways that were previously deployed.
+	Cleanup(ctx context.Context, status reporter.Interface) error
+}
+
+// GatewayDeployerWithoutContext is the previous form of GatewayDeployer, whose methods don't take a context.
+//
+// Deprecated: Use GatewayDeployer instead; this will be removed in the next release.
+type GatewayDeployerWithoutContext interface {
+	Deploy(input GatewayDeployInput, status reporter.Interface) error
 	Cleanup(status reporter.Interface) error
 }
+
+type gatewayDeployerWithoutContext struct {
+	deployer GatewayDeployer
+}
+
+// DeployerWithoutContext adapts the given GatewayDeployer to GatewayDeployerWithoutContext, running its operations with a
+// background context.
+//
+// Deprecated: Pass a context to the GatewayDeployer methods instead; this will be removed in the next release.
+func DeployerWithoutContext(deployer GatewayDeployer) GatewayDeployerWithoutContext {
+	return gatewayDeployerWithoutContext{deployer: deployer}
+}
+
+func (d gatewayDeployerWithoutContext) Deploy(input GatewayDeployInput, status reporter.Interface) error {
+	return d.deployer.Deploy(context.Background(), input, status)
+}
+
+func (d gatewayDeployerWithoutContext) Cleanup(status reporter.Interface) error {
+	return d.deployer.Cleanup(context.Background(), status)
+}
@@ -0,0 +1,96 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+)
+
+type recordingCloud struct {
+	contexts []context.Context
+	ports    []api.PortSpec
+}
+
+func (c *recordingCloud) OpenPorts(ctx context.Context, ports []api.PortSpec, _ reporter.Interface) error {
+	c.contexts = append(c.contexts, ctx)
+	c.ports = ports
+
+	return nil
+}
+
+func (c *recordingCloud) ClosePorts(ctx context.Context, _ reporter.Interface) error {
+	c.contexts = append(c.contexts, ctx)
+
+	return nil
+}
+
+func (c *recordingCloud) Validate(ctx context.Context, _ reporter.Interface) error {
+	c.contexts = append(c.contexts, ctx)
+
+	return nil
+}
+
+type recordingDeployer struct {
+	contexts []context.Context
+}
+
+func (d *recordingDeployer) Deploy(ctx context.Context, _ api.GatewayDeployInput, _ reporter.Interface) error {
+	d.contexts = append(d.contexts, ctx)
+
+	return nil
+}
+
+func (d *recordingDeployer) Cleanup(ctx context.Context, _ reporter.Interface) error {
+	d.contexts = append(d.contexts, ctx)
+
+	return nil
+}
+
+var _ = Describe("WithoutContext", func() {
+	It("should call the Cloud with a background context", func() {
+		cloud := &recordingCloud{}
+		ports := []api.PortSpec{{Port: 4800, Protocol: "udp"}}
+
+		//nolint:staticcheck // Testing the deprecated shim.
+		legacy := api.WithoutContext(cloud)
+		Expect(legacy.OpenPorts(ports, reporter.Stdout())).To(Succeed())
+		Expect(legacy.ClosePorts(reporter.Stdout())).To(Succeed())
+
+		Expect(cloud.ports).To(Equal(ports))
+		Expect(cloud.contexts).To(Equal([]context.Context{context.Background(), context.Background()}))
+	})
+})
+
+var _ = Describe("DeployerWithoutContext", func() {
+	It("should call the GatewayDeployer with a background context", func() {
+		deployer := &recordingDeployer{}
+
+		//nolint:staticcheck // Testing the deprecated shim.
+		legacy := api.DeployerWithoutContext(deployer)
+		Expect(legacy.Deploy(api.GatewayDeployInput{}, reporter.Stdout())).To(Succeed())
+		Expect(legacy.Cleanup(reporter.Stdout())).To(Succeed())
+
+		Expect(deployer.contexts).To(Equal([]context.Context{context.Background(), context.Background()}))
+	})
+})
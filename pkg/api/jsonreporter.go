@@ -0,0 +1,128 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Phases of the events written by the JSON reporter.
+const (
+	PhaseStart   = "start"
+	PhaseSuccess = "success"
+	PhaseFailure = "failure"
+	PhaseWarning = "warning"
+	PhaseEnd     = "end"
+)
+
+// ReportEvent is an event written by the JSON reporter, one per line.
+type ReportEvent struct {
+	Phase     string    `json:"phase"`
+	Message   string    `json:"message,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Error     string    `json:"error,omitempty"`
+
+	// Step and TotalSteps track the progress of the operation, if its number of steps is known.
+	Step       int `json:"step,omitempty"`
+	TotalSteps int `json:"totalSteps,omitempty"`
+}
+
+type jsonReporter struct {
+	mutex      sync.Mutex
+	encoder    *json.Encoder
+	step       int
+	totalSteps int
+}
+
+// NewJSONReporter returns a reporter which writes each event to the given writer as a JSON object on its own line, so
+// that the progress can be followed by tooling. It's safe for concurrent use. It's also a ProgressReporter, so the
+// events include the current step once the number of steps is set.
+func NewJSONReporter(w io.Writer) ProgressReporter {
+	return &jsonReporter{encoder: json.NewEncoder(w)}
+}
+
+func (r *jsonReporter) SetTotalSteps(n int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.step = 0
+	r.totalSteps = n
+}
+
+func (r *jsonReporter) write(event ReportEvent) {
+	event.Timestamp = time.Now().UTC()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if event.Phase == PhaseStart {
+		r.step++
+	}
+
+	if r.totalSteps > 0 {
+		event.Step = r.step
+		event.TotalSteps = r.totalSteps
+	}
+
+	// The progress is reported on a best effort basis, so a failure to write it doesn't fail the operation.
+	_ = r.encoder.Encode(event)
+}
+
+func (r *jsonReporter) Start(message string, args ...interface{}) {
+	r.write(ReportEvent{Phase: PhaseStart, Message: fmt.Sprintf(message, args...)})
+}
+
+func (r *jsonReporter) Success(message string, args ...interface{}) {
+	r.write(ReportEvent{Phase: PhaseSuccess, Message: fmt.Sprintf(message, args...)})
+}
+
+func (r *jsonReporter) Failure(message string, args ...interface{}) {
+	r.write(ReportEvent{Phase: PhaseFailure, Message: fmt.Sprintf(message, args...)})
+}
+
+func (r *jsonReporter) Warning(message string, args ...interface{}) {
+	r.write(ReportEvent{Phase: PhaseWarning, Message: fmt.Sprintf(message, args...)})
+}
+
+func (r *jsonReporter) End() {
+	r.write(ReportEvent{Phase: PhaseEnd})
+}
+
+// Error reports the given error as a failure, with the message in its own field, and ends the current operation. The
+// error is returned wrapped with the message, as with the other reporters.
+func (r *jsonReporter) Error(err error, message string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	r.write(ReportEvent{Phase: PhaseFailure, Message: fmt.Sprintf(message, args...), Error: err.Error()})
+	r.End()
+
+	if message != "" {
+		err = errors.Wrapf(err, message, args...)
+	}
+
+	return err
+}
@@ -0,0 +1,121 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+)
+
+var _ = Describe("JSON reporter", func() {
+	var out *bytes.Buffer
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+	})
+
+	events := func() []api.ReportEvent {
+		events := []api.ReportEvent{}
+
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			event := api.ReportEvent{}
+			Expect(json.Unmarshal([]byte(line), &event)).To(Succeed(), "line %q isn't a JSON object", line)
+			Expect(event.Timestamp.IsZero()).To(BeFalse())
+
+			events = append(events, event)
+		}
+
+		return events
+	}
+
+	It("should write each event as a JSON line", func() {
+		status := api.NewJSONReporter(out)
+
+		status.Start("Opening ports on %s", "Azure")
+		status.Warning("Subnet %q skipped", "workers")
+		status.Success("Opened %d ports", 2)
+		err := status.Error(errors.New("access denied"), "Failed to open ports")
+		Expect(err).To(MatchError("Failed to open ports: access denied"))
+
+		Expect(events()).To(HaveLen(5))
+
+		stripped := []api.ReportEvent{}
+		for _, event := range events() {
+			stripped = append(stripped, api.ReportEvent{Phase: event.Phase, Message: event.Message, Error: event.Error})
+		}
+
+		Expect(stripped).To(Equal([]api.ReportEvent{
+			{Phase: api.PhaseStart, Message: "Opening ports on Azure"},
+			{Phase: api.PhaseWarning, Message: `Subnet "workers" skipped`},
+			{Phase: api.PhaseSuccess, Message: "Opened 2 ports"},
+			{Phase: api.PhaseFailure, Message: "Failed to open ports", Error: "access denied"},
+			{Phase: api.PhaseEnd},
+		}))
+	})
+
+	It("should ignore nil errors", func() {
+		Expect(api.NewJSONReporter(out).Error(nil, "Failed")).To(Succeed())
+		Expect(out.Len()).To(BeZero())
+	})
+
+	It("should be safe for concurrent use", func() {
+		status := api.NewJSONReporter(out)
+
+		var wg sync.WaitGroup
+
+		for i := range 20 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				status.Success("Prepared cluster %d", i)
+			}()
+		}
+
+		wg.Wait()
+
+		Expect(events()).To(HaveLen(20))
+	})
+
+	It("should include the step of each event once the total steps are set", func() {
+		status := api.NewJSONReporter(out)
+
+		api.SetTotalSteps(status, 2)
+		status.Start("Retrieving the VPC")
+		status.Success("Retrieved the VPC")
+		status.Start("Opening the ports")
+
+		api.SetTotalSteps(status, 1)
+		status.Start("Opening the port")
+
+		steps := [][]int{}
+		for _, event := range events() {
+			steps = append(steps, []int{event.Step, event.TotalSteps})
+		}
+
+		Expect(steps).To(Equal([][]int{{1, 2}, {1, 2}, {2, 2}, {1, 1}}))
+	})
+})
@@ -0,0 +1,133 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/submariner-io/admiral/pkg/reporter"
+)
+
+// Metrics receives observations of cloud operations, for instance to export them to Prometheus.
+type Metrics interface {
+	// ObserveOperation records that the given operation of the given backend, e.g. "azure", took the given time, and failed
+	// with the given error if it's not nil. It must be safe to call concurrently.
+	ObserveOperation(backend, operation string, duration time.Duration, err error)
+}
+
+type observedCloud struct {
+	cloud   Cloud
+	backend string
+	metrics Metrics
+}
+
+// ObserveCloud returns a Cloud which reports the duration and outcome of the OpenPorts, ClosePorts and Validate
+// operations of the given Cloud, under the operation's name, to metrics. The returned Cloud implements io.Closer, closing
+// the given Cloud if it implements io.Closer, and the given Cloud can be retrieved with UnwrapCloud, for instance to create a
+// gateway deployer. If metrics is nil, the given Cloud is returned as-is.
+func ObserveCloud(cloud Cloud, backend string, metrics Metrics) Cloud {
+	if metrics == nil {
+		return cloud
+	}
+
+	return observedCloud{cloud: cloud, backend: backend, metrics: metrics}
+}
+
+// Unwrap returns the observed Cloud.
+func (c observedCloud) Unwrap() Cloud {
+	return c.cloud
+}
+
+// UnwrapCloud returns the Cloud wrapped by the given Cloud, for instance by ObserveCloud, or the given Cloud if it doesn't
+// wrap one, so that backends can recognize their own Cloud.
+func UnwrapCloud(cloud Cloud) Cloud {
+	for {
+		wrapper, ok := cloud.(interface{ Unwrap() Cloud })
+		if !ok {
+			return cloud
+		}
+
+		cloud = wrapper.Unwrap()
+	}
+}
+
+func (c observedCloud) OpenPorts(ctx context.Context, ports []PortSpec, status reporter.Interface) error {
+	return observe(c.metrics, c.backend, "OpenPorts", func() error {
+		return c.cloud.OpenPorts(ctx, ports, status)
+	})
+}
+
+func (c observedCloud) ClosePorts(ctx context.Context, status reporter.Interface) error {
+	return observe(c.metrics, c.backend, "ClosePorts", func() error {
+		return c.cloud.ClosePorts(ctx, status)
+	})
+}
+
+func (c observedCloud) Validate(ctx context.Context, status reporter.Interface) error {
+	return observe(c.metrics, c.backend, "Validate", func() error {
+		return c.cloud.Validate(ctx, status)
+	})
+}
+
+func (c observedCloud) Close() error {
+	if closer, ok := c.cloud.(io.Closer); ok {
+		return closer.Close() //nolint:wrapcheck // Let the caller wrap it.
+	}
+
+	return nil
+}
+
+type observedGatewayDeployer struct {
+	deployer GatewayDeployer
+	backend  string
+	metrics  Metrics
+}
+
+// ObserveGatewayDeployer returns a GatewayDeployer which reports the duration and outcome of the Deploy and Cleanup
+// operations of the given GatewayDeployer, under the operation's name, to metrics. If metrics is nil, the given
+// GatewayDeployer is returned as-is.
+func ObserveGatewayDeployer(deployer GatewayDeployer, backend string, metrics Metrics) GatewayDeployer {
+	if metrics == nil {
+		return deployer
+	}
+
+	return observedGatewayDeployer{deployer: deployer, backend: backend, metrics: metrics}
+}
+
+func (d observedGatewayDeployer) Deploy(ctx context.Context, input GatewayDeployInput, status reporter.Interface) error {
+	return observe(d.metrics, d.backend, "Deploy", func() error {
+		return d.deployer.Deploy(ctx, input, status)
+	})
+}
+
+func (d observedGatewayDeployer) Cleanup(ctx context.Context, status reporter.Interface) error {
+	return observe(d.metrics, d.backend, "Cleanup", func() error {
+		return d.deployer.Cleanup(ctx, status)
+	})
+}
+
+func observe(metrics Metrics, backend, operation string, run func() error) error {
+	start := time.Now()
+	err := run()
+	metrics.ObserveOperation(backend, operation, time.Since(start), err)
+
+	return err
+}
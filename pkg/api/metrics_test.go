@@ -0,0 +1,133 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+)
+
+type observation struct {
+	backend   string
+	operation string
+	err       error
+}
+
+type recordingMetrics struct {
+	mutex        sync.Mutex
+	observations []observation
+}
+
+func (m *recordingMetrics) ObserveOperation(backend, operation string, duration time.Duration, err error) {
+	Expect(duration).To(BeNumerically(">=", 0))
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.observations = append(m.observations, observation{backend: backend, operation: operation, err: err})
+}
+
+type failingDeployer struct {
+	err error
+}
+
+func (d failingDeployer) Deploy(_ context.Context, _ api.GatewayDeployInput, _ reporter.Interface) error {
+	return d.err
+}
+
+func (d failingDeployer) Cleanup(_ context.Context, _ reporter.Interface) error {
+	return nil
+}
+
+var _ = Describe("Metrics", func() {
+	var metrics *recordingMetrics
+
+	BeforeEach(func() {
+		metrics = &recordingMetrics{}
+	})
+
+	Describe("ObserveCloud", func() {
+		It("should report each operation and call the Cloud", func() {
+			cloud := &recordingCloud{}
+			observed := api.ObserveCloud(cloud, "test", metrics)
+
+			ports := []api.PortSpec{{Port: 4800, Protocol: "udp"}}
+			Expect(observed.OpenPorts(context.TODO(), ports, reporter.Stdout())).To(Succeed())
+			Expect(observed.ClosePorts(context.TODO(), reporter.Stdout())).To(Succeed())
+			Expect(observed.Validate(context.TODO(), reporter.Stdout())).To(Succeed())
+
+			Expect(cloud.ports).To(Equal(ports))
+			Expect(cloud.contexts).To(HaveLen(3))
+			Expect(metrics.observations).To(Equal([]observation{
+				{backend: "test", operation: "OpenPorts"},
+				{backend: "test", operation: "ClosePorts"},
+				{backend: "test", operation: "Validate"},
+			}))
+
+			closer, ok := observed.(io.Closer)
+			Expect(ok).To(BeTrue())
+			Expect(closer.Close()).To(Succeed())
+		})
+
+		It("should return the Cloud as-is without metrics", func() {
+			cloud := &recordingCloud{}
+			Expect(api.ObserveCloud(cloud, "test", nil)).To(BeIdenticalTo(cloud))
+		})
+	})
+
+	Describe("UnwrapCloud", func() {
+		It("should return the observed Cloud", func() {
+			cloud := &recordingCloud{}
+			Expect(api.UnwrapCloud(api.ObserveCloud(api.ObserveCloud(cloud, "test", metrics), "test", metrics))).To(BeIdenticalTo(cloud))
+		})
+
+		It("should return a Cloud which isn't wrapped as-is", func() {
+			cloud := &recordingCloud{}
+			Expect(api.UnwrapCloud(cloud)).To(BeIdenticalTo(cloud))
+		})
+	})
+
+	Describe("ObserveGatewayDeployer", func() {
+		It("should report each operation along with its error", func() {
+			deployErr := errors.New("fake failure")
+			observed := api.ObserveGatewayDeployer(failingDeployer{err: deployErr}, "test", metrics)
+
+			Expect(observed.Deploy(context.TODO(), api.GatewayDeployInput{}, reporter.Stdout())).To(MatchError(deployErr))
+			Expect(observed.Cleanup(context.TODO(), reporter.Stdout())).To(Succeed())
+
+			Expect(metrics.observations).To(Equal([]observation{
+				{backend: "test", operation: "Deploy", err: deployErr},
+				{backend: "test", operation: "Cleanup"},
+			}))
+		})
+
+		It("should return the GatewayDeployer as-is without metrics", func() {
+			deployer := failingDeployer{}
+			Expect(api.ObserveGatewayDeployer(deployer, "test", nil)).To(Equal(deployer))
+		})
+	})
+})
@@ -0,0 +1,103 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"k8s.io/utils/clock"
+)
+
+// Progress tracks an operation which processes a known number of items, such as ports, rules or subnets, and reports
+// how many are done along with an estimate of the time remaining, based on the time taken so far.
+type Progress struct {
+	status  reporter.Interface
+	clock   clock.PassiveClock
+	started time.Time
+	total   int
+	done    int
+}
+
+// NewProgress starts tracking the processing of total items, reporting to status. If clk is nil, the real clock is used.
+func NewProgress(status reporter.Interface, total int, clk clock.PassiveClock) *Progress {
+	if clk == nil {
+		clk = clock.RealClock{}
+	}
+
+	return &Progress{
+		status:  status,
+		clock:   clk,
+		started: clk.Now(),
+		total:   total,
+	}
+}
+
+// Done records that an item was processed, whether successfully or not.
+func (p *Progress) Done() {
+	if p.done < p.total {
+		p.done++
+	}
+}
+
+// Success records that an item was processed successfully, and reports the given message along with the progress.
+func (p *Progress) Success(message string, args ...interface{}) {
+	p.Done()
+	p.status.Success("%s (%s)", fmt.Sprintf(message, args...), p)
+}
+
+// Remaining estimates the time needed to process the remaining items, assuming they take as long as the items done
+// so far. It returns false if no items are done yet, since nothing can be estimated.
+func (p *Progress) Remaining() (time.Duration, bool) {
+	if p.done == 0 {
+		return 0, false
+	}
+
+	elapsed := p.clock.Since(p.started)
+
+	return elapsed / time.Duration(p.done) * time.Duration(p.total-p.done), true
+}
+
+func (p *Progress) String() string {
+	progress := fmt.Sprintf("%d of %d done", p.done, p.total)
+
+	if remaining, ok := p.Remaining(); ok && p.done < p.total {
+		progress += fmt.Sprintf(", about %v remaining", remaining.Round(time.Second))
+	}
+
+	return progress
+}
+
+// ProgressReporter is a reporter which can render the overall progress of an operation, e.g. as a progress bar, by
+// counting each call to Start as a step.
+type ProgressReporter interface {
+	reporter.Interface
+
+	// SetTotalSteps sets the number of steps of the sequence of steps starting, and resets the count of steps started.
+	SetTotalSteps(n int)
+}
+
+// SetTotalSteps sets the number of steps of the sequence of steps starting if status is a ProgressReporter, and does
+// nothing otherwise, so that it can be called with any reporter.
+func SetTotalSteps(status reporter.Interface, n int) {
+	if progressReporter, ok := status.(ProgressReporter); ok {
+		progressReporter.SetTotalSteps(n)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api_test
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+type recordingReporter struct {
+	reporter.Basic
+	successes []string
+}
+
+func (r *recordingReporter) Success(message string, args ...interface{}) {
+	r.successes = append(r.successes, fmt.Sprintf(message, args...))
+}
+
+var _ = Describe("Progress", func() {
+	var (
+		fakeClock *testingclock.FakeClock
+		recorder  *recordingReporter
+		progress  *api.Progress
+	)
+
+	BeforeEach(func() {
+		fakeClock = testingclock.NewFakeClock(time.Now())
+		recorder = &recordingReporter{Basic: reporter.Silent()}
+		progress = api.NewProgress(&reporter.Adapter{Basic: recorder}, 4, fakeClock)
+	})
+
+	It("should not estimate the time remaining before any progress", func() {
+		_, ok := progress.Remaining()
+		Expect(ok).To(BeFalse())
+		Expect(progress.String()).To(Equal("0 of 4 done"))
+	})
+
+	It("should estimate the time remaining from the progress so far", func() {
+		fakeClock.Step(30 * time.Second)
+		progress.Done()
+		fakeClock.Step(30 * time.Second)
+		progress.Success("Deleted %q", "gw-2")
+
+		remaining, ok := progress.Remaining()
+		Expect(ok).To(BeTrue())
+		Expect(remaining).To(Equal(time.Minute))
+		Expect(recorder.successes).To(Equal([]string{`Deleted "gw-2" (2 of 4 done, about 1m0s remaining)`}))
+	})
+
+	It("should not report any time remaining once all the items are done", func() {
+		for range 4 {
+			fakeClock.Step(time.Second)
+			progress.Success("Deleted")
+		}
+
+		Expect(recorder.successes[3]).To(Equal("Deleted (4 of 4 done)"))
+	})
+})
+
+var _ = Describe("SetTotalSteps", func() {
+	It("should do nothing with a reporter which doesn't track the steps", func() {
+		status := reporter.NewTracker(reporter.Stdout())
+		api.SetTotalSteps(status, 3)
+		status.Start("Step 1")
+		Expect(status.HasWarnings()).To(BeFalse())
+	})
+})
@@ -0,0 +1,128 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+const (
+	ProtocolTCP  = "tcp"
+	ProtocolUDP  = "udp"
+	ProtocolICMP = "icmp"
+	ProtocolESP  = "esp"
+	ProtocolAH   = "ah"
+)
+
+// supportedProtocols are the protocols, in their normalized lower-case form, which can be opened on every cloud.
+var supportedProtocols = []string{ProtocolTCP, ProtocolUDP, ProtocolICMP, ProtocolESP, ProtocolAH}
+
+// ipProtocolNumbers maps the protocols which cloud providers identify by their IANA IP protocol number.
+var ipProtocolNumbers = map[string]string{
+	ProtocolESP: "50",
+	ProtocolAH:  "51",
+}
+
+// IPProtocol returns the IP protocol number for protocols which cloud providers identify by number, i.e. ESP and AH,
+// otherwise the protocol is returned unchanged.
+func IPProtocol(protocol string) string {
+	if number, ok := ipProtocolNumbers[strings.ToLower(protocol)]; ok {
+		return number
+	}
+
+	return protocol
+}
+
+// UsesPorts returns whether the given protocol is qualified by a port.
+func UsesPorts(protocol string) bool {
+	_, ok := ipProtocolNumbers[strings.ToLower(protocol)]
+	return !ok
+}
+
+// SortPorts returns a copy of the given ports sorted by protocol, case-insensitively, and then by port and end of range
+// so that rules are generated and reported in a deterministic order.
+func SortPorts(ports []PortSpec) []PortSpec {
+	sorted := slices.Clone(ports)
+
+	slices.SortStableFunc(sorted, func(a, b PortSpec) int {
+		return cmp.Or(cmp.Compare(strings.ToLower(a.Protocol), strings.ToLower(b.Protocol)), cmp.Compare(a.Port, b.Port),
+			cmp.Compare(a.LastPort(), b.LastPort()))
+	})
+
+	return sorted
+}
+
+// Validate checks that the protocol is one of tcp, udp, icmp, esp or ah, case-insensitively, that a port is given
+// for tcp and udp, and that a range, if any, is only given for protocols which use ports and doesn't end before it starts.
+func (p PortSpec) Validate() error {
+	protocol := strings.ToLower(p.Protocol)
+
+	if !slices.Contains(supportedProtocols, protocol) {
+		return errors.Errorf("unsupported protocol %q for port %d, expected one of %s", p.Protocol, p.Port,
+			strings.Join(supportedProtocols, ", "))
+	}
+
+	if p.Port == 0 && (protocol == ProtocolTCP || protocol == ProtocolUDP) {
+		return errors.Errorf("a port is required for protocol %q", p.Protocol)
+	}
+
+	if p.EndPort == 0 {
+		return nil
+	}
+
+	if !UsesPorts(protocol) || protocol == ProtocolICMP {
+		return errors.Errorf("a port range can't be given for protocol %q", p.Protocol)
+	}
+
+	if p.EndPort < p.Port {
+		return errors.Errorf("the port range %d-%d/%s ends before it starts", p.Port, p.EndPort, p.Protocol)
+	}
+
+	return nil
+}
+
+// NormalizePorts validates the given ports and returns a sorted copy with the protocols in lower case, and single-port
+// ranges reduced to their port; the backends map that form to the one their cloud expects. All the invalid ports are
+// reported in the returned error.
+func NormalizePorts(ports []PortSpec) ([]PortSpec, error) {
+	normalized := make([]PortSpec, len(ports))
+	errs := []error{}
+
+	for i := range ports {
+		if err := ports[i].Validate(); err != nil {
+			errs = append(errs, err)
+		}
+
+		normalized[i] = PortSpec{Port: ports[i].Port, Protocol: strings.ToLower(ports[i].Protocol)}
+		if ports[i].IsRange() {
+			normalized[i].EndPort = ports[i].EndPort
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+
+	return SortPorts(normalized), nil
+}
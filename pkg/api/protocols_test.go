@@ -0,0 +1,128 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+)
+
+var _ = Describe("PortSpec Validate", func() {
+	It("should accept the supported protocols in any case", func() {
+		for _, port := range []api.PortSpec{
+			{Port: 4500, Protocol: "udp"},
+			{Port: 8080, Protocol: "TCP"},
+			{Port: 4800, Protocol: "Udp"},
+			{Protocol: "ICMP"},
+			{Protocol: "esp"},
+			{Protocol: "Ah"},
+		} {
+			Expect(port.Validate()).To(Succeed(), "%#v", port)
+		}
+	})
+
+	It("should reject an unsupported protocol", func() {
+		Expect(api.PortSpec{Port: 80, Protocol: "sctp"}.Validate()).To(MatchError(ContainSubstring(`unsupported protocol "sctp"`)))
+		Expect(api.PortSpec{Port: 80}.Validate()).To(MatchError(ContainSubstring("unsupported protocol")))
+	})
+
+	It("should accept a port range for TCP and UDP", func() {
+		Expect(api.PortSpec{Port: 4500, EndPort: 4510, Protocol: "udp"}.Validate()).To(Succeed())
+		Expect(api.PortSpec{Port: 8080, EndPort: 8080, Protocol: "TCP"}.Validate()).To(Succeed())
+	})
+
+	It("should reject a port range which ends before it starts", func() {
+		Expect(api.PortSpec{Port: 4510, EndPort: 4500, Protocol: "udp"}.Validate()).To(MatchError(ContainSubstring("ends before it starts")))
+	})
+
+	It("should reject a port range for protocols without ports", func() {
+		Expect(api.PortSpec{EndPort: 100, Protocol: "esp"}.Validate()).To(MatchError(ContainSubstring("can't be given")))
+		Expect(api.PortSpec{EndPort: 100, Protocol: "icmp"}.Validate()).To(HaveOccurred())
+	})
+
+	It("should reject a missing port for TCP and UDP", func() {
+		Expect(api.PortSpec{Protocol: "Tcp"}.Validate()).To(MatchError(ContainSubstring(`a port is required for protocol "Tcp"`)))
+		Expect(api.PortSpec{Protocol: "udp"}.Validate()).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("NormalizePorts", func() {
+	It("should lower-case and sort the protocols", func() {
+		ports, err := api.NormalizePorts([]api.PortSpec{
+			{Port: 4800, Protocol: "Udp"},
+			{Protocol: "ESP"},
+			{Port: 8080, Protocol: "TCP"},
+			{Port: 4500, Protocol: "udp"},
+		})
+		Expect(err).To(Succeed())
+		Expect(ports).To(Equal([]api.PortSpec{
+			{Protocol: "esp"},
+			{Port: 8080, Protocol: "tcp"},
+			{Port: 4500, Protocol: "udp"},
+			{Port: 4800, Protocol: "udp"},
+		}))
+	})
+
+	It("should reduce a single-port range to its port and sort ranges after the ports they start at", func() {
+		ports, err := api.NormalizePorts([]api.PortSpec{
+			{Port: 4500, EndPort: 4510, Protocol: "udp"},
+			{Port: 4500, EndPort: 4500, Protocol: "udp"},
+		})
+		Expect(err).To(Succeed())
+		Expect(ports).To(Equal([]api.PortSpec{
+			{Port: 4500, Protocol: "udp"},
+			{Port: 4500, EndPort: 4510, Protocol: "udp"},
+		}))
+	})
+
+	It("should not modify the given ports", func() {
+		given := []api.PortSpec{{Port: 8080, Protocol: "TCP"}}
+
+		_, err := api.NormalizePorts(given)
+		Expect(err).To(Succeed())
+		Expect(given).To(Equal([]api.PortSpec{{Port: 8080, Protocol: "TCP"}}))
+	})
+
+	It("should report all the invalid ports", func() {
+		_, err := api.NormalizePorts([]api.PortSpec{
+			{Port: 8080, Protocol: "TCP"},
+			{Port: 80, Protocol: "sctp"},
+			{Protocol: "Udp"},
+		})
+		Expect(err).To(MatchError(ContainSubstring(`unsupported protocol "sctp"`)))
+		Expect(err).To(MatchError(ContainSubstring(`a port is required for protocol "Udp"`)))
+	})
+})
+
+var _ = Describe("PortSpec", func() {
+	It("should render a single port", func() {
+		port := api.PortSpec{Port: 4500, Protocol: "udp"}
+		Expect(port.String()).To(Equal("4500/udp"))
+		Expect(port.IsRange()).To(BeFalse())
+		Expect(port.LastPort()).To(Equal(uint16(4500)))
+	})
+
+	It("should render a port range", func() {
+		port := api.PortSpec{Port: 100, EndPort: 200, Protocol: "udp"}
+		Expect(port.String()).To(Equal("100-200/udp"))
+		Expect(port.IsRange()).To(BeTrue())
+		Expect(port.LastPort()).To(Equal(uint16(200)))
+	})
+})
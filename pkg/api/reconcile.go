@@ -0,0 +1,104 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"k8s.io/utils/clock"
+)
+
+const (
+	DefaultReconcileInterval       = 10 * time.Minute
+	DefaultReconcileInitialBackoff = 10 * time.Second
+)
+
+// ReconcileOptions configures Reconcile; the zero value uses the defaults.
+type ReconcileOptions struct {
+	// Interval is the time between successful cycles, DefaultReconcileInterval if not set.
+	Interval time.Duration
+
+	// InitialBackoff is the time before retrying a failed cycle, DefaultReconcileInitialBackoff if not set. It doubles
+	// with each consecutive failure, up to MaxBackoff.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum time before retrying a failed cycle, Interval if not set.
+	MaxBackoff time.Duration
+
+	// Clock is the clock used to wait between cycles, the real clock if not set.
+	Clock clock.Clock
+}
+
+// Reconcile calls prepare repeatedly until the context is cancelled, so that any drift from the prepared state is
+// corrected. prepare must therefore be idempotent, as the Cloud and GatewayDeployer operations are. The first cycle runs
+// immediately; each cycle's outcome is reported to status.
+func Reconcile(ctx context.Context, prepare func(status reporter.Interface) error, options ReconcileOptions,
+	status reporter.Interface,
+) {
+	options = options.withDefaults()
+	backoff := options.InitialBackoff
+
+	for cycle := 1; ctx.Err() == nil; cycle++ {
+		delay := options.Interval
+
+		status.Start("Reconciling, cycle %d", cycle)
+
+		if err := prepare(status); err != nil {
+			status.Failure("Reconcile cycle %d failed, retrying in %v: %v", cycle, backoff, err)
+
+			delay = backoff
+			backoff = min(backoff*2, options.MaxBackoff)
+		} else {
+			status.Success("Reconcile cycle %d succeeded, next cycle in %v", cycle, delay)
+
+			backoff = options.InitialBackoff
+		}
+
+		status.End()
+
+		timer := options.Clock.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C():
+		}
+	}
+}
+
+func (o ReconcileOptions) withDefaults() ReconcileOptions {
+	if o.Interval <= 0 {
+		o.Interval = DefaultReconcileInterval
+	}
+
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = DefaultReconcileInitialBackoff
+	}
+
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = o.Interval
+	}
+
+	if o.Clock == nil {
+		o.Clock = clock.RealClock{}
+	}
+
+	return o
+}
@@ -0,0 +1,138 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package api_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+var _ = Describe("Reconcile", func() {
+	const interval = time.Minute
+
+	var (
+		fakeClock *testingclock.FakeClock
+		cycles    atomic.Int32
+		failing   atomic.Bool
+		tracker   *reporter.Tracker
+		cancel    context.CancelFunc
+		done      chan struct{}
+	)
+
+	BeforeEach(func() {
+		fakeClock = testingclock.NewFakeClock(time.Now())
+		cycles.Store(0)
+		failing.Store(false)
+		tracker = reporter.NewTracker(reporter.Silent())
+	})
+
+	JustBeforeEach(func() {
+		var ctx context.Context
+
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan struct{})
+
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+
+			api.Reconcile(ctx, func(_ reporter.Interface) error {
+				cycles.Add(1)
+
+				if failing.Load() {
+					return errors.New("mock error")
+				}
+
+				return nil
+			}, api.ReconcileOptions{Interval: interval, InitialBackoff: 10 * time.Second, MaxBackoff: 30 * time.Second, Clock: fakeClock},
+				tracker)
+		}()
+	})
+
+	stop := func() {
+		cancel()
+		Eventually(done).Should(BeClosed())
+	}
+
+	AfterEach(stop)
+
+	// expectNextCycleAfter advances the fake clock and checks that the next cycle runs after exactly the given delay.
+	expectNextCycleAfter := func(delay time.Duration) {
+		expected := cycles.Load() + 1
+
+		Eventually(fakeClock.HasWaiters).Should(BeTrue())
+		fakeClock.Step(delay - time.Nanosecond)
+		Consistently(cycles.Load, 50*time.Millisecond).Should(Equal(expected - 1))
+
+		fakeClock.Step(time.Nanosecond)
+		Eventually(cycles.Load).Should(Equal(expected))
+	}
+
+	It("should run a cycle immediately and then at each interval", func() {
+		Eventually(cycles.Load).Should(Equal(int32(1)))
+
+		expectNextCycleAfter(interval)
+		expectNextCycleAfter(interval)
+
+		stop()
+		Expect(tracker.HasFailures()).To(BeFalse())
+	})
+
+	When("cycles fail", func() {
+		BeforeEach(func() {
+			failing.Store(true)
+		})
+
+		It("should back off up to the maximum and reset the backoff after a success", func() {
+			Eventually(cycles.Load).Should(Equal(int32(1)))
+
+			expectNextCycleAfter(10 * time.Second)
+			expectNextCycleAfter(20 * time.Second)
+			expectNextCycleAfter(30 * time.Second)
+
+			failing.Store(false)
+			expectNextCycleAfter(30 * time.Second)
+			expectNextCycleAfter(interval)
+
+			failing.Store(true)
+			expectNextCycleAfter(interval)
+			expectNextCycleAfter(10 * time.Second)
+
+			stop()
+			Expect(tracker.HasFailures()).To(BeTrue())
+		})
+	})
+
+	It("should stop when the context is cancelled", func() {
+		Eventually(cycles.Load).Should(Equal(int32(1)))
+		Eventually(fakeClock.HasWaiters).Should(BeTrue())
+
+		stop()
+
+		fakeClock.Step(interval)
+		Consistently(cycles.Load, 50*time.Millisecond).Should(Equal(int32(1)))
+	})
+})
@@ -0,0 +1,177 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ClusterResult is the outcome of preparing one cluster of a fleet.
+type ClusterResult struct {
+	// Cluster identifies the cluster, e.g. by its name or infra ID.
+	Cluster string
+
+	// Provider is the cloud provider of the cluster, e.g. "aws", "azure", "gcp" or "rhos".
+	Provider string
+
+	// Ports are the ports opened on the cluster.
+	Ports []PortSpec
+
+	// GatewayIPs are the public IPs of the gateways of the cluster, if known.
+	GatewayIPs []string
+
+	// Err is the error which failed the preparation of the cluster, if any.
+	Err error
+}
+
+// FleetReport consolidates the outcomes of preparing a fleet of clusters, possibly on different providers, so that they
+// can be reviewed together. Results may be added concurrently by the preparations of the individual clusters.
+type FleetReport struct {
+	mutex   sync.Mutex
+	results []ClusterResult
+}
+
+type clusterResultJSON struct {
+	Cluster    string   `json:"cluster"`
+	Provider   string   `json:"provider"`
+	Succeeded  bool     `json:"succeeded"`
+	Ports      []string `json:"ports,omitempty"`
+	GatewayIPs []string `json:"gatewayIPs,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+type fleetReportJSON struct {
+	Total     int                 `json:"total"`
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+	Clusters  []clusterResultJSON `json:"clusters"`
+}
+
+// Add records the outcome of preparing a cluster.
+func (r *FleetReport) Add(result ClusterResult) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.results = append(r.results, result)
+}
+
+// Results returns the recorded outcomes, sorted by provider and cluster.
+func (r *FleetReport) Results() []ClusterResult {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	results := make([]ClusterResult, len(r.results))
+	copy(results, r.results)
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Provider != results[j].Provider {
+			return results[i].Provider < results[j].Provider
+		}
+
+		return results[i].Cluster < results[j].Cluster
+	})
+
+	return results
+}
+
+// Failed returns the outcomes of the clusters whose preparation failed.
+func (r *FleetReport) Failed() []ClusterResult {
+	failed := []ClusterResult{}
+
+	for _, result := range r.Results() {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+
+	return failed
+}
+
+// String returns a human-readable summary of the outcomes, with one line per cluster.
+func (r *FleetReport) String() string {
+	results := r.Results()
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%d of %d clusters prepared successfully", len(results)-len(r.Failed()), len(results))
+
+	for _, result := range results {
+		fmt.Fprintf(&sb, "\n%s (%s): ", result.Cluster, result.Provider)
+
+		if result.Err != nil {
+			fmt.Fprintf(&sb, "failed: %v", result.Err)
+			continue
+		}
+
+		sb.WriteString("succeeded")
+
+		if len(result.Ports) > 0 {
+			fmt.Fprintf(&sb, ", ports %s", strings.Join(formatPortSpecs(result.Ports), ", "))
+		}
+
+		if len(result.GatewayIPs) > 0 {
+			fmt.Fprintf(&sb, ", gateway IPs %s", strings.Join(result.GatewayIPs, ", "))
+		}
+	}
+
+	return sb.String()
+}
+
+// MarshalJSON renders the outcomes, along with the number of clusters which succeeded and failed, as JSON.
+func (r *FleetReport) MarshalJSON() ([]byte, error) {
+	results := r.Results()
+	report := fleetReportJSON{
+		Total:    len(results),
+		Clusters: []clusterResultJSON{},
+	}
+
+	for _, result := range results {
+		clusterJSON := clusterResultJSON{
+			Cluster:    result.Cluster,
+			Provider:   result.Provider,
+			Succeeded:  result.Err == nil,
+			Ports:      formatPortSpecs(result.Ports),
+			GatewayIPs: result.GatewayIPs,
+		}
+
+		if result.Err != nil {
+			clusterJSON.Error = result.Err.Error()
+			report.Failed++
+		} else {
+			report.Succeeded++
+		}
+
+		report.Clusters = append(report.Clusters, clusterJSON)
+	}
+
+	return json.Marshal(report) //nolint:wrapcheck // Let the caller wrap it.
+}
+
+func formatPortSpecs(ports []PortSpec) []string {
+	portStrs := []string{}
+	for _, port := range ports {
+		portStrs = append(portStrs, port.String())
+	}
+
+	return portStrs
+}
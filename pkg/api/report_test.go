@@ -0,0 +1,86 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api_test
+
+import (
+	"encoding/json"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+)
+
+var _ = Describe("FleetReport", func() {
+	var report *api.FleetReport
+
+	BeforeEach(func() {
+		report = &api.FleetReport{}
+
+		report.Add(api.ClusterResult{
+			Cluster:    "east",
+			Provider:   "azure",
+			Ports:      []api.PortSpec{{Port: 4500, Protocol: "udp"}},
+			GatewayIPs: []string{"1.2.3.4"},
+		})
+		report.Add(api.ClusterResult{
+			Cluster:  "west",
+			Provider: "aws",
+			Err:      errors.New("access denied"),
+		})
+		report.Add(api.ClusterResult{
+			Cluster:  "central",
+			Provider: "aws",
+			Ports:    []api.PortSpec{{Port: 4800, Protocol: "udp"}, {Port: 8080, EndPort: 8081, Protocol: "tcp"}},
+		})
+	})
+
+	It("should aggregate the outcomes sorted by provider and cluster", func() {
+		clusters := []string{}
+		for _, result := range report.Results() {
+			clusters = append(clusters, result.Cluster)
+		}
+
+		Expect(clusters).To(Equal([]string{"central", "west", "east"}))
+		Expect(report.Failed()).To(HaveLen(1))
+		Expect(report.Failed()[0].Cluster).To(Equal("west"))
+	})
+
+	It("should render a human-readable summary", func() {
+		Expect(report.String()).To(Equal("2 of 3 clusters prepared successfully\n" +
+			"central (aws): succeeded, ports 4800/udp, 8080-8081/tcp\n" +
+			"west (aws): failed: access denied\n" +
+			"east (azure): succeeded, ports 4500/udp, gateway IPs 1.2.3.4"))
+	})
+
+	It("should render the outcomes as JSON", func() {
+		data, err := json.Marshal(report)
+		Expect(err).To(Succeed())
+		Expect(data).To(MatchJSON(`{
+			"total": 3,
+			"succeeded": 2,
+			"failed": 1,
+			"clusters": [
+				{"cluster": "central", "provider": "aws", "succeeded": true, "ports": ["4800/udp", "8080-8081/tcp"]},
+				{"cluster": "west", "provider": "aws", "succeeded": false, "error": "access denied"},
+				{"cluster": "east", "provider": "azure", "succeeded": true, "ports": ["4500/udp"], "gatewayIPs": ["1.2.3.4"]}
+			]
+		}`))
+	})
+})
@@ -32,6 +32,7 @@ import (
 	"github.com/submariner-io/admiral/pkg/reporter"
 	"github.com/submariner-io/cloud-prepare/pkg/api"
 	awsClient "github.com/submariner-io/cloud-prepare/pkg/aws/client"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 const (
@@ -142,7 +143,7 @@ func DefaultProfile() string {
 	return "default"
 }
 
-func (ac *awsCloud) setSuffixes(vpcID string) error {
+func (ac *awsCloud) setSuffixes(ctx context.Context, vpcID string) error {
 	if ac.nodeSGSuffix != "" {
 		return nil
 	}
@@ -152,7 +153,7 @@ func (ac *awsCloud) setSuffixes(vpcID string) error {
 	if subnets, exists := ac.cloudConfig[PublicSubnetListKey]; exists {
 		if subnetIDs, ok := subnets.([]string); ok && len(subnetIDs) > 0 {
 			for _, id := range subnetIDs {
-				subnet, err := ac.getSubnetByID(id)
+				subnet, err := ac.getSubnetByID(ctx, id)
 				if err != nil {
 					return errors.Wrapf(err, "unable to find subnet with ID %s", id)
 				}
@@ -165,7 +166,7 @@ func (ac *awsCloud) setSuffixes(vpcID string) error {
 	} else {
 		var err error
 
-		publicSubnets, err = ac.findPublicSubnets(vpcID, ac.filterByName("{infraID}*-public-{region}*"))
+		publicSubnets, err = ac.findPublicSubnets(ctx, vpcID, ac.filterByName("{infraID}*-public-{region}*"))
 		if err != nil {
 			return errors.Wrapf(err, "unable to find the public subnet")
 		}
@@ -196,17 +197,30 @@ func (ac *awsCloud) setSuffixes(vpcID string) error {
 	return nil
 }
 
-func (ac *awsCloud) OpenPorts(ports []api.PortSpec, status reporter.Interface) error {
+func (ac *awsCloud) OpenPorts(ctx context.Context, ports []api.PortSpec, status reporter.Interface) error {
+	ports, err := api.NormalizePorts(ports)
+	if err != nil {
+		return errors.Wrap(err, "invalid ports")
+	}
+
+	// The VPC lookup, the validation, and opening the ports, together if there are several.
+	steps := 2 + len(ports)
+	if len(ports) > 1 {
+		steps = 3
+	}
+
+	api.SetTotalSteps(status, steps)
+
 	status.Start(messageRetrieveVPCID)
 	defer status.End()
 
-	vpcID, err := ac.getVpcID()
+	vpcID, err := ac.getVpcID(ctx)
 	if err != nil {
 		return status.Error(err, "unable to retrieve the VPC ID")
 	}
 
 	if _, found := ac.cloudConfig[VPCIDKey]; !found {
-		err = ac.setSuffixes(vpcID)
+		err = ac.setSuffixes(ctx, vpcID)
 		if err != nil {
 			return status.Error(err, "unable to retrieve the security group names")
 		}
@@ -216,42 +230,74 @@ func (ac *awsCloud) OpenPorts(ports []api.PortSpec, status reporter.Interface) e
 
 	status.Start(messageValidatePrerequisites)
 
-	err = ac.validatePreparePrerequisites(vpcID)
+	err = ac.validatePreparePrerequisites(ctx, vpcID)
 	if err != nil {
 		return status.Error(err, "unable to validate prerequisites")
 	}
 
 	status.Success(messageValidatedPrerequisites)
 
+	// Try to open all the ports with a single authorization per security group; if that fails, fall back to opening
+	// them one by one to find out which ones can't be opened.
+	if len(ports) > 1 {
+		status.Start("Opening ports for intra-cluster communications")
+
+		err = ac.allowPortsInCluster(ctx, vpcID, ports)
+		if err == nil {
+			status.Success("Opened ports for intra-cluster communications")
+
+			return nil
+		}
+
+		status.Warning("Unable to open the ports together, opening them individually: %v", err)
+
+		// Opening the ports one by one is a new sequence of steps.
+		api.SetTotalSteps(status, len(ports))
+	}
+
+	result := &api.PartialPortsError{}
+
 	for _, port := range ports {
 		status.Start("Opening port %v protocol %s for intra-cluster communications", port.Port, port.Protocol)
 
-		err = ac.allowPortInCluster(vpcID, port.Port, port.Protocol)
+		err = ac.allowPortsInCluster(ctx, vpcID, []api.PortSpec{port})
 		if err != nil {
-			return status.Error(err, "unable to open port")
+			status.Failure("Unable to open port %v protocol %s: %v", port.Port, port.Protocol, err)
+			result.Failed = append(result.Failed, api.PortError{Port: port, Err: err})
+
+			continue
 		}
 
+		result.Opened = append(result.Opened, port)
+
 		status.Success("Opened port %v protocol %s for intra-cluster communications", port.Port, port.Protocol)
 	}
 
+	if len(result.Failed) > 0 {
+		return result
+	}
+
 	return nil
 }
 
-func (ac *awsCloud) validatePreparePrerequisites(vpcID string) error {
-	return ac.validateCreateSecGroupRule(vpcID)
+func (ac *awsCloud) validatePreparePrerequisites(ctx context.Context, vpcID string) error {
+	return ac.validateCreateSecGroupRule(ctx, vpcID)
 }
 
-func (ac *awsCloud) ClosePorts(status reporter.Interface) error {
+func (ac *awsCloud) ClosePorts(ctx context.Context, status reporter.Interface) error {
+	// The VPC lookup, the validation and the revocation.
+	api.SetTotalSteps(status, 3)
+
 	status.Start(messageRetrieveVPCID)
 	defer status.End()
 
-	vpcID, err := ac.getVpcID()
+	vpcID, err := ac.getVpcID(ctx)
 	if err != nil {
 		return status.Error(err, "unable to retrieve the VPC ID")
 	}
 
 	if _, found := ac.cloudConfig[VPCIDKey]; !found {
-		err = ac.setSuffixes(vpcID)
+		err = ac.setSuffixes(ctx, vpcID)
 		if err != nil {
 			return status.Error(err, "unable to retrieve the security group names")
 		}
@@ -261,7 +307,7 @@ func (ac *awsCloud) ClosePorts(status reporter.Interface) error {
 
 	status.Start(messageValidatePrerequisites)
 
-	err = ac.validateCleanupPrerequisites(vpcID)
+	err = ac.validateCleanupPrerequisites(ctx, vpcID)
 	if err != nil {
 		return status.Error(err, "unable to validate prerequisites")
 	}
@@ -270,7 +316,7 @@ func (ac *awsCloud) ClosePorts(status reporter.Interface) error {
 
 	status.Start("Revoking intra-cluster communication permissions")
 
-	err = ac.revokePortsInCluster(vpcID)
+	err = ac.revokePortsInCluster(ctx, vpcID)
 	if err != nil {
 		return status.Error(err, "unable to revoke permissions")
 	}
@@ -280,6 +326,48 @@ func (ac *awsCloud) ClosePorts(status reporter.Interface) error {
 	return nil
 }
 
-func (ac *awsCloud) validateCleanupPrerequisites(vpcID string) error {
-	return ac.validateDeleteSecGroupRule(vpcID)
+func (ac *awsCloud) validateCleanupPrerequisites(ctx context.Context, vpcID string) error {
+	return ac.validateDeleteSecGroupRule(ctx, vpcID)
+}
+
+func (ac *awsCloud) Validate(ctx context.Context, status reporter.Interface) error {
+	// The VPC lookup and the permission checks.
+	api.SetTotalSteps(status, 2)
+
+	status.Start(messageRetrieveVPCID)
+	defer status.End()
+
+	vpcID, err := ac.getVpcID(ctx)
+	if err != nil {
+		return status.Error(err, "unable to retrieve the VPC ID")
+	}
+
+	if _, found := ac.cloudConfig[VPCIDKey]; !found {
+		err = ac.setSuffixes(ctx, vpcID)
+		if err != nil {
+			return status.Error(err, "unable to retrieve the security group names")
+		}
+	}
+
+	status.Success(messageRetrievedVPCID, vpcID)
+
+	status.Start(messageValidatePrerequisites)
+
+	errs := []error{}
+
+	if err := ac.validatePreparePrerequisites(ctx, vpcID); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := ac.validateCleanupPrerequisites(ctx, vpcID); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		return status.Error(err, "unable to validate prerequisites")
+	}
+
+	status.Success(messageValidatedPrerequisites)
+
+	return nil
 }
@@ -19,8 +19,10 @@ limitations under the License.
 package aws_test
 
 import (
+	"context"
 	"errors"
 
+	"github.com/aws/smithy-go"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/submariner-io/admiral/pkg/reporter"
@@ -31,19 +33,19 @@ import (
 var _ = Describe("Cloud", func() {
 	Describe("OpenPorts", testOpenPorts)
 	Describe("ClosePorts", testClosePorts)
+	Describe("Validate", testValidate)
 })
 
 func testOpenPorts() {
 	t := newCloudTestDriver()
 
-	var retError error
-
-	JustBeforeEach(func() {
-		t.expectDescribeVpcs(t.vpcID)
-		t.expectDescribeVpcsSigs(t.vpcID)
-		t.expectDescribePublicSubnets(t.subnets...)
+	var (
+		ports    []api.PortSpec
+		retError error
+	)
 
-		retError = t.cloud.OpenPorts([]api.PortSpec{
+	BeforeEach(func() {
+		ports = []api.PortSpec{
 			{
 				Port:     100,
 				Protocol: "TCP",
@@ -52,7 +54,15 @@ func testOpenPorts() {
 				Port:     200,
 				Protocol: "UDP",
 			},
-		}, reporter.Stdout())
+		}
+	})
+
+	JustBeforeEach(func() {
+		t.expectDescribeVpcs(t.vpcID)
+		t.expectDescribeVpcsSigs(t.vpcID)
+		t.expectDescribePublicSubnets(t.subnets...)
+
+		retError = t.cloud.OpenPorts(context.TODO(), ports, reporter.Stdout())
 	})
 
 	When("on success", func() {
@@ -62,20 +72,84 @@ func testOpenPorts() {
 			t.expectValidateAuthorizeSecurityGroupIngress(nil)
 			t.expectDescribeSecurityGroups(masterSGName, masterGroupID)
 
-			t.expectAuthorizeSecurityGroupIngress(workerGroupID, newClusterSGRule(workerGroupID, 100, "TCP"))
-			t.expectAuthorizeSecurityGroupIngress(workerGroupID, newClusterSGRule(masterGroupID, 100, "TCP"))
-			t.expectAuthorizeSecurityGroupIngress(masterGroupID, newClusterSGRule(workerGroupID, 100, "TCP"))
+			t.expectAuthorizeSecurityGroupIngress(workerGroupID, newClusterSGRule(workerGroupID, 100, "tcp"),
+				newClusterSGRule(workerGroupID, 200, "udp"))
+			t.expectAuthorizeSecurityGroupIngress(workerGroupID, newClusterSGRule(masterGroupID, 100, "tcp"),
+				newClusterSGRule(masterGroupID, 200, "udp"))
+			t.expectAuthorizeSecurityGroupIngress(masterGroupID, newClusterSGRule(workerGroupID, 100, "tcp"),
+				newClusterSGRule(workerGroupID, 200, "udp"))
+		})
+
+		It("should authorize the appropriate security groups ingress in a single call per group", func() {
+			Expect(retError).To(Succeed())
+		})
+	})
+
+	When("some of the ports are already authorized", func() {
+		BeforeEach(func() {
+			t.expectValidateAuthorizeSecurityGroupIngress(nil)
+			t.expectDescribeSecurityGroups(masterSGName, masterGroupID)
+
+			t.expectAuthorizeSecurityGroupIngressFailure(workerGroupID, &smithy.GenericAPIError{Code: "InvalidPermission.Duplicate"},
+				newClusterSGRule(workerGroupID, 100, "tcp"), newClusterSGRule(workerGroupID, 200, "udp"))
+			t.expectAuthorizeSecurityGroupIngressFailure(workerGroupID, &smithy.GenericAPIError{Code: "InvalidPermission.Duplicate"},
+				newClusterSGRule(workerGroupID, 100, "tcp"))
+			t.expectAuthorizeSecurityGroupIngress(workerGroupID, newClusterSGRule(workerGroupID, 200, "udp"))
 
-			t.expectAuthorizeSecurityGroupIngress(workerGroupID, newClusterSGRule(workerGroupID, 200, "UDP"))
-			t.expectAuthorizeSecurityGroupIngress(workerGroupID, newClusterSGRule(masterGroupID, 200, "UDP"))
-			t.expectAuthorizeSecurityGroupIngress(masterGroupID, newClusterSGRule(workerGroupID, 200, "UDP"))
+			t.expectAuthorizeSecurityGroupIngress(workerGroupID, newClusterSGRule(masterGroupID, 100, "tcp"),
+				newClusterSGRule(masterGroupID, 200, "udp"))
+			t.expectAuthorizeSecurityGroupIngress(masterGroupID, newClusterSGRule(workerGroupID, 100, "tcp"),
+				newClusterSGRule(workerGroupID, 200, "udp"))
 		})
 
-		It("should authorize the appropriate security groups ingress", func() {
+		It("should authorize the remaining ports individually", func() {
 			Expect(retError).To(Succeed())
 		})
 	})
 
+	When("an ESP port is requested", func() {
+		BeforeEach(func() {
+			ports = []api.PortSpec{{Protocol: "esp"}}
+
+			t.expectValidateAuthorizeSecurityGroupIngress(nil)
+			t.expectDescribeSecurityGroups(masterSGName, masterGroupID)
+
+			t.expectAuthorizeSecurityGroupIngress(workerGroupID, newClusterSGRule(workerGroupID, 0, "50"))
+			t.expectAuthorizeSecurityGroupIngress(workerGroupID, newClusterSGRule(masterGroupID, 0, "50"))
+			t.expectAuthorizeSecurityGroupIngress(masterGroupID, newClusterSGRule(workerGroupID, 0, "50"))
+		})
+
+		It("should authorize IP protocol 50", func() {
+			Expect(retError).To(Succeed())
+		})
+	})
+
+	When("authorizing one of the ports fails", func() {
+		BeforeEach(func() {
+			t.expectValidateAuthorizeSecurityGroupIngress(nil)
+			t.expectDescribeSecurityGroups(masterSGName, masterGroupID)
+
+			t.expectAuthorizeSecurityGroupIngressFailure(workerGroupID, errors.New("mock error"),
+				newClusterSGRule(workerGroupID, 100, "tcp"), newClusterSGRule(workerGroupID, 200, "udp"))
+
+			t.expectAuthorizeSecurityGroupIngress(workerGroupID, newClusterSGRule(workerGroupID, 100, "tcp"))
+			t.expectAuthorizeSecurityGroupIngress(workerGroupID, newClusterSGRule(masterGroupID, 100, "tcp"))
+			t.expectAuthorizeSecurityGroupIngress(masterGroupID, newClusterSGRule(workerGroupID, 100, "tcp"))
+
+			t.expectAuthorizeSecurityGroupIngressFailure(workerGroupID, errors.New("mock error"),
+				newClusterSGRule(workerGroupID, 200, "udp"))
+		})
+
+		It("should return the opened and failed ports", func() {
+			partialErr := &api.PartialPortsError{}
+			Expect(errors.As(retError, &partialErr)).To(BeTrue())
+			Expect(partialErr.Opened).To(Equal([]api.PortSpec{{Port: 100, Protocol: "tcp"}}))
+			Expect(partialErr.Failed).To(HaveLen(1))
+			Expect(partialErr.Failed[0].Port).To(Equal(api.PortSpec{Port: 200, Protocol: "udp"}))
+			Expect(partialErr.Failed[0].Err).To(HaveOccurred())
+		})
+	})
+
 	When("the infra ID VPC does not exist", func() {
 		BeforeEach(func() {
 			t.vpcID = ""
@@ -121,7 +195,7 @@ func testClosePorts() {
 		t.expectDescribePublicSubnets(t.subnets...)
 		t.expectDescribePublicSubnetsSigs(t.subnets...)
 
-		retError = t.cloud.ClosePorts(reporter.Stdout())
+		retError = t.cloud.ClosePorts(context.TODO(), reporter.Stdout())
 	})
 
 	Context("on success", func() {
@@ -171,6 +245,54 @@ func testClosePorts() {
 	})
 }
 
+func testValidate() {
+	t := newCloudTestDriver()
+
+	var retError error
+
+	JustBeforeEach(func() {
+		t.expectDescribeVpcs(t.vpcID)
+		t.expectDescribeVpcsSigs(t.vpcID)
+		t.expectDescribePublicSubnets(t.subnets...)
+		t.expectDescribePublicSubnetsSigs(t.subnets...)
+
+		retError = t.cloud.Validate(context.TODO(), reporter.Stdout())
+	})
+
+	When("the ports can be opened and closed", func() {
+		BeforeEach(func() {
+			t.expectValidateAuthorizeSecurityGroupIngress(nil)
+			t.expectValidateRevokeSecurityGroupIngress(nil)
+		})
+
+		It("should succeed", func() {
+			Expect(retError).To(Succeed())
+		})
+	})
+
+	When("the ports can neither be opened nor closed", func() {
+		BeforeEach(func() {
+			t.expectValidateAuthorizeSecurityGroupIngress(&smithy.GenericAPIError{Code: "UnauthorizedOperation"})
+			t.expectValidateRevokeSecurityGroupIngress(&smithy.GenericAPIError{Code: "UnauthorizedOperation"})
+		})
+
+		It("should return both errors", func() {
+			Expect(retError).To(MatchError(ContainSubstring("no permission to authorize security group ingress")))
+			Expect(retError).To(MatchError(ContainSubstring("no permission to revoke security group ingress")))
+		})
+	})
+
+	When("the infra ID VPC does not exist", func() {
+		BeforeEach(func() {
+			t.vpcID = ""
+		})
+
+		It("should return an error", func() {
+			Expect(retError).To(HaveOccurred())
+		})
+	})
+}
+
 type cloudTestDriver struct {
 	fakeAWSClientBase
 	cloud api.Cloud
@@ -37,6 +37,7 @@ const (
 	infraID                  = "test-infra"
 	region                   = "test-region"
 	vpcID                    = "test-vpc"
+	vpcCIDR                  = "10.0.0.0/16"
 	workerGroupID            = "worker-group"
 	masterGroupID            = "master-group"
 	gatewayGroupID           = "gateway-group"
@@ -50,7 +51,8 @@ const (
 	workerSGName             = infraID + "-worker-sg"
 	gatewaySGName            = infraID + "-submariner-gw-sg"
 	providerAWSTagPrefix     = "tag:sigs.k8s.io/cluster-api-provider-aws/cluster/"
-	clusterFilterTagName     = "tag:kubernetes.io/cluster/" + infraID
+	clusterTagKey            = "kubernetes.io/cluster/" + infraID
+	clusterFilterTagName     = "tag:" + clusterTagKey
 	clusterFilterTagNameSigs = providerAWSTagPrefix + infraID
 )
 
@@ -133,6 +135,11 @@ func (f *fakeAWSClientBase) expectDescribeVpcsSigs(vpcID string) {
 	}}}).Matches))).Return(&ec2.DescribeVpcsOutput{Vpcs: vpcs}, nil).Maybe()
 }
 
+func (f *fakeAWSClientBase) expectDescribeVpcCIDR(vpcID, cidr string) {
+	f.awsClient.EXPECT().DescribeVpcs(mock.Anything, &ec2.DescribeVpcsInput{VpcIds: []string{vpcID}}).
+		Return(&ec2.DescribeVpcsOutput{Vpcs: []types.Vpc{{VpcId: ptr.To(vpcID), CidrBlock: ptr.To(cidr)}}}, nil)
+}
+
 func (f *fakeAWSClientBase) expectValidateAuthorizeSecurityGroupIngress(authErr error) *mock.Call {
 	return f.awsClient.EXPECT().AuthorizeSecurityGroupIngress(mock.Anything,
 		mock.MatchedBy((&authorizeSecurityGroupIngressInputMatcher{ec2.AuthorizeSecurityGroupIngressInput{
@@ -141,15 +148,32 @@ func (f *fakeAWSClientBase) expectValidateAuthorizeSecurityGroupIngress(authErr
 		}}).Matches)).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, authErr).Call
 }
 
-func (f *fakeAWSClientBase) expectAuthorizeSecurityGroupIngress(srcGroup string, ipPerm *types.IpPermission) {
+func (f *fakeAWSClientBase) expectAuthorizeSecurityGroupIngress(srcGroup string, ipPerms ...*types.IpPermission) {
 	f.awsClient.EXPECT().AuthorizeSecurityGroupIngress(mock.Anything,
 		mock.MatchedBy((&authorizeSecurityGroupIngressInputMatcher{ec2.AuthorizeSecurityGroupIngressInput{
 			GroupId:       ptr.To(srcGroup),
-			IpPermissions: []types.IpPermission{*ipPerm},
+			IpPermissions: toIPPermissions(ipPerms),
 		}}).Matches)).Return(&ec2.AuthorizeSecurityGroupIngressOutput{},
 		f.authorizeSecurityGroupIngressErr)
 }
 
+func (f *fakeAWSClientBase) expectAuthorizeSecurityGroupIngressFailure(srcGroup string, err error, ipPerms ...*types.IpPermission) {
+	f.awsClient.EXPECT().AuthorizeSecurityGroupIngress(mock.Anything,
+		mock.MatchedBy((&authorizeSecurityGroupIngressInputMatcher{ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       ptr.To(srcGroup),
+			IpPermissions: toIPPermissions(ipPerms),
+		}}).Matches)).Return(nil, err)
+}
+
+func toIPPermissions(ipPerms []*types.IpPermission) []types.IpPermission {
+	out := make([]types.IpPermission, len(ipPerms))
+	for i := range ipPerms {
+		out[i] = *ipPerms[i]
+	}
+
+	return out
+}
+
 func (f *fakeAWSClientBase) expectRevokeSecurityGroupIngress(groupID string, ipPermissions ...types.IpPermission) {
 	f.awsClient.EXPECT().RevokeSecurityGroupIngress(mock.Anything, &ec2.RevokeSecurityGroupIngressInput{
 		GroupId:       ptr.To(groupID),
@@ -190,6 +214,19 @@ func (f *fakeAWSClientBase) expectDescribePublicSubnetsSigs(retSubnets ...types.
 	}}}).Matches))).Return(&ec2.DescribeSubnetsOutput{Subnets: retSubnets}, f.describeSubnetsErr).Maybe()
 }
 
+func (f *fakeAWSClientBase) expectDescribePrivateSubnets(retSubnets ...types.Subnet) {
+	f.awsClient.EXPECT().DescribeSubnets(mock.Anything, mock.MatchedBy(((&filtersMatcher{expectedFilters: []types.Filter{{
+		Name:   ptr.To("tag:Name"),
+		Values: []string{infraID + "*-private-" + region + "*"},
+	}, {
+		Name:   ptr.To("vpc-id"),
+		Values: []string{f.vpcID},
+	}, {
+		Name:   ptr.To(clusterFilterTagName),
+		Values: []string{"owned"},
+	}}}).Matches))).Return(&ec2.DescribeSubnetsOutput{Subnets: retSubnets}, f.describeSubnetsErr)
+}
+
 func (f *fakeAWSClientBase) expectDescribeGatewaySubnets(retSubnets ...types.Subnet) {
 	f.awsClient.EXPECT().DescribeSubnets(mock.Anything, mock.MatchedBy(((&filtersMatcher{expectedFilters: []types.Filter{{
 		Name:   ptr.To("tag:submariner.io/gateway"),
@@ -272,6 +309,15 @@ func (f *fakeAWSClientBase) expectCreateGatewayTags(subnetID string) {
 	f.expectCreateTags(subnetID, "kubernetes.io/role/internal-elb", "submariner.io/gateway")
 }
 
+func (f *fakeAWSClientBase) expectCreateGatewayAndClusterTags(subnetID string) {
+	f.awsClient.EXPECT().CreateTags(mock.Anything, &ec2.CreateTagsInput{
+		Resources: []string{subnetID},
+		Tags: append(makeTags([]string{"kubernetes.io/role/internal-elb", "submariner.io/gateway"}),
+			types.Tag{Key: ptr.To(clusterTagKey), Value: ptr.To("shared")},
+			types.Tag{Key: ptr.To("submariner.io/cluster-tag-added"), Value: ptr.To("")}),
+	}).Return(&ec2.CreateTagsOutput{}, f.createTagsErr)
+}
+
 func (f *fakeAWSClientBase) expectValidateCreateTags() *mock.Call {
 	return f.awsClient.EXPECT().CreateTags(mock.Anything, mock.MatchedBy(func(in *ec2.CreateTagsInput) bool {
 		return in.DryRun != nil && *in.DryRun
@@ -289,6 +335,15 @@ func (f *fakeAWSClientBase) expectDeleteGatewayTags(subnetID string) {
 	f.expectDeleteTags(subnetID, "kubernetes.io/role/internal-elb", "submariner.io/gateway")
 }
 
+func (f *fakeAWSClientBase) expectDeleteGatewayAndClusterTags(subnetID string) {
+	f.awsClient.EXPECT().DeleteTags(mock.Anything, &ec2.DeleteTagsInput{
+		Resources: []string{subnetID},
+		Tags: append(makeTags([]string{"kubernetes.io/role/internal-elb", "submariner.io/gateway"}),
+			types.Tag{Key: ptr.To(clusterTagKey), Value: ptr.To("shared")},
+			types.Tag{Key: ptr.To("submariner.io/cluster-tag-added"), Value: ptr.To("")}),
+	}).Return(&ec2.DeleteTagsOutput{}, f.createTagsErr)
+}
+
 func (f *fakeAWSClientBase) expectValidateDeleteTags() *mock.Call {
 	return f.awsClient.EXPECT().DeleteTags(mock.Anything, mock.MatchedBy(func(in *ec2.DeleteTagsInput) bool {
 		return in.DryRun != nil && *in.DryRun
@@ -342,6 +397,10 @@ func newSubnet(availabilityZone, subnetID string) types.Subnet {
 				Key:   ptr.To("Name"),
 				Value: ptr.To(subnetName(subnetID)),
 			},
+			{
+				Key:   ptr.To(clusterTagKey),
+				Value: ptr.To("owned"),
+			},
 		},
 	}
 }
@@ -403,13 +462,17 @@ func newClusterSGRule(groupID string, port int32, protocol string) *types.IpPerm
 }
 
 func newPublicSGRule(port int32, protocol string) *types.IpPermission {
+	return newCIDRSGRule(port, protocol, "0.0.0.0/0")
+}
+
+func newCIDRSGRule(port int32, protocol, cidr string) *types.IpPermission {
 	return &types.IpPermission{
 		FromPort:   ptr.To(port),
 		ToPort:     ptr.To(port),
 		IpProtocol: ptr.To(protocol),
 		IpRanges: []types.IpRange{
 			{
-				CidrIp: ptr.To("0.0.0.0/0"),
+				CidrIp: ptr.To(cidr),
 			},
 		},
 	}
@@ -431,7 +494,7 @@ func (m *authorizeSecurityGroupIngressInputMatcher) Matches(i interface{}) bool
 	eIPPerms := eInput.IpPermissions
 	eInput.IpPermissions = nil
 
-	if !reflect.DeepEqual(&eInput, &aInput) && len(eIPPerms) != len(aIPPerms) {
+	if !reflect.DeepEqual(&eInput, &aInput) || len(eIPPerms) != len(aIPPerms) {
 		return false
 	}
 
@@ -465,7 +528,13 @@ func (m *authorizeSecurityGroupIngressInputMatcher) Matches(i interface{}) bool
 		return &out
 	}
 
-	return reflect.DeepEqual(&eIPPerms[0], copyIPPerm(&aIPPerms[0]))
+	for i := range eIPPerms {
+		if !reflect.DeepEqual(&eIPPerms[i], copyIPPerm(&aIPPerms[i])) {
+			return false
+		}
+	}
+
+	return true
 }
 
 type filtersMatcher struct {
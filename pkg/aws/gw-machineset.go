@@ -79,4 +79,4 @@ spec:
               value: gateway
           userDataSecret:
             name: worker-user-data
-          publicIp: true`
+          publicIp: {{.PublicIP}}`
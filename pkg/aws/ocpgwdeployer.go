@@ -39,30 +39,56 @@ type ocpGatewayDeployer struct {
 	aws          *awsCloud
 	msDeployer   ocp.MachineSetDeployer
 	instanceType string
+	publicIP     bool
+}
+
+// GatewayDeployerOption configures optional behaviour of the AWS GatewayDeployer.
+type GatewayDeployerOption func(*ocpGatewayDeployer)
+
+// WithPublicIP specifies whether gateway nodes are assigned a public IP, which is the default. When disabled, gateway
+// nodes are deployed in the cluster's private subnets and reach other clusters through the VPC's existing NAT gateway,
+// and the gateway security group only admits the public ports from the VPC CIDR rather than 0.0.0.0/0. Since the
+// gateways then sit behind NAT, IPsec falls back to NAT-T (ESP encapsulated in UDP 4500), so the NAT-T port must be
+// among the public ports, and connections can only be initiated from this cluster unless the remote side reaches the
+// gateways through a load balancer in the VPC.
+func WithPublicIP(enabled bool) GatewayDeployerOption {
+	return func(d *ocpGatewayDeployer) {
+		d.publicIP = enabled
+	}
 }
 
 var PreferredInstances = []string{"c5d.large", "m5n.large"}
 
 // NewOcpGatewayDeployer returns a GatewayDeployer capable deploying gateways using OCP.
-// If the supplied cloud is not an awsCloud, an error is returned.
-func NewOcpGatewayDeployer(cloud api.Cloud, msDeployer ocp.MachineSetDeployer, instanceType string) (api.GatewayDeployer, error) {
-	aws, ok := cloud.(*awsCloud)
+// If the supplied cloud, or the Cloud it wraps, e.g. with api.ObserveCloud, is not an awsCloud, an error is returned.
+func NewOcpGatewayDeployer(cloud api.Cloud, msDeployer ocp.MachineSetDeployer, instanceType string, opts ...GatewayDeployerOption,
+) (api.GatewayDeployer, error) {
+	aws, ok := api.UnwrapCloud(cloud).(*awsCloud)
 	if !ok {
 		return nil, errors.New("the cloud must be AWS")
 	}
 
-	return &ocpGatewayDeployer{
+	d := &ocpGatewayDeployer{
 		aws:          aws,
 		msDeployer:   msDeployer,
 		instanceType: instanceType,
-	}, nil
+		publicIP:     true,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d, nil
 }
 
-func (d *ocpGatewayDeployer) Deploy(input api.GatewayDeployInput, status reporter.Interface) error {
+func (d *ocpGatewayDeployer) Deploy(ctx context.Context, input api.GatewayDeployInput, status reporter.Interface) error {
+	input.PublicPorts = api.SortPorts(input.PublicPorts)
+
 	status.Start(messageRetrieveVPCID)
 	defer status.End()
 
-	vpcID, err := d.aws.getVpcID()
+	vpcID, err := d.aws.getVpcID(ctx)
 	if err != nil {
 		return status.Error(err, "unable to retrieve the VPC ID")
 	}
@@ -70,7 +96,7 @@ func (d *ocpGatewayDeployer) Deploy(input api.GatewayDeployInput, status reporte
 	status.Success(messageRetrievedVPCID, vpcID)
 
 	if _, found := d.aws.cloudConfig[VPCIDKey]; !found {
-		err = d.aws.setSuffixes(vpcID)
+		err = d.aws.setSuffixes(ctx, vpcID)
 		if err != nil {
 			return status.Error(err, "unable to retrieve the security group names")
 		}
@@ -83,7 +109,7 @@ func (d *ocpGatewayDeployer) Deploy(input api.GatewayDeployInput, status reporte
 	if subnets, exists := d.aws.cloudConfig[PublicSubnetListKey]; exists {
 		if subnetIDs, ok := subnets.([]string); ok && len(subnetIDs) > 0 {
 			for _, id := range subnetIDs {
-				subnet, err := d.aws.getSubnetByID(id)
+				subnet, err := d.aws.getSubnetByID(ctx, id)
 				if err != nil {
 					return errors.Wrapf(err, "unable to find subnet with ID %s", id)
 				}
@@ -94,13 +120,13 @@ func (d *ocpGatewayDeployer) Deploy(input api.GatewayDeployInput, status reporte
 			return errors.New("Subnet IDs must be a valid non-empty slice of strings")
 		}
 	} else {
-		publicSubnets, err = d.aws.findPublicSubnets(vpcID, d.aws.filterByName("{infraID}*-public-{region}*"))
+		publicSubnets, err = d.aws.findPublicSubnets(ctx, vpcID, d.aws.filterByName(d.subnetNamePattern()))
 		if err != nil {
 			return status.Error(err, "unable to find public subnets")
 		}
 	}
 
-	err = d.validateDeployPrerequisites(vpcID, input, publicSubnets)
+	err = d.validateDeployPrerequisites(ctx, vpcID, input, publicSubnets)
 	if err != nil {
 		return status.Error(err, "unable to validate prerequisites")
 	}
@@ -109,20 +135,39 @@ func (d *ocpGatewayDeployer) Deploy(input api.GatewayDeployInput, status reporte
 
 	status.Start("Creating Submariner gateway security group")
 
-	gatewaySG, err := d.aws.createGatewaySG(vpcID, input.PublicPorts)
+	sourceCIDR := anyIPv4CIDR
+
+	if !d.publicIP {
+		sourceCIDR, err = d.aws.getVpcCIDR(ctx, vpcID)
+		if err != nil {
+			return status.Error(err, "unable to retrieve the VPC CIDR")
+		}
+	}
+
+	gatewaySG, err := d.aws.createGatewaySG(ctx, vpcID, input.PublicPorts, sourceCIDR)
 	if err != nil {
 		return status.Error(err, "unable to create gateway")
 	}
 
 	status.Success("Created Submariner gateway security group %s", gatewaySG)
 
-	return d.processSubnets(vpcID, gatewaySG, publicSubnets, input, status)
+	return d.processSubnets(ctx, vpcID, gatewaySG, publicSubnets, input, status)
+}
+
+// subnetNamePattern returns the name pattern of the subnets gateways are deployed in. Without a public IP, gateways go
+// in the private subnets, whose default route already points at the cluster's NAT gateway.
+func (d *ocpGatewayDeployer) subnetNamePattern() string {
+	if d.publicIP {
+		return "{infraID}*-public-{region}*"
+	}
+
+	return "{infraID}*-private-{region}*"
 }
 
-func (d *ocpGatewayDeployer) processSubnets(vpcID, gatewaySG string, publicSubnets []types.Subnet,
+func (d *ocpGatewayDeployer) processSubnets(ctx context.Context, vpcID, gatewaySG string, publicSubnets []types.Subnet,
 	input api.GatewayDeployInput, status reporter.Interface,
 ) error {
-	subnets, err := d.aws.getSubnetsSupportingInstanceType(publicSubnets, d.instanceType)
+	subnets, err := d.aws.getSubnetsSupportingInstanceType(ctx, publicSubnets, d.instanceType)
 	if err != nil {
 		return status.Error(err, "unable to get subnets supporting instance type")
 	}
@@ -145,7 +190,7 @@ func (d *ocpGatewayDeployer) processSubnets(vpcID, gatewaySG string, publicSubne
 
 		status.Start("Adjusting public subnet %s to support Submariner", subnetName)
 
-		err = d.aws.tagPublicSubnet(subnet.SubnetId)
+		err = d.aws.tagPublicSubnet(ctx, subnet)
 		if err != nil {
 			return status.Error(err, "unable to tag public subnet")
 		}
@@ -161,7 +206,7 @@ func (d *ocpGatewayDeployer) processSubnets(vpcID, gatewaySG string, publicSubne
 
 		status.Start("Deploying gateway node for public subnet %s", subnetName)
 
-		err = d.deployGateway(vpcID, gatewaySG, subnet)
+		err = d.deployGateway(ctx, vpcID, gatewaySG, subnet)
 		if err != nil {
 			return status.Error(err, "unable to deploy gateway")
 		}
@@ -172,15 +217,15 @@ func (d *ocpGatewayDeployer) processSubnets(vpcID, gatewaySG string, publicSubne
 	return nil
 }
 
-func (d *ocpGatewayDeployer) validateDeployPrerequisites(vpcID string, input api.GatewayDeployInput,
+func (d *ocpGatewayDeployer) validateDeployPrerequisites(ctx context.Context, vpcID string, input api.GatewayDeployInput,
 	publicSubnets []types.Subnet,
 ) error {
 	var errs []error
 	var subnets []types.Subnet
 
-	errs = appendIfError(errs, d.aws.validateCreateSecGroup(vpcID))
-	errs = appendIfError(errs, d.aws.validateCreateSecGroupRule(vpcID))
-	err := d.aws.validateDescribeInstanceTypeOfferings()
+	errs = appendIfError(errs, d.aws.validateCreateSecGroup(ctx, vpcID))
+	errs = appendIfError(errs, d.aws.validateCreateSecGroupRule(ctx, vpcID))
+	err := d.aws.validateDescribeInstanceTypeOfferings(ctx)
 	errs = appendIfError(errs, err)
 
 	if err != nil {
@@ -190,7 +235,7 @@ func (d *ocpGatewayDeployer) validateDeployPrerequisites(vpcID string, input api
 	// If instanceType is not specified, auto-select the most suitable one.
 	if d.instanceType == "" {
 		for _, instanceType := range PreferredInstances {
-			subnets, err = d.aws.getSubnetsSupportingInstanceType(publicSubnets, instanceType)
+			subnets, err = d.aws.getSubnetsSupportingInstanceType(ctx, publicSubnets, instanceType)
 			if err != nil {
 				return err
 			}
@@ -201,7 +246,7 @@ func (d *ocpGatewayDeployer) validateDeployPrerequisites(vpcID string, input api
 			}
 		}
 	} else {
-		subnets, err = d.aws.getSubnetsSupportingInstanceType(publicSubnets, d.instanceType)
+		subnets, err = d.aws.getSubnetsSupportingInstanceType(ctx, publicSubnets, d.instanceType)
 		if err != nil {
 			return err
 		}
@@ -214,7 +259,7 @@ func (d *ocpGatewayDeployer) validateDeployPrerequisites(vpcID string, input api
 	}
 
 	if len(subnets) > 0 {
-		errs = appendIfError(errs, d.aws.validateCreateTag(*subnets[0].SubnetId))
+		errs = appendIfError(errs, d.aws.validateCreateTag(ctx, *subnets[0].SubnetId))
 	}
 
 	return utilerrors.NewAggregate(errs)
@@ -229,15 +274,16 @@ type machineSetConfig struct {
 	SecurityGroup string
 	PublicSubnet  string
 	NodeSG        string
+	PublicIP      bool
 }
 
-func (d *ocpGatewayDeployer) findAMIID(vpcID string) (string, error) {
+func (d *ocpGatewayDeployer) findAMIID(ctx context.Context, vpcID string) (string, error) {
 	ownedFilters := d.aws.filterByCurrentCluster()
 	var err error
 	var result *ec2.DescribeInstancesOutput
 
 	for i := range ownedFilters {
-		result, err = d.aws.client.DescribeInstances(context.TODO(), &ec2.DescribeInstancesInput{
+		result, err = d.aws.client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
 			Filters: []types.Filter{
 				ec2Filter("vpc-id", vpcID),
 				d.aws.filterByName("{infraID}-worker*"),
@@ -268,7 +314,8 @@ func (d *ocpGatewayDeployer) findAMIID(vpcID string) (string, error) {
 	return *result.Reservations[0].Instances[0].ImageId, nil
 }
 
-func (d *ocpGatewayDeployer) loadGatewayYAML(gatewaySecurityGroup, amiID string, publicSubnet *types.Subnet) ([]byte, error) {
+func (d *ocpGatewayDeployer) loadGatewayYAML(ctx context.Context, gatewaySecurityGroup, amiID string, publicSubnet *types.Subnet,
+) ([]byte, error) {
 	var buf bytes.Buffer
 
 	tpl, err := template.New("").Parse(machineSetYAML)
@@ -284,11 +331,12 @@ func (d *ocpGatewayDeployer) loadGatewayYAML(gatewaySecurityGroup, amiID string,
 		Region:        d.aws.region,
 		SecurityGroup: gatewaySecurityGroup,
 		PublicSubnet:  extractName(publicSubnet.Tags),
+		PublicIP:      d.publicIP,
 	}
 
 	if id, exists := d.aws.cloudConfig[WorkerSecurityGroupIDKey]; exists {
 		if workerGroupIDStr, ok := id.(string); ok && workerGroupIDStr != "" {
-			workerSecurityGroup, err := d.aws.getSecurityGroupByID(workerGroupIDStr)
+			workerSecurityGroup, err := d.aws.getSecurityGroupByID(ctx, workerGroupIDStr)
 			if err != nil {
 				return nil, errors.Wrapf(err, "error finding the worker security group with ID %s", workerGroupIDStr)
 			}
@@ -313,8 +361,9 @@ func (d *ocpGatewayDeployer) loadGatewayYAML(gatewaySecurityGroup, amiID string,
 	return buf.Bytes(), nil
 }
 
-func (d *ocpGatewayDeployer) initMachineSet(gwSecurityGroup, amiID string, publicSubnet *types.Subnet) (*unstructured.Unstructured, error) {
-	gatewayYAML, err := d.loadGatewayYAML(gwSecurityGroup, amiID, publicSubnet)
+func (d *ocpGatewayDeployer) initMachineSet(ctx context.Context, gwSecurityGroup, amiID string, publicSubnet *types.Subnet,
+) (*unstructured.Unstructured, error) {
+	gatewayYAML, err := d.loadGatewayYAML(ctx, gwSecurityGroup, amiID, publicSubnet)
 	if err != nil {
 		return nil, err
 	}
@@ -331,13 +380,13 @@ func (d *ocpGatewayDeployer) initMachineSet(gwSecurityGroup, amiID string, publi
 	return machineSet, nil
 }
 
-func (d *ocpGatewayDeployer) deployGateway(vpcID, gatewaySecurityGroup string, publicSubnet *types.Subnet) error {
-	amiID, err := d.findAMIID(vpcID)
+func (d *ocpGatewayDeployer) deployGateway(ctx context.Context, vpcID, gatewaySecurityGroup string, publicSubnet *types.Subnet) error {
+	amiID, err := d.findAMIID(ctx, vpcID)
 	if err != nil {
 		return err
 	}
 
-	machineSet, err := d.initMachineSet(gatewaySecurityGroup, amiID, publicSubnet)
+	machineSet, err := d.initMachineSet(ctx, gatewaySecurityGroup, amiID, publicSubnet)
 	if err != nil {
 		return err
 	}
@@ -345,11 +394,11 @@ func (d *ocpGatewayDeployer) deployGateway(vpcID, gatewaySecurityGroup string, p
 	return errors.Wrapf(d.msDeployer.Deploy(machineSet), "error deploying machine set %q", machineSet.GetName())
 }
 
-func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
+func (d *ocpGatewayDeployer) Cleanup(ctx context.Context, status reporter.Interface) error {
 	status.Start(messageRetrieveVPCID)
 	defer status.End()
 
-	vpcID, err := d.aws.getVpcID()
+	vpcID, err := d.aws.getVpcID(ctx)
 	if err != nil {
 		return status.Error(err, "unable to retrieve the VPC ID")
 	}
@@ -357,7 +406,7 @@ func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
 	status.Success(messageRetrievedVPCID, vpcID)
 
 	if _, found := d.aws.cloudConfig[VPCIDKey]; !found {
-		err = d.aws.setSuffixes(vpcID)
+		err = d.aws.setSuffixes(ctx, vpcID)
 		if err != nil {
 			return status.Error(err, "unable to retrieve the security group names")
 		}
@@ -365,7 +414,7 @@ func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
 
 	status.Start(messageValidatePrerequisites)
 
-	err = d.validateCleanupPrerequisites(vpcID)
+	err = d.validateCleanupPrerequisites(ctx, vpcID)
 	if err != nil {
 		return status.Error(err, "unable to validate prerequisites")
 	}
@@ -377,7 +426,7 @@ func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
 	if subnets, exists := d.aws.cloudConfig[PublicSubnetListKey]; exists {
 		if subnetIDs, ok := subnets.([]string); ok && len(subnetIDs) > 0 {
 			for _, id := range subnetIDs {
-				subnet, err := d.aws.getSubnetByID(id)
+				subnet, err := d.aws.getSubnetByID(ctx, id)
 				if err != nil {
 					return errors.Wrapf(err, "unable to find subnet with ID %s", id)
 				}
@@ -388,7 +437,7 @@ func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
 			return errors.New("Subnet IDs must be a valid non-empty slice of strings")
 		}
 	} else {
-		publicSubnets, err = d.aws.getTaggedPublicSubnets(vpcID)
+		publicSubnets, err = d.aws.getTaggedPublicSubnets(ctx, vpcID)
 		if err != nil {
 			return err
 		}
@@ -400,7 +449,7 @@ func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
 
 		status.Start("Removing gateway node for public subnet %s", subnetName)
 
-		err = d.deleteGateway(subnet)
+		err = d.deleteGateway(ctx, subnet)
 		if err != nil {
 			return status.Error(err, "unable to remove gateway node")
 		}
@@ -409,7 +458,7 @@ func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
 
 		status.Start("Untagging public subnet %s from supporting Submariner", subnetName)
 
-		err = d.aws.untagPublicSubnet(subnet.SubnetId)
+		err = d.aws.untagPublicSubnet(ctx, subnet)
 		if err != nil {
 			return status.Error(err, "unable to untag subnet")
 		}
@@ -419,7 +468,7 @@ func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
 
 	status.Start("Deleting Submariner gateway security group")
 
-	err = d.aws.deleteGatewaySG(vpcID)
+	err = d.aws.deleteGatewaySG(ctx, vpcID)
 	if err != nil {
 		return status.Error(err, "unable to delete gateway")
 	}
@@ -429,25 +478,25 @@ func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
 	return nil
 }
 
-func (d *ocpGatewayDeployer) validateCleanupPrerequisites(vpcID string) error {
+func (d *ocpGatewayDeployer) validateCleanupPrerequisites(ctx context.Context, vpcID string) error {
 	var errs []error
 
-	errs = appendIfError(errs, d.aws.validateDeleteSecGroup(vpcID))
+	errs = appendIfError(errs, d.aws.validateDeleteSecGroup(ctx, vpcID))
 
-	subnets, err := d.aws.getTaggedPublicSubnets(vpcID)
+	subnets, err := d.aws.getTaggedPublicSubnets(ctx, vpcID)
 	if err != nil {
 		return err
 	}
 
 	if len(subnets) > 0 {
-		errs = appendIfError(errs, d.aws.validateRemoveTag(subnets[0].SubnetId))
+		errs = appendIfError(errs, d.aws.validateRemoveTag(ctx, subnets[0].SubnetId))
 	}
 
 	return utilerrors.NewAggregate(errs)
 }
 
-func (d *ocpGatewayDeployer) deleteGateway(publicSubnet *types.Subnet) error {
-	machineSet, err := d.initMachineSet("", "", publicSubnet)
+func (d *ocpGatewayDeployer) deleteGateway(ctx context.Context, publicSubnet *types.Subnet) error {
+	machineSet, err := d.initMachineSet(ctx, "", "", publicSubnet)
 	if err != nil {
 		return err
 	}
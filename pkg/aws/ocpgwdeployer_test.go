@@ -19,7 +19,9 @@ limitations under the License.
 package aws_test
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	. "github.com/onsi/ginkgo/v2"
@@ -62,15 +64,18 @@ func testDeploy() {
 		BeforeEach(func() {
 			t.expectDeployValidations(true)
 
-			t.expectAuthorizeSecurityGroupIngress(gatewayGroupID, newPublicSGRule(100, "TCP"))
-			t.expectAuthorizeSecurityGroupIngress(gatewayGroupID, newPublicSGRule(200, "UDP"))
+			t.expectAuthorizeSecurityGroupIngress(gatewayGroupID, newPublicSGRule(100, "TCP"), newPublicSGRule(200, "UDP"))
 		})
 
 		JustBeforeEach(func() {
 			deployCall.Times(t.numGateways)
 
 			for i := range t.expectedSubnetsTagged {
-				t.expectCreateGatewayTags(*t.expectedSubnetsTagged[i].SubnetId)
+				if t.missingClusterTag {
+					t.expectCreateGatewayAndClusterTags(*t.expectedSubnetsTagged[i].SubnetId)
+				} else {
+					t.expectCreateGatewayTags(*t.expectedSubnetsTagged[i].SubnetId)
+				}
 			}
 
 			t.doDeploy()
@@ -87,6 +92,14 @@ func testDeploy() {
 			t.testDeploySuccess("should create it and", "")
 		})
 
+		Context("and the cloud is observed", func() {
+			BeforeEach(func() {
+				t.metrics = noopMetrics{}
+			})
+
+			t.testDeploySuccess("", "")
+		})
+
 		Context("and the first subnet doesn't have an instance type offering", func() {
 			BeforeEach(func() {
 				t.zonesWithInstanceTypeOfferings = set.New(availabilityZone2)
@@ -109,6 +122,15 @@ func testDeploy() {
 			t.testDeploySuccess("", " without retagging it")
 		})
 
+		Context("and the deploying subnet doesn't have the cluster tag", func() {
+			BeforeEach(func() {
+				t.missingClusterTag = true
+				t.subnets[0].Tags = t.subnets[0].Tags[:1]
+			})
+
+			t.testDeploySuccess("", " and add the cluster tag")
+		})
+
 		Context("and a desired instance type is not provided", func() {
 			BeforeEach(func() {
 				t.instanceType = ""
@@ -118,6 +140,26 @@ func testDeploy() {
 		})
 	})
 
+	When("public IPs are disabled", func() {
+		BeforeEach(func() {
+			t.publicIP = false
+			t.expectDeployValidations(true)
+			t.expectDescribeVpcCIDR(t.vpcID, vpcCIDR)
+			t.expectAuthorizeSecurityGroupIngress(gatewayGroupID, newCIDRSGRule(100, "TCP", vpcCIDR),
+				newCIDRSGRule(200, "UDP", vpcCIDR))
+		})
+
+		JustBeforeEach(func() {
+			deployCall.Times(t.numGateways)
+			t.expectDescribePrivateSubnets(t.subnets...)
+			t.expectCreateGatewayTags(*t.expectedSubnetsTagged[0].SubnetId)
+
+			t.doDeploy()
+		})
+
+		t.testDeploySuccess("", " in the private subnets without a public IP")
+	})
+
 	Context("", func() {
 		JustBeforeEach(func() {
 			deployCall.Maybe()
@@ -151,8 +193,7 @@ func testDeploy() {
 		When("tagging a public subnet fails", func() {
 			BeforeEach(func() {
 				t.createTagsErr = errors.New("mock error")
-				t.expectAuthorizeSecurityGroupIngress(gatewayGroupID, newPublicSGRule(100, "TCP"))
-				t.expectAuthorizeSecurityGroupIngress(gatewayGroupID, newPublicSGRule(200, "UDP"))
+				t.expectAuthorizeSecurityGroupIngress(gatewayGroupID, newPublicSGRule(100, "TCP"), newPublicSGRule(200, "UDP"))
 				t.expectCreateGatewayTags(*t.expectedSubnetsTagged[0].SubnetId)
 			})
 
@@ -164,7 +205,7 @@ func testDeploy() {
 		When("the creation of a security group fails", func() {
 			BeforeEach(func() {
 				t.authorizeSecurityGroupIngressErr = errors.New("mock error")
-				t.expectAuthorizeSecurityGroupIngress(gatewayGroupID, newPublicSGRule(100, "TCP"))
+				t.expectAuthorizeSecurityGroupIngress(gatewayGroupID, newPublicSGRule(100, "TCP"), newPublicSGRule(200, "UDP"))
 			})
 
 			It("should return an error", func() {
@@ -216,6 +257,26 @@ func testCleanup() {
 		})
 	})
 
+	When("Submariner added the cluster tag to a subnet", func() {
+		BeforeEach(func() {
+			t.expectCleanupValidations(true)
+			t.msDeployer.EXPECT().Delete(mock.Anything).RunAndReturn(machineSetFn(&t.machineSets)).Times(len(t.subnets))
+			t.expectDeleteSecurityGroup(gatewayGroupID)
+
+			t.subnets[0].Tags = append(t.subnets[0].Tags[:1], types.Tag{
+				Key:   ptr.To("submariner.io/cluster-tag-added"),
+				Value: ptr.To(""),
+			})
+
+			t.expectDeleteGatewayAndClusterTags(*t.subnets[0].SubnetId)
+			t.expectDeleteGatewayTags(*t.subnets[1].SubnetId)
+		})
+
+		It("should only remove the cluster tag from that subnet", func() {
+			Expect(t.retError).To(Succeed())
+		})
+	})
+
 	Context("", func() {
 		BeforeEach(func() {
 			t.expectCleanupValidations(false)
@@ -243,6 +304,10 @@ func testCleanup() {
 	})
 }
 
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveOperation(_, _ string, _ time.Duration, _ error) {}
+
 type gatewayDeployerTestDriver struct {
 	fakeAWSClientBase
 	numGateways                    int
@@ -256,6 +321,9 @@ type gatewayDeployerTestDriver struct {
 	retError                       error
 	msDeployer                     *ocpFake.MockMachineSetDeployer
 	gwDeployer                     api.GatewayDeployer
+	metrics                        api.Metrics
+	publicIP                       bool
+	missingClusterTag              bool
 }
 
 func newGatewayDeployerTestDriver() *gatewayDeployerTestDriver {
@@ -267,6 +335,9 @@ func newGatewayDeployerTestDriver() *gatewayDeployerTestDriver {
 		t.msDeployer = ocpFake.NewMockMachineSetDeployer(GinkgoT())
 		t.numGateways = 1
 		t.instanceType = "test-instance-type"
+		t.publicIP = true
+		t.missingClusterTag = false
+		t.metrics = nil
 		t.subnets = []types.Subnet{newSubnet(availabilityZone1, subnetID1), newSubnet(availabilityZone2, subnetID2)}
 		t.expectedSubnetsDeployed = []types.Subnet{t.subnets[0]}
 		t.expectedSubnetsTagged = []types.Subnet{t.subnets[0]}
@@ -289,7 +360,8 @@ func newGatewayDeployerTestDriver() *gatewayDeployerTestDriver {
 
 		var err error
 
-		t.gwDeployer, err = aws.NewOcpGatewayDeployer(aws.NewCloud(t.awsClient, infraID, region), t.msDeployer, t.instanceType)
+		t.gwDeployer, err = aws.NewOcpGatewayDeployer(api.ObserveCloud(aws.NewCloud(t.awsClient, infraID, region), "aws", t.metrics),
+			t.msDeployer, t.instanceType, aws.WithPublicIP(t.publicIP))
 		Expect(err).To(Succeed())
 	})
 
@@ -305,7 +377,7 @@ func (t *gatewayDeployerTestDriver) expectedInstanceType() string {
 }
 
 func (t *gatewayDeployerTestDriver) doDeploy() {
-	t.retError = t.gwDeployer.Deploy(api.GatewayDeployInput{
+	t.retError = t.gwDeployer.Deploy(context.TODO(), api.GatewayDeployInput{
 		Gateways: t.numGateways,
 		PublicPorts: []api.PortSpec{
 			{
@@ -321,7 +393,7 @@ func (t *gatewayDeployerTestDriver) doDeploy() {
 }
 
 func (t *gatewayDeployerTestDriver) doCleanup() {
-	t.retError = t.gwDeployer.Cleanup(reporter.Stdout())
+	t.retError = t.gwDeployer.Cleanup(context.TODO(), reporter.Stdout())
 }
 
 func (t *gatewayDeployerTestDriver) expectDeployValidations(enforce bool) {
@@ -366,6 +438,12 @@ func (t *gatewayDeployerTestDriver) testDeploySuccess(msgPrefix, msgSuffix strin
 		for i := range t.expectedSubnetsDeployed {
 			assertMachineSet(t.machineSets[*t.expectedSubnetsDeployed[i].AvailabilityZone], *t.expectedSubnetsDeployed[i].SubnetId,
 				t.expectedInstanceType(), instanceImageID, gatewaySGName)
+
+			publicIP, found, _ := unstructured.NestedBool(t.machineSets[*t.expectedSubnetsDeployed[i].AvailabilityZone].Object,
+				"spec", "template", "spec", "providerSpec", "value", "publicIp")
+			Expect(found).To(BeTrue())
+			Expect(publicIP).To(Equal(t.publicIP))
+
 			delete(t.machineSets, *t.expectedSubnetsDeployed[i].AvailabilityZone)
 		}
 
@@ -32,10 +32,13 @@ import (
 	"k8s.io/utils/ptr"
 )
 
-const internalTraffic = "Internal Submariner traffic"
+const (
+	internalTraffic = "Internal Submariner traffic"
+	anyIPv4CIDR     = "0.0.0.0/0"
+)
 
-func (ac *awsCloud) getSecurityGroupName(vpcID, name string) (*string, error) {
-	group, err := ac.getSecurityGroup(vpcID, name)
+func (ac *awsCloud) getSecurityGroupName(ctx context.Context, vpcID, name string) (*string, error) {
+	group, err := ac.getSecurityGroup(ctx, vpcID, name)
 	if err != nil {
 		return nil, err
 	}
@@ -43,8 +46,8 @@ func (ac *awsCloud) getSecurityGroupName(vpcID, name string) (*string, error) {
 	return group.GroupId, nil
 }
 
-func (ac *awsCloud) getSecurityGroupByID(groupID string) (types.SecurityGroup, error) {
-	output, err := ac.client.DescribeSecurityGroups(context.TODO(), &ec2.DescribeSecurityGroupsInput{
+func (ac *awsCloud) getSecurityGroupByID(ctx context.Context, groupID string) (types.SecurityGroup, error) {
+	output, err := ac.client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
 		GroupIds: []string{groupID},
 	})
 	if err != nil {
@@ -58,13 +61,13 @@ func (ac *awsCloud) getSecurityGroupByID(groupID string) (types.SecurityGroup, e
 	return output.SecurityGroups[0], nil
 }
 
-func (ac *awsCloud) getSecurityGroup(vpcID, name string) (types.SecurityGroup, error) {
+func (ac *awsCloud) getSecurityGroup(ctx context.Context, vpcID, name string) (types.SecurityGroup, error) {
 	filters := []types.Filter{
 		ec2Filter("vpc-id", vpcID),
 		ac.filterByName(name),
 	}
 
-	result, err := ac.client.DescribeSecurityGroups(context.TODO(), &ec2.DescribeSecurityGroupsInput{
+	result, err := ac.client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
 		Filters: filters,
 	})
 	if err != nil {
@@ -78,39 +81,51 @@ func (ac *awsCloud) getSecurityGroup(vpcID, name string) (types.SecurityGroup, e
 	return result.SecurityGroups[0], nil
 }
 
-func (ac *awsCloud) authorizeSecurityGroupIngress(groupID *string, ipPermissions []types.IpPermission) error {
+func (ac *awsCloud) authorizeSecurityGroupIngress(ctx context.Context, groupID *string, ipPermissions []types.IpPermission) error {
 	input := &ec2.AuthorizeSecurityGroupIngressInput{
 		GroupId:       groupID,
 		IpPermissions: ipPermissions,
 	}
 
-	_, err := ac.client.AuthorizeSecurityGroupIngress(context.TODO(), input)
+	_, err := ac.client.AuthorizeSecurityGroupIngress(ctx, input)
 	if isAWSError(err, "InvalidPermission.Duplicate") {
+		// The authorization is all or nothing so, if some of the permissions already exist, none of them were added;
+		// authorize them individually to add the missing ones.
+		if len(ipPermissions) > 1 {
+			for i := range ipPermissions {
+				if err := ac.authorizeSecurityGroupIngress(ctx, groupID, ipPermissions[i:i+1]); err != nil {
+					return err
+				}
+			}
+		}
+
 		return nil
 	}
 
 	return errors.Wrap(err, "error authorizing AWS security groups ingress")
 }
 
-func (ac *awsCloud) createClusterSGRule(srcGroup, destGroup *string, port uint16, protocol, description string) error {
-	ipPermissions := []types.IpPermission{
-		{
-			FromPort:   ptr.To(int32(port)),
-			ToPort:     ptr.To(int32(port)),
-			IpProtocol: ptr.To(protocol),
+func (ac *awsCloud) createClusterSGRule(ctx context.Context, srcGroup, destGroup *string, ports []api.PortSpec, description string) error {
+	ipPermissions := make([]types.IpPermission, 0, len(ports))
+
+	for _, port := range ports {
+		ipPermissions = append(ipPermissions, types.IpPermission{
+			FromPort:   ptr.To(int32(port.Port)),
+			ToPort:     ptr.To(int32(port.LastPort())),
+			IpProtocol: ptr.To(api.IPProtocol(port.Protocol)),
 			UserIdGroupPairs: []types.UserIdGroupPair{
 				{
 					Description: ptr.To(description),
 					GroupId:     srcGroup,
 				},
 			},
-		},
+		})
 	}
 
-	return ac.authorizeSecurityGroupIngress(destGroup, ipPermissions)
+	return ac.authorizeSecurityGroupIngress(ctx, destGroup, ipPermissions)
 }
 
-func (ac *awsCloud) allowPortInCluster(vpcID string, port uint16, protocol string) error {
+func (ac *awsCloud) allowPortsInCluster(ctx context.Context, vpcID string, ports []api.PortSpec) error {
 	var workerGroupID, controlPlaneGroupID *string
 	var err error
 
@@ -123,7 +138,7 @@ func (ac *awsCloud) allowPortInCluster(vpcID string, port uint16, protocol strin
 	} else {
 		workerGroupName := withInfraIDPrefix(ac.nodeSGSuffix)
 
-		workerGroupID, err = ac.getSecurityGroupName(vpcID, workerGroupName)
+		workerGroupID, err = ac.getSecurityGroupName(ctx, vpcID, workerGroupName)
 		if err != nil {
 			return err
 		}
@@ -138,49 +153,51 @@ func (ac *awsCloud) allowPortInCluster(vpcID string, port uint16, protocol strin
 	} else {
 		controlPlaneGroupName := withInfraIDPrefix(ac.controlPlaneSGSuffix)
 
-		controlPlaneGroupID, err = ac.getSecurityGroupName(vpcID, controlPlaneGroupName)
+		controlPlaneGroupID, err = ac.getSecurityGroupName(ctx, vpcID, controlPlaneGroupName)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = ac.createClusterSGRule(workerGroupID, workerGroupID, port, protocol, internalTraffic+" between the workers")
+	err = ac.createClusterSGRule(ctx, workerGroupID, workerGroupID, ports, internalTraffic+" between the workers")
 	if err != nil {
 		return err
 	}
 
-	err = ac.createClusterSGRule(workerGroupID, controlPlaneGroupID, port, protocol,
+	err = ac.createClusterSGRule(ctx, workerGroupID, controlPlaneGroupID, ports,
 		internalTraffic+" from worker to control plane nodes")
 	if err != nil {
 		return err
 	}
 
-	return ac.createClusterSGRule(controlPlaneGroupID, workerGroupID, port, protocol,
+	return ac.createClusterSGRule(ctx, controlPlaneGroupID, workerGroupID, ports,
 		internalTraffic+" from control plane to worker nodes")
 }
 
-func (ac *awsCloud) createPublicSGRule(groupID *string, port uint16, protocol, description string) error {
-	ipPermissions := []types.IpPermission{
-		{
-			FromPort:   ptr.To(int32(port)),
-			ToPort:     ptr.To(int32(port)),
-			IpProtocol: ptr.To(protocol),
+func (ac *awsCloud) createPublicSGRules(ctx context.Context, groupID *string, ports []api.PortSpec, sourceCIDR, description string) error {
+	ipPermissions := make([]types.IpPermission, 0, len(ports))
+
+	for _, port := range ports {
+		ipPermissions = append(ipPermissions, types.IpPermission{
+			FromPort:   ptr.To(int32(port.Port)),
+			ToPort:     ptr.To(int32(port.LastPort())),
+			IpProtocol: ptr.To(api.IPProtocol(port.Protocol)),
 			IpRanges: []types.IpRange{
 				{
-					CidrIp:      ptr.To("0.0.0.0/0"),
+					CidrIp:      ptr.To(sourceCIDR),
 					Description: ptr.To(description),
 				},
 			},
-		},
+		})
 	}
 
-	return ac.authorizeSecurityGroupIngress(groupID, ipPermissions)
+	return ac.authorizeSecurityGroupIngress(ctx, groupID, ipPermissions)
 }
 
-func (ac *awsCloud) createGatewaySG(vpcID string, ports []api.PortSpec) (string, error) {
+func (ac *awsCloud) createGatewaySG(ctx context.Context, vpcID string, ports []api.PortSpec, sourceCIDR string) (string, error) {
 	groupName := ac.withAWSInfo(withInfraIDPrefix("-submariner-gw-sg"))
 
-	gatewayGroupID, err := ac.getSecurityGroupName(vpcID, groupName)
+	gatewayGroupID, err := ac.getSecurityGroupName(ctx, vpcID, groupName)
 	if err != nil {
 		if !isNotFoundError(err) {
 			return "", err
@@ -200,7 +217,7 @@ func (ac *awsCloud) createGatewaySG(vpcID string, ports []api.PortSpec) (string,
 			},
 		}
 
-		result, err := ac.client.CreateSecurityGroup(context.TODO(), input)
+		result, err := ac.client.CreateSecurityGroup(ctx, input)
 
 		if err != nil && !isAWSError(err, "InvalidGroup.Duplicate") {
 			return "", errors.Wrap(err, "error creating AWS security group")
@@ -209,8 +226,8 @@ func (ac *awsCloud) createGatewaySG(vpcID string, ports []api.PortSpec) (string,
 		gatewayGroupID = result.GroupId
 	}
 
-	for _, port := range ports {
-		err = ac.createPublicSGRule(gatewayGroupID, port.Port, port.Protocol, "Public Submariner traffic")
+	if len(ports) > 0 {
+		err = ac.createPublicSGRules(ctx, gatewayGroupID, ports, sourceCIDR, "Public Submariner traffic")
 		if err != nil {
 			return "", err
 		}
@@ -223,10 +240,10 @@ func gatewayDeletionRetriable(err error) bool {
 	return isAWSError(err, "DependencyViolation")
 }
 
-func (ac *awsCloud) deleteGatewaySG(vpcID string) error {
+func (ac *awsCloud) deleteGatewaySG(ctx context.Context, vpcID string) error {
 	groupName := ac.withAWSInfo(withInfraIDPrefix("-submariner-gw-sg"))
 
-	gatewayGroupID, err := ac.getSecurityGroupName(vpcID, groupName)
+	gatewayGroupID, err := ac.getSecurityGroupName(ctx, vpcID, groupName)
 	if err != nil {
 		if isNotFoundError(err) {
 			return nil
@@ -243,7 +260,7 @@ func (ac *awsCloud) deleteGatewaySG(vpcID string) error {
 	}
 
 	err = retry.OnError(backoff, gatewayDeletionRetriable, func() error {
-		_, err = ac.client.DeleteSecurityGroup(context.TODO(), &ec2.DeleteSecurityGroupInput{
+		_, err = ac.client.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{
 			GroupId: gatewayGroupID,
 		})
 
@@ -257,13 +274,13 @@ func (ac *awsCloud) deleteGatewaySG(vpcID string) error {
 	return errors.Wrap(err, "error deleting AWS security group")
 }
 
-func (ac *awsCloud) revokePortsInCluster(vpcID string) error {
+func (ac *awsCloud) revokePortsInCluster(ctx context.Context, vpcID string) error {
 	var workerGroup, controlPlaneGroup types.SecurityGroup
 	var err error
 
 	if id, exists := ac.cloudConfig[WorkerSecurityGroupIDKey]; exists {
 		if workerGroupIDStr, ok := id.(string); ok && workerGroupIDStr != "" {
-			workerGroup, err = ac.getSecurityGroupByID(workerGroupIDStr)
+			workerGroup, err = ac.getSecurityGroupByID(ctx, workerGroupIDStr)
 			if err != nil {
 				return errors.Wrap(err, "unable to get Worker Security Group by ID")
 			}
@@ -273,7 +290,7 @@ func (ac *awsCloud) revokePortsInCluster(vpcID string) error {
 	} else {
 		workerGroupName := withInfraIDPrefix(ac.nodeSGSuffix)
 
-		workerGroup, err = ac.getSecurityGroup(vpcID, workerGroupName)
+		workerGroup, err = ac.getSecurityGroup(ctx, vpcID, workerGroupName)
 		if err != nil {
 			return err
 		}
@@ -281,7 +298,7 @@ func (ac *awsCloud) revokePortsInCluster(vpcID string) error {
 
 	if id, exists := ac.cloudConfig[ControlPlaneSecurityGroupIDKey]; exists {
 		if controlPlaneGroupIDStr, ok := id.(string); ok && controlPlaneGroupIDStr != "" {
-			controlPlaneGroup, err = ac.getSecurityGroupByID(controlPlaneGroupIDStr)
+			controlPlaneGroup, err = ac.getSecurityGroupByID(ctx, controlPlaneGroupIDStr)
 			if err != nil {
 				return errors.Wrap(err, "unable to get Control Plane Security Group by ID")
 			}
@@ -291,21 +308,21 @@ func (ac *awsCloud) revokePortsInCluster(vpcID string) error {
 	} else {
 		controlPlaneGroupName := withInfraIDPrefix(ac.controlPlaneSGSuffix)
 
-		controlPlaneGroup, err = ac.getSecurityGroup(vpcID, controlPlaneGroupName)
+		controlPlaneGroup, err = ac.getSecurityGroup(ctx, vpcID, controlPlaneGroupName)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = ac.revokePortsFromGroup(&workerGroup)
+	err = ac.revokePortsFromGroup(ctx, &workerGroup)
 	if err != nil {
 		return err
 	}
 
-	return ac.revokePortsFromGroup(&controlPlaneGroup)
+	return ac.revokePortsFromGroup(ctx, &controlPlaneGroup)
 }
 
-func (ac *awsCloud) revokePortsFromGroup(group *types.SecurityGroup) error {
+func (ac *awsCloud) revokePortsFromGroup(ctx context.Context, group *types.SecurityGroup) error {
 	var permissionsToRevoke []types.IpPermission
 
 	for perm := range group.IpPermissions {
@@ -327,7 +344,7 @@ func (ac *awsCloud) revokePortsFromGroup(group *types.SecurityGroup) error {
 		IpPermissions: permissionsToRevoke,
 	}
 
-	_, err := ac.client.RevokeSecurityGroupIngress(context.TODO(), input)
+	_, err := ac.client.RevokeSecurityGroupIngress(ctx, input)
 
 	return errors.Wrap(err, "error revoking AWS security group ingress")
 }
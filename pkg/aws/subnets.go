@@ -29,8 +29,16 @@ import (
 var (
 	tagSubmarinerGateway = ec2Tag("submariner.io/gateway", "")
 	tagInternalELB       = ec2Tag("kubernetes.io/role/internal-elb", "")
+	// tagClusterTagAdded marks the subnets to which Submariner added the cluster tag, so that it only removes it from those.
+	tagClusterTagAdded = ec2Tag("submariner.io/cluster-tag-added", "")
 )
 
+// clusterTag returns the tag identifying the subnets used by the cluster, which the AWS cloud controller requires on the
+// subnets of the service load balancers. Submariner adds it as "shared" since it doesn't own the subnets.
+func (ac *awsCloud) clusterTag() types.Tag {
+	return ec2Tag(ac.withAWSInfo("kubernetes.io/cluster/{infraID}"), "shared")
+}
+
 func filterSubnets(subnets []types.Subnet, filterFunc func(subnet *types.Subnet) (bool, error)) ([]types.Subnet, error) {
 	var filteredSubnets []types.Subnet
 
@@ -54,7 +62,7 @@ func subnetTagged(subnet *types.Subnet) bool {
 	return hasTag(subnet.Tags, tagSubmarinerGateway)
 }
 
-func (ac *awsCloud) findPublicSubnets(vpcID string, filter types.Filter) ([]types.Subnet, error) {
+func (ac *awsCloud) findPublicSubnets(ctx context.Context, vpcID string, filter types.Filter) ([]types.Subnet, error) {
 	ownedFilters := ac.filterByCurrentCluster()
 	var err error
 	var result *ec2.DescribeSubnetsOutput
@@ -66,7 +74,7 @@ func (ac *awsCloud) findPublicSubnets(vpcID string, filter types.Filter) ([]type
 			filter,
 		}
 
-		result, err = ac.client.DescribeSubnets(context.TODO(), &ec2.DescribeSubnetsInput{Filters: filters})
+		result, err = ac.client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{Filters: filters})
 		if err != nil {
 			return nil, errors.Wrap(err, "error describing AWS subnets")
 		}
@@ -79,9 +87,10 @@ func (ac *awsCloud) findPublicSubnets(vpcID string, filter types.Filter) ([]type
 	return result.Subnets, nil
 }
 
-func (ac *awsCloud) getSubnetsSupportingInstanceType(subnets []types.Subnet, instanceType string) ([]types.Subnet, error) {
+func (ac *awsCloud) getSubnetsSupportingInstanceType(ctx context.Context, subnets []types.Subnet, instanceType string,
+) ([]types.Subnet, error) {
 	return filterSubnets(subnets, func(subnet *types.Subnet) (bool, error) {
-		output, err := ac.client.DescribeInstanceTypeOfferings(context.TODO(), &ec2.DescribeInstanceTypeOfferingsInput{
+		output, err := ac.client.DescribeInstanceTypeOfferings(ctx, &ec2.DescribeInstanceTypeOfferingsInput{
 			LocationType: types.LocationTypeAvailabilityZone,
 			Filters: []types.Filter{
 				ec2Filter("location", *subnet.AvailabilityZone),
@@ -96,36 +105,52 @@ func (ac *awsCloud) getSubnetsSupportingInstanceType(subnets []types.Subnet, ins
 	})
 }
 
-func (ac *awsCloud) getTaggedPublicSubnets(vpcID string) ([]types.Subnet, error) {
-	return ac.findPublicSubnets(vpcID, ec2FilterByTag(tagSubmarinerGateway))
+func (ac *awsCloud) getTaggedPublicSubnets(ctx context.Context, vpcID string) ([]types.Subnet, error) {
+	return ac.findPublicSubnets(ctx, vpcID, ec2FilterByTag(tagSubmarinerGateway))
 }
 
-func (ac *awsCloud) tagPublicSubnet(subnetID *string) error {
-	_, err := ac.client.CreateTags(context.TODO(), &ec2.CreateTagsInput{
-		Resources: []string{*subnetID},
-		Tags: []types.Tag{
-			tagInternalELB,
-			tagSubmarinerGateway,
-		},
+// tagPublicSubnet tags the given subnet as a Submariner gateway subnet, adding the cluster tag if it's missing, e.g. on
+// subnets identified by the cluster API tag or supplied explicitly.
+func (ac *awsCloud) tagPublicSubnet(ctx context.Context, subnet *types.Subnet) error {
+	tags := []types.Tag{
+		tagInternalELB,
+		tagSubmarinerGateway,
+	}
+
+	if !hasTag(subnet.Tags, ac.clusterTag()) {
+		tags = append(tags, ac.clusterTag(), tagClusterTagAdded)
+	}
+
+	_, err := ac.client.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{*subnet.SubnetId},
+		Tags:      tags,
 	})
 
 	return errors.Wrap(err, "error creating AWS tag")
 }
 
-func (ac *awsCloud) untagPublicSubnet(subnetID *string) error {
-	_, err := ac.client.DeleteTags(context.TODO(), &ec2.DeleteTagsInput{
-		Resources: []string{*subnetID},
-		Tags: []types.Tag{
-			tagInternalELB,
-			tagSubmarinerGateway,
-		},
+// untagPublicSubnet removes the Submariner gateway tags from the given subnet, along with the cluster tag only if
+// Submariner added it.
+func (ac *awsCloud) untagPublicSubnet(ctx context.Context, subnet *types.Subnet) error {
+	tags := []types.Tag{
+		tagInternalELB,
+		tagSubmarinerGateway,
+	}
+
+	if hasTag(subnet.Tags, tagClusterTagAdded) {
+		tags = append(tags, ac.clusterTag(), tagClusterTagAdded)
+	}
+
+	_, err := ac.client.DeleteTags(ctx, &ec2.DeleteTagsInput{
+		Resources: []string{*subnet.SubnetId},
+		Tags:      tags,
 	})
 
 	return errors.Wrap(err, "error deleting AWS tag")
 }
 
-func (ac *awsCloud) getSubnetByID(subnetID string) (*types.Subnet, error) {
-	output, err := ac.client.DescribeSubnets(context.TODO(), &ec2.DescribeSubnetsInput{
+func (ac *awsCloud) getSubnetByID(ctx context.Context, subnetID string) (*types.Subnet, error) {
+	output, err := ac.client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{
 		SubnetIds: []string{subnetID},
 	})
 	if err != nil {
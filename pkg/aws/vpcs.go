@@ -26,7 +26,7 @@ import (
 	"github.com/pkg/errors"
 )
 
-func (ac *awsCloud) getVpcID() (string, error) {
+func (ac *awsCloud) getVpcID(ctx context.Context) (string, error) {
 	var err error
 	var result *ec2.DescribeVpcsOutput
 
@@ -48,7 +48,7 @@ func (ac *awsCloud) getVpcID() (string, error) {
 			ownedFilters[i],
 		}
 
-		result, err = ac.client.DescribeVpcs(context.TODO(), &ec2.DescribeVpcsInput{Filters: filters})
+		result, err = ac.client.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{Filters: filters})
 		if err != nil {
 			return "", errors.Wrap(err, "error describing AWS VPCs")
 		}
@@ -64,3 +64,16 @@ func (ac *awsCloud) getVpcID() (string, error) {
 
 	return *result.Vpcs[0].VpcId, nil
 }
+
+func (ac *awsCloud) getVpcCIDR(ctx context.Context, vpcID string) (string, error) {
+	result, err := ac.client.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{VpcIds: []string{vpcID}})
+	if err != nil {
+		return "", errors.Wrapf(err, "error describing AWS VPC %s", vpcID)
+	}
+
+	if len(result.Vpcs) == 0 || result.Vpcs[0].CidrBlock == nil {
+		return "", newNotFoundError("CIDR of VPC %s", vpcID)
+	}
+
+	return *result.Vpcs[0].CidrBlock, nil
+}
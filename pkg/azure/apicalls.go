@@ -0,0 +1,116 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/pkg/errors"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+)
+
+// metricsBackend is the backend under which the Azure API requests are reported to CloudInfo.Metrics.
+const metricsBackend = "azure"
+
+// apiCallCounter counts the Azure API requests sent during an operation, including retries and polling, distinguishing
+// reads from writes.
+type apiCallCounter struct {
+	reads  atomic.Int64
+	writes atomic.Int64
+}
+
+type apiCallCounterKey struct{}
+
+func (a *apiCallCounter) count(method string) {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		a.reads.Add(1)
+	default:
+		a.writes.Add(1)
+	}
+}
+
+func (a *apiCallCounter) String() string {
+	return fmt.Sprintf("%d API reads, %d API writes", a.reads.Load(), a.writes.Load())
+}
+
+// countAPICalls returns a context under which the Azure API calls made are counted by the returned counter, so that
+// concurrent operations each count their own calls.
+func countAPICalls(ctx context.Context) (context.Context, *apiCallCounter) {
+	apiCalls := &apiCallCounter{}
+
+	return context.WithValue(ctx, apiCallCounterKey{}, apiCalls), apiCalls
+}
+
+// apiCallCounting is a pipeline policy which counts the Azure API requests sent with the counter of their context, if
+// any.
+type apiCallCounting struct{}
+
+func (apiCallCounting) Do(req *policy.Request) (*http.Response, error) {
+	if apiCalls, ok := req.Raw().Context().Value(apiCallCounterKey{}).(*apiCallCounter); ok {
+		apiCalls.count(req.Raw().Method)
+	}
+
+	return req.Next() //nolint:wrapcheck // Let the caller wrap it.
+}
+
+// metricsPolicy is a pipeline policy which reports the duration and outcome of each Azure API request to the metrics.
+type metricsPolicy struct {
+	metrics api.Metrics
+}
+
+func (m metricsPolicy) Do(req *policy.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := req.Next()
+
+	observedErr := err
+	if err == nil && resp.StatusCode >= http.StatusBadRequest {
+		observedErr = errors.Errorf("the request failed with status %d", resp.StatusCode)
+	}
+
+	m.metrics.ObserveOperation(metricsBackend, req.Raw().Method+" "+resourceType(req.Raw().URL.Path), time.Since(start),
+		observedErr)
+
+	return resp, err //nolint:wrapcheck // Let the caller wrap it.
+}
+
+// resourceType returns the type of the resource at the given Azure Resource Manager path, without the provider namespace,
+// e.g. "networkSecurityGroups" or "virtualNetworks/subnets".
+func resourceType(path string) string {
+	_, resourcePath, ok := strings.Cut(path, "/providers/")
+	if !ok {
+		return path
+	}
+
+	// The provider namespace is followed by alternating resource types and names.
+	segments := strings.Split(resourcePath, "/")
+	types := []string{}
+
+	for i := 1; i < len(segments); i += 2 {
+		types = append(types, segments[i])
+	}
+
+	return strings.Join(types, "/")
+}
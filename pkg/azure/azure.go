@@ -19,54 +19,176 @@ limitations under the License.
 package azure
 
 import (
-	"fmt"
+	"context"
+	"io"
 	"strings"
+	"sync"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/pkg/errors"
 	reporterInterface "github.com/submariner-io/admiral/pkg/reporter"
 	"github.com/submariner-io/cloud-prepare/pkg/api"
+	"github.com/submariner-io/cloud-prepare/pkg/k8s"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 type azureCloud struct {
 	CloudInfo
+	closeOnce sync.Once
 }
 
+var _ io.Closer = &azureCloud{}
+
 // NewCloud creates a new api.Cloud instance which can prepare Azure for Submariner to be deployed on it.
+// The returned instance also implements io.Closer to release the connections of its HTTP transport.
 func NewCloud(info *CloudInfo) api.Cloud {
-	return &azureCloud{
+	info.initPolicies()
+
+	az := &azureCloud{
 		CloudInfo: *info,
 	}
+
+	if az.ClientOptions == nil || az.ClientOptions.Transport == nil {
+		options := &arm.ClientOptions{}
+		if az.ClientOptions != nil {
+			*options = *az.ClientOptions
+		}
+
+		options.Transport = newHTTPClient()
+		az.ClientOptions = options
+	}
+
+	return az
 }
 
-func (az *azureCloud) OpenPorts(ports []api.PortSpec, reporter reporterInterface.Interface) error {
+// Close closes the idle connections of the HTTP transport. It's safe to call more than once.
+func (az *azureCloud) Close() error {
+	az.closeOnce.Do(func() {
+		if closer, ok := az.ClientOptions.Transport.(interface{ CloseIdleConnections() }); ok {
+			closer.CloseIdleConnections()
+		}
+	})
+
+	return nil
+}
+
+func (az *azureCloud) OpenPorts(ctx context.Context, ports []api.PortSpec, reporter reporterInterface.Interface) error {
+	ports, err := api.NormalizePorts(ports)
+	if err != nil {
+		return errors.Wrap(err, "invalid ports")
+	}
+
+	api.SetTotalSteps(reporter, 1)
+
+	reporter = withRemediationHints(reporter)
+
 	reporter.Start("Opening internal ports for intra-cluster communications on Azure")
 
+	ctx, apiCalls := countAPICalls(ctx)
+	ctx = az.cacheReads(ctx)
+
+	if err := az.validate(); err != nil {
+		return reporter.Error(err, "Invalid Azure configuration")
+	}
+
+	if err := k8s.CheckReachable(az.K8sClient); err != nil {
+		return reporter.Error(err, "Invalid cluster configuration")
+	}
+
+	if err := az.validateRegion(ctx, reporter); err != nil {
+		return reporter.Error(err, "Invalid Azure region")
+	}
+
 	nsgClient, err := az.getNsgClient()
 	if err != nil {
 		return reporter.Error(err, "Failed to get network security groups client")
 	}
 
-	if err := az.openInternalPorts(az.InfraID, ports, nsgClient); err != nil {
+	subnetClient, err := az.getSubnetsClient()
+	if err != nil {
+		return reporter.Error(err, "Failed to get subnets client")
+	}
+
+	skippedSubnets, err := az.openInternalPorts(ctx, az.InfraID, ports, nsgClient, subnetClient, reporter)
+	if err != nil {
 		return reporter.Error(err, "Failed to open internal ports")
 	}
 
-	reporter.Success("Opened internal ports %q for intra-cluster communications on Azure", formatPorts(ports))
+	if len(skippedSubnets) > 0 {
+		reporter.Warning("The security group wasn't associated with some subnets: %s", formatSkippedSubnets(skippedSubnets))
+	}
+
+	if az.DryRun {
+		reporter.Success("Previewed opening internal ports %q for intra-cluster communications on Azure, without changing anything (%s)",
+			formatPorts(ports), apiCalls)
+
+		return nil
+	}
+
+	if err := az.recordState(map[string]string{
+		StateInternalSecurityGroupKey: az.InfraID + internalSecurityGroupSuffix,
+		StateInternalPortsKey:         formatPorts(ports),
+		StateSkippedSubnetsKey:        formatSkippedSubnets(skippedSubnets),
+	}); err != nil {
+		return reporter.Error(err, "Failed to record the prepared state")
+	}
+
+	if err := az.recordLastPrepared(ctx, nsgClient); err != nil {
+		return reporter.Error(err, "Failed to record the prepare time")
+	}
+
+	reporter.Success("Opened internal ports %q for intra-cluster communications on Azure (%s)", formatPorts(ports), apiCalls)
 
 	return nil
 }
 
-func (az *azureCloud) ClosePorts(reporter reporterInterface.Interface) error {
+func (az *azureCloud) ClosePorts(ctx context.Context, reporter reporterInterface.Interface) error {
+	api.SetTotalSteps(reporter, 1)
+
+	reporter = withRemediationHints(reporter)
+
 	reporter.Start("Revoking intra-cluster communication permissions")
 
+	ctx, apiCalls := countAPICalls(ctx)
+	ctx = az.cacheReads(ctx)
+
 	nsgClient, err := az.getNsgClient()
 	if err != nil {
 		return reporter.Error(err, "Failed to get network security groups client")
 	}
 
-	if err := az.removeInternalFirewallRules(az.InfraID, nsgClient); err != nil {
+	if err := az.removeInternalFirewallRules(ctx, az.InfraID, nsgClient, reporter); err != nil {
 		return reporter.Error(err, "Failed to revoke intra-cluster communication permissions")
 	}
 
-	reporter.Success("Revoked intra-cluster communication permissions")
+	if az.DryRun {
+		reporter.Success("Previewed revoking intra-cluster communication permissions, without changing anything (%s)", apiCalls)
+		return nil
+	}
+
+	reporter.Success("Revoked intra-cluster communication permissions (%s)", apiCalls)
+
+	return nil
+}
+
+func (az *azureCloud) Validate(ctx context.Context, reporter reporterInterface.Interface) error {
+	api.SetTotalSteps(reporter, 1)
+
+	reporter = withRemediationHints(reporter)
+
+	reporter.Start("Validating the Azure prerequisites")
+
+	ctx, apiCalls := countAPICalls(ctx)
+	ctx = az.cacheReads(ctx)
+
+	ctx, cancel := az.opContext(ctx)
+	defer cancel()
+
+	if err := utilerrors.NewAggregate(az.checkPrerequisites(ctx, az.InfraID, reporter)); err != nil {
+		return reporter.Error(err, "The Azure prerequisites aren't met")
+	}
+
+	reporter.Success("Validated the Azure prerequisites (%s)", apiCalls)
 
 	return nil
 }
@@ -74,7 +196,11 @@ func (az *azureCloud) ClosePorts(reporter reporterInterface.Interface) error {
 func formatPorts(ports []api.PortSpec) string {
 	portStrs := []string{}
 	for _, port := range ports {
-		portStrs = append(portStrs, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+		if hasDestinationPorts(port.Protocol) {
+			portStrs = append(portStrs, port.String())
+		} else {
+			portStrs = append(portStrs, port.Protocol)
+		}
 	}
 
 	return strings.Join(portStrs, ", ")
@@ -0,0 +1,1472 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+	"github.com/submariner-io/cloud-prepare/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Cloud", func() {
+	Describe("OpenPorts", testOpenPorts)
+	Describe("Close", testClose)
+	Describe("Rule owners", testRuleOwners)
+	Describe("Validate", testValidate)
+})
+
+func testClose() {
+	It("should close the idle connections once", func() {
+		fake := newFakeARM()
+		cloud := NewCloud(newTestCloudInfo(fake))
+
+		closer, ok := cloud.(io.Closer)
+		Expect(ok).To(BeTrue())
+
+		Expect(closer.Close()).To(Succeed())
+		Expect(closer.Close()).To(Succeed())
+		Expect(fake.closed).To(Equal(1))
+	})
+
+	It("should use a dedicated transport by default", func() {
+		cloud := NewCloud(&CloudInfo{}).(*azureCloud)
+		Expect(cloud.ClientOptions.Transport).ToNot(BeNil())
+		Expect(cloud.Close()).To(Succeed())
+	})
+}
+
+func testOpenPorts() {
+	var (
+		fake      *fakeARM
+		info      *CloudInfo
+		successes *successRecorder
+		tracker   *reporter.Tracker
+		cloud     *azureCloud
+		ctx       context.Context
+		ports     []api.PortSpec
+		retErr    error
+	)
+
+	BeforeEach(func() {
+		fake = newFakeARM()
+		info = newTestCloudInfo(fake)
+		info.AssociateSubnets = true
+		successes = &successRecorder{Interface: reporter.Stdout()}
+		tracker = reporter.NewTracker(successes)
+		ctx = context.TODO()
+		ports = []api.PortSpec{{Port: 4800, Protocol: "Udp"}, {Port: 8080, Protocol: "Tcp"}}
+
+		fake.put(nsgPath(info.InfraID+internalSecurityGroupSuffix), &armnetwork.SecurityGroup{
+			Properties: &armnetwork.SecurityGroupPropertiesFormat{},
+		})
+
+		for _, subnetName := range info.clusterSubnetNames(info.InfraID) {
+			fake.put(subnetPath(info.InfraID+vnetSuffix, subnetName), &armnetwork.Subnet{
+				Properties: &armnetwork.SubnetPropertiesFormat{},
+			})
+		}
+	})
+
+	JustBeforeEach(func() {
+		cloud = NewCloud(info).(*azureCloud)
+		retErr = cloud.OpenPorts(ctx, ports, tracker)
+	})
+
+	getSecurityGroup := func() *armnetwork.SecurityGroup {
+		nsg := &armnetwork.SecurityGroup{}
+		Expect(fake.get(nsgPath(info.InfraID+internalSecurityGroupSuffix), nsg)).To(BeTrue())
+
+		return nsg
+	}
+
+	getSubnet := func(name string) *armnetwork.Subnet {
+		subnet := &armnetwork.Subnet{}
+		Expect(fake.get(subnetPath(info.InfraID+vnetSuffix, name), subnet)).To(BeTrue())
+
+		return subnet
+	}
+
+	It("should add the Submariner rules to the security group", func() {
+		Expect(retErr).To(Succeed())
+		Expect(getSecurityGroup().Properties.SecurityRules).To(HaveLen(4))
+	})
+
+	When("an unsupported protocol is requested", func() {
+		BeforeEach(func() {
+			ports = append(ports, api.PortSpec{Port: 9000, Protocol: "sctp"})
+		})
+
+		It("should fail without calling Azure", func() {
+			Expect(retErr).To(MatchError(ContainSubstring(`unsupported protocol "sctp"`)))
+			Expect(fake.requestCountByMethod(http.MethodGet)).To(BeZero())
+			Expect(fake.requestCountByMethod(http.MethodPut)).To(BeZero())
+		})
+	})
+
+	When("the context is cancelled", func() {
+		BeforeEach(func() {
+			var cancel context.CancelFunc
+
+			ctx, cancel = context.WithCancel(context.Background())
+			cancel()
+		})
+
+		It("should abort without updating the security group", func() {
+			Expect(retErr).To(MatchError(context.Canceled))
+			Expect(getSecurityGroup().Properties.SecurityRules).To(BeEmpty())
+		})
+
+		It("should abort the region lookup", func() {
+			Expect(retErr).To(MatchError(ContainSubstring("error listing the locations")))
+		})
+	})
+
+	When("the security group has rules for outdated ports", func() {
+		BeforeEach(func() {
+			newRule := func(name string, priority int32) *armnetwork.SecurityRule {
+				return &armnetwork.SecurityRule{
+					Name:       ptr.To(name),
+					Properties: &armnetwork.SecurityRulePropertiesFormat{Priority: ptr.To(priority)},
+				}
+			}
+
+			fake.put(nsgPath(info.InfraID+internalSecurityGroupSuffix), &armnetwork.SecurityGroup{
+				Properties: &armnetwork.SecurityGroupPropertiesFormat{
+					SecurityRules: []*armnetwork.SecurityRule{
+						newRule(internalSecurityRulePrefix+"Udp-4800-Inbound", basePriorityInternal),
+						newRule(internalSecurityRulePrefix+"Udp-4800-Outbound", basePriorityInternal),
+						newRule(internalSecurityRulePrefix+"Udp-4900-Inbound", basePriorityInternal+1),
+						newRule(internalSecurityRulePrefix+"Udp-4900-Outbound", basePriorityInternal+1),
+						newRule("custom-rule", basePriorityInternal+2),
+					},
+				},
+			})
+		})
+
+		It("should reconcile the Submariner rules with the requested ports", func() {
+			Expect(retErr).To(Succeed())
+
+			priorities := map[string]int32{}
+			for _, rule := range getSecurityGroup().Properties.SecurityRules {
+				priorities[*rule.Name] = *rule.Properties.Priority
+			}
+
+			Expect(priorities).To(Equal(map[string]int32{
+				internalSecurityRulePrefix + "Udp-4800-Inbound":  basePriorityInternal,
+				internalSecurityRulePrefix + "Udp-4800-Outbound": basePriorityInternal,
+				internalSecurityRulePrefix + "Tcp-8080-Inbound":  basePriorityInternal + 1,
+				internalSecurityRulePrefix + "Tcp-8080-Outbound": basePriorityInternal + 1,
+				"custom-rule": basePriorityInternal + 2,
+			}))
+		})
+	})
+
+	When("the cluster is dual-stack", func() {
+		BeforeEach(func() {
+			info.IPFamilies = []string{ipFamilyIPv4, ipFamilyIPv6}
+		})
+
+		It("should add IPv4 and IPv6 rules for each port", func() {
+			Expect(retErr).To(Succeed())
+
+			rules := getSecurityGroup().Properties.SecurityRules
+			Expect(rules).To(HaveLen(8))
+
+			ipv6Rules := 0
+
+			for _, rule := range rules {
+				destination := allNetworkCIDR
+				if strings.HasPrefix(*rule.Name, internalSecurityRulePrefix+ipv6RuleMarker) {
+					destination = allIPv6NetworkCIDR
+					ipv6Rules++
+				}
+
+				Expect(*rule.Properties.SourceAddressPrefix).To(Equal(destination))
+				Expect(*rule.Properties.DestinationAddressPrefix).To(Equal(destination))
+			}
+
+			Expect(ipv6Rules).To(Equal(4))
+			Expect(validateSecurityRules(rules)).To(Succeed())
+		})
+	})
+
+	When("unscoped sources are denied", func() {
+		BeforeEach(func() {
+			info.DenyUnscopedSources = true
+		})
+
+		It("should add deny rules with a lower precedence than the allow rules", func() {
+			Expect(retErr).To(Succeed())
+
+			denyRules := map[string]int32{}
+			maxAllowPriority := int32(0)
+
+			for _, rule := range getSecurityGroup().Properties.SecurityRules {
+				if !isDenySecurityRule(rule) {
+					Expect(*rule.Properties.Access).To(Equal(armnetwork.SecurityRuleAccessAllow))
+					maxAllowPriority = max(maxAllowPriority, *rule.Properties.Priority)
+
+					continue
+				}
+
+				Expect(*rule.Properties.Access).To(Equal(armnetwork.SecurityRuleAccessDeny))
+				Expect(*rule.Properties.Direction).To(Equal(armnetwork.SecurityRuleDirectionInbound))
+				Expect(*rule.Properties.SourceAddressPrefix).To(Equal("*"))
+				denyRules[*rule.Name] = *rule.Properties.Priority
+			}
+
+			Expect(denyRules).To(Equal(map[string]int32{
+				denySecurityRulePrefix + "Tcp-8080-Inbound": basePriorityDeny,
+				denySecurityRulePrefix + "Udp-4800-Inbound": basePriorityDeny + 1,
+			}))
+			Expect(maxAllowPriority).To(BeNumerically("<", basePriorityDeny))
+		})
+
+		It("should not allow them when the staged rules are activated", func() {
+			Expect(info.ActivateSecurityRules(ctx, reporter.Stdout())).To(Succeed())
+
+			for _, rule := range getSecurityGroup().Properties.SecurityRules {
+				if isDenySecurityRule(rule) {
+					Expect(*rule.Properties.Access).To(Equal(armnetwork.SecurityRuleAccessDeny))
+				}
+			}
+		})
+
+		It("should remove the deny rules once they're no longer requested", func() {
+			info.DenyUnscopedSources = false
+			Expect(NewCloud(info).OpenPorts(ctx, ports, tracker)).To(Succeed())
+			Expect(getSecurityGroup().Properties.SecurityRules).ToNot(ContainElement(Satisfy(isDenySecurityRule)))
+			Expect(getSecurityGroup().Properties.SecurityRules).To(HaveLen(4))
+		})
+	})
+
+	When("an invalid IP family is configured", func() {
+		BeforeEach(func() {
+			info.IPFamilies = []string{"IPv5"}
+		})
+
+		It("should return an error", func() {
+			Expect(retErr).To(MatchError(ContainSubstring(`IP family "IPv5"`)))
+		})
+	})
+
+	When("the security group already has the requested rules", func() {
+		JustBeforeEach(func() {
+			Expect(retErr).To(Succeed())
+
+			writes := fake.requestCount(http.MethodPut, nsgPath(info.InfraID+internalSecurityGroupSuffix))
+			retErr = cloud.OpenPorts(ctx, ports, tracker)
+
+			Expect(fake.requestCount(http.MethodPut, nsgPath(info.InfraID+internalSecurityGroupSuffix))).To(Equal(writes))
+		})
+
+		It("should not update the security group", func() {
+			Expect(retErr).To(Succeed())
+			Expect(getSecurityGroup().Properties.SecurityRules).To(HaveLen(4))
+		})
+	})
+
+	When("the security group's rules differ from the requested rules", func() {
+		var priorities map[string]int32
+
+		JustBeforeEach(func() {
+			Expect(retErr).To(Succeed())
+
+			nsg := getSecurityGroup()
+			priorities = map[string]int32{}
+
+			for _, rule := range nsg.Properties.SecurityRules {
+				priorities[*rule.Name] = *rule.Properties.Priority
+
+				switch *rule.Name {
+				case internalSecurityRulePrefix + "Udp-4800-Inbound":
+					rule.Properties.SourceAddressPrefix = ptr.To("10.9.0.0/16")
+				case internalSecurityRulePrefix + "Udp-4800-Outbound":
+					rule.Properties.Access = ptr.To(armnetwork.SecurityRuleAccessDeny)
+				case internalSecurityRulePrefix + "Tcp-8080-Inbound":
+					rule.Properties.DestinationPortRange = ptr.To("8081")
+				case internalSecurityRulePrefix + "Tcp-8080-Outbound":
+					rule.Properties.Protocol = ptr.To(armnetwork.SecurityRuleProtocolAsterisk)
+				}
+			}
+
+			fake.put(nsgPath(info.InfraID+internalSecurityGroupSuffix), nsg)
+
+			retErr = cloud.OpenPorts(ctx, ports, tracker)
+		})
+
+		It("should rewrite them with their existing priorities", func() {
+			Expect(retErr).To(Succeed())
+
+			rules := getSecurityGroup().Properties.SecurityRules
+			Expect(rules).To(HaveLen(4))
+
+			for _, rule := range rules {
+				Expect(*rule.Properties.Priority).To(Equal(priorities[*rule.Name]))
+				Expect(*rule.Properties.SourceAddressPrefix).To(Equal(allNetworkCIDR))
+				Expect(*rule.Properties.Access).To(Equal(armnetwork.SecurityRuleAccessAllow))
+				Expect(*rule.Name).To(ContainSubstring(string(*rule.Properties.Protocol) + "-" +
+					strings.Split(*rule.Properties.DestinationPortRange, "-")[0]))
+			}
+		})
+	})
+
+	It("should count the API calls made", func() {
+		Expect(retErr).To(Succeed())
+		Expect(successes.messages).To(ConsistOf(ContainSubstring(fmt.Sprintf("(%d API reads, %d API writes)",
+			fake.requestCountByMethod(http.MethodGet), 4))))
+		Expect(fake.requestCountByMethod(http.MethodPut) + fake.requestCountByMethod(http.MethodPatch)).To(Equal(4))
+	})
+
+	It("should count the API calls of concurrent operations separately", func() {
+		Expect(retErr).To(Succeed())
+
+		cloud.CacheReads = true
+		getsBefore := fake.requestCountByMethod(http.MethodGet)
+		recorders := []*successRecorder{{Interface: reporter.Stdout()}, {Interface: reporter.Stdout()}}
+
+		var wg sync.WaitGroup
+
+		for _, recorder := range recorders {
+			wg.Add(1)
+
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				Expect(cloud.OpenPorts(ctx, ports, recorder)).To(Succeed())
+			}()
+		}
+
+		wg.Wait()
+
+		reads := 0
+
+		for _, recorder := range recorders {
+			Expect(recorder.messages).To(HaveLen(1))
+
+			var recorderReads, recorderWrites int
+
+			_, err := fmt.Sscanf(recorder.messages[0][strings.LastIndex(recorder.messages[0], "(")+1:], "%d API reads, %d API writes",
+				&recorderReads, &recorderWrites)
+			Expect(err).To(Succeed())
+
+			reads += recorderReads
+		}
+
+		Expect(reads).To(Equal(fake.requestCountByMethod(http.MethodGet) - getsBefore))
+	})
+
+	It("should keep the internal and public ports in their own security groups", func() {
+		Expect(retErr).To(Succeed())
+
+		nsgClient, err := info.getNsgClient()
+		Expect(err).To(Succeed())
+
+		externalGroupName := info.InfraID + externalSecurityGroupSuffix
+		Expect(info.createGWSecurityGroup(context.TODO(), externalGroupName, []api.PortSpec{{Port: 4500, Protocol: "Udp"}}, nsgClient)).
+			To(Succeed())
+
+		ruleNames := func(nsg *armnetwork.SecurityGroup) []string {
+			names := []string{}
+			for _, rule := range nsg.Properties.SecurityRules {
+				names = append(names, *rule.Name)
+			}
+
+			return names
+		}
+
+		Expect(ruleNames(getSecurityGroup())).To(ConsistOf(
+			internalSecurityRulePrefix+"Udp-4800-Inbound", internalSecurityRulePrefix+"Udp-4800-Outbound",
+			internalSecurityRulePrefix+"Tcp-8080-Inbound", internalSecurityRulePrefix+"Tcp-8080-Outbound"))
+
+		externalGroup := &armnetwork.SecurityGroup{}
+		Expect(fake.get(nsgPath(externalGroupName), externalGroup)).To(BeTrue())
+		Expect(ruleNames(externalGroup)).To(ConsistOf(
+			externalSecurityRulePrefix+"Udp-4500-Inbound", externalSecurityRulePrefix+"Udp-4500-Outbound"))
+	})
+
+	It("should create the Submariner rules with Allow access", func() {
+		Expect(retErr).To(Succeed())
+
+		for _, rule := range getSecurityGroup().Properties.SecurityRules {
+			Expect(*rule.Properties.Access).To(Equal(armnetwork.SecurityRuleAccessAllow))
+		}
+	})
+
+	It("should record the time at which the ports were opened", func() {
+		Expect(retErr).To(Succeed())
+
+		lastPreparedAt, err := info.LastPreparedAt(ctx)
+		Expect(err).To(Succeed())
+		Expect(lastPreparedAt).To(BeTemporally("~", time.Now(), time.Minute))
+	})
+
+	It("should record when the Submariner rules were last modified", func() {
+		Expect(retErr).To(Succeed())
+
+		lastModified, err := info.RulesLastModified(ctx)
+		Expect(err).To(Succeed())
+		Expect(lastModified).To(HaveLen(1))
+		Expect(lastModified[info.InfraID+internalSecurityGroupSuffix]).To(BeTemporally("~", time.Now(), time.Minute))
+	})
+
+	It("should report the number of rules created", func() {
+		Expect(retErr).To(Succeed())
+
+		counts, err := info.SecurityRuleCounts(ctx)
+		Expect(err).To(Succeed())
+		Expect(counts).To(Equal(map[string]SecurityRuleCount{
+			info.InfraID + internalSecurityGroupSuffix: {Submariner: 4, Total: 4},
+		}))
+	})
+
+	When("the security group has many existing rules", func() {
+		const existingRules = 900
+
+		BeforeEach(func() {
+			rules := []*armnetwork.SecurityRule{}
+			for i := range existingRules {
+				rules = append(rules, &armnetwork.SecurityRule{
+					Name: ptr.To(fmt.Sprintf("existing-%d", i)),
+					Properties: &armnetwork.SecurityRulePropertiesFormat{
+						Priority:  ptr.To(int32(100 + i)), //nolint:gosec // Ignore integer overflow conversion
+						Direction: ptr.To(armnetwork.SecurityRuleDirectionInbound),
+					},
+				})
+			}
+
+			fake.put(nsgPath(info.InfraID+internalSecurityGroupSuffix), &armnetwork.SecurityGroup{
+				Properties: &armnetwork.SecurityGroupPropertiesFormat{SecurityRules: rules},
+			})
+		})
+
+		It("should warn that the limit is approaching and report the rule counts", func() {
+			Expect(retErr).To(Succeed())
+			Expect(tracker.HasWarnings()).To(BeTrue())
+
+			counts, err := info.SecurityRuleCounts(ctx)
+			Expect(err).To(Succeed())
+			Expect(counts[info.InfraID+internalSecurityGroupSuffix]).To(Equal(SecurityRuleCount{Submariner: 4, Total: 904}))
+		})
+
+		Context("and the Submariner rules would exceed the limit", func() {
+			BeforeEach(func() {
+				ports = append(ports, api.PortSpec{Port: 9000, Protocol: "Tcp"}, api.PortSpec{Port: 9001, Protocol: "Tcp"})
+
+				nsg := &armnetwork.SecurityGroup{}
+				Expect(fake.get(nsgPath(info.InfraID+internalSecurityGroupSuffix), nsg)).To(BeTrue())
+
+				for i := existingRules; i < MaxSecurityRules-4; i++ {
+					nsg.Properties.SecurityRules = append(nsg.Properties.SecurityRules, &armnetwork.SecurityRule{
+						Name: ptr.To(fmt.Sprintf("existing-%d", i)),
+					})
+				}
+
+				fake.put(nsgPath(info.InfraID+internalSecurityGroupSuffix), nsg)
+			})
+
+			It("should return an error", func() {
+				Expect(retErr).To(MatchError(ContainSubstring("exceed the maximum of 1000")))
+			})
+		})
+	})
+
+	When("the gateway security group was prepared by an older version", func() {
+		BeforeEach(func() {
+			fake.put(nsgPath(info.InfraID+externalSecurityGroupSuffix), &armnetwork.SecurityGroup{
+				Tags:       map[string]*string{RulesModifiedAtTag: ptr.To("2020-01-02T03:04:05Z")},
+				Properties: &armnetwork.SecurityGroupPropertiesFormat{},
+			})
+		})
+
+		It("should report when its rules were last modified", func() {
+			Expect(retErr).To(Succeed())
+
+			lastModified, err := info.RulesLastModified(ctx)
+			Expect(err).To(Succeed())
+			Expect(lastModified).To(HaveKeyWithValue(info.InfraID+externalSecurityGroupSuffix,
+				time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+		})
+	})
+
+	When("the security group already has tags", func() {
+		BeforeEach(func() {
+			fake.put(nsgPath(info.InfraID+internalSecurityGroupSuffix), &armnetwork.SecurityGroup{
+				Tags:       map[string]*string{"owner": ptr.To("openshift")},
+				Properties: &armnetwork.SecurityGroupPropertiesFormat{},
+			})
+		})
+
+		It("should preserve them", func() {
+			Expect(retErr).To(Succeed())
+			Expect(getSecurityGroup().Tags).To(HaveKeyWithValue("owner", ptr.To("openshift")))
+			Expect(getSecurityGroup().Tags).To(HaveKey(LastPreparedAtTag))
+		})
+	})
+
+	When("the security group isn't managed by Submariner", func() {
+		BeforeEach(func() {
+			info.Tags = map[string]*string{"cost-center": ptr.To("networking")}
+
+			fake.put(nsgPath(info.InfraID+internalSecurityGroupSuffix), &armnetwork.SecurityGroup{
+				Properties: &armnetwork.SecurityGroupPropertiesFormat{SecurityRules: []*armnetwork.SecurityRule{{
+					Name: ptr.To("allow-ssh"),
+					Properties: &armnetwork.SecurityRulePropertiesFormat{
+						Priority:  ptr.To(int32(100)),
+						Direction: ptr.To(armnetwork.SecurityRuleDirectionInbound),
+					},
+				}}},
+			})
+		})
+
+		It("should not tag it with the Submariner ownership metadata", func() {
+			Expect(retErr).To(Succeed())
+			Expect(getSecurityGroup().Tags).ToNot(HaveKey("cost-center"))
+			Expect(getSecurityGroup().Tags).ToNot(HaveKey(InfraIDTag))
+			Expect(getSecurityGroup().Tags).ToNot(HaveKey(RulesModifiedAtTag))
+		})
+	})
+
+	When("additional tags are configured", func() {
+		BeforeEach(func() {
+			info.Tags = map[string]*string{"cost-center": ptr.To("networking")}
+		})
+
+		It("should tag the security group with them and the infra ID but not as managed", func() {
+			Expect(retErr).To(Succeed())
+			Expect(getSecurityGroup().Tags).To(HaveKeyWithValue("cost-center", ptr.To("networking")))
+			Expect(getSecurityGroup().Tags).To(HaveKeyWithValue(InfraIDTag, ptr.To(info.InfraID)))
+			Expect(getSecurityGroup().Tags).ToNot(HaveKey(ManagedTag))
+		})
+	})
+
+	It("should set a description on the Submariner rules", func() {
+		Expect(retErr).To(Succeed())
+
+		for _, rule := range getSecurityGroup().Properties.SecurityRules {
+			Expect(rule.Properties.Description).ToNot(BeNil())
+			Expect(*rule.Properties.Description).To(HavePrefix("Created by Submariner to allow intra-cluster traffic on "))
+		}
+	})
+
+	When("the module version is known", func() {
+		BeforeEach(func() {
+			DeferCleanup(func(version string) {
+				moduleVersion = version
+			}, moduleVersion)
+
+			moduleVersion = "v0.20.0"
+		})
+
+		It("should include it in the description of the Submariner rules", func() {
+			Expect(retErr).To(Succeed())
+
+			for _, rule := range getSecurityGroup().Properties.SecurityRules {
+				Expect(*rule.Properties.Description).To(HavePrefix("Created by Submariner v0.20.0 to allow intra-cluster traffic on "))
+			}
+		})
+	})
+
+	When("the security rules are staged", func() {
+		BeforeEach(func() {
+			info.StageSecurityRules = true
+		})
+
+		It("should create them with Deny access until they're activated", func() {
+			Expect(retErr).To(Succeed())
+
+			for _, rule := range getSecurityGroup().Properties.SecurityRules {
+				Expect(*rule.Properties.Access).To(Equal(armnetwork.SecurityRuleAccessDeny))
+			}
+
+			Expect(info.ActivateSecurityRules(ctx, tracker)).To(Succeed())
+
+			for _, rule := range getSecurityGroup().Properties.SecurityRules {
+				Expect(*rule.Properties.Access).To(Equal(armnetwork.SecurityRuleAccessAllow))
+			}
+		})
+
+		Context("and the ports are opened again once they're activated", func() {
+			JustBeforeEach(func() {
+				Expect(retErr).To(Succeed())
+				Expect(info.ActivateSecurityRules(ctx, tracker)).To(Succeed())
+
+				retErr = cloud.OpenPorts(ctx, ports, tracker)
+			})
+
+			It("should keep them active", func() {
+				Expect(retErr).To(Succeed())
+
+				for _, rule := range getSecurityGroup().Properties.SecurityRules {
+					Expect(*rule.Properties.Access).To(Equal(armnetwork.SecurityRuleAccessAllow))
+				}
+			})
+		})
+	})
+
+	When("it's a dry run", func() {
+		BeforeEach(func() {
+			info.DryRun = true
+		})
+
+		It("should not change anything", func() {
+			Expect(retErr).To(Succeed())
+			Expect(fake.requestCountByMethod(http.MethodPut)).To(BeZero())
+			Expect(fake.requestCountByMethod(http.MethodPatch)).To(BeZero())
+			Expect(getSecurityGroup().Properties.SecurityRules).To(BeEmpty())
+
+			for _, subnetName := range info.clusterSubnetNames(info.InfraID) {
+				Expect(getSubnet(subnetName).Properties.NetworkSecurityGroup).To(BeNil())
+			}
+		})
+
+		It("should not remove the rules when closing the ports", func() {
+			info.DryRun = false
+			Expect(NewCloud(info).OpenPorts(ctx, ports, tracker)).To(Succeed())
+
+			puts := fake.requestCountByMethod(http.MethodPut)
+
+			info.DryRun = true
+			Expect(NewCloud(info).ClosePorts(ctx, tracker)).To(Succeed())
+			Expect(fake.requestCountByMethod(http.MethodPut)).To(Equal(puts))
+			Expect(getSecurityGroup().Properties.SecurityRules).To(HaveLen(4))
+		})
+	})
+
+	When("a custom security rule description is configured", func() {
+		BeforeEach(func() {
+			info.SecurityRuleDescription = "Submariner - change ticket 1234"
+		})
+
+		It("should set it on the Submariner rules", func() {
+			Expect(retErr).To(Succeed())
+
+			for _, rule := range getSecurityGroup().Properties.SecurityRules {
+				Expect(*rule.Properties.Description).To(Equal(info.SecurityRuleDescription))
+			}
+		})
+	})
+
+	It("should associate the security group with the cluster subnets", func() {
+		Expect(retErr).To(Succeed())
+
+		for _, subnetName := range info.clusterSubnetNames(info.InfraID) {
+			Expect(getSubnet(subnetName).Properties.NetworkSecurityGroup).ToNot(BeNil())
+			Expect(*getSubnet(subnetName).Properties.NetworkSecurityGroup.ID).To(Equal(*getSecurityGroup().ID))
+		}
+
+		Expect(tracker.HasWarnings()).To(BeFalse())
+	})
+
+	When("subnet association isn't enabled", func() {
+		BeforeEach(func() {
+			info.AssociateSubnets = false
+		})
+
+		It("should leave the cluster subnets as they are", func() {
+			Expect(retErr).To(Succeed())
+			Expect(getSecurityGroup().Properties.SecurityRules).ToNot(BeEmpty())
+
+			for _, subnetName := range info.clusterSubnetNames(info.InfraID) {
+				Expect(getSubnet(subnetName).Properties.NetworkSecurityGroup).To(BeNil())
+				Expect(fake.requestCount(http.MethodPut, subnetPath(info.InfraID+vnetSuffix, subnetName))).To(BeZero())
+			}
+		})
+	})
+
+	When("the ports are requested in a different order", func() {
+		var kubeClient *kubeFake.Clientset
+
+		BeforeEach(func() {
+			ports = []api.PortSpec{ports[1], ports[0]}
+
+			kubeClient = kubeFake.NewClientset(
+				newNode("worker-1", "node-role.kubernetes.io/worker"),
+				newNode("master-1", "node-role.kubernetes.io/master"))
+			info.K8sClient = k8s.NewInterface(kubeClient)
+			info.StateConfigMapName = "cloud-prepare-state"
+		})
+
+		It("should record the ports in sorted order", func() {
+			Expect(retErr).To(Succeed())
+
+			cm, err := kubeClient.CoreV1().ConfigMaps(DefaultStateConfigMapNamespace).Get(context.TODO(), "cloud-prepare-state",
+				metav1.GetOptions{})
+			Expect(err).To(Succeed())
+			Expect(cm.Data).To(HaveKeyWithValue(StateInternalPortsKey, "8080/tcp, 4800/udp"))
+		})
+
+		It("should generate the rules in the same order with the same priorities", func() {
+			Expect(retErr).To(Succeed())
+
+			rules := getSecurityGroup().Properties.SecurityRules
+			Expect(rules).To(HaveLen(4))
+			Expect(*rules[0].Name).To(Equal(internalSecurityRulePrefix + "Tcp-8080-Inbound"))
+			Expect(*rules[0].Properties.Priority).To(Equal(basePriorityInternal))
+			Expect(*rules[2].Name).To(Equal(internalSecurityRulePrefix + "Udp-4800-Inbound"))
+			Expect(*rules[2].Properties.Priority).To(Equal(basePriorityInternal + 1))
+		})
+	})
+
+	When("an ESP port is requested", func() {
+		BeforeEach(func() {
+			ports = []api.PortSpec{{Protocol: "esp"}}
+		})
+
+		It("should add Esp rules without a port range", func() {
+			Expect(retErr).To(Succeed())
+
+			rules := getSecurityGroup().Properties.SecurityRules
+			Expect(rules).To(HaveLen(2))
+
+			for _, rule := range rules {
+				Expect(*rule.Properties.Protocol).To(Equal(armnetwork.SecurityRuleProtocolEsp))
+				Expect(*rule.Properties.DestinationPortRange).To(Equal("*"))
+			}
+		})
+	})
+
+	When("a subnet isn't found at first after the cluster's network is created", func() {
+		BeforeEach(func() {
+			fake.failNext(http.MethodGet, subnetPath(info.InfraID+vnetSuffix, info.InfraID+workerSubnetSuffix),
+				http.StatusNotFound, http.StatusNotFound)
+		})
+
+		It("should look it up again and associate the security group with it", func() {
+			Expect(retErr).To(Succeed())
+			Expect(tracker.HasWarnings()).To(BeFalse())
+			Expect(getSubnet(info.InfraID + workerSubnetSuffix).Properties.NetworkSecurityGroup).ToNot(BeNil())
+		})
+	})
+
+	When("there are additional worker subnets", func() {
+		additionalSubnets := []string{"test-infraID-worker-subnet-1", "test-infraID-worker-subnet-2"}
+
+		BeforeEach(func() {
+			info.AdditionalWorkerSubnetNames = additionalSubnets
+
+			for _, subnetName := range additionalSubnets {
+				fake.put(subnetPath(info.InfraID+vnetSuffix, subnetName), &armnetwork.Subnet{
+					Properties: &armnetwork.SubnetPropertiesFormat{},
+				})
+			}
+		})
+
+		It("should associate the security group with all of them", func() {
+			Expect(retErr).To(Succeed())
+
+			for _, subnetName := range info.clusterSubnetNames(info.InfraID) {
+				Expect(getSubnet(subnetName).Properties.NetworkSecurityGroup).ToNot(BeNil())
+			}
+		})
+
+		Context("and they're associated one at a time", func() {
+			BeforeEach(func() {
+				info.Concurrency = 1
+			})
+
+			It("should associate the security group with all of them", func() {
+				Expect(retErr).To(Succeed())
+
+				for _, subnetName := range info.clusterSubnetNames(info.InfraID) {
+					Expect(getSubnet(subnetName).Properties.NetworkSecurityGroup).ToNot(BeNil())
+				}
+			})
+		})
+
+		Context("and one of them can't be looked up", func() {
+			BeforeEach(func() {
+				fake.failNext(http.MethodGet, subnetPath(info.InfraID+vnetSuffix, additionalSubnets[0]), http.StatusBadRequest)
+			})
+
+			It("should skip it and associate the security group with the others", func() {
+				Expect(retErr).To(Succeed())
+				Expect(tracker.HasWarnings()).To(BeTrue())
+				Expect(getSubnet(additionalSubnets[0]).Properties.NetworkSecurityGroup).To(BeNil())
+				Expect(getSubnet(additionalSubnets[1]).Properties.NetworkSecurityGroup).ToNot(BeNil())
+				Expect(getSubnet(info.InfraID + workerSubnetSuffix).Properties.NetworkSecurityGroup).ToNot(BeNil())
+			})
+		})
+	})
+
+	When("a subnet is delegated to a service that doesn't support security groups", func() {
+		BeforeEach(func() {
+			fake.put(subnetPath(info.InfraID+vnetSuffix, info.InfraID+workerSubnetSuffix), &armnetwork.Subnet{
+				Properties: &armnetwork.SubnetPropertiesFormat{
+					Delegations: []*armnetwork.Delegation{{
+						Name: ptr.To("netapp"),
+						Properties: &armnetwork.ServiceDelegationPropertiesFormat{
+							ServiceName: ptr.To("Microsoft.Netapp/volumes"),
+						},
+					}},
+				},
+			})
+		})
+
+		It("should skip the subnet with a warning", func() {
+			Expect(retErr).To(Succeed())
+			Expect(tracker.HasWarnings()).To(BeTrue())
+			Expect(getSubnet(info.InfraID + workerSubnetSuffix).Properties.NetworkSecurityGroup).To(BeNil())
+			Expect(getSubnet(info.InfraID + masterSubnetSuffix).Properties.NetworkSecurityGroup).ToNot(BeNil())
+		})
+	})
+
+	When("subnets are skipped", func() {
+		var kubeClient *kubeFake.Clientset
+
+		workerSubnet := func() string {
+			return info.InfraID + workerSubnetSuffix
+		}
+
+		BeforeEach(func() {
+			kubeClient = kubeFake.NewClientset(
+				newNode("worker-1", "node-role.kubernetes.io/worker"),
+				newNode("master-1", "node-role.kubernetes.io/master"),
+				newClusterConfig("10.0.0.0/16"))
+			info.K8sClient = k8s.NewInterface(kubeClient)
+			info.StateConfigMapName = "cloud-prepare-state"
+		})
+
+		getSkippedSubnets := func() string {
+			Expect(retErr).To(Succeed())
+			Expect(tracker.HasWarnings()).To(BeTrue())
+
+			cm, err := kubeClient.CoreV1().ConfigMaps(DefaultStateConfigMapNamespace).Get(context.TODO(), "cloud-prepare-state",
+				metav1.GetOptions{})
+			Expect(err).To(Succeed())
+
+			return cm.Data[StateSkippedSubnetsKey]
+		}
+
+		Context("because they have no nodes", func() {
+			BeforeEach(func() {
+				kubeClient = kubeFake.NewClientset(newNode("worker-1", "node-role.kubernetes.io/worker"), newClusterConfig("10.0.0.0/16"))
+				info.K8sClient = k8s.NewInterface(kubeClient)
+			})
+
+			It("should report them", func() {
+				Expect(getSkippedSubnets()).To(Equal(info.InfraID + masterSubnetSuffix +
+					" (no control plane nodes with any of the labels [node-role.kubernetes.io/control-plane node-role.kubernetes.io/master])"))
+			})
+		})
+
+		Context("because they don't exist", func() {
+			BeforeEach(func() {
+				info.SubnetNotFoundTimeout = -1
+				fake.failNext(http.MethodGet, subnetPath(info.InfraID+vnetSuffix, workerSubnet()), http.StatusNotFound)
+			})
+
+			It("should report them", func() {
+				Expect(getSkippedSubnets()).To(Equal(workerSubnet() + ` (not found in virtual network "test-infraID-vnet")`))
+			})
+		})
+
+		Context("because they're delegated to a service which doesn't support security groups", func() {
+			BeforeEach(func() {
+				fake.put(subnetPath(info.InfraID+vnetSuffix, workerSubnet()), &armnetwork.Subnet{
+					Properties: &armnetwork.SubnetPropertiesFormat{
+						Delegations: []*armnetwork.Delegation{{
+							Properties: &armnetwork.ServiceDelegationPropertiesFormat{ServiceName: ptr.To("Microsoft.Netapp/volumes")},
+						}},
+					},
+				})
+			})
+
+			It("should report them", func() {
+				Expect(getSkippedSubnets()).To(Equal(workerSubnet() +
+					` (delegated to "Microsoft.Netapp/volumes" which doesn't support network security groups)`))
+			})
+		})
+
+		Context("because they're associated with another security group", func() {
+			BeforeEach(func() {
+				fake.put(subnetPath(info.InfraID+vnetSuffix, workerSubnet()), &armnetwork.Subnet{
+					Properties: &armnetwork.SubnetPropertiesFormat{
+						NetworkSecurityGroup: &armnetwork.SecurityGroup{ID: ptr.To(nsgPath("other-nsg"))},
+					},
+				})
+			})
+
+			It("should report them", func() {
+				Expect(getSkippedSubnets()).To(Equal(workerSubnet() + fmt.Sprintf(" (already associated with security group %q)",
+					nsgPath("other-nsg"))))
+			})
+		})
+
+		Context("because they're locked", func() {
+			BeforeEach(func() {
+				fake.failNextWithCode(http.MethodPut, subnetPath(info.InfraID+vnetSuffix, workerSubnet()), http.StatusConflict,
+					"ScopeLocked")
+			})
+
+			It("should report them", func() {
+				Expect(getSkippedSubnets()).To(Equal(workerSubnet() + " (locked by a management lock)"))
+				Expect(getSubnet(workerSubnet()).Properties.NetworkSecurityGroup).To(BeNil())
+			})
+		})
+	})
+
+	When("the VNet and subnets have custom names", func() {
+		BeforeEach(func() {
+			info.VNetName = "custom-vnet"
+			info.WorkerSubnetName = "custom-worker"
+			info.MasterSubnetName = "custom-master"
+
+			for _, subnetName := range []string{"custom-worker", "custom-master"} {
+				fake.put(subnetPath("custom-vnet", subnetName), &armnetwork.Subnet{
+					Properties: &armnetwork.SubnetPropertiesFormat{},
+				})
+			}
+		})
+
+		It("should associate the security group with the named subnets", func() {
+			Expect(retErr).To(Succeed())
+
+			for _, subnetName := range []string{"custom-worker", "custom-master"} {
+				subnet := &armnetwork.Subnet{}
+				Expect(fake.get(subnetPath("custom-vnet", subnetName), subnet)).To(BeTrue())
+				Expect(subnet.Properties.NetworkSecurityGroup).ToNot(BeNil())
+			}
+
+			Expect(getSubnet(info.InfraID + workerSubnetSuffix).Properties.NetworkSecurityGroup).To(BeNil())
+		})
+
+		Context("and a named subnet doesn't exist", func() {
+			BeforeEach(func() {
+				info.MasterSubnetName = "missing-master"
+			})
+
+			It("should return a clear error without updating the security group", func() {
+				Expect(retErr).To(MatchError(ContainSubstring(
+					`subnet "missing-master" was not found in virtual network "custom-vnet" of resource group "test-rg"`)))
+				Expect(errors.Is(retErr, ErrSubnetNotFound)).To(BeTrue())
+				Expect(getSecurityGroup().Properties.SecurityRules).To(BeEmpty())
+			})
+		})
+	})
+
+	When("the cluster nodes use control-plane role labels", func() {
+		BeforeEach(func() {
+			info.K8sClient = k8s.NewInterface(kubeFake.NewClientset(
+				newNode("worker-1", "node-role.kubernetes.io/worker"),
+				newNode("master-1", "node-role.kubernetes.io/control-plane"),
+				newClusterConfig("10.0.0.0/16")))
+		})
+
+		It("should associate the security group with both cluster subnets", func() {
+			Expect(retErr).To(Succeed())
+			Expect(tracker.HasWarnings()).To(BeFalse())
+			Expect(getSubnet(info.InfraID + workerSubnetSuffix).Properties.NetworkSecurityGroup).ToNot(BeNil())
+			Expect(getSubnet(info.InfraID + masterSubnetSuffix).Properties.NetworkSecurityGroup).ToNot(BeNil())
+		})
+	})
+
+	When("the cluster nodes use custom role labels", func() {
+		BeforeEach(func() {
+			info.WorkerRoleLabels = []string{"example.com/compute"}
+			info.ControlPlaneRoleLabels = []string{"example.com/control"}
+			info.K8sClient = k8s.NewInterface(kubeFake.NewClientset(
+				newNode("worker-1", "example.com/compute"),
+				newNode("master-1", "node-role.kubernetes.io/master")))
+		})
+
+		It("should only associate the subnets of the roles which have nodes", func() {
+			Expect(retErr).To(Succeed())
+			Expect(tracker.HasWarnings()).To(BeTrue())
+			Expect(getSubnet(info.InfraID + workerSubnetSuffix).Properties.NetworkSecurityGroup).ToNot(BeNil())
+			Expect(getSubnet(info.InfraID + masterSubnetSuffix).Properties.NetworkSecurityGroup).To(BeNil())
+		})
+	})
+
+	When("the cluster's machine network is available", func() {
+		BeforeEach(func() {
+			info.K8sClient = k8s.NewInterface(kubeFake.NewClientset(
+				newNode("worker-1", "node-role.kubernetes.io/worker"),
+				newNode("master-1", "node-role.kubernetes.io/master"),
+				newClusterConfig("10.0.0.0/16")))
+		})
+
+		It("should scope the internal rules to the machine CIDR", func() {
+			Expect(retErr).To(Succeed())
+			Expect(tracker.HasWarnings()).To(BeFalse())
+
+			for _, rule := range getSecurityGroup().Properties.SecurityRules {
+				Expect(*rule.Properties.SourceAddressPrefix).To(Equal("10.0.0.0/16"))
+			}
+		})
+	})
+
+	When("the gateway nodes are in a dedicated subnet", func() {
+		BeforeEach(func() {
+			gatewaySubnetPath := subnetPath(info.InfraID+vnetSuffix, info.InfraID+"-gateway-subnet")
+
+			gwNode := newNode("gw-1", "node-role.kubernetes.io/worker")
+			gwNode.Labels[k8s.SubmarinerGatewayLabel] = "true"
+
+			info.K8sClient = k8s.NewInterface(kubeFake.NewClientset(
+				gwNode,
+				newNode("master-1", "node-role.kubernetes.io/master"),
+				newClusterConfig("10.0.0.0/16")))
+
+			fake.put(gatewaySubnetPath, &armnetwork.Subnet{
+				Properties: &armnetwork.SubnetPropertiesFormat{AddressPrefix: ptr.To("10.2.0.0/24")},
+			})
+			fake.put(nicPath("gw-1-nic"), &armnetwork.Interface{
+				Properties: &armnetwork.InterfacePropertiesFormat{
+					IPConfigurations: []*armnetwork.InterfaceIPConfiguration{{
+						Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
+							Primary: ptr.To(true),
+							Subnet:  &armnetwork.Subnet{ID: ptr.To(gatewaySubnetPath)},
+						},
+					}},
+				},
+			})
+		})
+
+		It("should allow internal traffic from the gateway subnet", func() {
+			Expect(retErr).To(Succeed())
+			Expect(tracker.HasWarnings()).To(BeFalse())
+
+			for _, rule := range getSecurityGroup().Properties.SecurityRules {
+				Expect(rule.Properties.SourceAddressPrefixes).To(Equal([]*string{ptr.To("10.0.0.0/16"), ptr.To("10.2.0.0/24")}))
+			}
+		})
+	})
+
+	When("the cluster has multiple machine networks", func() {
+		BeforeEach(func() {
+			info.K8sClient = k8s.NewInterface(kubeFake.NewClientset(
+				newNode("worker-1", "node-role.kubernetes.io/worker"),
+				newNode("master-1", "node-role.kubernetes.io/master"),
+				newClusterConfig("10.0.0.0/16", "10.1.0.0/16")))
+		})
+
+		It("should scope the internal rules to all the machine CIDRs", func() {
+			Expect(retErr).To(Succeed())
+
+			for _, rule := range getSecurityGroup().Properties.SecurityRules {
+				Expect(rule.Properties.SourceAddressPrefix).To(BeNil())
+				Expect(rule.Properties.SourceAddressPrefixes).To(Equal([]*string{ptr.To("10.0.0.0/16"), ptr.To("10.1.0.0/16")}))
+			}
+		})
+	})
+
+	When("peer VNet CIDRs are supplied", func() {
+		BeforeEach(func() {
+			info.PeerVNetCIDRs = []string{"10.100.0.0/16"}
+			info.K8sClient = k8s.NewInterface(kubeFake.NewClientset(
+				newNode("worker-1", "node-role.kubernetes.io/worker"),
+				newNode("master-1", "node-role.kubernetes.io/master"),
+				newClusterConfig("10.0.0.0/16")))
+		})
+
+		It("should allow them as sources of the internal rules", func() {
+			Expect(retErr).To(Succeed())
+
+			for _, rule := range getSecurityGroup().Properties.SecurityRules {
+				Expect(rule.Properties.SourceAddressPrefixes).To(Equal([]*string{ptr.To("10.0.0.0/16"), ptr.To("10.100.0.0/16")}))
+			}
+		})
+	})
+
+	When("the source CIDRs and ports exceed the configured maximum", func() {
+		BeforeEach(func() {
+			info.MaxSourceCIDRPorts = 3
+			info.PeerVNetCIDRs = []string{"10.100.0.0/16"}
+			info.K8sClient = k8s.NewInterface(kubeFake.NewClientset(
+				newNode("worker-1", "node-role.kubernetes.io/worker"),
+				newNode("master-1", "node-role.kubernetes.io/master"),
+				newClusterConfig("10.0.0.0/16")))
+		})
+
+		It("should return an error without changing the security group", func() {
+			Expect(retErr).To(MatchError(ContainSubstring("exceed the maximum of 3")))
+			Expect(getSecurityGroup().Properties.SecurityRules).To(BeEmpty())
+		})
+	})
+
+	When("peer VNet CIDRs are discovered", func() {
+		BeforeEach(func() {
+			info.DiscoverPeerVNetCIDRs = true
+			info.K8sClient = k8s.NewInterface(kubeFake.NewClientset(
+				newNode("worker-1", "node-role.kubernetes.io/worker"),
+				newNode("master-1", "node-role.kubernetes.io/master"),
+				newClusterConfig("10.0.0.0/16")))
+
+			fake.put(resourceGroupPath("Microsoft.Network/virtualNetworks/"+info.InfraID+vnetSuffix+"/virtualNetworkPeerings/hub"),
+				&armnetwork.VirtualNetworkPeering{
+					Properties: &armnetwork.VirtualNetworkPeeringPropertiesFormat{
+						RemoteAddressSpace: &armnetwork.AddressSpace{
+							AddressPrefixes: []*string{ptr.To("10.200.0.0/16"), ptr.To("10.201.0.0/16")},
+						},
+					},
+				})
+		})
+
+		It("should allow the peered VNets' CIDRs as sources of the internal rules", func() {
+			Expect(retErr).To(Succeed())
+			Expect(tracker.HasWarnings()).To(BeFalse())
+
+			for _, rule := range getSecurityGroup().Properties.SecurityRules {
+				Expect(rule.Properties.SourceAddressPrefixes).To(Equal([]*string{
+					ptr.To("10.0.0.0/16"), ptr.To("10.200.0.0/16"), ptr.To("10.201.0.0/16"),
+				}))
+			}
+		})
+	})
+
+	When("the cluster's machine network isn't available", func() {
+		BeforeEach(func() {
+			info.K8sClient = k8s.NewInterface(kubeFake.NewClientset(
+				newNode("worker-1", "node-role.kubernetes.io/worker"),
+				newNode("master-1", "node-role.kubernetes.io/master")))
+		})
+
+		It("should fall back to allowing any source address with a warning", func() {
+			Expect(retErr).To(Succeed())
+			Expect(tracker.HasWarnings()).To(BeTrue())
+
+			for _, rule := range getSecurityGroup().Properties.SecurityRules {
+				Expect(*rule.Properties.SourceAddressPrefix).To(Equal(allNetworkCIDR))
+			}
+		})
+	})
+
+	When("the cluster API is unreachable", func() {
+		BeforeEach(func() {
+			kubeClient := kubeFake.NewClientset()
+			kubeClient.PrependReactor("get", "version", func(_ testing.Action) (bool, runtime.Object, error) {
+				return true, nil, errors.New("connection refused")
+			})
+
+			info.K8sClient = k8s.NewInterface(kubeClient)
+		})
+
+		It("should return an error before making any Azure calls", func() {
+			Expect(retErr).To(MatchError(ContainSubstring("cluster API unreachable")))
+			Expect(fake.requestCountByMethod(http.MethodGet)).To(BeZero())
+			Expect(fake.requestCountByMethod(http.MethodPut)).To(BeZero())
+		})
+	})
+
+	When("the region isn't available for the subscription", func() {
+		BeforeEach(func() {
+			fake.setLocations("west", "north")
+		})
+
+		It("should return an error", func() {
+			Expect(retErr).To(MatchError(ContainSubstring(`region "east" is not available for subscription`)))
+			Expect(fake.requestCountByMethod(http.MethodPut)).To(BeZero())
+		})
+	})
+
+	When("the credentials aren't authorized to list the subscription's locations", func() {
+		BeforeEach(func() {
+			fake.failNextWithCode(http.MethodGet, "/subscriptions/"+testSubscriptionID+"/locations", http.StatusForbidden,
+				"AuthorizationFailed")
+		})
+
+		It("should skip the region check with a warning", func() {
+			Expect(retErr).To(Succeed())
+			Expect(tracker.HasWarnings()).To(BeTrue())
+			Expect(getSecurityGroup().Properties.SecurityRules).ToNot(BeEmpty())
+		})
+	})
+
+	When("the region doesn't support the configured public IP zones", func() {
+		BeforeEach(func() {
+			info.PublicIPZones = []string{"1", "4"}
+			fake.setZonalLocations([]string{"1", "2", "3"}, "east")
+		})
+
+		It("should return an error", func() {
+			Expect(retErr).To(MatchError(ContainSubstring(`region "east" does not support availability zone "4"`)))
+			Expect(fake.requestCountByMethod(http.MethodPut)).To(BeZero())
+		})
+	})
+
+	When("the security group doesn't exist", func() {
+		BeforeEach(func() {
+			fake = newFakeARM()
+			info = newTestCloudInfo(fake)
+		})
+
+		It("should return an error", func() {
+			Expect(retErr).To(HaveOccurred())
+		})
+	})
+}
+
+func newClusterConfig(machineCIDRs ...string) *corev1.ConfigMap {
+	installConfig := "networking:\n  machineNetwork:\n"
+	for _, cidr := range machineCIDRs {
+		installConfig += "  - cidr: " + cidr + "\n"
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterConfigName,
+			Namespace: clusterConfigNamespace,
+		},
+		Data: map[string]string{installConfigKey: installConfig},
+	}
+}
+
+func newNode(name, roleLabel string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{roleLabel: ""},
+		},
+	}
+}
+
+func testRuleOwners() {
+	var (
+		fake  *fakeARM
+		ports []api.PortSpec
+	)
+
+	BeforeEach(func() {
+		fake = newFakeARM()
+		ports = []api.PortSpec{{Port: 4800, Protocol: "Udp"}, {Port: 8080, Protocol: "Tcp"}}
+
+		info := newTestCloudInfo(fake)
+
+		fake.put(nsgPath(info.InfraID+internalSecurityGroupSuffix), &armnetwork.SecurityGroup{
+			Properties: &armnetwork.SecurityGroupPropertiesFormat{},
+		})
+
+		for _, subnetName := range info.clusterSubnetNames(info.InfraID) {
+			fake.put(subnetPath(info.InfraID+vnetSuffix, subnetName), &armnetwork.Subnet{
+				Properties: &armnetwork.SubnetPropertiesFormat{},
+			})
+		}
+	})
+
+	cloudFor := func(owner string) api.Cloud {
+		info := newTestCloudInfo(fake)
+		info.RuleOwner = owner
+
+		return NewCloud(info)
+	}
+
+	getRules := func() map[string]int32 {
+		nsg := &armnetwork.SecurityGroup{}
+		Expect(fake.get(nsgPath("test-infraID"+internalSecurityGroupSuffix), nsg)).To(BeTrue())
+
+		rules := map[string]int32{}
+		for _, rule := range nsg.Properties.SecurityRules {
+			rules[*rule.Name] = *rule.Properties.Priority
+		}
+
+		return rules
+	}
+
+	It("should keep the rules of each owner separate", func() {
+		Expect(cloudFor("alpha").OpenPorts(context.TODO(), ports, reporter.Stdout())).To(Succeed())
+		Expect(cloudFor("beta").OpenPorts(context.TODO(), ports, reporter.Stdout())).To(Succeed())
+
+		Expect(getRules()).To(Equal(map[string]int32{
+			"Submariner-Internal-Owner-alpha-Tcp-8080-Inbound":  basePriorityInternal,
+			"Submariner-Internal-Owner-alpha-Tcp-8080-Outbound": basePriorityInternal,
+			"Submariner-Internal-Owner-alpha-Udp-4800-Inbound":  basePriorityInternal + 1,
+			"Submariner-Internal-Owner-alpha-Udp-4800-Outbound": basePriorityInternal + 1,
+			"Submariner-Internal-Owner-beta-Tcp-8080-Inbound":   basePriorityInternal + 2,
+			"Submariner-Internal-Owner-beta-Tcp-8080-Outbound":  basePriorityInternal + 2,
+			"Submariner-Internal-Owner-beta-Udp-4800-Inbound":   basePriorityInternal + 3,
+			"Submariner-Internal-Owner-beta-Udp-4800-Outbound":  basePriorityInternal + 3,
+		}))
+
+		Expect(cloudFor("alpha").ClosePorts(context.TODO(), reporter.Stdout())).To(Succeed())
+
+		Expect(getRules()).To(HaveLen(4))
+		Expect(getRules()).To(HaveKey("Submariner-Internal-Owner-beta-Udp-4800-Inbound"))
+
+		Expect(cloudFor("").OpenPorts(context.TODO(), ports, reporter.Stdout())).To(Succeed())
+		Expect(getRules()).To(HaveLen(8))
+		Expect(getRules()).To(HaveKeyWithValue("Submariner-Internal-Tcp-8080-Inbound", basePriorityInternal))
+
+		Expect(cloudFor("").ClosePorts(context.TODO(), reporter.Stdout())).To(Succeed())
+		Expect(getRules()).To(HaveLen(4))
+		Expect(getRules()).To(HaveKey("Submariner-Internal-Owner-beta-Tcp-8080-Outbound"))
+	})
+
+	It("should reject an owner which isn't alphanumeric", func() {
+		Expect(cloudFor("not-valid").OpenPorts(context.TODO(), ports, reporter.Stdout())).To(MatchError(ContainSubstring(
+			`rule owner "not-valid" must be alphanumeric`)))
+	})
+}
+
+func testValidate() {
+	var (
+		fake    *fakeARM
+		info    *CloudInfo
+		tracker *reporter.Tracker
+		retErr  error
+	)
+
+	BeforeEach(func() {
+		fake = newFakeARM()
+		info = newTestCloudInfo(fake)
+		tracker = reporter.NewTracker(reporter.Stdout())
+
+		fake.put("/subscriptions/"+testSubscriptionID+"/resourceGroups/"+testResourceGroup, map[string]any{})
+		fake.put(resourceGroupPath("Microsoft.Network/virtualNetworks/"+info.InfraID+vnetSuffix), &armnetwork.VirtualNetwork{})
+		fake.setPermissions([]string{"Microsoft.Network/*"}, nil)
+
+		for _, subnetName := range info.clusterSubnetNames(info.InfraID) {
+			fake.put(subnetPath(info.InfraID+vnetSuffix, subnetName), &armnetwork.Subnet{
+				Properties: &armnetwork.SubnetPropertiesFormat{},
+			})
+		}
+	})
+
+	JustBeforeEach(func() {
+		retErr = NewCloud(info).Validate(context.TODO(), tracker)
+	})
+
+	It("should succeed without changing anything", func() {
+		Expect(retErr).To(Succeed())
+		Expect(tracker.HasWarnings()).To(BeFalse())
+		Expect(fake.requestCountByMethod(http.MethodPut)).To(BeZero())
+		Expect(fake.requestCountByMethod(http.MethodDelete)).To(BeZero())
+	})
+
+	When("the resource group doesn't exist", func() {
+		BeforeEach(func() {
+			info.BaseGroupName = "missing-rg"
+		})
+
+		It("should return an error", func() {
+			Expect(retErr).To(MatchError(ContainSubstring(`resource group "missing-rg" doesn't exist`)))
+		})
+	})
+
+	When("the virtual network doesn't exist", func() {
+		BeforeEach(func() {
+			info.VNetName = "missing-vnet"
+		})
+
+		It("should return an error", func() {
+			Expect(retErr).To(MatchError(ContainSubstring(`virtual network "missing-vnet" doesn't exist`)))
+		})
+	})
+
+	When("a subnet named after the infra ID doesn't exist", func() {
+		BeforeEach(func() {
+			info.MasterSubnetName = ""
+			info.AdditionalWorkerSubnetNames = []string{"missing-subnet"}
+		})
+
+		It("should only report a warning", func() {
+			Expect(retErr).To(Succeed())
+			Expect(tracker.HasWarnings()).To(BeTrue())
+		})
+	})
+
+	When("an explicitly named subnet doesn't exist", func() {
+		BeforeEach(func() {
+			info.WorkerSubnetName = "missing-subnet"
+		})
+
+		It("should return an error", func() {
+			Expect(retErr).To(MatchError(ContainSubstring(`subnet "missing-subnet" was not found`)))
+		})
+	})
+
+	When("the credentials aren't allowed to write security groups", func() {
+		BeforeEach(func() {
+			fake.setPermissions([]string{"*"}, []string{"Microsoft.Network/networkSecurityGroups/*"})
+		})
+
+		It("should return an error", func() {
+			Expect(retErr).To(MatchError(ContainSubstring("aren't allowed to perform " + nsgWriteAction)))
+		})
+	})
+
+	When("the credentials aren't allowed to write subnets", func() {
+		BeforeEach(func() {
+			fake.setPermissions([]string{"*"}, []string{"Microsoft.Network/virtualNetworks/*"})
+		})
+
+		It("should succeed", func() {
+			Expect(retErr).To(Succeed())
+		})
+
+		Context("and subnet association is enabled", func() {
+			BeforeEach(func() {
+				info.AssociateSubnets = true
+			})
+
+			It("should return an error", func() {
+				Expect(retErr).To(MatchError(ContainSubstring("aren't allowed to perform " + subnetWriteAction)))
+			})
+		})
+	})
+
+	When("several checks fail", func() {
+		BeforeEach(func() {
+			info.AssociateSubnets = true
+			info.RuleOwner = "not a valid owner"
+			info.WorkerSubnetName = "missing-subnet"
+			fake.setPermissions([]string{"*/read"}, nil)
+		})
+
+		It("should return all the failures", func() {
+			Expect(retErr).To(MatchError(ContainSubstring("invalid Azure configuration")))
+			Expect(retErr).To(MatchError(ContainSubstring(`subnet "missing-subnet" was not found`)))
+			Expect(retErr).To(MatchError(ContainSubstring("aren't allowed to perform " + nsgWriteAction + ", " + subnetWriteAction)))
+		})
+	})
+}
+
+// successRecorder is a reporter which records the success messages, e.g. to check the API calls reported.
+type successRecorder struct {
+	reporter.Interface
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (r *successRecorder) Success(message string, args ...interface{}) {
+	r.mutex.Lock()
+	r.messages = append(r.messages, fmt.Sprintf(message, args...))
+	r.mutex.Unlock()
+
+	r.Interface.Success(message, args...)
+}
@@ -0,0 +1,150 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/reporter"
+)
+
+const (
+	// The BGP rules are a subset of the external rules so that they're removed along with them.
+	bgpSecurityRulePrefix        = externalSecurityRulePrefix + "BGP-"
+	basePriorityBGP       int32  = 3400
+	bgpPort               uint16 = 179
+)
+
+// OpenBGPPort opens the BGP port in the gateway security group, allowing it from the peer IPs of the given Azure Route
+// Server so that the gateways can peer with it. The gateway security group is also associated with the subnets dedicated
+// to the gateway nodes, if any. Any previously opened BGP port rules are replaced.
+func (c *CloudInfo) OpenBGPPort(routeServerName string, status reporter.Interface) error {
+	status = withRemediationHints(status)
+
+	status.Start("Opening the BGP port %d/TCP for Azure Route Server %q", bgpPort, routeServerName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.resourceTimeout())
+	defer cancel()
+
+	peerIPs, err := c.routeServerPeerIPs(ctx, routeServerName)
+	if err != nil {
+		return status.Error(err, "Failed to determine the peer IPs of the route server")
+	}
+
+	nsgClient, err := c.getNsgClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network security groups client")
+	}
+
+	groupName := c.InfraID + externalSecurityGroupSuffix
+
+	nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
+	if err != nil {
+		return status.Error(err, "error getting the security group %q", groupName)
+	}
+
+	if nwSecurityGroup.Properties == nil {
+		nwSecurityGroup.Properties = &armnetwork.SecurityGroupPropertiesFormat{}
+	}
+
+	securityRules := []*armnetwork.SecurityRule{}
+
+	for _, rule := range nwSecurityGroup.Properties.SecurityRules {
+		if rule.Name == nil || !strings.HasPrefix(*rule.Name, bgpSecurityRulePrefix) || !c.ownsSecurityRule(rule) {
+			securityRules = append(securityRules, rule)
+		}
+	}
+
+	priorities, err := nextAvailablePriorities(securityRules, basePriorityBGP, 1)
+	if err != nil {
+		return status.Error(err, "error allocating the priority of the BGP rules in security group %q", groupName)
+	}
+
+	priority := priorities[0]
+
+	securityRules = append(securityRules,
+		c.createSecurityRule(bgpSecurityRulePrefix, armnetwork.SecurityRuleProtocolTCP, bgpPort, priority,
+			armnetwork.SecurityRuleDirectionInbound, peerIPs),
+		c.createSecurityRule(bgpSecurityRulePrefix, armnetwork.SecurityRuleProtocolTCP, bgpPort, priority,
+			armnetwork.SecurityRuleDirectionOutbound, peerIPs))
+
+	if err := validateSecurityRules(securityRules); err != nil {
+		return status.Error(err, "invalid security rules for security group %q", groupName)
+	}
+
+	nwSecurityGroup.Properties.SecurityRules = securityRules
+	stampRulesModified(&nwSecurityGroup.SecurityGroup)
+
+	poller, err := nsgClient.BeginCreateOrUpdate(ctx, c.BaseGroupName, groupName, nwSecurityGroup.SecurityGroup, nil)
+	if err != nil {
+		return status.Error(err, "updating security group %q with the BGP rules failed", groupName)
+	}
+
+	_, err = pollUntilDone(ctx, poller, c.pollOptions())
+	if err != nil {
+		return status.Error(err, "error updating security group %q with the BGP rules", groupName)
+	}
+
+	if c.K8sClient != nil {
+		gwNodes, err := c.K8sClient.ListGatewayNodes()
+		if err != nil {
+			return status.Error(err, "Failed to list the gateway nodes")
+		}
+
+		if err := c.associateGatewaySubnets(ctx, groupName, gwNodes.Items, nsgClient, status); err != nil {
+			return status.Error(err, "Failed to associate the gateway security group with the gateway subnets")
+		}
+	}
+
+	status.Success("Opened the BGP port %d/TCP from the route server peers %v", bgpPort, peerIPs)
+
+	return nil
+}
+
+// routeServerPeerIPs returns the IPs with which the given Azure Route Server peers.
+func (c *CloudInfo) routeServerPeerIPs(ctx context.Context, routeServerName string) ([]string, error) {
+	hubClient, err := c.getVirtualHubsClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the virtual hubs client")
+	}
+
+	routeServer, err := hubClient.Get(ctx, c.BaseGroupName, routeServerName, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting the route server %q", routeServerName)
+	}
+
+	peerIPs := []string{}
+
+	if routeServer.Properties != nil {
+		for _, ip := range routeServer.Properties.VirtualRouterIPs {
+			if ip != nil && *ip != "" {
+				peerIPs = append(peerIPs, *ip)
+			}
+		}
+	}
+
+	if len(peerIPs) == 0 {
+		return nil, errors.Errorf("route server %q has no peer IPs", routeServerName)
+	}
+
+	return peerIPs, nil
+}
@@ -0,0 +1,109 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("OpenBGPPort", func() {
+	const routeServerName = "test-route-server"
+
+	var (
+		fake   *fakeARM
+		info   *CloudInfo
+		retErr error
+	)
+
+	BeforeEach(func() {
+		fake = newFakeARM()
+		info = newTestCloudInfo(fake)
+
+		fake.put(resourceGroupPath("Microsoft.Network/virtualHubs/"+routeServerName), &armnetwork.VirtualHub{
+			Properties: &armnetwork.VirtualHubProperties{
+				VirtualRouterIPs: []*string{ptr.To("10.3.0.4"), ptr.To("10.3.0.5")},
+			},
+		})
+
+		fake.put(nsgPath(info.InfraID+externalSecurityGroupSuffix), &armnetwork.SecurityGroup{
+			Properties: &armnetwork.SecurityGroupPropertiesFormat{
+				SecurityRules: []*armnetwork.SecurityRule{
+					{
+						Name:       ptr.To(bgpSecurityRulePrefix + "Tcp-179-Inbound"),
+						Properties: &armnetwork.SecurityRulePropertiesFormat{Priority: ptr.To(basePriorityBGP)},
+					},
+					{
+						Name:       ptr.To(externalSecurityRulePrefix + "Udp-4500-Inbound"),
+						Properties: &armnetwork.SecurityRulePropertiesFormat{Priority: ptr.To(baseExternalInternal)},
+					},
+				},
+			},
+		})
+	})
+
+	JustBeforeEach(func() {
+		retErr = info.OpenBGPPort(routeServerName, reporter.Stdout())
+	})
+
+	getRules := func() []*armnetwork.SecurityRule {
+		nsg := &armnetwork.SecurityGroup{}
+		Expect(fake.get(nsgPath(info.InfraID+externalSecurityGroupSuffix), nsg)).To(BeTrue())
+
+		return nsg.Properties.SecurityRules
+	}
+
+	It("should add rules for the BGP port scoped to the route server peers", func() {
+		Expect(retErr).To(Succeed())
+
+		rules := getRules()
+		Expect(rules).To(HaveLen(3))
+		Expect(*rules[0].Name).To(Equal(externalSecurityRulePrefix + "Udp-4500-Inbound"))
+
+		for _, rule := range rules[1:] {
+			Expect(*rule.Name).To(HavePrefix(bgpSecurityRulePrefix + "Tcp-179-"))
+			Expect(*rule.Properties.Protocol).To(Equal(armnetwork.SecurityRuleProtocolTCP))
+			Expect(*rule.Properties.DestinationPortRange).To(Equal("179-179"))
+			Expect(rule.Properties.SourceAddressPrefixes).To(Equal([]*string{ptr.To("10.3.0.4"), ptr.To("10.3.0.5")}))
+			Expect(*rule.Properties.Priority).To(Equal(basePriorityBGP))
+		}
+	})
+
+	When("the route server has no peer IPs", func() {
+		BeforeEach(func() {
+			fake.put(resourceGroupPath("Microsoft.Network/virtualHubs/"+routeServerName), &armnetwork.VirtualHub{
+				Properties: &armnetwork.VirtualHubProperties{},
+			})
+		})
+
+		It("should return an error without opening the port", func() {
+			Expect(retErr).To(MatchError(ContainSubstring("no peer IPs")))
+			Expect(getRules()).To(HaveLen(2))
+		})
+	})
+
+	When("the route server doesn't exist", func() {
+		It("should return an error", func() {
+			Expect(info.OpenBGPPort("missing", reporter.Stdout())).To(MatchError(ContainSubstring("missing")))
+		})
+	})
+})
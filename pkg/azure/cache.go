@@ -0,0 +1,169 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// readCache memoizes the successful reads of Azure resources made during an operation. A write to a resource
+// invalidates the cached reads of the resource itself, of its ancestors, such as the list of its siblings, and of its
+// descendants. The polling of long-running operations, resources which are still being provisioned and public IPs which
+// haven't been assigned an address yet aren't cached.
+type readCache struct {
+	mutex   sync.Mutex
+	entries map[string]*cachedResponse
+	hits    int
+}
+
+type cachedResponse struct {
+	path       string
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+func (r *readCache) Do(req *policy.Request) (*http.Response, error) {
+	url := req.Raw().URL
+	path := strings.ToLower(url.Path)
+
+	if req.Raw().Method != http.MethodGet {
+		r.invalidate(path)
+		return req.Next() //nolint:wrapcheck // Let the caller wrap it.
+	}
+
+	key := path + "?" + url.RawQuery
+
+	r.mutex.Lock()
+	cached, ok := r.entries[key]
+	if ok {
+		r.hits++
+	}
+	r.mutex.Unlock()
+
+	if ok {
+		return cached.response(req.Raw()), nil
+	}
+
+	resp, err := req.Next()
+	if err != nil || resp.StatusCode != http.StatusOK || isOperationPath(path) {
+		return resp, err //nolint:wrapcheck // Let the caller wrap it.
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		return nil, err //nolint:wrapcheck // Let the caller wrap it.
+	}
+
+	cached = &cachedResponse{path: path, statusCode: resp.StatusCode, header: resp.Header.Clone(), body: body}
+	if isCacheable(path, body) {
+		r.mutex.Lock()
+		r.entries[key] = cached
+		r.mutex.Unlock()
+	}
+
+	return cached.response(req.Raw()), nil
+}
+
+func (r *readCache) invalidate(path string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for key, cached := range r.entries {
+		if cached.path == path || strings.HasPrefix(cached.path, path+"/") || strings.HasPrefix(path, cached.path+"/") {
+			delete(r.entries, key)
+		}
+	}
+}
+
+func (c *cachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		StatusCode: c.statusCode,
+		Status:     http.StatusText(c.statusCode),
+		Header:     c.header.Clone(),
+		Body:       io.NopCloser(bytes.NewReader(c.body)),
+		Request:    req,
+	}
+}
+
+func isOperationPath(path string) bool {
+	return strings.Contains(path, "/operations/") || strings.Contains(path, "/operationresults/") ||
+		strings.Contains(path, "/operationstatuses/")
+}
+
+// isCacheable returns whether the given resource isn't in the midst of being provisioned and, if it's a public IP, has
+// been assigned an address, since it may be polled otherwise.
+func isCacheable(path string, body []byte) bool {
+	resource := struct {
+		Properties struct {
+			ProvisioningState string `json:"provisioningState"`
+			IPAddress         string `json:"ipAddress"`
+		} `json:"properties"`
+	}{}
+
+	if err := json.Unmarshal(body, &resource); err != nil {
+		return true
+	}
+
+	if strings.Contains(path, "/microsoft.network/publicipaddresses/") && resource.Properties.IPAddress == "" {
+		return false
+	}
+
+	state := resource.Properties.ProvisioningState
+
+	return state == "" || strings.EqualFold(state, "Succeeded")
+}
+
+type readCacheKey struct{}
+
+// cacheReads returns a context under which the Azure resources read are cached, if enabled, so that concurrent
+// operations each have their own cache.
+func (c *CloudInfo) cacheReads(ctx context.Context) context.Context {
+	if !c.CacheReads {
+		return ctx
+	}
+
+	return context.WithValue(ctx, readCacheKey{}, &readCache{entries: map[string]*cachedResponse{}})
+}
+
+func readCacheFrom(ctx context.Context) *readCache {
+	cache, _ := ctx.Value(readCacheKey{}).(*readCache)
+
+	return cache
+}
+
+// cachedReads is a pipeline policy which serves the Azure requests with the cache of their context, if any.
+type cachedReads struct{}
+
+func (cachedReads) Do(req *policy.Request) (*http.Response, error) {
+	if cache := readCacheFrom(req.Raw().Context()); cache != nil {
+		return cache.Do(req)
+	}
+
+	return req.Next() //nolint:wrapcheck // Let the caller wrap it.
+}
@@ -0,0 +1,177 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package azure
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Read cache", func() {
+	const groupName = "test-nsg"
+
+	var (
+		fake      *fakeARM
+		info      *CloudInfo
+		ctx       context.Context
+		nsgClient *armnetwork.SecurityGroupsClient
+	)
+
+	BeforeEach(func() {
+		fake = newFakeARM()
+		info = newTestCloudInfo(fake)
+		info.CacheReads = true
+
+		fake.put(nsgPath(groupName), &armnetwork.SecurityGroup{
+			Properties: &armnetwork.SecurityGroupPropertiesFormat{ProvisioningState: ptr.To(armnetwork.ProvisioningStateSucceeded)},
+		})
+	})
+
+	JustBeforeEach(func() {
+		ctx = info.cacheReads(context.TODO())
+
+		var err error
+
+		nsgClient, err = info.getNsgClient()
+		Expect(err).To(Succeed())
+	})
+
+	getGroup := func() {
+		_, err := nsgClient.Get(ctx, info.BaseGroupName, groupName, nil)
+		Expect(err).To(Succeed())
+	}
+
+	It("should serve repeated lookups from the cache", func() {
+		getGroup()
+		getGroup()
+		getGroup()
+
+		Expect(fake.requestCount(http.MethodGet, nsgPath(groupName))).To(Equal(1))
+		Expect(readCacheFrom(ctx).hits).To(Equal(2))
+	})
+
+	It("should invalidate a resource when it's written", func() {
+		getGroup()
+
+		poller, err := nsgClient.BeginCreateOrUpdate(ctx, info.BaseGroupName, groupName, armnetwork.SecurityGroup{}, nil)
+		Expect(err).To(Succeed())
+		_, err = poller.PollUntilDone(ctx, nil)
+		Expect(err).To(Succeed())
+
+		getGroup()
+
+		Expect(fake.requestCount(http.MethodGet, nsgPath(groupName))).To(Equal(2))
+	})
+
+	It("should invalidate the list containing a resource when it's written", func() {
+		pager := nsgClient.NewListPager(info.BaseGroupName, nil)
+		_, err := pager.NextPage(ctx)
+		Expect(err).To(Succeed())
+
+		poller, err := nsgClient.BeginCreateOrUpdate(ctx, info.BaseGroupName, "other-nsg", armnetwork.SecurityGroup{}, nil)
+		Expect(err).To(Succeed())
+		_, err = poller.PollUntilDone(ctx, nil)
+		Expect(err).To(Succeed())
+
+		pager = nsgClient.NewListPager(info.BaseGroupName, nil)
+		page, err := pager.NextPage(ctx)
+		Expect(err).To(Succeed())
+		Expect(page.Value).To(HaveLen(2))
+	})
+
+	When("the resource is still being provisioned", func() {
+		BeforeEach(func() {
+			fake.put(nsgPath(groupName), &armnetwork.SecurityGroup{
+				Properties: &armnetwork.SecurityGroupPropertiesFormat{ProvisioningState: ptr.To(armnetwork.ProvisioningStateUpdating)},
+			})
+		})
+
+		It("should not cache it", func() {
+			getGroup()
+			getGroup()
+
+			Expect(fake.requestCount(http.MethodGet, nsgPath(groupName))).To(Equal(2))
+		})
+	})
+
+	When("a public IP hasn't been assigned an address yet", func() {
+		const publicIPName = "test-pub"
+
+		var pubIPClient *armnetwork.PublicIPAddressesClient
+
+		BeforeEach(func() {
+			info.publicIPAssignTimeout = 5 * time.Second
+			info.publicIPLookupFrequency = 10 * time.Millisecond
+
+			fake.put(publicIPPath(publicIPName), &armnetwork.PublicIPAddress{
+				Properties: &armnetwork.PublicIPAddressPropertiesFormat{
+					ProvisioningState: ptr.To(armnetwork.ProvisioningStateSucceeded),
+				},
+			})
+		})
+
+		JustBeforeEach(func() {
+			var err error
+
+			pubIPClient, err = info.getPublicIPClient()
+			Expect(err).To(Succeed())
+		})
+
+		It("should not cache it so that it can be polled until it is", func() {
+			pubIP, err := info.getPublicIP(ctx, publicIPName, pubIPClient)
+			Expect(err).To(Succeed())
+
+			go func() {
+				defer GinkgoRecover()
+
+				time.Sleep(50 * time.Millisecond)
+				fake.put(publicIPPath(publicIPName), &armnetwork.PublicIPAddress{
+					Properties: &armnetwork.PublicIPAddressPropertiesFormat{
+						ProvisioningState: ptr.To(armnetwork.ProvisioningStateSucceeded),
+						IPAddress:         ptr.To("1.2.3.4"),
+					},
+				})
+			}()
+
+			Expect(info.waitForPublicIPAddress(ctx, publicIPName, pubIP, pubIPClient)).To(Equal("1.2.3.4"))
+
+			_, err = info.getPublicIP(ctx, publicIPName, pubIPClient)
+			Expect(err).To(Succeed())
+			Expect(readCacheFrom(ctx).hits).To(Equal(1))
+		})
+	})
+
+	When("the cache isn't enabled", func() {
+		BeforeEach(func() {
+			info.CacheReads = false
+		})
+
+		It("should not cache the lookups", func() {
+			getGroup()
+			getGroup()
+
+			Expect(fake.requestCount(http.MethodGet, nsgPath(groupName))).To(Equal(2))
+		})
+	})
+})
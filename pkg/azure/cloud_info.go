@@ -20,30 +20,57 @@ package azure
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/reporter"
 	"github.com/submariner-io/cloud-prepare/pkg/api"
 	"github.com/submariner-io/cloud-prepare/pkg/k8s"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/utils/ptr"
+	"k8s.io/utils/set"
 )
 
 const (
 	internalSecurityGroupSuffix       = "-nsg"
 	externalSecurityGroupSuffix       = "-submariner-external-sg"
 	internalSecurityRulePrefix        = "Submariner-Internal-"
+	denySecurityRulePrefix            = internalSecurityRulePrefix + "Deny-"
 	externalSecurityRulePrefix        = "Submariner-External-"
+	ruleOwnerMarker                   = "Owner-"
 	publicIPNameSuffix                = "-pub"
 	allNetworkCIDR                    = "0.0.0.0/0"
+	allIPv6NetworkCIDR                = "::/0"
+	ipFamilyIPv4                      = "IPv4"
+	ipFamilyIPv6                      = "IPv6"
+	ipv6RuleMarker                    = "IPv6-"
 	basePriorityInternal        int32 = 2500
 	baseExternalInternal        int32 = 3500
+	basePriorityDeny            int32 = 4000
+	maxSecurityRulePriority     int32 = 4096
+	defaultResourceTimeout            = 300 * time.Second
+	defaultOperationTimeout           = 300 * time.Second
 )
 
+const (
+	defaultPublicIPAssignTimeout   = 2 * time.Minute
+	defaultPublicIPLookupFrequency = 2 * time.Second
+)
+
+// CloudInfo describes the Azure cluster to prepare and how to access it. NewCloudInfo is the recommended way to create
+// it, as it checks that the required fields are set.
 type CloudInfo struct {
 	SubscriptionID  string
 	InfraID         string
@@ -51,75 +78,553 @@ type CloudInfo struct {
 	BaseGroupName   string
 	TokenCredential azcore.TokenCredential
 	K8sClient       k8s.Interface
+
+	// InternalSourceServiceTag optionally specifies an Azure service tag (e.g. "VirtualNetwork") to use as the source
+	// of the internal security rules instead of allowing any source address.
+	InternalSourceServiceTag string
+
+	// StateConfigMapName, if set, is the name of a ConfigMap to which a summary of the prepared resources is written.
+	StateConfigMapName string
+
+	// StateConfigMapNamespace is the namespace of the state ConfigMap, DefaultStateConfigMapNamespace if not set.
+	StateConfigMapNamespace string
+
+	// WorkerRoleLabels are the node labels which identify worker nodes; any one of them may be present. If not set,
+	// the standard node-role.kubernetes.io/worker label is used.
+	WorkerRoleLabels []string
+
+	// GatewayNodeSelector optionally restricts the nodes which the node gateway deployer dedicates as gateways to those with
+	// all the given labels, for instance to target a zone, an instance type or nodes labelled by the operator. If not
+	// set, any worker node may become a gateway.
+	GatewayNodeSelector map[string]string
+
+	// ControlPlaneRoleLabels are the node labels which identify control plane nodes; any one of them may be present.
+	// If not set, the standard node-role.kubernetes.io/control-plane and node-role.kubernetes.io/master labels are used.
+	ControlPlaneRoleLabels []string
+
+	// VNetName optionally overrides the name of the cluster VNet, for clusters whose network wasn't provisioned by the
+	// installer. If not set, the VNet is named after the infra ID with a "-vnet" suffix.
+	VNetName string
+
+	// WorkerSubnetName optionally overrides the name of the subnet of the worker nodes. If not set, the subnet is named
+	// after the infra ID with a "-worker-subnet" suffix.
+	WorkerSubnetName string
+
+	// AdditionalWorkerSubnetNames are the names of further subnets of worker nodes in the cluster VNet, e.g. those of
+	// additional machine pools, with which the internal security group is also associated. Unlike the other cluster
+	// subnets, one which can't be looked up or associated is skipped, and reported, rather than failing.
+	AdditionalWorkerSubnetNames []string
+
+	// MasterSubnetName optionally overrides the name of the subnet of the control plane nodes. If not set, the subnet is
+	// named after the infra ID with a "-master-subnet" suffix.
+	MasterSubnetName string
+
+	// SecurityRuleDescription optionally overrides the description set on the Submariner security rules.
+	SecurityRuleDescription string
+
+	// RuleOwner optionally identifies the owner of the Submariner security rules, so that several tools can manage their
+	// own rules in the same security groups. It's encoded in the rule names, and only the rules with a matching owner, or
+	// without an owner if not set, are replaced, activated or removed. It must be alphanumeric and at most 20 characters long.
+	RuleOwner string
+
+	// PublicIPZones are the availability zones of the gateway public IPs. By default the public IPs are regional; listing
+	// all the zones of the region makes them zone-redundant, and listing a single zone pins them to that zone.
+	PublicIPZones []string
+
+	// PublicIPResourceGroup is the resource group in which the gateway public IPs are allocated, and from which they're
+	// removed on cleanup. If not set, BaseGroupName is used.
+	PublicIPResourceGroup string
+
+	// IPFamilies are the IP families, "IPv4" and/or "IPv6", of the cluster's internal traffic. The internal rules are
+	// created for each family, so dual-stack clusters should list both. If not set, only IPv4 rules are created.
+	IPFamilies []string
+
+	// Tags are additional tags set on the security groups managed by Submariner to which it adds rules and on the gateway
+	// public IPs it creates, along with InfraIDTag, and ManagedTag on those it creates.
+	Tags map[string]*string
+
+	// ResourceTimeout is the maximum time to wait for the removal of each resource during cleanup, after which
+	// cleanup moves on to the remaining resources. If not set, the value of the CLOUD_PREPARE_TIMEOUT environment
+	// variable is used, if any, otherwise a default of 5 minutes.
+	ResourceTimeout time.Duration
+
+	// OperationTimeout is the maximum time to wait for each Azure operation, such as updating a security group and
+	// associating it with the cluster subnets. If not set, the value of the CLOUD_PREPARE_TIMEOUT environment variable is
+	// used, if any, otherwise a default of 5 minutes.
+	OperationTimeout time.Duration
+
+	// SubnetNotFoundTimeout is the maximum time for which a cluster subnet which isn't found is looked up again before
+	// it's considered missing, since Azure may not find it yet right after the cluster's network is created. If not set,
+	// a default of 15 seconds is used; a negative value disables the retries.
+	SubnetNotFoundTimeout time.Duration
+
+	// subnetLookupFrequency is the time between lookups of a subnet which isn't found.
+	subnetLookupFrequency time.Duration
+
+	// publicIPAssignTimeout is the maximum time to wait for Azure to assign an address to a gateway public IP, and
+	// publicIPLookupFrequency the time between the lookups of a public IP which has none yet.
+	publicIPAssignTimeout   time.Duration
+	publicIPLookupFrequency time.Duration
+
+	// NetworkAPIVersion optionally overrides the version of the network API used, for instance for Azure Stack Hub which
+	// only supports older versions. With versions which predate the Esp and Ah security rule protocols, the ESP and AH
+	// rules allow any protocol instead.
+	NetworkAPIVersion string
+
+	// ResourceManagerEndpoint optionally specifies the URL of the Azure Resource Manager endpoint to use, for instance a
+	// private endpoint when public access to the management API is disabled.
+	ResourceManagerEndpoint string
+
+	// ResourceManagerAudience is the audience of the tokens used with ResourceManagerEndpoint. If not set, the audience
+	// of the Azure public cloud is used.
+	ResourceManagerAudience string
+
+	// ClientOptions are optionally passed to the Azure clients, for instance Cloud to target a sovereign cloud such as
+	// cloud.AzureGovernment or cloud.AzureChina, or Transport to send the requests through a custom *http.Client, e.g. a
+	// proxy or a recording transport in tests. The retries, policies and endpoint configured by the other fields are
+	// applied on top of them. If not set, or if Transport isn't set, the Azure public cloud is targeted through a
+	// dedicated HTTP client.
+	ClientOptions *arm.ClientOptions
+
+	// PostPrepare is optionally called with the result of a successful gateway deployment, once all the gateways are
+	// deployed, for instance to register the gateways with a broker. It isn't called if the deployment fails, and an
+	// error returned by it fails the deployment.
+	PostPrepare func(result PreparedResult) error
+
+	// PeerVNetCIDRs are the address ranges of peered VNets, e.g. in a hub-spoke topology, which are additionally allowed
+	// as sources of the internal security rules when these are scoped to the machine network.
+	PeerVNetCIDRs []string
+
+	// MaxSourceCIDRPorts is the maximum number of source CIDRs of the internal security rules multiplied by the number of
+	// ports, which bounds the size of the rules. If not set, a default of 4000 is used, the maximum number of addresses and
+	// ranges Azure allows in a security group; a negative value disables the check.
+	MaxSourceCIDRPorts int
+
+	// AZCommandWriter, if set, receives the az CLI commands equivalent to the changes made in Azure, one per line, so that
+	// they can be understood or reproduced manually. The changes are still made.
+	AZCommandWriter io.Writer
+
+	// commandRenderer renders the commands written to AZCommandWriter; it's created by the constructors.
+	commandRenderer *commandRenderer
+
+	// MaxConcurrentPolls is the maximum number of long-running operations polled concurrently by the Azure clients
+	// created from this CloudInfo, to avoid polls being throttled. If not set, a default of 4 is used.
+	MaxConcurrentPolls int
+
+	// pollLimiter limits the concurrent polls; it's created by the constructors.
+	pollLimiter *pollLimiter
+
+	// Concurrency is the maximum number of subnets associated concurrently with the internal security group when opening
+	// the internal ports. If not set, a default of 4 is used; 1 associates the subnets one at a time.
+	Concurrency int
+
+	// MaxPollRetries is the maximum number of consecutive times a poll of a long-running operation is retried when it fails
+	// transiently, i.e. when the operation's status can't be determined, as opposed to the operation failing. If not set,
+	// a default of 3 is used; a negative value disables the retries.
+	MaxPollRetries int
+
+	// PollInterval is the time between the first polls of a long-running operation, unless Azure requests otherwise. The
+	// interval is multiplied by PollMultiplier after each poll, up to MaxPollInterval, so that short operations complete
+	// quickly without polling long ones too often. If not set, a default of 30 seconds is used.
+	PollInterval time.Duration
+
+	// MaxPollInterval is the maximum time between polls of a long-running operation. If not set, the larger of
+	// PollInterval and 30 seconds is used.
+	MaxPollInterval time.Duration
+
+	// PollMultiplier is the factor by which the time between polls grows after each poll. If not set, or less than 1, the
+	// time between polls stays at PollInterval.
+	PollMultiplier float64
+
+	// Metrics, if set, receives the duration and outcome of each Azure API request, including retries and polling, as
+	// operations of the "azure" backend named after the HTTP method and the resource type, e.g.
+	// "PUT networkSecurityGroups". The cloud and gateway deployer operations can be observed by wrapping them with
+	// api.ObserveCloud and api.ObserveGatewayDeployer.
+	Metrics api.Metrics
+
+	// MaxRetries is the maximum number of times a failed Azure request is retried; a negative value disables retries.
+	// If not set, the value of the CLOUD_PREPARE_MAX_RETRIES environment variable is used if it's a valid number, where
+	// zero disables retries, otherwise 5. Throttled requests are retried after the delay requested by Azure, if any,
+	// otherwise with an exponential backoff with jitter; requests which fail with errors such as 403 or 404 aren't retried.
+	MaxRetries int32
+
+	// StageSecurityRules causes the Submariner security rules to be created with Deny access so that the configuration
+	// can be staged; ActivateSecurityRules then switches them to Allow. By default, the rules are created with Allow.
+	StageSecurityRules bool
+
+	// DenyUnscopedSources adds rules denying the internal ports from any source, with a lower precedence than all the
+	// Submariner rules, so that only the sources allowed by the internal rules are permitted even if a broader rule with
+	// a lower precedence allows them. By default, no deny rules are added.
+	DenyUnscopedSources bool
+
+	// EnableGatewayIPForwarding enables IP forwarding on the interfaces of the gateway nodes which have it disabled, as the
+	// traffic routed by the gateways is otherwise dropped. By default, a warning is reported for such interfaces instead.
+	EnableGatewayIPForwarding bool
+
+	// RollbackOnFailure causes a failed deployment of the node gateway deployer to undo the changes it made before failing:
+	// the gateway security group, if it created it, and the label, public IP and interface changes of the nodes it
+	// labelled as gateways. The original error is still returned. By default, the changes are left in place, to be
+	// completed by deploying again or removed by Cleanup.
+	RollbackOnFailure bool
+
+	// DiscoverPeerVNetCIDRs causes the address ranges of the VNets peered with the cluster VNet to be discovered and
+	// added to PeerVNetCIDRs.
+	DiscoverPeerVNetCIDRs bool
+
+	// DryRun causes OpenPorts and ClosePorts to report the security rules they would add or remove, and the subnets they
+	// would associate with the internal security group, without changing anything. Azure is still read so that the
+	// reported changes are accurate. The gateway deployers don't support dry runs.
+	DryRun bool
+
+	// CacheReads enables an in-memory cache, scoped to each operation, of the resources read from Azure so that repeated
+	// lookups of the same resource don't result in further API calls.
+	CacheReads bool
+
+	// AssociateSubnets causes OpenPorts to associate the internal security group with the cluster subnets, and the gateway
+	// deployers to associate the gateway security group with the subnets dedicated to the gateway nodes, if any. Subnets
+	// delegated to services which don't support network security groups, or already associated with another security
+	// group, are skipped. This requires the Microsoft.Network/virtualNetworks/subnets/write permission. By default, the
+	// subnets are left as they are.
+	AssociateSubnets bool
+}
+
+// CloudInfoOption sets a field of a CloudInfo created by NewCloudInfo. The optional fields without a dedicated option can
+// be set with a function of this type.
+type CloudInfoOption func(*CloudInfo)
+
+// WithSubscriptionID sets the ID of the Azure subscription containing the cluster.
+func WithSubscriptionID(id string) CloudInfoOption {
+	return func(info *CloudInfo) {
+		info.SubscriptionID = id
+	}
+}
+
+// WithInfraID sets the infra ID of the cluster, which prefixes the names of its Azure resources.
+func WithInfraID(infraID string) CloudInfoOption {
+	return func(info *CloudInfo) {
+		info.InfraID = infraID
+	}
+}
+
+// WithRegion sets the Azure region of the cluster.
+func WithRegion(region string) CloudInfoOption {
+	return func(info *CloudInfo) {
+		info.Region = region
+	}
+}
+
+// WithBaseGroupName sets the name of the resource group containing the cluster's resources.
+func WithBaseGroupName(name string) CloudInfoOption {
+	return func(info *CloudInfo) {
+		info.BaseGroupName = name
+	}
+}
+
+// WithTokenCredential sets the credential used to authenticate with Azure.
+func WithTokenCredential(credential azcore.TokenCredential) CloudInfoOption {
+	return func(info *CloudInfo) {
+		info.TokenCredential = credential
+	}
+}
+
+// WithK8sClient sets the client used to access the cluster's Kubernetes API.
+func WithK8sClient(client k8s.Interface) CloudInfoOption {
+	return func(info *CloudInfo) {
+		info.K8sClient = client
+	}
+}
+
+// NewCloudInfo creates a CloudInfo with the given options, and checks that the subscription ID, infra ID, region, base
+// resource group name, token credential and Kubernetes client are set, and that the optional fields are valid, so that
+// a misconfiguration is reported up front rather than failing an Azure call later.
+func NewCloudInfo(opts ...CloudInfoOption) (*CloudInfo, error) {
+	info := &CloudInfo{}
+
+	for _, opt := range opts {
+		opt(info)
+	}
+
+	missing := []string{}
+
+	for _, field := range []struct {
+		name  string
+		isSet bool
+	}{
+		{"subscription ID", info.SubscriptionID != ""},
+		{"infra ID", info.InfraID != ""},
+		{"region", info.Region != ""},
+		{"base resource group name", info.BaseGroupName != ""},
+		{"token credential", info.TokenCredential != nil},
+		{"Kubernetes client", info.K8sClient != nil},
+	} {
+		if !field.isSet {
+			missing = append(missing, field.name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, errors.Errorf("the Azure cloud info is missing the %s", strings.Join(missing, ", "))
+	}
+
+	if err := info.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid Azure cloud info")
+	}
+
+	info.initPolicies()
+
+	return info, nil
 }
 
 //nolint:wrapcheck // Let the caller wrap it.
 func (c *CloudInfo) getNsgClient() (*armnetwork.SecurityGroupsClient, error) {
-	return armnetwork.NewSecurityGroupsClient(c.SubscriptionID, c.TokenCredential, nil)
+	return armnetwork.NewSecurityGroupsClient(c.SubscriptionID, c.TokenCredential, c.networkClientOptions())
+}
+
+//nolint:wrapcheck // Let the caller wrap it.
+func (c *CloudInfo) getSubnetsClient() (*armnetwork.SubnetsClient, error) {
+	return armnetwork.NewSubnetsClient(c.SubscriptionID, c.TokenCredential, c.networkClientOptions())
+}
+
+//nolint:wrapcheck // Let the caller wrap it.
+func (c *CloudInfo) getVirtualNetworksClient() (*armnetwork.VirtualNetworksClient, error) {
+	return armnetwork.NewVirtualNetworksClient(c.SubscriptionID, c.TokenCredential, c.networkClientOptions())
 }
 
 //nolint:wrapcheck // Let the caller wrap it.
 func (c *CloudInfo) getInterfacesClient() (*armnetwork.InterfacesClient, error) {
-	return armnetwork.NewInterfacesClient(c.SubscriptionID, c.TokenCredential, nil)
+	return armnetwork.NewInterfacesClient(c.SubscriptionID, c.TokenCredential, c.networkClientOptions())
 }
 
 //nolint:wrapcheck // Let the caller wrap it.
 func (c *CloudInfo) getPublicIPClient() (*armnetwork.PublicIPAddressesClient, error) {
-	return armnetwork.NewPublicIPAddressesClient(c.SubscriptionID, c.TokenCredential, nil)
+	return armnetwork.NewPublicIPAddressesClient(c.SubscriptionID, c.TokenCredential, c.networkClientOptions())
+}
+
+//nolint:wrapcheck // Let the caller wrap it.
+func (c *CloudInfo) getNatGatewaysClient() (*armnetwork.NatGatewaysClient, error) {
+	return armnetwork.NewNatGatewaysClient(c.SubscriptionID, c.TokenCredential, c.networkClientOptions())
+}
+
+//nolint:wrapcheck // Let the caller wrap it.
+func (c *CloudInfo) getPeeringsClient() (*armnetwork.VirtualNetworkPeeringsClient, error) {
+	return armnetwork.NewVirtualNetworkPeeringsClient(c.SubscriptionID, c.TokenCredential, c.networkClientOptions())
+}
+
+//nolint:wrapcheck // Let the caller wrap it.
+func (c *CloudInfo) getVirtualHubsClient() (*armnetwork.VirtualHubsClient, error) {
+	return armnetwork.NewVirtualHubsClient(c.SubscriptionID, c.TokenCredential, c.networkClientOptions())
 }
 
 //nolint:wrapcheck // Let the caller wrap it.
 func (c *CloudInfo) getResourceSKUClient() (*armcompute.ResourceSKUsClient, error) {
-	return armcompute.NewResourceSKUsClient(c.SubscriptionID, c.TokenCredential, nil)
+	return armcompute.NewResourceSKUsClient(c.SubscriptionID, c.TokenCredential, c.armClientOptions())
 }
 
-func (c *CloudInfo) openInternalPorts(infraID string, ports []api.PortSpec, nsgClient *armnetwork.SecurityGroupsClient) error {
+// openInternalPorts adds the internal rules to the internal security group and, if AssociateSubnets is set, associates it
+// with the cluster subnets, returning the subnets which were skipped.
+func (c *CloudInfo) openInternalPorts(ctx context.Context, infraID string, ports []api.PortSpec,
+	nsgClient *armnetwork.SecurityGroupsClient, subnetClient *armnetwork.SubnetsClient, status reporter.Interface,
+) ([]skippedSubnet, error) {
 	groupName := infraID + internalSecurityGroupSuffix
 
-	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
+	ctx, cancel := c.opContext(ctx)
 	defer cancel()
 
+	if err := c.validateNamedSubnets(ctx, infraID, subnetClient); err != nil {
+		return nil, err
+	}
+
 	nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
 	if err != nil {
-		return errors.Wrapf(err, "error getting the security group %q", groupName)
+		return nil, errors.Wrapf(err, "error getting the security group %q", groupName)
 	}
 
 	if nwSecurityGroup.Properties == nil {
 		nwSecurityGroup.Properties = &armnetwork.SecurityGroupPropertiesFormat{}
 	}
 
-	isFound := checkIfSecurityRulesPresent(nwSecurityGroup.Properties.SecurityRules)
-	if isFound {
-		return nil
+	securityRules, changed, err := c.planInternalRules(ctx, groupName, nwSecurityGroup.Properties.SecurityRules, ports, status)
+	if err != nil {
+		return nil, err
 	}
 
-	for i, port := range ports {
-		p := int32(i) //nolint:gosec // Ignore integer overflow conversion
+	if changed && c.DryRun {
+		reportRuleChanges(groupName, nwSecurityGroup.Properties.SecurityRules, securityRules, status)
+	} else if changed {
+		nwSecurityGroup.Properties.SecurityRules = securityRules
+
+		if count := len(nwSecurityGroup.Properties.SecurityRules); count > securityRulesWarningThreshold {
+			status.Warning("Security group %q has %d rules, approaching the maximum of %d", groupName, count, MaxSecurityRules)
+		}
+
+		stampRulesModified(&nwSecurityGroup.SecurityGroup)
+		c.tagSecurityGroup(&nwSecurityGroup.SecurityGroup, false)
 
-		nwSecurityGroup.Properties.SecurityRules = append(nwSecurityGroup.Properties.SecurityRules,
-			c.createSecurityRule(internalSecurityRulePrefix, armnetwork.SecurityRuleProtocol(port.Protocol), port.Port,
-				basePriorityInternal+p, armnetwork.SecurityRuleDirectionInbound),
-			c.createSecurityRule(internalSecurityRulePrefix, armnetwork.SecurityRuleProtocol(port.Protocol), port.Port,
-				basePriorityInternal+p, armnetwork.SecurityRuleDirectionOutbound))
+		poller, err := nsgClient.BeginCreateOrUpdate(ctx, c.BaseGroupName, groupName, nwSecurityGroup.SecurityGroup, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "updating security group %q with submariner rules failed", groupName)
+		}
+
+		_, err = pollUntilDone(ctx, poller, c.pollOptions())
+		if err != nil {
+			return nil, errors.Wrapf(err, "error updating  security group %q with submariner rules", groupName)
+		}
 	}
 
-	poller, err := nsgClient.BeginCreateOrUpdate(ctx, c.BaseGroupName, groupName, nwSecurityGroup.SecurityGroup, nil)
+	if !c.AssociateSubnets {
+		return nil, nil
+	}
+
+	return c.associateSubnets(ctx, infraID, &nwSecurityGroup.SecurityGroup, subnetClient, status)
+}
+
+// reportRuleChanges reports the rules which replacing the existing rules of the given security group with the planned
+// rules would add, rewrite and remove.
+func reportRuleChanges(groupName string, existing, planned []*armnetwork.SecurityRule, status reporter.Interface) {
+	existingNames := ruleNames(existing)
+	plannedNames := ruleNames(planned)
+
+	added := plannedNames.Difference(existingNames).SortedList()
+	if len(added) > 0 {
+		status.Success("Would add the rules %s to security group %q", strings.Join(added, ", "), groupName)
+	}
+
+	// The planned rules which are kept as they are are the existing rules themselves.
+	rewritten := set.New[string]()
+
+	for _, rule := range planned {
+		if rule.Name != nil && existingNames.Has(*rule.Name) && !slices.Contains(existing, rule) {
+			rewritten.Insert(*rule.Name)
+		}
+	}
+
+	if rewritten.Len() > 0 {
+		status.Success("Would rewrite the rules %s in security group %q", strings.Join(rewritten.SortedList(), ", "), groupName)
+	}
+
+	removed := existingNames.Difference(plannedNames).SortedList()
+	if len(removed) > 0 {
+		status.Success("Would remove the rules %s from security group %q", strings.Join(removed, ", "), groupName)
+	}
+}
+
+func ruleNames(rules []*armnetwork.SecurityRule) set.Set[string] {
+	names := set.New[string]()
+
+	for _, rule := range rules {
+		if rule.Name != nil {
+			names.Insert(*rule.Name)
+		}
+	}
+
+	return names
+}
+
+// planInternalRules returns the rules which the given internal security group should have for the given ports, given its
+// existing rules, along with whether they differ from the existing rules.
+func (c *CloudInfo) planInternalRules(ctx context.Context, groupName string, existing []*armnetwork.SecurityRule, ports []api.PortSpec,
+	status reporter.Interface,
+) ([]*armnetwork.SecurityRule, bool, error) {
+	sourceAddressPrefixes := c.internalSourceAddressPrefixes(ctx, status)
+
+	securityRules, rewritten, missing := c.reconcileInternalRules(existing, ports, sourceAddressPrefixes)
+
+	securityRules, denyRulesChanged, err := c.reconcileDenyRules(securityRules, ports)
 	if err != nil {
-		return errors.Wrapf(err, "updating security group %q with submariner rules failed", groupName)
+		return nil, false, errors.Wrapf(err, "error allocating the priorities of the deny rules in security group %q", groupName)
 	}
 
-	_, err = poller.PollUntilDone(ctx, nil)
+	if len(missing) == 0 && !rewritten && !denyRulesChanged && len(securityRules) == len(existing) {
+		return existing, false, nil
+	}
 
-	return errors.Wrapf(err, "error updating  security group %q with submariner rules", groupName)
+	if len(missing) > 0 || rewritten {
+		if maxCIDRPorts := c.maxSourceCIDRPorts(); maxCIDRPorts > 0 && len(sourceAddressPrefixes)*len(ports) > maxCIDRPorts {
+			return nil, false, errors.Errorf("%d source CIDRs for %d ports exceed the maximum of %d combinations; aggregate the "+
+				"CIDRs or use a service tag as the source instead", len(sourceAddressPrefixes), len(ports), maxCIDRPorts)
+		}
+
+		priorities, err := nextAvailablePriorities(securityRules, basePriorityInternal, len(missing))
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "error allocating the priorities of the internal rules in security group %q", groupName)
+		}
+
+		for i, rule := range missing {
+			for _, direction := range rule.directions {
+				securityRules = append(securityRules, c.createFamilySecurityRule(internalSecurityRulePrefix, rule.family,
+					securityRuleProtocol(rule.port.Protocol), rangeOf(rule.port), priorities[i], direction,
+					familyAddressPrefixes(sourceAddressPrefixes, rule.family)))
+			}
+		}
+	}
+
+	if err := validateSecurityRules(securityRules); err != nil {
+		return nil, false, errors.Wrapf(err, "invalid security rules for security group %q", groupName)
+	}
+
+	return securityRules, true, nil
 }
 
-func (c *CloudInfo) removeInternalFirewallRules(infraID string, nsgClient *armnetwork.SecurityGroupsClient) error {
+// PreviewInternalRulePriorities returns the priorities, keyed by rule name, of the internal Submariner rules which opening
+// the given ports would result in, given the current rules of the internal security group, without changing anything.
+// This allows the priorities to be reviewed, e.g. for clashes with other rules, before the ports are opened.
+func (c *CloudInfo) PreviewInternalRulePriorities(ctx context.Context, ports []api.PortSpec, status reporter.Interface,
+) (map[string]int32, error) {
+	if err := c.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid Azure configuration")
+	}
+
+	nsgClient, err := c.getNsgClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the network security groups client")
+	}
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	groupName := c.InfraID + internalSecurityGroupSuffix
+
+	nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting the security group %q", groupName)
+	}
+
+	var existing []*armnetwork.SecurityRule
+	if nwSecurityGroup.Properties != nil {
+		existing = nwSecurityGroup.Properties.SecurityRules
+	}
+
+	securityRules, _, err := c.planInternalRules(ctx, groupName, existing, api.SortPorts(ports), status)
+	if err != nil {
+		return nil, err
+	}
+
+	priorities := map[string]int32{}
+
+	for _, rule := range securityRules {
+		if strings.HasPrefix(ptr.Deref(rule.Name, ""), internalSecurityRulePrefix) && c.ownsSecurityRule(rule) &&
+			rule.Properties != nil && rule.Properties.Priority != nil {
+			priorities[*rule.Name] = *rule.Properties.Priority
+		}
+	}
+
+	return priorities, nil
+}
+
+func (c *CloudInfo) removeInternalFirewallRules(ctx context.Context, infraID string, nsgClient *armnetwork.SecurityGroupsClient,
+	status reporter.Interface,
+) error {
 	groupName := infraID + internalSecurityGroupSuffix
 
-	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
+	ctx, cancel := c.opContext(ctx)
 	defer cancel()
 
 	nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
+	if isNotFound(err) {
+		status.Success("The security group %q no longer exists, it's already cleaned up", groupName)
+		return nil
+	}
+
 	if err != nil {
 		return errors.Wrapf(err, "error getting the security group %q", groupName)
 	}
@@ -131,55 +636,637 @@ func (c *CloudInfo) removeInternalFirewallRules(infraID string, nsgClient *armne
 	securityRules := []*armnetwork.SecurityRule{}
 
 	for _, existingSGRule := range nwSecurityGroup.Properties.SecurityRules {
-		if existingSGRule.Name != nil && !strings.Contains(*existingSGRule.Name, internalSecurityRulePrefix) {
+		if existingSGRule.Name != nil && (!strings.Contains(*existingSGRule.Name, internalSecurityRulePrefix) ||
+			!c.ownsSecurityRule(existingSGRule)) {
 			securityRules = append(securityRules, existingSGRule)
 		}
 	}
 
+	if c.DryRun {
+		reportRuleChanges(groupName, nwSecurityGroup.Properties.SecurityRules, securityRules, status)
+		return nil
+	}
+
 	nwSecurityGroup.Properties.SecurityRules = securityRules
+	stampRulesModified(&nwSecurityGroup.SecurityGroup)
 
 	poller, err := nsgClient.BeginCreateOrUpdate(ctx, c.BaseGroupName, groupName, nwSecurityGroup.SecurityGroup, nil)
 	if err != nil {
 		return errors.Wrapf(err, "removing submariner rules from  security group %q failed", groupName)
 	}
 
-	_, err = poller.PollUntilDone(ctx, nil)
+	_, err = pollUntilDone(ctx, poller, c.pollOptions())
 
 	return errors.Wrapf(err, "removing submariner rules from security group %q failed", groupName)
 }
 
-func checkIfSecurityRulesPresent(securityRules []*armnetwork.SecurityRule) bool {
-	for _, existingSGRule := range securityRules {
-		if existingSGRule.Name != nil && strings.Contains(*existingSGRule.Name, internalSecurityRulePrefix) {
-			return true
+// RemoveAllSubmarinerRules removes the Submariner security rules from every network security group in the resource
+// group, including shared groups and rules created by other, possibly deleted, clusters. Other rules are left untouched.
+func (c *CloudInfo) RemoveAllSubmarinerRules(ctx context.Context, status reporter.Interface) error {
+	status = withRemediationHints(status)
+
+	status.Start("Removing the Submariner security rules from all security groups in resource group %q", c.BaseGroupName)
+	defer status.End()
+
+	nsgClient, err := c.getNsgClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network security groups client")
+	}
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	var errs []error
+
+	pager := nsgClient.NewListPager(c.BaseGroupName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return status.Error(err, "error listing the security groups in resource group %q", c.BaseGroupName)
+		}
+
+		for _, nwSecurityGroup := range page.Value {
+			if err := c.removeSubmarinerRules(ctx, nwSecurityGroup, nsgClient); err != nil {
+				errs = append(errs, status.Error(err, "Failed to remove the Submariner rules from security group %q",
+					ptr.Deref(nwSecurityGroup.Name, "")))
+			}
 		}
 	}
 
-	return false
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	status.Success("Removed the Submariner security rules from resource group %q", c.BaseGroupName)
+
+	return nil
 }
 
-func (c *CloudInfo) createSecurityRule(securityRulePrfix string, protocol armnetwork.SecurityRuleProtocol, port uint16, priority int32,
+func (c *CloudInfo) removeSubmarinerRules(ctx context.Context, nwSecurityGroup *armnetwork.SecurityGroup,
+	nsgClient *armnetwork.SecurityGroupsClient,
+) error {
+	if nwSecurityGroup.Name == nil || nwSecurityGroup.Properties == nil {
+		return nil
+	}
+
+	securityRules := []*armnetwork.SecurityRule{}
+
+	for _, existingSGRule := range nwSecurityGroup.Properties.SecurityRules {
+		if !c.ownsSecurityRule(existingSGRule) {
+			securityRules = append(securityRules, existingSGRule)
+		}
+	}
+
+	if len(securityRules) == len(nwSecurityGroup.Properties.SecurityRules) {
+		return nil
+	}
+
+	nwSecurityGroup.Properties.SecurityRules = securityRules
+	stampRulesModified(nwSecurityGroup)
+
+	poller, err := nsgClient.BeginCreateOrUpdate(ctx, c.BaseGroupName, *nwSecurityGroup.Name, *nwSecurityGroup, nil)
+	if err != nil {
+		return errors.Wrapf(err, "removing submariner rules from security group %q failed", *nwSecurityGroup.Name)
+	}
+
+	_, err = pollUntilDone(ctx, poller, c.pollOptions())
+
+	return errors.Wrapf(err, "removing submariner rules from security group %q failed", *nwSecurityGroup.Name)
+}
+
+func isSubmarinerSecurityRule(rule *armnetwork.SecurityRule) bool {
+	return rule.Name != nil && (strings.HasPrefix(*rule.Name, internalSecurityRulePrefix) ||
+		strings.HasPrefix(*rule.Name, externalSecurityRulePrefix))
+}
+
+// ownsSecurityRule checks whether the given rule is a Submariner rule belonging to the configured RuleOwner.
+func (c *CloudInfo) ownsSecurityRule(rule *armnetwork.SecurityRule) bool {
+	return isSubmarinerSecurityRule(rule) && securityRuleOwner(*rule.Name) == c.RuleOwner
+}
+
+// securityRuleOwner returns the owner encoded in the name of a Submariner rule, if any.
+func securityRuleOwner(name string) string {
+	for _, prefix := range []string{
+		metricsSecurityRulePrefix, denySecurityRulePrefix, internalSecurityRulePrefix, bgpSecurityRulePrefix, externalSecurityRulePrefix,
+	} {
+		rest, found := strings.CutPrefix(name, prefix)
+		if !found {
+			continue
+		}
+
+		rest, found = strings.CutPrefix(rest, ruleOwnerMarker)
+		if !found {
+			return ""
+		}
+
+		owner, _, _ := strings.Cut(rest, "-")
+
+		return owner
+	}
+
+	return ""
+}
+
+// nextAvailablePriorities returns count priorities, from base upwards, which aren't used by any of the given rules, so
+// that new rules don't clash with those of other owners or with user rules. It fails if there aren't enough free
+// priorities below the maximum priority allowed by Azure.
+func nextAvailablePriorities(rules []*armnetwork.SecurityRule, base int32, count int) ([]int32, error) {
+	used := set.New[int32]()
+
+	for _, rule := range rules {
+		if rule.Properties != nil && rule.Properties.Priority != nil {
+			used.Insert(*rule.Properties.Priority)
+		}
+	}
+
+	priorities := []int32{}
+
+	for priority := base; len(priorities) < count; priority++ {
+		if priority > maxSecurityRulePriority {
+			return nil, errors.Errorf("there are only %d free security rule priorities from %d to %d, %d are needed",
+				len(priorities), base, maxSecurityRulePriority, count)
+		}
+
+		if !used.Has(priority) {
+			priorities = append(priorities, priority)
+		}
+	}
+
+	return priorities, nil
+}
+
+// ActivateSecurityRules switches the Submariner security rules staged with Deny access, as requested by
+// StageSecurityRules, to Allow.
+func (c *CloudInfo) ActivateSecurityRules(ctx context.Context, status reporter.Interface) error {
+	status = withRemediationHints(status)
+
+	status.Start("Activating the Submariner security rules")
+	defer status.End()
+
+	nsgClient, err := c.getNsgClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network security groups client")
+	}
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	for _, groupName := range []string{c.InfraID + internalSecurityGroupSuffix, c.InfraID + externalSecurityGroupSuffix} {
+		if err := c.activateSecurityRules(ctx, groupName, nsgClient); err != nil {
+			return status.Error(err, "Failed to activate the Submariner security rules in security group %q", groupName)
+		}
+	}
+
+	status.Success("Activated the Submariner security rules")
+
+	return nil
+}
+
+func (c *CloudInfo) activateSecurityRules(ctx context.Context, groupName string, nsgClient *armnetwork.SecurityGroupsClient) error {
+	nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
+	if isNotFound(err) {
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "error getting the security group %q", groupName)
+	}
+
+	if nwSecurityGroup.Properties == nil {
+		return nil
+	}
+
+	activated := false
+
+	for _, rule := range nwSecurityGroup.Properties.SecurityRules {
+		if c.ownsSecurityRule(rule) && !isDenySecurityRule(rule) && rule.Properties != nil && rule.Properties.Access != nil &&
+			*rule.Properties.Access == armnetwork.SecurityRuleAccessDeny {
+			rule.Properties.Access = ptr.To(armnetwork.SecurityRuleAccessAllow)
+			activated = true
+		}
+	}
+
+	if !activated {
+		return nil
+	}
+
+	stampRulesModified(&nwSecurityGroup.SecurityGroup)
+
+	poller, err := nsgClient.BeginCreateOrUpdate(ctx, c.BaseGroupName, groupName, nwSecurityGroup.SecurityGroup, nil)
+	if err != nil {
+		return errors.Wrapf(err, "activating the submariner rules in security group %q failed", groupName)
+	}
+
+	_, err = pollUntilDone(ctx, poller, c.pollOptions())
+
+	return errors.Wrapf(err, "activating the submariner rules in security group %q failed", groupName)
+}
+
+// isInternalSecurityRule checks whether the given rule is one of the internal rules, excluding the metrics rules, belonging
+// to the configured RuleOwner.
+func (c *CloudInfo) isInternalSecurityRule(rule *armnetwork.SecurityRule) bool {
+	return rule.Name != nil && strings.Contains(*rule.Name, internalSecurityRulePrefix) &&
+		!strings.HasPrefix(*rule.Name, metricsSecurityRulePrefix) && !isDenySecurityRule(rule) && c.ownsSecurityRule(rule)
+}
+
+func isDenySecurityRule(rule *armnetwork.SecurityRule) bool {
+	return rule.Name != nil && strings.HasPrefix(*rule.Name, denySecurityRulePrefix)
+}
+
+// reconcileDenyRules returns the given rules with the deny rules for the given ports, if DenyUnscopedSources is set, and
+// without any other deny rules, along with whether they changed. It fails if the deny rules can't be given priorities.
+func (c *CloudInfo) reconcileDenyRules(rules []*armnetwork.SecurityRule, ports []api.PortSpec,
+) ([]*armnetwork.SecurityRule, bool, error) {
+	desired := []*armnetwork.SecurityRule{}
+	if c.DenyUnscopedSources {
+		for _, port := range ports {
+			desired = append(desired, c.createPortSecurityRule(denySecurityRulePrefix, port, 0, armnetwork.SecurityRuleDirectionInbound,
+				[]string{"*"}))
+		}
+	}
+
+	kept := []*armnetwork.SecurityRule{}
+	existing := set.New[string]()
+
+	for _, rule := range rules {
+		if isDenySecurityRule(rule) && c.ownsSecurityRule(rule) {
+			existing.Insert(*rule.Name)
+			continue
+		}
+
+		kept = append(kept, rule)
+	}
+
+	desiredNames := set.New[string]()
+	for _, rule := range desired {
+		desiredNames.Insert(*rule.Name)
+	}
+
+	if existing.Equal(desiredNames) {
+		return rules, false, nil
+	}
+
+	priorities, err := nextAvailablePriorities(kept, basePriorityDeny, len(desired))
+	if err != nil {
+		return nil, false, err
+	}
+
+	for i, rule := range desired {
+		rule.Properties.Priority = ptr.To(priorities[i])
+		rule.Properties.Access = ptr.To(armnetwork.SecurityRuleAccessDeny)
+		kept = append(kept, rule)
+	}
+
+	return kept, true, nil
+}
+
+var ruleDirections = []armnetwork.SecurityRuleDirection{
+	armnetwork.SecurityRuleDirectionInbound, armnetwork.SecurityRuleDirectionOutbound,
+}
+
+// missingRule is a requested port for which internal rules of the given IP family have to be created in the given
+// directions, sharing a priority.
+type missingRule struct {
+	port       api.PortSpec
+	family     string
+	directions []armnetwork.SecurityRuleDirection
+}
+
+// reconcileInternalRules returns the given rules without the internal rules for ports which are no longer requested, and
+// with the internal rules which differ from those the requested ports need, e.g. in their sources, rewritten with their
+// existing priorities, along with whether any was rewritten and the internal rules which are missing for the requested
+// ports. Other rules are left untouched.
+func (c *CloudInfo) reconcileInternalRules(rules []*armnetwork.SecurityRule, ports []api.PortSpec, sourceAddressPrefixes []string,
+) ([]*armnetwork.SecurityRule, bool, []missingRule) {
+	desired := map[string]*armnetwork.SecurityRule{}
+
+	for _, port := range ports {
+		for _, family := range c.ipFamilies() {
+			for _, direction := range ruleDirections {
+				rule := c.createFamilySecurityRule(internalSecurityRulePrefix, family, securityRuleProtocol(port.Protocol), rangeOf(port),
+					0, direction, familyAddressPrefixes(sourceAddressPrefixes, family))
+				desired[*rule.Name] = rule
+			}
+		}
+	}
+
+	found := map[string]bool{}
+	kept := []*armnetwork.SecurityRule{}
+	rewritten := false
+
+	for _, rule := range rules {
+		if c.isInternalSecurityRule(rule) {
+			wanted, ok := desired[*rule.Name]
+			if !ok || rule.Properties == nil {
+				continue
+			}
+
+			found[*rule.Name] = true
+
+			// Staged rules which were since activated are kept active.
+			if c.StageSecurityRules && strings.EqualFold(string(ptr.Deref(rule.Properties.Access, "")),
+				string(armnetwork.SecurityRuleAccessAllow)) {
+				wanted.Properties.Access = rule.Properties.Access
+			}
+
+			if !internalRuleMatches(rule, wanted) {
+				wanted.Properties.Priority = rule.Properties.Priority
+				rule = wanted
+				rewritten = true
+			}
+		}
+
+		kept = append(kept, rule)
+	}
+
+	missing := []missingRule{}
+
+	for _, port := range ports {
+		for _, family := range c.ipFamilies() {
+			rule := missingRule{port: port, family: family}
+
+			for _, direction := range ruleDirections {
+				name := c.securityRuleName(internalSecurityRulePrefix, family, securityRuleProtocol(port.Protocol), rangeOf(port),
+					direction)
+				if !found[name] {
+					found[name] = true
+
+					rule.directions = append(rule.directions, direction)
+				}
+			}
+
+			if len(rule.directions) > 0 {
+				missing = append(missing, rule)
+			}
+		}
+	}
+
+	return kept, rewritten, missing
+}
+
+// internalRuleMatches returns whether the given existing internal rule has the sources, destination ports, protocol and
+// access of the wanted rule.
+func internalRuleMatches(existing, wanted *armnetwork.SecurityRule) bool {
+	return strings.EqualFold(string(ptr.Deref(existing.Properties.Protocol, "")), string(*wanted.Properties.Protocol)) &&
+		strings.EqualFold(string(ptr.Deref(existing.Properties.Access, "")), string(*wanted.Properties.Access)) &&
+		asPortRange(ptr.Deref(existing.Properties.DestinationPortRange, "")) == asPortRange(*wanted.Properties.DestinationPortRange) &&
+		len(existing.Properties.DestinationPortRanges) == 0 &&
+		ruleSourceAddressPrefixes(existing).Equal(ruleSourceAddressPrefixes(wanted))
+}
+
+// asPortRange returns the given destination port range with a single port written as a range, since Azure accepts both.
+func asPortRange(ports string) string {
+	if ports == "*" || ports == "" || strings.Contains(ports, "-") {
+		return ports
+	}
+
+	return ports + "-" + ports
+}
+
+func ruleSourceAddressPrefixes(rule *armnetwork.SecurityRule) set.Set[string] {
+	prefixes := set.New[string]()
+
+	if rule.Properties.SourceAddressPrefix != nil {
+		prefixes.Insert(*rule.Properties.SourceAddressPrefix)
+	}
+
+	for _, prefix := range rule.Properties.SourceAddressPrefixes {
+		if prefix != nil {
+			prefixes.Insert(*prefix)
+		}
+	}
+
+	return prefixes
+}
+
+// portRange is the range of ports, inclusive, covered by a security rule; first and last are equal for a single port.
+type portRange struct {
+	first, last uint16
+}
+
+func singlePort(port uint16) portRange {
+	return portRange{first: port, last: port}
+}
+
+func rangeOf(port api.PortSpec) portRange {
+	return portRange{first: port.Port, last: port.LastPort()}
+}
+
+// destination returns the range in the form of a security rule's destination port range.
+func (r portRange) destination() string {
+	return strconv.Itoa(int(r.first)) + "-" + strconv.Itoa(int(r.last))
+}
+
+// nameToken returns the range as it appears in security rule names: the port alone for a single port, so that existing
+// rules are recognized, otherwise the first and last ports joined with an underscore since the name's parts are
+// separated by hyphens. With the longest rule owner, ranges still fit within Azure's rule name length limit.
+func (r portRange) nameToken() string {
+	if r.first == r.last {
+		return strconv.Itoa(int(r.first))
+	}
+
+	return strconv.Itoa(int(r.first)) + "_" + strconv.Itoa(int(r.last))
+}
+
+func (r portRange) String() string {
+	if r.first == r.last {
+		return strconv.Itoa(int(r.first))
+	}
+
+	return r.destination()
+}
+
+// securityRuleProtocol maps the given protocol to its Azure representation, which is case-sensitive.
+func securityRuleProtocol(protocol string) armnetwork.SecurityRuleProtocol {
+	for _, p := range armnetwork.PossibleSecurityRuleProtocolValues() {
+		if strings.EqualFold(string(p), protocol) {
+			return p
+		}
+	}
+
+	return armnetwork.SecurityRuleProtocol(protocol)
+}
+
+// hasDestinationPorts returns whether rules for the given protocol are scoped to destination ports; Azure doesn't
+// qualify ICMP, ESP or AH by port, so their rules apply to all ports.
+func hasDestinationPorts(protocol string) bool {
+	return api.UsesPorts(protocol) && !strings.EqualFold(protocol, api.ProtocolICMP)
+}
+
+// modulePath is the path of the module whose version is recorded in the security rule descriptions.
+const modulePath = "github.com/submariner-io/cloud-prepare"
+
+// moduleVersion is the version of this module built into the running binary, or empty if it isn't known, e.g. when it's
+// built from a local checkout.
+var moduleVersion = func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	version := info.Main.Version
+	if info.Main.Path != modulePath {
+		version = ""
+
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				version = dep.Version
+				break
+			}
+		}
+	}
+
+	if version == "(devel)" {
+		return ""
+	}
+
+	return version
+}()
+
+func (c *CloudInfo) securityRuleDescription(securityRulePrfix string, protocol armnetwork.SecurityRuleProtocol, ports portRange,
+) string {
+	if c.SecurityRuleDescription != "" {
+		return c.SecurityRuleDescription
+	}
+
+	creator := "Submariner"
+	if moduleVersion != "" {
+		creator += " " + moduleVersion
+	}
+
+	verb := "allow"
+	purpose := "intra-cluster"
+
+	switch securityRulePrfix {
+	case externalSecurityRulePrefix:
+		purpose = "inter-cluster gateway"
+	case metricsSecurityRulePrefix:
+		purpose = "metrics scraping"
+	case denySecurityRulePrefix:
+		verb = "deny"
+		purpose = "unscoped"
+	case bgpSecurityRulePrefix:
+		purpose = "BGP peering"
+	}
+
+	if !hasDestinationPorts(string(protocol)) {
+		return fmt.Sprintf("Created by %s to %s %s %s traffic", creator, verb, purpose, protocol)
+	}
+
+	return fmt.Sprintf("Created by %s to %s %s traffic on %s/%s", creator, verb, purpose, ports, protocol)
+}
+
+func (c *CloudInfo) securityRuleName(securityRulePrfix, family string, protocol armnetwork.SecurityRuleProtocol, ports portRange,
 	ruleDirection armnetwork.SecurityRuleDirection,
+) string {
+	owner := ""
+	if c.RuleOwner != "" {
+		owner = ruleOwnerMarker + c.RuleOwner + "-"
+	}
+
+	// IPv4 rules keep their original names so that existing rules are recognized.
+	if family == ipFamilyIPv6 {
+		owner += ipv6RuleMarker
+	}
+
+	return securityRulePrfix + owner + string(protocol) + "-" + ports.nameToken() + "-" + string(ruleDirection)
+}
+
+func (c *CloudInfo) ipFamilies() []string {
+	if len(c.IPFamilies) == 0 {
+		return []string{ipFamilyIPv4}
+	}
+
+	return c.IPFamilies
+}
+
+func allNetworkCIDRFor(family string) string {
+	if family == ipFamilyIPv6 {
+		return allIPv6NetworkCIDR
+	}
+
+	return allNetworkCIDR
+}
+
+// familyAddressPrefixes returns the given address prefixes which belong to the given IP family, along with any service
+// tags, since Azure doesn't allow mixing families in a rule. If there are none, all the addresses of the family are used.
+func familyAddressPrefixes(prefixes []string, family string) []string {
+	result := []string{}
+
+	for _, prefix := range prefixes {
+		_, cidr, err := net.ParseCIDR(prefix)
+		if err != nil || (cidr.IP.To4() == nil) == (family == ipFamilyIPv6) {
+			result = append(result, prefix)
+		}
+	}
+
+	if len(result) == 0 {
+		return []string{allNetworkCIDRFor(family)}
+	}
+
+	return result
+}
+
+func (c *CloudInfo) createSecurityRule(securityRulePrfix string, protocol armnetwork.SecurityRuleProtocol, port uint16, priority int32,
+	ruleDirection armnetwork.SecurityRuleDirection, sourceAddressPrefixes []string,
+) *armnetwork.SecurityRule {
+	return c.createFamilySecurityRule(securityRulePrfix, ipFamilyIPv4, protocol, singlePort(port), priority, ruleDirection,
+		sourceAddressPrefixes)
+}
+
+// createPortSecurityRule creates an IPv4 security rule for the given port specification, which may be a range.
+func (c *CloudInfo) createPortSecurityRule(securityRulePrfix string, port api.PortSpec, priority int32,
+	ruleDirection armnetwork.SecurityRuleDirection, sourceAddressPrefixes []string,
+) *armnetwork.SecurityRule {
+	return c.createFamilySecurityRule(securityRulePrfix, ipFamilyIPv4, securityRuleProtocol(port.Protocol), rangeOf(port), priority,
+		ruleDirection, sourceAddressPrefixes)
+}
+
+func (c *CloudInfo) createFamilySecurityRule(securityRulePrfix, family string, protocol armnetwork.SecurityRuleProtocol,
+	ports portRange, priority int32, ruleDirection armnetwork.SecurityRuleDirection, sourceAddressPrefixes []string,
 ) *armnetwork.SecurityRule {
 	access := armnetwork.SecurityRuleAccessAllow
+	if c.StageSecurityRules {
+		access = armnetwork.SecurityRuleAccessDeny
+	}
+
+	destinationPortRange := ports.destination()
+	if !hasDestinationPorts(string(protocol)) {
+		destinationPortRange = "*"
+	}
 
-	return &armnetwork.SecurityRule{
-		Name: ptr.To(securityRulePrfix + string(protocol) + "-" + strconv.Itoa(int(port)) + "-" + string(ruleDirection)),
+	ruleProtocol := protocol
+	if !api.UsesPorts(string(protocol)) && !c.supportsESPAndAH() {
+		ruleProtocol = armnetwork.SecurityRuleProtocolAsterisk
+	}
+
+	rule := &armnetwork.SecurityRule{
+		Name: ptr.To(c.securityRuleName(securityRulePrfix, family, protocol, ports, ruleDirection)),
 		Properties: &armnetwork.SecurityRulePropertiesFormat{
-			Protocol:                 &protocol,
-			DestinationPortRange:     ptr.To(strconv.Itoa(int(port)) + "-" + strconv.Itoa(int(port))),
-			SourceAddressPrefix:      ptr.To(allNetworkCIDR),
-			DestinationAddressPrefix: ptr.To(allNetworkCIDR),
+			Protocol:                 &ruleProtocol,
+			Description:              ptr.To(c.securityRuleDescription(securityRulePrfix, protocol, ports)),
+			DestinationPortRange:     ptr.To(destinationPortRange),
+			DestinationAddressPrefix: ptr.To(allNetworkCIDRFor(family)),
 			SourcePortRange:          ptr.To("*"),
 			Access:                   &access,
 			Direction:                &ruleDirection,
 			Priority:                 ptr.To(priority),
 		},
 	}
+
+	if len(sourceAddressPrefixes) == 1 {
+		rule.Properties.SourceAddressPrefix = ptr.To(sourceAddressPrefixes[0])
+	} else {
+		rule.Properties.SourceAddressPrefixes = to.SliceOfPtrs(sourceAddressPrefixes...)
+	}
+
+	return rule
 }
 
-func (c *CloudInfo) createGWSecurityGroup(groupName string, ports []api.PortSpec, nsgClient *armnetwork.SecurityGroupsClient) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
+func (c *CloudInfo) createGWSecurityGroup(ctx context.Context, groupName string, ports []api.PortSpec,
+	nsgClient *armnetwork.SecurityGroupsClient,
+) error {
+	ctx, cancel := c.opContext(ctx)
 	defer cancel()
 
 	isFound := c.checkIfSecurityGroupPresent(ctx, groupName, nsgClient)
@@ -192,10 +1279,14 @@ func (c *CloudInfo) createGWSecurityGroup(groupName string, ports []api.PortSpec
 	for i, port := range ports {
 		p := int32(i) //nolint:gosec // Ignore integer overflow conversion
 		securityRules = append(securityRules,
-			c.createSecurityRule(externalSecurityRulePrefix, armnetwork.SecurityRuleProtocol(port.Protocol), port.Port,
-				baseExternalInternal+p, armnetwork.SecurityRuleDirectionInbound),
-			c.createSecurityRule(externalSecurityRulePrefix, armnetwork.SecurityRuleProtocol(port.Protocol), port.Port,
-				baseExternalInternal+p, armnetwork.SecurityRuleDirectionOutbound))
+			c.createPortSecurityRule(externalSecurityRulePrefix, port, baseExternalInternal+p, armnetwork.SecurityRuleDirectionInbound,
+				[]string{allNetworkCIDR}),
+			c.createPortSecurityRule(externalSecurityRulePrefix, port, baseExternalInternal+p, armnetwork.SecurityRuleDirectionOutbound,
+				[]string{allNetworkCIDR}))
+	}
+
+	if err := validateSecurityRules(securityRules); err != nil {
+		return errors.Wrapf(err, "invalid security rules for security group %q", groupName)
 	}
 
 	nwSecurityGroup := armnetwork.SecurityGroup{
@@ -206,34 +1297,44 @@ func (c *CloudInfo) createGWSecurityGroup(groupName string, ports []api.PortSpec
 		},
 	}
 
+	c.tagSecurityGroup(&nwSecurityGroup, true)
+	stampRulesModified(&nwSecurityGroup)
+
 	poller, err := nsgClient.BeginCreateOrUpdate(ctx, c.BaseGroupName, groupName, nwSecurityGroup, nil)
 	if err != nil {
 		return errors.Wrapf(err, "creating security group %q failed", groupName)
 	}
 
-	_, err = poller.PollUntilDone(ctx, nil)
+	_, err = pollUntilDone(ctx, poller, c.pollOptions())
 
 	return errors.Wrapf(err, "Error creating  security group %v ", groupName)
 }
 
-func (c *CloudInfo) prepareGWInterface(nodeName, groupName string, nsgClient *armnetwork.SecurityGroupsClient,
-	nwClient *armnetwork.InterfacesClient, pubIPClient *armnetwork.PublicIPAddressesClient,
-) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
+// prepareGWInterface attaches the gateway security group and, unless air-gapped, a public IP to the given node's interface,
+// and returns the address of the public IP, if any.
+func (c *CloudInfo) prepareGWInterface(ctx context.Context, nodeName, groupName string, airGapped bool,
+	nsgClient *armnetwork.SecurityGroupsClient, nwClient *armnetwork.InterfacesClient, pubIPClient *armnetwork.PublicIPAddressesClient,
+	status reporter.Interface,
+) (string, error) {
+	ctx, cancel := c.opContext(ctx)
 	defer cancel()
 
 	nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
 	if err != nil {
-		return errors.Wrapf(err, "error getting the submariner gateway security group %q", groupName)
+		return "", errors.Wrapf(err, "error getting the submariner gateway security group %q", groupName)
 	}
 
 	publicIPName := nodeName + publicIPNameSuffix
 
-	pubIP, err := c.getPublicIP(ctx, publicIPName, pubIPClient)
-	if err != nil {
-		pubIP, err = c.createPublicIP(ctx, publicIPName, pubIPClient)
+	var pubIP armnetwork.PublicIPAddress
+
+	if !airGapped {
+		pubIP, err = c.getPublicIP(ctx, publicIPName, pubIPClient)
 		if err != nil {
-			return errors.Wrapf(err, "failed to create public IP %q", publicIPName)
+			pubIP, err = c.createPublicIP(ctx, publicIPName, pubIPClient)
+			if err != nil {
+				return "", errors.Wrapf(err, "failed to create public IP %q", publicIPName)
+			}
 		}
 	}
 
@@ -241,7 +1342,7 @@ func (c *CloudInfo) prepareGWInterface(nodeName, groupName string, nsgClient *ar
 
 	nwInterface, err := nwClient.Get(ctx, c.BaseGroupName, interfaceName, nil)
 	if err != nil {
-		return errors.Wrapf(err, "error getting the interfaces %q from resource group %q", interfaceName, c.BaseGroupName)
+		return "", errors.Wrapf(err, "error getting the interfaces %q from resource group %q", interfaceName, c.BaseGroupName)
 	}
 
 	if nwInterface.Properties == nil {
@@ -250,9 +1351,18 @@ func (c *CloudInfo) prepareGWInterface(nodeName, groupName string, nsgClient *ar
 
 	nwInterface.Properties.NetworkSecurityGroup = &nwSecurityGroup.SecurityGroup
 
+	if !ptr.Deref(nwInterface.Properties.EnableIPForwarding, false) {
+		if c.EnableGatewayIPForwarding {
+			nwInterface.Properties.EnableIPForwarding = ptr.To(true)
+		} else {
+			status.Warning("IP forwarding is disabled on gateway interface %q, so the traffic routed by the gateway will be dropped",
+				interfaceName)
+		}
+	}
+
 	for i := range nwInterface.Properties.IPConfigurations {
 		props := nwInterface.Properties.IPConfigurations[i].Properties
-		if props != nil && props.Primary != nil && *props.Primary {
+		if !airGapped && props != nil && props.Primary != nil && *props.Primary {
 			nwInterface.Properties.IPConfigurations[i].Properties.PublicIPAddress = &pubIP
 			break
 		}
@@ -260,34 +1370,107 @@ func (c *CloudInfo) prepareGWInterface(nodeName, groupName string, nsgClient *ar
 
 	poller, err := nwClient.BeginCreateOrUpdate(ctx, c.BaseGroupName, *nwInterface.Name, nwInterface.Interface, nil)
 	if err != nil {
-		return errors.Wrapf(err, "adding security group %q and public IP %q to interface %q failed", *nwSecurityGroup.Name,
-			*pubIP.Name, *nwInterface.ID)
+		return "", errors.Wrapf(err, "adding security group %q and public IP %q to interface %q failed", *nwSecurityGroup.Name,
+			ptr.Deref(pubIP.Name, ""), *nwInterface.ID)
+	}
+
+	_, err = pollUntilDone(ctx, poller, c.pollOptions())
+	if err != nil {
+		return "", errors.Wrapf(err, "updating interface %q failed", *nwInterface.Name)
+	}
+
+	// A successful update doesn't guarantee that the security group took effect, in which case the gateway ports
+	// wouldn't be opened, so check the association.
+	if err := c.verifyInterfaceSecurityGroup(ctx, interfaceName, nwSecurityGroup.ID, nwClient); err != nil {
+		return "", err
+	}
+
+	if airGapped {
+		return "", nil
+	}
+
+	return c.waitForPublicIPAddress(ctx, publicIPName, pubIP, pubIPClient)
+}
+
+// waitForPublicIPAddress returns the address of the given public IP, looking it up again until Azure has assigned one,
+// since that may not be the case right after it's created. An error is returned if no address is assigned in time.
+func (c *CloudInfo) waitForPublicIPAddress(ctx context.Context, publicIPName string, pubIP armnetwork.PublicIPAddress,
+	pubIPClient *armnetwork.PublicIPAddressesClient,
+) (string, error) {
+	timeout := c.publicIPAssignTimeout
+	if timeout <= 0 {
+		timeout = defaultPublicIPAssignTimeout
+	}
+
+	frequency := c.publicIPLookupFrequency
+	if frequency <= 0 {
+		frequency = defaultPublicIPLookupFrequency
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		if pubIP.Properties != nil && ptr.Deref(pubIP.Properties.IPAddress, "") != "" {
+			return *pubIP.Properties.IPAddress, nil
+		}
+
+		if time.Now().Add(frequency).After(deadline) {
+			return "", errors.Errorf("no address was assigned to public IP %q within %v", publicIPName, timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", errors.Wrapf(ctx.Err(), "error waiting for an address to be assigned to public IP %q", publicIPName)
+		case <-time.After(frequency):
+		}
+
+		var err error
+
+		pubIP, err = c.getPublicIP(ctx, publicIPName, pubIPClient)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func (c *CloudInfo) verifyInterfaceSecurityGroup(ctx context.Context, interfaceName string, groupID *string,
+	nwClient *armnetwork.InterfacesClient,
+) error {
+	nwInterface, err := nwClient.Get(ctx, c.BaseGroupName, interfaceName, nil)
+	if err != nil {
+		return errors.Wrapf(err, "error getting the interface %q to verify its security group", interfaceName)
 	}
 
-	_, err = poller.PollUntilDone(ctx, nil)
+	if nwInterface.Properties == nil || nwInterface.Properties.NetworkSecurityGroup == nil ||
+		nwInterface.Properties.NetworkSecurityGroup.ID == nil || groupID == nil ||
+		!strings.EqualFold(*nwInterface.Properties.NetworkSecurityGroup.ID, *groupID) {
+		return errors.Errorf("the security group %q is not associated with interface %q", ptr.Deref(groupID, ""), interfaceName)
+	}
 
-	return errors.Wrapf(err, "updating interface %q failed", *nwInterface.Name)
+	return nil
 }
 
-func (c *CloudInfo) cleanupGWInterface(infraID string, nsgClient *armnetwork.SecurityGroupsClient,
+func (c *CloudInfo) cleanupGWInterface(ctx context.Context, infraID string, nsgClient *armnetwork.SecurityGroupsClient,
 	nwClient *armnetwork.InterfacesClient,
 ) error {
 	groupName := infraID + externalSecurityGroupSuffix
 
-	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, c.resourceTimeout())
 	defer cancel()
 
-	isFound := c.checkIfSecurityGroupPresent(ctx, groupName, nsgClient)
-
-	if !isFound {
+	nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
+	if isNotFound(err) {
 		return nil
 	}
 
-	nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
 	if err != nil {
 		return errors.Wrapf(err, "error getting the submariner gateway security group %q", groupName)
 	}
 
+	if !isManagedSecurityGroup(&nwSecurityGroup.SecurityGroup) {
+		return errors.Errorf("the security group %q isn't tagged as managed by Submariner, refusing to delete it", groupName)
+	}
+
 	interfacesInRGMap := map[string]*armnetwork.Interface{}
 
 	interfacesInRGPager := nwClient.NewListPager(c.BaseGroupName, nil)
@@ -320,29 +1503,84 @@ func (c *CloudInfo) cleanupGWInterface(infraID string, nsgClient *armnetwork.Sec
 		}
 
 		poller, err := nwClient.BeginCreateOrUpdate(ctx, c.BaseGroupName, *interfaceWithSG.Name, *interfaceWithSG, nil)
-		if err != nil {
+		if err == nil {
+			_, err = pollUntilDone(ctx, poller, c.pollOptions())
+		}
+
+		// The interface may have been deleted, along with its node, since the interfaces were listed.
+		if err != nil && !isNotFound(err) {
 			return errors.Wrapf(err, "removing security group %q from interface %q failed", groupName,
 				*interfaceWithSG.ID)
 		}
+	}
 
-		_, err = poller.PollUntilDone(ctx, nil)
-		if err != nil {
-			return errors.Wrapf(err, "updating interface %q failed", *interfaceWithSG.Name)
-		}
+	poller, err := nsgClient.BeginDelete(ctx, c.BaseGroupName, groupName, nil)
+	if err == nil {
+		_, err = pollUntilDone(ctx, poller, c.pollOptions())
 	}
 
-	if err != nil {
-		return errors.Wrapf(err, "waiting for the submariner gateway security group  %q to be updated failed", groupName)
+	if isNotFound(err) {
+		return nil
+	}
+
+	return errors.Wrapf(err, "deleting security group %q failed", groupName)
+}
+
+// detachGWInterface removes the given gateway security group and the node's gateway public IP from the node's interface,
+// if they're attached to it.
+func (c *CloudInfo) detachGWInterface(ctx context.Context, nodeName, groupName string, nwClient *armnetwork.InterfacesClient) error {
+	ctx, cancel := context.WithTimeout(ctx, c.resourceTimeout())
+	defer cancel()
+
+	interfaceName := nodeName + "-nic"
+
+	nwInterface, err := nwClient.Get(ctx, c.BaseGroupName, interfaceName, nil)
+	if isNotFound(err) {
+		return nil
 	}
 
-	poller, err := nsgClient.BeginDelete(ctx, c.BaseGroupName, groupName, nil)
 	if err != nil {
-		return errors.Wrapf(err, "deleting security group %q failed", groupName)
+		return errors.Wrapf(err, "error getting the interface %q", interfaceName)
 	}
 
-	_, err = poller.PollUntilDone(ctx, nil)
+	if nwInterface.Properties == nil {
+		return nil
+	}
+
+	detached := false
+
+	if nsg := nwInterface.Properties.NetworkSecurityGroup; nsg != nil && hasResourceName(nsg.ID, groupName) {
+		nwInterface.Properties.NetworkSecurityGroup = nil
+		detached = true
+	}
+
+	for _, ipConfig := range nwInterface.Properties.IPConfigurations {
+		props := ipConfig.Properties
+		if props != nil && props.PublicIPAddress != nil && hasResourceName(props.PublicIPAddress.ID, nodeName+publicIPNameSuffix) {
+			props.PublicIPAddress = nil
+			detached = true
+		}
+	}
+
+	if !detached {
+		return nil
+	}
+
+	poller, err := nwClient.BeginCreateOrUpdate(ctx, c.BaseGroupName, interfaceName, nwInterface.Interface, nil)
+	if err == nil {
+		_, err = pollUntilDone(ctx, poller, c.pollOptions())
+	}
+
+	if err != nil && !isNotFound(err) {
+		return errors.Wrapf(err, "detaching the gateway resources from interface %q failed", interfaceName)
+	}
 
-	return errors.WithMessage(err, "failed to remove the submariner gateway security group from servers")
+	return nil
+}
+
+// hasResourceName checks whether the given resource ID ends with the given name; resource IDs are case-insensitive.
+func hasResourceName(id *string, name string) bool {
+	return strings.HasSuffix(strings.ToLower(ptr.Deref(id, "")), "/"+strings.ToLower(name))
 }
 
 func removePublicIP(nwInterfaceIPConfiguration []*armnetwork.InterfaceIPConfiguration) {
@@ -363,7 +1601,7 @@ func (c *CloudInfo) checkIfSecurityGroupPresent(ctx context.Context, groupName s
 
 func (c *CloudInfo) getPublicIP(ctx context.Context, publicIPName string, pubIPClient *armnetwork.PublicIPAddressesClient,
 ) (armnetwork.PublicIPAddress, error) {
-	resp, err := pubIPClient.Get(ctx, c.BaseGroupName, publicIPName, nil)
+	resp, err := pubIPClient.Get(ctx, c.publicIPResourceGroup(), publicIPName, nil)
 
 	return resp.PublicIPAddress, errors.Wrapf(err, "error getting public ip: %q", publicIPName)
 }
@@ -374,9 +1612,12 @@ func (c *CloudInfo) createPublicIP(ctx context.Context, ipName string, ipClient
 	ipAllocMethod := armnetwork.IPAllocationMethodStatic
 	skuName := armnetwork.PublicIPAddressSKUNameStandard
 
+	tags := map[string]*string{}
+	c.addTags(tags, true)
+
 	poller, err := ipClient.BeginCreateOrUpdate(
 		ctx,
-		c.BaseGroupName,
+		c.publicIPResourceGroup(),
 		ipName,
 		armnetwork.PublicIPAddress{
 			Name: ptr.To(ipName),
@@ -388,12 +1629,14 @@ func (c *CloudInfo) createPublicIP(ctx context.Context, ipName string, ipClient
 			SKU: &armnetwork.PublicIPAddressSKU{
 				Name: &skuName,
 			},
+			Zones: publicIPZones(c.PublicIPZones),
+			Tags:  tags,
 		}, nil)
 	if err != nil {
 		return armnetwork.PublicIPAddress{}, errors.Wrapf(err, "cannot create public ip address: %q", ipName)
 	}
 
-	resp, err := poller.PollUntilDone(ctx, nil)
+	resp, err := pollUntilDone(ctx, poller, c.pollOptions())
 	if err != nil {
 		return armnetwork.PublicIPAddress{}, errors.Wrapf(err, "cannot get public ip address create or update response: %q", ipName)
 	}
@@ -401,13 +1644,33 @@ func (c *CloudInfo) createPublicIP(ctx context.Context, ipName string, ipClient
 	return resp.PublicIPAddress, nil
 }
 
+func (c *CloudInfo) publicIPResourceGroup() string {
+	if c.PublicIPResourceGroup != "" {
+		return c.PublicIPResourceGroup
+	}
+
+	return c.BaseGroupName
+}
+
+// publicIPZones returns the zones to set on a public IP, nil for a regional public IP.
+func publicIPZones(zones []string) []*string {
+	if len(zones) == 0 {
+		return nil
+	}
+
+	return to.SliceOfPtrs(zones...)
+}
+
+// deletePublicIP deletes the given public IP; it's not an error if it's already deleted.
 func (c *CloudInfo) deletePublicIP(ctx context.Context, ipClient *armnetwork.PublicIPAddressesClient, ipName string) error {
-	poller, err := ipClient.BeginDelete(ctx, c.BaseGroupName, ipName, nil)
-	if err != nil {
-		return errors.Wrapf(err, "failed to delete public ip : %q", ipName)
+	poller, err := ipClient.BeginDelete(ctx, c.publicIPResourceGroup(), ipName, nil)
+	if err == nil {
+		_, err = pollUntilDone(ctx, poller, c.pollOptions())
 	}
 
-	_, err = poller.PollUntilDone(ctx, nil)
+	if isNotFound(err) {
+		return nil
+	}
 
 	return errors.Wrapf(err, "failed to delete public ip : %q", ipName)
 }
@@ -0,0 +1,732 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+	"github.com/submariner-io/cloud-prepare/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("CloudInfo", func() {
+	var info *CloudInfo
+
+	BeforeEach(func() {
+		info = &CloudInfo{
+			InfraID: "test-infraID",
+			Region:  "east",
+		}
+	})
+
+	Describe("ESP security rules", func() {
+		createRule := func() *armnetwork.SecurityRule {
+			return info.createSecurityRule(internalSecurityRulePrefix, securityRuleProtocol(api.ProtocolESP), 0, basePriorityInternal,
+				armnetwork.SecurityRuleDirectionInbound, []string{allNetworkCIDR})
+		}
+
+		It("should use the Esp protocol with the default network API version", func() {
+			rule := createRule()
+			Expect(*rule.Properties.Protocol).To(Equal(armnetwork.SecurityRuleProtocolEsp))
+			Expect(*rule.Properties.DestinationPortRange).To(Equal("*"))
+		})
+
+		When("the network API version predates the Esp protocol", func() {
+			BeforeEach(func() {
+				info.NetworkAPIVersion = "2018-11-01"
+			})
+
+			It("should fall back to any protocol while keeping the ESP rule name", func() {
+				rule := createRule()
+				Expect(*rule.Properties.Protocol).To(Equal(armnetwork.SecurityRuleProtocolAsterisk))
+				Expect(*rule.Properties.DestinationPortRange).To(Equal("*"))
+				Expect(*rule.Name).To(Equal(internalSecurityRulePrefix + "Esp-0-Inbound"))
+			})
+		})
+
+		When("the network API version supports the Esp protocol", func() {
+			BeforeEach(func() {
+				info.NetworkAPIVersion = "2023-02-01-preview"
+			})
+
+			It("should use the Esp protocol", func() {
+				Expect(*createRule().Properties.Protocol).To(Equal(armnetwork.SecurityRuleProtocolEsp))
+			})
+		})
+	})
+
+	Describe("internal security rules", func() {
+		When("no source service tag is configured", func() {
+			It("should allow any source address", func() {
+				rule := info.createSecurityRule(internalSecurityRulePrefix, armnetwork.SecurityRuleProtocolUDP, 4800, basePriorityInternal,
+					armnetwork.SecurityRuleDirectionInbound, info.internalSourceAddressPrefixes(context.TODO(), reporter.Stdout()))
+				Expect(*rule.Properties.SourceAddressPrefix).To(Equal(allNetworkCIDR))
+			})
+		})
+
+		When("the VirtualNetwork source service tag is configured", func() {
+			BeforeEach(func() {
+				info.InternalSourceServiceTag = "VirtualNetwork"
+			})
+
+			It("should use the service tag as the source", func() {
+				Expect(info.validate()).To(Succeed())
+
+				rule := info.createSecurityRule(internalSecurityRulePrefix, armnetwork.SecurityRuleProtocolUDP, 4800, basePriorityInternal,
+					armnetwork.SecurityRuleDirectionInbound, info.internalSourceAddressPrefixes(context.TODO(), reporter.Stdout()))
+				Expect(*rule.Properties.SourceAddressPrefix).To(Equal("VirtualNetwork"))
+				Expect(*rule.Properties.DestinationPortRange).To(Equal("4800-4800"))
+			})
+		})
+
+		When("a port specification is given", func() {
+			It("should open a single port", func() {
+				rule := info.createPortSecurityRule(internalSecurityRulePrefix, api.PortSpec{Port: 4800, Protocol: "udp"},
+					basePriorityInternal, armnetwork.SecurityRuleDirectionInbound, []string{allNetworkCIDR})
+				Expect(*rule.Name).To(Equal("Submariner-Internal-Udp-4800-Inbound"))
+				Expect(*rule.Properties.DestinationPortRange).To(Equal("4800-4800"))
+				Expect(*rule.Properties.Description).To(HaveSuffix("on 4800/Udp"))
+			})
+
+			It("should open a port range", func() {
+				rule := info.createPortSecurityRule(internalSecurityRulePrefix, api.PortSpec{Port: 4500, EndPort: 4510, Protocol: "udp"},
+					basePriorityInternal, armnetwork.SecurityRuleDirectionInbound, []string{allNetworkCIDR})
+				Expect(*rule.Name).To(Equal("Submariner-Internal-Udp-4500_4510-Inbound"))
+				Expect(*rule.Properties.DestinationPortRange).To(Equal("4500-4510"))
+				Expect(*rule.Properties.Description).To(HaveSuffix("on 4500-4510/Udp"))
+			})
+
+			It("should open ICMP without a port range", func() {
+				rule := info.createPortSecurityRule(internalSecurityRulePrefix, api.PortSpec{Protocol: "icmp"},
+					basePriorityInternal, armnetwork.SecurityRuleDirectionInbound, []string{allNetworkCIDR})
+				Expect(*rule.Properties.Protocol).To(Equal(armnetwork.SecurityRuleProtocolIcmp))
+				Expect(*rule.Properties.DestinationPortRange).To(Equal("*"))
+				Expect(*rule.Properties.Description).To(HaveSuffix("intra-cluster Icmp traffic"))
+			})
+
+			It("should format the ports and ranges", func() {
+				Expect(formatPorts([]api.PortSpec{{Port: 100, EndPort: 200, Protocol: "udp"}, {Port: 4500, Protocol: "udp"}})).To(
+					Equal("100-200/udp, 4500/udp"))
+			})
+
+			It("should format ICMP without a port", func() {
+				Expect(formatPorts([]api.PortSpec{{Protocol: "icmp"}, {Port: 4500, Protocol: "udp"}})).To(Equal("icmp, 4500/udp"))
+			})
+		})
+
+		When("a regional service tag is configured", func() {
+			BeforeEach(func() {
+				info.InternalSourceServiceTag = "AzureCloud.eastus"
+			})
+
+			It("should be accepted", func() {
+				Expect(info.validate()).To(Succeed())
+			})
+		})
+
+		When("an unknown service tag is configured", func() {
+			BeforeEach(func() {
+				info.InternalSourceServiceTag = "NotATag"
+			})
+
+			It("should fail validation", func() {
+				Expect(info.validate()).ToNot(Succeed())
+			})
+		})
+	})
+
+	Describe("validateSecurityRules", func() {
+		var rules []*armnetwork.SecurityRule
+
+		BeforeEach(func() {
+			rules = []*armnetwork.SecurityRule{
+				info.createSecurityRule(internalSecurityRulePrefix, armnetwork.SecurityRuleProtocolUDP, 4800, basePriorityInternal,
+					armnetwork.SecurityRuleDirectionInbound, []string{allNetworkCIDR}),
+				info.createSecurityRule(internalSecurityRulePrefix, armnetwork.SecurityRuleProtocolUDP, 4800, basePriorityInternal,
+					armnetwork.SecurityRuleDirectionOutbound, []string{allNetworkCIDR}),
+				info.createSecurityRule(internalSecurityRulePrefix, armnetwork.SecurityRuleProtocolTCP, 8080, basePriorityInternal+1,
+					armnetwork.SecurityRuleDirectionInbound, []string{allNetworkCIDR}),
+			}
+		})
+
+		It("should accept the same priority in different directions", func() {
+			Expect(validateSecurityRules(rules)).To(Succeed())
+		})
+
+		When("two rules in the same direction have the same priority", func() {
+			It("should return an error", func() {
+				rules[2].Properties.Priority = ptr.To(basePriorityInternal)
+				Expect(validateSecurityRules(rules)).To(MatchError(ContainSubstring("have the same Inbound priority 2500")))
+			})
+		})
+
+		When("two rules have the same name", func() {
+			It("should return an error", func() {
+				rules[2].Name = ptr.To(strings.ToLower(*rules[0].Name))
+				Expect(validateSecurityRules(rules)).To(MatchError(ContainSubstring("duplicate security rule name")))
+			})
+		})
+
+		When("a rule name is too long", func() {
+			It("should return an error", func() {
+				rules[2].Name = ptr.To(internalSecurityRulePrefix + strings.Repeat("x", maxSecurityRuleNameLength))
+				Expect(validateSecurityRules(rules)).To(MatchError(ContainSubstring("exceeds the maximum length")))
+			})
+		})
+
+		It("should accept the longest generated names", func() {
+			info.RuleOwner = strings.Repeat("o", 20)
+
+			rules = []*armnetwork.SecurityRule{info.createFamilySecurityRule(internalSecurityRulePrefix, ipFamilyIPv6,
+				armnetwork.SecurityRuleProtocolIcmp, singlePort(65535), basePriorityInternal, armnetwork.SecurityRuleDirectionOutbound,
+				[]string{allIPv6NetworkCIDR})}
+
+			Expect(validateSecurityRules(rules)).To(Succeed())
+		})
+
+		It("should accept the longest generated port range names", func() {
+			info.RuleOwner = strings.Repeat("o", 20)
+			ports := api.PortSpec{Port: 10000, EndPort: 65535, Protocol: "udp"}
+
+			rules = []*armnetwork.SecurityRule{
+				info.createFamilySecurityRule(internalSecurityRulePrefix, ipFamilyIPv6, armnetwork.SecurityRuleProtocolUDP,
+					rangeOf(ports), basePriorityInternal, armnetwork.SecurityRuleDirectionOutbound, []string{allIPv6NetworkCIDR}),
+				info.createPortSecurityRule(metricsSecurityRulePrefix, ports, basePriorityMetrics,
+					armnetwork.SecurityRuleDirectionOutbound, []string{allNetworkCIDR}),
+				info.createPortSecurityRule(denySecurityRulePrefix, ports, basePriorityDeny,
+					armnetwork.SecurityRuleDirectionInbound, []string{"*"}),
+			}
+
+			Expect(validateSecurityRules(rules)).To(Succeed())
+		})
+	})
+
+	Describe("nextAvailablePriorities", func() {
+		newRules := func(priorities ...int32) []*armnetwork.SecurityRule {
+			rules := []*armnetwork.SecurityRule{{Name: ptr.To("no-properties")}}
+			for _, priority := range priorities {
+				rules = append(rules, &armnetwork.SecurityRule{
+					Properties: &armnetwork.SecurityRulePropertiesFormat{Priority: ptr.To(priority)},
+				})
+			}
+
+			return rules
+		}
+
+		It("should start from the base priority", func() {
+			Expect(nextAvailablePriorities(newRules(100, 200), 300, 3)).To(Equal([]int32{300, 301, 302}))
+		})
+
+		It("should skip the priorities already in use", func() {
+			Expect(nextAvailablePriorities(newRules(300, 302, 303, 305), 300, 3)).To(Equal([]int32{301, 304, 306}))
+		})
+
+		It("should allocate up to the maximum priority", func() {
+			Expect(nextAvailablePriorities(newRules(4094), 4093, 3)).To(Equal([]int32{4093, 4095, 4096}))
+		})
+
+		It("should return an error if it would exceed the maximum priority", func() {
+			_, err := nextAvailablePriorities(newRules(4095), 4094, 3)
+			Expect(err).To(MatchError(ContainSubstring("only 2 free security rule priorities from 4094 to 4096, 3 are needed")))
+		})
+	})
+
+	Describe("PreviewInternalRulePriorities", func() {
+		var (
+			fake  *fakeARM
+			ports []api.PortSpec
+		)
+
+		BeforeEach(func() {
+			fake = newFakeARM()
+			info = newTestCloudInfo(fake)
+			info.DenyUnscopedSources = true
+			ports = []api.PortSpec{{Port: 8080, Protocol: "Tcp"}, {Port: 4800, Protocol: "Udp"}}
+
+			fake.put(nsgPath(info.InfraID+internalSecurityGroupSuffix), &armnetwork.SecurityGroup{
+				Properties: &armnetwork.SecurityGroupPropertiesFormat{
+					SecurityRules: []*armnetwork.SecurityRule{{
+						Name: ptr.To("user-rule"),
+						Properties: &armnetwork.SecurityRulePropertiesFormat{
+							Priority:  ptr.To(basePriorityInternal),
+							Direction: ptr.To(armnetwork.SecurityRuleDirectionInbound),
+						},
+					}},
+				},
+			})
+
+			for _, subnetName := range info.clusterSubnetNames(info.InfraID) {
+				fake.put(subnetPath(info.InfraID+vnetSuffix, subnetName), &armnetwork.Subnet{
+					Properties: &armnetwork.SubnetPropertiesFormat{},
+				})
+			}
+		})
+
+		It("should return the priorities which opening the ports applies without changing anything", func() {
+			priorities, err := info.PreviewInternalRulePriorities(context.TODO(), ports, reporter.Stdout())
+			Expect(err).To(Succeed())
+			Expect(fake.requestCountByMethod(http.MethodPut)).To(BeZero())
+
+			Expect(priorities).To(Equal(map[string]int32{
+				internalSecurityRulePrefix + "Tcp-8080-Inbound":  basePriorityInternal + 1,
+				internalSecurityRulePrefix + "Tcp-8080-Outbound": basePriorityInternal + 1,
+				internalSecurityRulePrefix + "Udp-4800-Inbound":  basePriorityInternal + 2,
+				internalSecurityRulePrefix + "Udp-4800-Outbound": basePriorityInternal + 2,
+				denySecurityRulePrefix + "Tcp-8080-Inbound":      basePriorityDeny,
+				denySecurityRulePrefix + "Udp-4800-Inbound":      basePriorityDeny + 1,
+			}))
+
+			Expect(NewCloud(info).OpenPorts(context.TODO(), ports, reporter.Stdout())).To(Succeed())
+
+			nwSecurityGroup := &armnetwork.SecurityGroup{}
+			Expect(fake.get(nsgPath(info.InfraID+internalSecurityGroupSuffix), nwSecurityGroup)).To(BeTrue())
+
+			applied := map[string]int32{}
+			for _, rule := range nwSecurityGroup.Properties.SecurityRules {
+				if *rule.Name != "user-rule" {
+					applied[*rule.Name] = *rule.Properties.Priority
+				}
+			}
+
+			Expect(applied).To(Equal(priorities))
+		})
+	})
+
+	Describe("prepareGWInterface", func() {
+		const nodeName = "test-node"
+
+		var (
+			fake      *fakeARM
+			tracker   *reporter.Tracker
+			publicIP  string
+			err       error
+			groupName string
+		)
+
+		getInterface := func() *armnetwork.Interface {
+			nwInterface := &armnetwork.Interface{}
+			Expect(fake.get(nicPath(nodeName+"-nic"), nwInterface)).To(BeTrue())
+
+			return nwInterface
+		}
+
+		BeforeEach(func() {
+			fake = newFakeARM()
+			info = newTestCloudInfo(fake)
+			tracker = reporter.NewTracker(reporter.Stdout())
+			groupName = info.InfraID + externalSecurityGroupSuffix
+
+			fake.put(nsgPath(groupName), &armnetwork.SecurityGroup{})
+			fake.put(publicIPPath(nodeName+publicIPNameSuffix), &armnetwork.PublicIPAddress{
+				Properties: &armnetwork.PublicIPAddressPropertiesFormat{IPAddress: ptr.To("1.2.3.4")},
+			})
+			fake.put(nicPath(nodeName+"-nic"), &armnetwork.Interface{
+				Properties: &armnetwork.InterfacePropertiesFormat{
+					EnableIPForwarding: ptr.To(true),
+					IPConfigurations: []*armnetwork.InterfaceIPConfiguration{{
+						Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{Primary: ptr.To(true)},
+					}},
+				},
+			})
+		})
+
+		JustBeforeEach(func() {
+			nsgClient, clientErr := info.getNsgClient()
+			Expect(clientErr).To(Succeed())
+
+			nwClient, clientErr := info.getInterfacesClient()
+			Expect(clientErr).To(Succeed())
+
+			pubIPClient, clientErr := info.getPublicIPClient()
+			Expect(clientErr).To(Succeed())
+
+			publicIP, err = info.prepareGWInterface(context.TODO(), nodeName, groupName, false, nsgClient, nwClient, pubIPClient, tracker)
+		})
+
+		It("should associate the security group and return the public IP", func() {
+			Expect(err).To(Succeed())
+			Expect(publicIP).To(Equal("1.2.3.4"))
+			Expect(tracker.HasWarnings()).To(BeFalse())
+		})
+
+		When("IP forwarding is disabled on the interface", func() {
+			BeforeEach(func() {
+				fake.put(nicPath(nodeName+"-nic"), &armnetwork.Interface{
+					Properties: &armnetwork.InterfacePropertiesFormat{
+						EnableIPForwarding: ptr.To(false),
+					},
+				})
+			})
+
+			It("should warn and leave it disabled", func() {
+				Expect(err).To(Succeed())
+				Expect(tracker.HasWarnings()).To(BeTrue())
+				Expect(ptr.Deref(getInterface().Properties.EnableIPForwarding, false)).To(BeFalse())
+			})
+
+			Context("and enabling it is allowed", func() {
+				BeforeEach(func() {
+					info.EnableGatewayIPForwarding = true
+				})
+
+				It("should enable it without warning", func() {
+					Expect(err).To(Succeed())
+					Expect(tracker.HasWarnings()).To(BeFalse())
+					Expect(ptr.Deref(getInterface().Properties.EnableIPForwarding, false)).To(BeTrue())
+				})
+			})
+		})
+
+		When("the public IP is created", func() {
+			BeforeEach(func() {
+				fake.failNext(http.MethodGet, publicIPPath(nodeName+publicIPNameSuffix), http.StatusNotFound)
+			})
+
+			It("should return the address assigned by Azure", func() {
+				Expect(err).To(Succeed())
+				Expect(publicIP).To(Equal("20.0.0.1"))
+			})
+
+			It("should tag it with the infra ID as managed by Submariner", func() {
+				pubIP := &armnetwork.PublicIPAddress{}
+				Expect(fake.get(publicIPPath(nodeName+publicIPNameSuffix), pubIP)).To(BeTrue())
+				Expect(pubIP.Tags).To(HaveKeyWithValue(InfraIDTag, ptr.To(info.InfraID)))
+				Expect(pubIP.Tags).To(HaveKeyWithValue(ManagedTag, ptr.To("true")))
+			})
+		})
+
+		When("the public IP has no address", func() {
+			BeforeEach(func() {
+				fake.put(publicIPPath(nodeName+publicIPNameSuffix), &armnetwork.PublicIPAddress{
+					Properties: &armnetwork.PublicIPAddressPropertiesFormat{},
+				})
+			})
+
+			It("should return an error once the wait times out", func() {
+				Expect(err).To(MatchError(ContainSubstring("no address was assigned to public IP")))
+			})
+		})
+
+		When("the security group isn't associated after the interface is updated", func() {
+			BeforeEach(func() {
+				fake.mutateOnPut(nicPath(nodeName+"-nic"), func(obj map[string]any) {
+					delete(obj["properties"].(map[string]any), "networkSecurityGroup")
+				})
+			})
+
+			It("should return an error", func() {
+				Expect(err).To(MatchError(ContainSubstring("is not associated with interface")))
+			})
+		})
+	})
+
+	Describe("cleanupGWInterface", func() {
+		var (
+			fake      *fakeARM
+			groupName string
+			err       error
+		)
+
+		BeforeEach(func() {
+			fake = newFakeARM()
+			info = newTestCloudInfo(fake)
+			groupName = info.InfraID + externalSecurityGroupSuffix
+		})
+
+		JustBeforeEach(func() {
+			nsgClient, clientErr := info.getNsgClient()
+			Expect(clientErr).To(Succeed())
+
+			nwClient, clientErr := info.getInterfacesClient()
+			Expect(clientErr).To(Succeed())
+
+			err = info.cleanupGWInterface(context.TODO(), info.InfraID, nsgClient, nwClient)
+		})
+
+		When("the gateway security group was created by Submariner", func() {
+			BeforeEach(func() {
+				nwSecurityGroup := &armnetwork.SecurityGroup{Properties: &armnetwork.SecurityGroupPropertiesFormat{
+					SecurityRules: []*armnetwork.SecurityRule{{Name: ptr.To("allow-ssh")}},
+				}}
+				info.tagSecurityGroup(nwSecurityGroup, true)
+				fake.put(nsgPath(groupName), nwSecurityGroup)
+			})
+
+			It("should delete it", func() {
+				Expect(err).To(Succeed())
+				Expect(fake.get(nsgPath(groupName), &armnetwork.SecurityGroup{})).To(BeFalse())
+			})
+		})
+
+		When("the gateway security group was created by an older version", func() {
+			BeforeEach(func() {
+				fake.put(nsgPath(groupName), &armnetwork.SecurityGroup{Properties: &armnetwork.SecurityGroupPropertiesFormat{
+					SecurityRules: []*armnetwork.SecurityRule{{Name: ptr.To(externalSecurityRulePrefix + "Udp-4500-Inbound")}},
+				}})
+			})
+
+			It("should delete it", func() {
+				Expect(err).To(Succeed())
+				Expect(fake.get(nsgPath(groupName), &armnetwork.SecurityGroup{})).To(BeFalse())
+			})
+		})
+
+		When("the gateway security group isn't tagged as managed by Submariner", func() {
+			BeforeEach(func() {
+				fake.put(nsgPath(groupName), &armnetwork.SecurityGroup{Properties: &armnetwork.SecurityGroupPropertiesFormat{
+					SecurityRules: []*armnetwork.SecurityRule{{Name: ptr.To("allow-ssh")}},
+				}})
+			})
+
+			It("should refuse to delete it", func() {
+				Expect(err).To(MatchError(ContainSubstring("refusing to delete it")))
+				Expect(fake.get(nsgPath(groupName), &armnetwork.SecurityGroup{})).To(BeTrue())
+				Expect(fake.requestCountByMethod(http.MethodDelete)).To(BeZero())
+			})
+		})
+
+		When("the gateway security group was already deleted", func() {
+			It("should succeed", func() {
+				Expect(err).To(Succeed())
+			})
+		})
+
+		When("the gateway security group is deleted concurrently", func() {
+			BeforeEach(func() {
+				nwSecurityGroup := &armnetwork.SecurityGroup{Properties: &armnetwork.SecurityGroupPropertiesFormat{}}
+				info.tagSecurityGroup(nwSecurityGroup, true)
+				fake.put(nsgPath(groupName), nwSecurityGroup)
+				fake.failNext(http.MethodDelete, nsgPath(groupName), http.StatusNotFound)
+			})
+
+			It("should succeed", func() {
+				Expect(err).To(Succeed())
+			})
+		})
+
+		When("getting the gateway security group fails", func() {
+			BeforeEach(func() {
+				fake.failNext(http.MethodGet, nsgPath(groupName), http.StatusForbidden)
+			})
+
+			It("should return an error", func() {
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("ClosePorts", func() {
+		It("should succeed when the internal security group was already deleted, e.g. by a previous cleanup", func() {
+			info = newTestCloudInfo(newFakeARM())
+			Expect(NewCloud(info).ClosePorts(context.TODO(), reporter.Stdout())).To(Succeed())
+		})
+	})
+
+	Describe("RemoveAllSubmarinerRules", func() {
+		var fake *fakeARM
+
+		newRule := func(name string) *armnetwork.SecurityRule {
+			return &armnetwork.SecurityRule{
+				Name:       ptr.To(name),
+				Properties: &armnetwork.SecurityRulePropertiesFormat{},
+			}
+		}
+
+		ruleNames := func(groupName string) []string {
+			nsg := &armnetwork.SecurityGroup{}
+			Expect(fake.get(nsgPath(groupName), nsg)).To(BeTrue())
+
+			names := []string{}
+			for _, rule := range nsg.Properties.SecurityRules {
+				names = append(names, *rule.Name)
+			}
+
+			return names
+		}
+
+		BeforeEach(func() {
+			fake = newFakeARM()
+			info = newTestCloudInfo(fake)
+
+			fake.put(nsgPath("cluster-nsg"), &armnetwork.SecurityGroup{
+				Properties: &armnetwork.SecurityGroupPropertiesFormat{
+					SecurityRules: []*armnetwork.SecurityRule{
+						newRule(internalSecurityRulePrefix + "Udp-4800-Inbound"),
+						newRule("allow-ssh"),
+						newRule("other-" + internalSecurityRulePrefix + "Udp-4800-Inbound"),
+					},
+				},
+			})
+
+			fake.put(nsgPath("orphaned-submariner-external-sg"), &armnetwork.SecurityGroup{
+				Properties: &armnetwork.SecurityGroupPropertiesFormat{
+					SecurityRules: []*armnetwork.SecurityRule{
+						newRule(externalSecurityRulePrefix + "Udp-4500-Inbound"),
+						newRule(externalSecurityRulePrefix + "Udp-4500-Outbound"),
+					},
+				},
+			})
+
+			fake.put(nsgPath("shared-nsg"), &armnetwork.SecurityGroup{
+				Properties: &armnetwork.SecurityGroupPropertiesFormat{
+					SecurityRules: []*armnetwork.SecurityRule{newRule("allow-https")},
+				},
+			})
+		})
+
+		It("should remove only the Submariner rules from every security group", func() {
+			Expect(info.RemoveAllSubmarinerRules(context.TODO(), reporter.Stdout())).To(Succeed())
+
+			Expect(ruleNames("cluster-nsg")).To(Equal([]string{"allow-ssh", "other-" + internalSecurityRulePrefix + "Udp-4800-Inbound"}))
+			Expect(ruleNames("orphaned-submariner-external-sg")).To(BeEmpty())
+			Expect(ruleNames("shared-nsg")).To(Equal([]string{"allow-https"}))
+			Expect(fake.requestCount(http.MethodPut, nsgPath("shared-nsg"))).To(BeZero())
+		})
+
+		It("should only stamp the security groups managed by Submariner", func() {
+			Expect(info.RemoveAllSubmarinerRules(context.TODO(), reporter.Stdout())).To(Succeed())
+
+			nsg := &armnetwork.SecurityGroup{}
+			Expect(fake.get(nsgPath("cluster-nsg"), nsg)).To(BeTrue())
+			Expect(nsg.Tags).ToNot(HaveKey(RulesModifiedAtTag))
+
+			Expect(fake.get(nsgPath("orphaned-submariner-external-sg"), nsg)).To(BeTrue())
+			Expect(nsg.Tags).To(HaveKey(RulesModifiedAtTag))
+		})
+
+		When("updating one of the security groups fails", func() {
+			BeforeEach(func() {
+				fake.failNext(http.MethodPut, nsgPath("cluster-nsg"), http.StatusConflict)
+			})
+
+			It("should still update the others and return an error", func() {
+				Expect(info.RemoveAllSubmarinerRules(context.TODO(), reporter.Stdout())).ToNot(Succeed())
+				Expect(ruleNames("orphaned-submariner-external-sg")).To(BeEmpty())
+			})
+		})
+	})
+	Describe("GatewayPrivateIPs", func() {
+		var fake *fakeARM
+
+		newGatewayNode := func(name string, addresses ...corev1.NodeAddress) *corev1.Node {
+			return &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   name,
+					Labels: map[string]string{k8s.SubmarinerGatewayLabel: "true"},
+				},
+				Status: corev1.NodeStatus{Addresses: addresses},
+			}
+		}
+
+		BeforeEach(func() {
+			fake = newFakeARM()
+			info = newTestCloudInfo(fake)
+			info.K8sClient = k8s.NewInterface(kubeFake.NewClientset(
+				newGatewayNode("gw-1",
+					corev1.NodeAddress{Type: corev1.NodeHostName, Address: "gw-1"},
+					corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.1.4"}),
+				newGatewayNode("gw-2"),
+				newNode("worker-1", "node-role.kubernetes.io/worker")))
+
+			fake.put(nicPath("gw-2-nic"), &armnetwork.Interface{
+				Properties: &armnetwork.InterfacePropertiesFormat{
+					IPConfigurations: []*armnetwork.InterfaceIPConfiguration{
+						{Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
+							Primary: ptr.To(false), PrivateIPAddress: ptr.To("10.0.1.6"),
+						}},
+						{Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
+							Primary: ptr.To(true), PrivateIPAddress: ptr.To("10.0.1.5"),
+						}},
+					},
+				},
+			})
+		})
+
+		It("should return the internal address of each gateway node, falling back to its interface", func() {
+			Expect(info.GatewayPrivateIPs(context.TODO())).To(Equal(map[string]string{
+				"gw-1": "10.0.1.4",
+				"gw-2": "10.0.1.5",
+			}))
+		})
+
+		When("a gateway node's interface doesn't exist", func() {
+			BeforeEach(func() {
+				fake = newFakeARM()
+				info.ClientOptions = fake.clientOptions()
+			})
+
+			It("should return an error", func() {
+				_, err := info.GatewayPrivateIPs(context.TODO())
+				Expect(err).To(MatchError(ContainSubstring(`error getting the interface "gw-2-nic"`)))
+			})
+		})
+	})
+
+	Describe("NewCloudInfo", func() {
+		var opts []CloudInfoOption
+
+		BeforeEach(func() {
+			opts = []CloudInfoOption{
+				WithSubscriptionID("test-subscription"), WithInfraID("test-infraID"), WithRegion("east"),
+				WithBaseGroupName("test-rg"), WithTokenCredential(fakeTokenCredential{}),
+				WithK8sClient(k8s.NewInterface(kubeFake.NewClientset())),
+			}
+		})
+
+		It("should create the cloud info with the given options", func() {
+			created, err := NewCloudInfo(append(opts, func(info *CloudInfo) {
+				info.RuleOwner = "owner"
+			})...)
+			Expect(err).To(Succeed())
+			Expect(created.SubscriptionID).To(Equal("test-subscription"))
+			Expect(created.InfraID).To(Equal("test-infraID"))
+			Expect(created.Region).To(Equal("east"))
+			Expect(created.BaseGroupName).To(Equal("test-rg"))
+			Expect(created.TokenCredential).ToNot(BeNil())
+			Expect(created.K8sClient).ToNot(BeNil())
+			Expect(created.RuleOwner).To(Equal("owner"))
+		})
+
+		When("required fields aren't set", func() {
+			It("should return an error listing them", func() {
+				_, err := NewCloudInfo(opts[1], opts[3], opts[4])
+				Expect(err).To(MatchError("the Azure cloud info is missing the subscription ID, region, Kubernetes client"))
+			})
+		})
+
+		When("an optional field is invalid", func() {
+			It("should return an error", func() {
+				_, err := NewCloudInfo(append(opts, func(info *CloudInfo) {
+					info.IPFamilies = []string{"IPv5"}
+				})...)
+				Expect(err).To(MatchError(ContainSubstring(`IP family "IPv5"`)))
+			})
+		})
+	})
+})
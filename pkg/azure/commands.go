@@ -0,0 +1,334 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package azure
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	nsgResourceType       = "Microsoft.Network/networkSecurityGroups"
+	subnetResourceType    = "Microsoft.Network/virtualNetworks/subnets"
+	interfaceResourceType = "Microsoft.Network/networkInterfaces"
+	publicIPResourceType  = "Microsoft.Network/publicIPAddresses"
+)
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_./:=,@+-]+$`)
+
+// commandRenderer is a pipeline policy which writes the az CLI commands equivalent to the changes made through the Azure
+// clients. The security groups read are remembered so that their updates can be rendered as the individual rule changes.
+type commandRenderer struct {
+	mutex          sync.Mutex
+	out            io.Writer
+	securityGroups map[string]*armnetwork.SecurityGroup
+}
+
+func newCommandRenderer(out io.Writer) *commandRenderer {
+	return &commandRenderer{out: out, securityGroups: map[string]*armnetwork.SecurityGroup{}}
+}
+
+func (r *commandRenderer) Do(req *policy.Request) (*http.Response, error) {
+	id, err := arm.ParseResourceID(req.Raw().URL.Path)
+	if err != nil {
+		return req.Next() //nolint:wrapcheck // Let the caller wrap it.
+	}
+
+	if req.Raw().Method == http.MethodGet {
+		resp, err := req.Next()
+		if err == nil && resp.StatusCode == http.StatusOK && strings.EqualFold(id.ResourceType.String(), nsgResourceType) {
+			r.rememberSecurityGroup(id, resp)
+		}
+
+		return resp, err //nolint:wrapcheck // Let the caller wrap it.
+	}
+
+	var body []byte
+
+	if req.Body() != nil {
+		body, err = io.ReadAll(req.Body())
+		if err != nil {
+			return nil, err //nolint:wrapcheck // Let the caller wrap it.
+		}
+
+		if err := req.RewindBody(); err != nil {
+			return nil, err //nolint:wrapcheck // Let the caller wrap it.
+		}
+	}
+
+	r.mutex.Lock()
+	for _, command := range r.render(req.Raw().Method, id, body) {
+		fmt.Fprintln(r.out, command)
+	}
+	r.mutex.Unlock()
+
+	return req.Next() //nolint:wrapcheck // Let the caller wrap it.
+}
+
+func (r *commandRenderer) rememberSecurityGroup(id *arm.ResourceID, resp *http.Response) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	nwSecurityGroup := &armnetwork.SecurityGroup{}
+	if err != nil || json.Unmarshal(body, nwSecurityGroup) != nil {
+		return
+	}
+
+	r.mutex.Lock()
+	r.securityGroups[strings.ToLower(id.String())] = nwSecurityGroup
+	r.mutex.Unlock()
+}
+
+// render returns the az CLI commands equivalent to the given request, which the caller must synchronize.
+func (r *commandRenderer) render(method string, id *arm.ResourceID, body []byte) []string {
+	resourceType := strings.ToLower(id.ResourceType.String())
+
+	switch {
+	case method == http.MethodPut && resourceType == strings.ToLower(nsgResourceType):
+		nwSecurityGroup := &armnetwork.SecurityGroup{}
+		if json.Unmarshal(body, nwSecurityGroup) == nil {
+			commands := r.renderSecurityGroupUpdate(id, nwSecurityGroup)
+			r.securityGroups[strings.ToLower(id.String())] = nwSecurityGroup
+
+			return commands
+		}
+	case method == http.MethodPatch && resourceType == strings.ToLower(nsgResourceType):
+		tags := armnetwork.TagsObject{}
+		if json.Unmarshal(body, &tags) == nil {
+			return renderTagsUpdate(id, tags.Tags)
+		}
+	case method == http.MethodPut && resourceType == strings.ToLower(subnetResourceType):
+		subnet := &armnetwork.Subnet{}
+		if json.Unmarshal(body, subnet) == nil {
+			nsgID := `""`
+			if subnet.Properties != nil && subnet.Properties.NetworkSecurityGroup != nil {
+				nsgID = ptr.Deref(subnet.Properties.NetworkSecurityGroup.ID, nsgID)
+			}
+
+			return []string{command("network", "vnet", "subnet", "update", "-g", id.ResourceGroupName, "--vnet-name", id.Parent.Name,
+				"-n", id.Name, "--nsg", nsgID)}
+		}
+	case method == http.MethodPut && resourceType == strings.ToLower(interfaceResourceType):
+		nwInterface := &armnetwork.Interface{}
+		if json.Unmarshal(body, nwInterface) == nil {
+			return renderInterfaceUpdate(id, nwInterface)
+		}
+	case method == http.MethodPut && resourceType == strings.ToLower(publicIPResourceType):
+		publicIP := &armnetwork.PublicIPAddress{}
+		if json.Unmarshal(body, publicIP) == nil {
+			args := []string{"network", "public-ip", "create", "-g", id.ResourceGroupName, "-n", id.Name}
+			args = appendIfSet(args, "-l", publicIP.Location)
+
+			if publicIP.SKU != nil && publicIP.SKU.Name != nil {
+				args = append(args, "--sku", string(*publicIP.SKU.Name))
+			}
+
+			if publicIP.Properties != nil && publicIP.Properties.PublicIPAllocationMethod != nil {
+				args = append(args, "--allocation-method", string(*publicIP.Properties.PublicIPAllocationMethod))
+			}
+
+			return []string{command(args...)}
+		}
+	case method == http.MethodDelete && resourceType == strings.ToLower(publicIPResourceType):
+		return []string{command("network", "public-ip", "delete", "-g", id.ResourceGroupName, "-n", id.Name)}
+	case method == http.MethodDelete && resourceType == strings.ToLower(nsgResourceType):
+		delete(r.securityGroups, strings.ToLower(id.String()))
+		return []string{command("network", "nsg", "delete", "-g", id.ResourceGroupName, "-n", id.Name)}
+	case method == http.MethodDelete:
+		return []string{command("resource", "delete", "--ids", id.String())}
+	}
+
+	return []string{command("rest", "--method", strings.ToLower(method), "--url", id.String(), "--body", string(body))}
+}
+
+func (r *commandRenderer) renderSecurityGroupUpdate(id *arm.ResourceID, nwSecurityGroup *armnetwork.SecurityGroup) []string {
+	commands := []string{}
+
+	existing, found := r.securityGroups[strings.ToLower(id.String())]
+	if !found {
+		args := []string{"network", "nsg", "create", "-g", id.ResourceGroupName, "-n", id.Name}
+		commands = append(commands, command(appendIfSet(args, "-l", nwSecurityGroup.Location)...))
+		existing = &armnetwork.SecurityGroup{}
+	}
+
+	existingRules := map[string]*armnetwork.SecurityRule{}
+	if existing.Properties != nil {
+		for _, rule := range existing.Properties.SecurityRules {
+			existingRules[strings.ToLower(ptr.Deref(rule.Name, ""))] = rule
+		}
+	}
+
+	ruleCommand := func(verb string, rule *armnetwork.SecurityRule) string {
+		args := []string{"network", "nsg", "rule", verb, "-g", id.ResourceGroupName, "--nsg-name", id.Name, "-n", ptr.Deref(rule.Name, "")}
+		return command(append(args, securityRuleArgs(rule)...)...)
+	}
+
+	if nwSecurityGroup.Properties != nil {
+		for _, rule := range nwSecurityGroup.Properties.SecurityRules {
+			name := strings.ToLower(ptr.Deref(rule.Name, ""))
+
+			existingRule, found := existingRules[name]
+			delete(existingRules, name)
+
+			switch {
+			case !found:
+				commands = append(commands, ruleCommand("create", rule))
+			case !reflect.DeepEqual(securityRuleArgs(existingRule), securityRuleArgs(rule)):
+				commands = append(commands, ruleCommand("update", rule))
+			}
+		}
+	}
+
+	removed := []string{}
+	for _, rule := range existingRules {
+		removed = append(removed, ptr.Deref(rule.Name, ""))
+	}
+
+	slices.Sort(removed)
+
+	for _, name := range removed {
+		commands = append(commands, command("network", "nsg", "rule", "delete", "-g", id.ResourceGroupName, "--nsg-name", id.Name,
+			"-n", name))
+	}
+
+	return commands
+}
+
+func securityRuleArgs(rule *armnetwork.SecurityRule) []string {
+	props := rule.Properties
+	if props == nil {
+		return nil
+	}
+
+	args := []string{}
+
+	if props.Priority != nil {
+		args = append(args, "--priority", strconv.Itoa(int(*props.Priority)))
+	}
+
+	if props.Direction != nil {
+		args = append(args, "--direction", string(*props.Direction))
+	}
+
+	if props.Access != nil {
+		args = append(args, "--access", string(*props.Access))
+	}
+
+	if props.Protocol != nil {
+		args = append(args, "--protocol", string(*props.Protocol))
+	}
+
+	if props.SourceAddressPrefix != nil {
+		args = append(args, "--source-address-prefixes", *props.SourceAddressPrefix)
+	} else if len(props.SourceAddressPrefixes) > 0 {
+		args = append(args, "--source-address-prefixes")
+		for _, prefix := range props.SourceAddressPrefixes {
+			args = append(args, ptr.Deref(prefix, ""))
+		}
+	}
+
+	args = appendIfSet(args, "--source-port-ranges", props.SourcePortRange)
+	args = appendIfSet(args, "--destination-address-prefixes", props.DestinationAddressPrefix)
+	args = appendIfSet(args, "--destination-port-ranges", props.DestinationPortRange)
+
+	return appendIfSet(args, "--description", props.Description)
+}
+
+func renderInterfaceUpdate(id *arm.ResourceID, nwInterface *armnetwork.Interface) []string {
+	if nwInterface.Properties == nil {
+		return nil
+	}
+
+	nsgID := `""`
+	if nwInterface.Properties.NetworkSecurityGroup != nil {
+		nsgID = ptr.Deref(nwInterface.Properties.NetworkSecurityGroup.ID, nsgID)
+	}
+
+	commands := []string{command("network", "nic", "update", "-g", id.ResourceGroupName, "-n", id.Name,
+		"--network-security-group", nsgID)}
+
+	for _, ipConfig := range nwInterface.Properties.IPConfigurations {
+		if ipConfig.Properties == nil || !ptr.Deref(ipConfig.Properties.Primary, false) {
+			continue
+		}
+
+		publicIPID := `""`
+		if ipConfig.Properties.PublicIPAddress != nil {
+			publicIPID = ptr.Deref(ipConfig.Properties.PublicIPAddress.ID, publicIPID)
+		}
+
+		commands = append(commands, command("network", "nic", "ip-config", "update", "-g", id.ResourceGroupName, "--nic-name", id.Name,
+			"-n", ptr.Deref(ipConfig.Name, ""), "--public-ip-address", publicIPID))
+	}
+
+	return commands
+}
+
+func renderTagsUpdate(id *arm.ResourceID, tags map[string]*string) []string {
+	keys := []string{}
+	for key := range tags {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	args := []string{"network", "nsg", "update", "-g", id.ResourceGroupName, "-n", id.Name}
+	for _, key := range keys {
+		args = append(args, "--set", "tags."+key+"="+ptr.Deref(tags[key], ""))
+	}
+
+	return []string{command(args...)}
+}
+
+func appendIfSet(args []string, flag string, value *string) []string {
+	if value == nil {
+		return args
+	}
+
+	return append(args, flag, *value)
+}
+
+// command renders an az CLI command line, quoting the arguments as required by a POSIX shell.
+func command(args ...string) string {
+	quoted := []string{"az"}
+
+	for _, arg := range args {
+		if shellSafe.MatchString(arg) || arg == `""` {
+			quoted = append(quoted, arg)
+		} else {
+			quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+		}
+	}
+
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,118 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package azure
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("az CLI commands", func() {
+	var (
+		fake     *fakeARM
+		info     *CloudInfo
+		out      *bytes.Buffer
+		nsgName  string
+		cloud    api.Cloud
+		commands []string
+	)
+
+	BeforeEach(func() {
+		fake = newFakeARM()
+		info = newTestCloudInfo(fake)
+		out = &bytes.Buffer{}
+		info.AZCommandWriter = out
+		info.AssociateSubnets = true
+		nsgName = info.InfraID + internalSecurityGroupSuffix
+
+		fake.put(nsgPath(nsgName), &armnetwork.SecurityGroup{
+			Properties: &armnetwork.SecurityGroupPropertiesFormat{SecurityRules: []*armnetwork.SecurityRule{{
+				Name: ptr.To("other-rule"),
+				Properties: &armnetwork.SecurityRulePropertiesFormat{
+					Priority:  ptr.To(int32(100)),
+					Direction: ptr.To(armnetwork.SecurityRuleDirectionInbound),
+				},
+			}}},
+		})
+
+		for _, subnetName := range info.clusterSubnetNames(info.InfraID) {
+			fake.put(subnetPath(info.InfraID+vnetSuffix, subnetName), &armnetwork.Subnet{
+				Properties: &armnetwork.SubnetPropertiesFormat{},
+			})
+		}
+	})
+
+	JustBeforeEach(func() {
+		cloud = NewCloud(info)
+		Expect(cloud.OpenPorts(context.TODO(), []api.PortSpec{{Port: 4800, Protocol: "Udp"}}, reporter.Stdout())).To(Succeed())
+
+		commands = strings.Split(strings.TrimSpace(out.String()), "\n")
+	})
+
+	ruleCommand := func(verb, direction string) string {
+		return "az network nsg rule " + verb + " -g test-rg --nsg-name " + nsgName + " -n Submariner-Internal-Udp-4800-" + direction
+	}
+
+	It("should render the rules created", func() {
+		Expect(commands).To(ContainElements(
+			ruleCommand("create", "Inbound")+" --priority 2500 --direction Inbound --access Allow --protocol Udp"+
+				" --source-address-prefixes 0.0.0.0/0 --source-port-ranges '*' --destination-address-prefixes 0.0.0.0/0"+
+				" --destination-port-ranges 4800-4800 --description 'Created by Submariner to allow intra-cluster traffic on 4800/Udp'",
+			ruleCommand("create", "Outbound")+" --priority 2500 --direction Outbound --access Allow --protocol Udp"+
+				" --source-address-prefixes 0.0.0.0/0 --source-port-ranges '*' --destination-address-prefixes 0.0.0.0/0"+
+				" --destination-port-ranges 4800-4800 --description 'Created by Submariner to allow intra-cluster traffic on 4800/Udp'",
+		))
+		Expect(commands).ToNot(ContainElement(ContainSubstring("other-rule")))
+	})
+
+	It("should render the subnets associated with the security group", func() {
+		for _, subnetName := range info.clusterSubnetNames(info.InfraID) {
+			Expect(commands).To(ContainElement("az network vnet subnet update -g test-rg --vnet-name " + info.InfraID + vnetSuffix +
+				" -n " + subnetName + " --nsg /subscriptions/test-subscription/resourceGroups/test-rg/providers/" + nsgResourceType +
+				"/" + nsgName))
+		}
+	})
+
+	It("should render the tags updated", func() {
+		Expect(commands).To(ContainElement(MatchRegexp(`^az network nsg update -g test-rg -n ` + nsgName +
+			` --set tags\.` + LastPreparedAtTag + `=\S+$`)))
+	})
+
+	It("should render the rules deleted when the ports are closed", func() {
+		out.Reset()
+		Expect(cloud.ClosePorts(context.TODO(), reporter.Stdout())).To(Succeed())
+
+		Expect(strings.Split(strings.TrimSpace(out.String()), "\n")).To(ContainElements(
+			ruleCommand("delete", "Inbound"), ruleCommand("delete", "Outbound")))
+	})
+})
+
+var _ = Describe("az CLI command quoting", func() {
+	It("should quote the arguments which aren't safe in a shell", func() {
+		Expect(command("network", "nsg", "rule", "create", "--description", "it's here", "--source-port-ranges", "*")).To(Equal(
+			`az network nsg rule create --description 'it'\''s here' --source-port-ranges '*'`))
+	})
+})
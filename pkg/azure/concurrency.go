@@ -0,0 +1,139 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"sync"
+
+	"github.com/submariner-io/admiral/pkg/reporter"
+)
+
+const defaultConcurrency = 4
+
+func (c *CloudInfo) concurrency() int {
+	if c.Concurrency > 0 {
+		return c.Concurrency
+	}
+
+	return defaultConcurrency
+}
+
+// forEachConcurrently calls the given function for each index up to count, running at most limit calls at a time. When a
+// call fails, the context given to the other calls is cancelled, no further calls are started and the first error is
+// returned.
+func forEachConcurrently(ctx context.Context, count, limit int, do func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	slots := make(chan struct{}, max(limit, 1))
+
+	for i := range count {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			if err := do(ctx, i); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if firstErr == nil {
+		return ctx.Err() //nolint:wrapcheck // Let the caller wrap it.
+	}
+
+	return firstErr
+}
+
+// syncReporter serializes the calls to a reporter shared by concurrent operations.
+type syncReporter struct {
+	mutex  sync.Mutex
+	status reporter.Interface
+}
+
+func newSyncReporter(status reporter.Interface) reporter.Interface {
+	return &syncReporter{status: status}
+}
+
+func (r *syncReporter) Start(message string, args ...interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.status.Start(message, args...)
+}
+
+func (r *syncReporter) Success(message string, args ...interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.status.Success(message, args...)
+}
+
+func (r *syncReporter) Failure(message string, args ...interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.status.Failure(message, args...)
+}
+
+func (r *syncReporter) End() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.status.End()
+}
+
+func (r *syncReporter) Warning(message string, args ...interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.status.Warning(message, args...)
+}
+
+func (r *syncReporter) Error(err error, message string, args ...interface{}) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.status.Error(err, message, args...) //nolint:wrapcheck // The reporter wraps it.
+}
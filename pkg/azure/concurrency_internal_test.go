@@ -0,0 +1,139 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/reporter"
+)
+
+var _ = Describe("forEachConcurrently", func() {
+	It("should call the function for each index, at most the limit at a time", func() {
+		var inFlight, maxSeen atomic.Int32
+
+		called := make([]bool, 10)
+
+		Expect(forEachConcurrently(context.TODO(), len(called), 3, func(_ context.Context, i int) error {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+
+			for {
+				seen := maxSeen.Load()
+				if n <= seen || maxSeen.CompareAndSwap(seen, n) {
+					break
+				}
+			}
+
+			time.Sleep(5 * time.Millisecond)
+
+			called[i] = true
+
+			return nil
+		})).To(Succeed())
+
+		Expect(called).ToNot(ContainElement(false))
+		Expect(maxSeen.Load()).To(BeNumerically("<=", 3))
+		Expect(maxSeen.Load()).To(BeNumerically(">", 1))
+	})
+
+	It("should return the first error and cancel the remaining calls", func() {
+		var started atomic.Int32
+
+		err := forEachConcurrently(context.TODO(), 10, 2, func(ctx context.Context, i int) error {
+			started.Add(1)
+
+			if i == 0 {
+				return errors.New("fake error")
+			}
+
+			<-ctx.Done()
+
+			return ctx.Err()
+		})
+
+		Expect(err).To(MatchError("fake error"))
+		Expect(started.Load()).To(BeNumerically("<", 10))
+	})
+
+	It("should return the error of a context cancelled beforehand", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		Expect(forEachConcurrently(ctx, 3, 1, func(_ context.Context, _ int) error {
+			return nil
+		})).To(MatchError(context.Canceled))
+	})
+})
+
+// BenchmarkAssociateSubnets associates the security group with eight worker subnets through a fake Azure which responds
+// after a delay, one subnet at a time and concurrently.
+func BenchmarkAssociateSubnets(b *testing.B) {
+	for _, concurrency := range []int{1, defaultConcurrency} {
+		b.Run("concurrency-"+strconv.Itoa(concurrency), func(b *testing.B) {
+			RegisterTestingT(b)
+
+			for range b.N {
+				b.StopTimer()
+
+				fake := newFakeARM()
+				fake.latency = 5 * time.Millisecond
+
+				info := newTestCloudInfo(fake)
+				info.Concurrency = concurrency
+
+				for i := range 6 {
+					info.AdditionalWorkerSubnetNames = append(info.AdditionalWorkerSubnetNames,
+						fmt.Sprintf("%s%s-%d", info.InfraID, workerSubnetSuffix, i))
+				}
+
+				for _, subnetName := range info.clusterSubnetNames(info.InfraID) {
+					fake.put(subnetPath(info.InfraID+vnetSuffix, subnetName), &armnetwork.Subnet{
+						Properties: &armnetwork.SubnetPropertiesFormat{},
+					})
+				}
+
+				subnetClient, err := info.getSubnetsClient()
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				nsgID := "/fake/" + info.InfraID + internalSecurityGroupSuffix
+				nsgName := info.InfraID + internalSecurityGroupSuffix
+
+				b.StartTimer()
+
+				_, err = info.associateSubnets(context.TODO(), info.InfraID,
+					&armnetwork.SecurityGroup{ID: &nsgID, Name: &nsgName}, subnetClient, reporter.Silent())
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/submariner-io/admiral/pkg/reporter"
+)
+
+var (
+	// ErrSubnetNotFound is returned, along with the Azure error, when a subnet doesn't exist.
+	ErrSubnetNotFound = errors.New("subnet not found")
+
+	// ErrAuthFailed is returned, along with the Azure error, when the credentials aren't authorized to read a subnet.
+	ErrAuthFailed = errors.New("not authorized")
+)
+
+// ErrorCategory classifies the errors returned by Azure so that callers can handle them without matching messages.
+type ErrorCategory string
+
+const (
+	ErrorCategoryThrottled    ErrorCategory = "Throttled"
+	ErrorCategoryUnauthorized ErrorCategory = "Unauthorized"
+	ErrorCategoryNotFound     ErrorCategory = "NotFound"
+	ErrorCategoryConflict     ErrorCategory = "Conflict"
+	ErrorCategoryTransient    ErrorCategory = "Transient"
+	ErrorCategoryQuota        ErrorCategory = "Quota"
+	ErrorCategoryLocked       ErrorCategory = "Locked"
+	ErrorCategoryUnknown      ErrorCategory = "Unknown"
+)
+
+// errorCodeCategories maps the Azure error codes which aren't categorized correctly by their status code alone.
+var errorCodeCategories = map[string]ErrorCategory{
+	"SubscriptionRequestsThrottled": ErrorCategoryThrottled,
+	"TooManyRequests":               ErrorCategoryThrottled,
+	"AuthorizationFailed":           ErrorCategoryUnauthorized,
+	"InvalidAuthenticationToken":    ErrorCategoryUnauthorized,
+	"ResourceGroupNotFound":         ErrorCategoryNotFound,
+	"ResourceNotFound":              ErrorCategoryNotFound,
+	"AnotherOperationInProgress":    ErrorCategoryConflict,
+	"RetryableError":                ErrorCategoryTransient,
+	"QuotaExceeded":                 ErrorCategoryQuota,
+	"PublicIPCountLimitReached":     ErrorCategoryQuota,
+	"ScopeLocked":                   ErrorCategoryLocked,
+}
+
+// remediationHints suggest how to address the errors of each category.
+var remediationHints = map[ErrorCategory]string{
+	ErrorCategoryUnauthorized: "check that the credentials are valid and have the Network Contributor role on the resource group",
+	ErrorCategoryNotFound:     "check that the resource group, VNet and subnet names match the cluster",
+	ErrorCategoryThrottled:    "the subscription is throttled by Azure, retry later or lower MaxConcurrentPolls",
+	ErrorCategoryQuota:        "request a quota increase for the subscription, or release unused resources",
+	ErrorCategoryLocked:       "remove the management lock from the resource or its resource group",
+}
+
+// CategorizeError returns the category of the given error, as returned by any of the operations in this package, based
+// on the status and error codes of the underlying Azure response. ErrorCategoryUnknown is returned if the error can't be
+// categorized, including if it's nil.
+func CategorizeError(err error) ErrorCategory {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return ErrorCategoryTransient
+		}
+
+		return ErrorCategoryUnknown
+	}
+
+	if category, found := errorCodeCategories[respErr.ErrorCode]; found {
+		return category
+	}
+
+	switch {
+	case respErr.StatusCode == http.StatusTooManyRequests:
+		return ErrorCategoryThrottled
+	case respErr.StatusCode == http.StatusUnauthorized || respErr.StatusCode == http.StatusForbidden:
+		return ErrorCategoryUnauthorized
+	case respErr.StatusCode == http.StatusNotFound:
+		return ErrorCategoryNotFound
+	case respErr.StatusCode == http.StatusConflict || respErr.StatusCode == http.StatusPreconditionFailed:
+		return ErrorCategoryConflict
+	case respErr.StatusCode == http.StatusRequestTimeout || respErr.StatusCode >= http.StatusInternalServerError:
+		return ErrorCategoryTransient
+	}
+
+	return ErrorCategoryUnknown
+}
+
+// RemediationHint returns a suggestion of how to address the errors of the given category, or an empty string if there's
+// none.
+func RemediationHint(category ErrorCategory) string {
+	return remediationHints[category]
+}
+
+// hintedError adds the remediation hint of its category to an error.
+type hintedError struct {
+	error
+	hint string
+}
+
+func (e *hintedError) Error() string {
+	return e.error.Error() + " (hint: " + e.hint + ")"
+}
+
+func (e *hintedError) Unwrap() error {
+	return e.error
+}
+
+// hintingReporter adds the remediation hints of the errors it reports to the failures.
+type hintingReporter struct {
+	reporter.Interface
+}
+
+// withRemediationHints returns a reporter which adds the remediation hints of the errors reported to the given reporter.
+func withRemediationHints(status reporter.Interface) reporter.Interface {
+	return hintingReporter{Interface: status}
+}
+
+func (r hintingReporter) Error(err error, message string, args ...interface{}) error {
+	var hinted *hintedError
+
+	if hint := RemediationHint(CategorizeError(err)); hint != "" && !errors.As(err, &hinted) {
+		err = &hintedError{error: err, hint: hint}
+	}
+
+	return r.Interface.Error(err, message, args...) //nolint:wrapcheck // The reporter wraps it.
+}
+
+// isScopeLocked checks whether the given error was caused by a management lock on the resource or one of its parents.
+func isScopeLocked(err error) bool {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.ErrorCode == "ScopeLocked"
+	}
+
+	return false
+}
+
+func isNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode == http.StatusNotFound
+	}
+
+	return false
+}
@@ -0,0 +1,176 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+)
+
+var _ = Describe("CategorizeError", func() {
+	responseError := func(statusCode int, errorCode string) error {
+		return errors.Wrap(&azcore.ResponseError{StatusCode: statusCode, ErrorCode: errorCode}, "wrapped")
+	}
+
+	DescribeTable("should map Azure errors to their category",
+		func(err error, expected ErrorCategory) {
+			Expect(CategorizeError(err)).To(Equal(expected))
+		},
+		Entry("too many requests", responseError(http.StatusTooManyRequests, "TooManyRequests"), ErrorCategoryThrottled),
+		Entry("subscription throttling", responseError(http.StatusTooManyRequests, "SubscriptionRequestsThrottled"),
+			ErrorCategoryThrottled),
+		Entry("unauthenticated", responseError(http.StatusUnauthorized, "InvalidAuthenticationToken"), ErrorCategoryUnauthorized),
+		Entry("forbidden", responseError(http.StatusForbidden, "AuthorizationFailed"), ErrorCategoryUnauthorized),
+		Entry("not found", responseError(http.StatusNotFound, "NotFound"), ErrorCategoryNotFound),
+		Entry("missing resource group", responseError(http.StatusNotFound, "ResourceGroupNotFound"), ErrorCategoryNotFound),
+		Entry("conflict", responseError(http.StatusConflict, "Conflict"), ErrorCategoryConflict),
+		Entry("operation in progress", responseError(http.StatusConflict, "AnotherOperationInProgress"), ErrorCategoryConflict),
+		Entry("precondition failed", responseError(http.StatusPreconditionFailed, "PreconditionFailed"), ErrorCategoryConflict),
+		Entry("internal server error", responseError(http.StatusInternalServerError, "InternalServerError"),
+			ErrorCategoryTransient),
+		Entry("service unavailable", responseError(http.StatusServiceUnavailable, "ServiceUnavailable"), ErrorCategoryTransient),
+		Entry("retryable error", responseError(http.StatusBadRequest, "RetryableError"), ErrorCategoryTransient),
+		Entry("quota exceeded", responseError(http.StatusConflict, "QuotaExceeded"), ErrorCategoryQuota),
+		Entry("public IP limit", responseError(http.StatusBadRequest, "PublicIPCountLimitReached"), ErrorCategoryQuota),
+		Entry("management lock", responseError(http.StatusConflict, "ScopeLocked"), ErrorCategoryLocked),
+		Entry("timeout", errors.Wrap(context.DeadlineExceeded, "wrapped"), ErrorCategoryTransient),
+		Entry("bad request", responseError(http.StatusBadRequest, "InvalidRequestFormat"), ErrorCategoryUnknown),
+		Entry("non-Azure error", errors.New("mock error"), ErrorCategoryUnknown),
+		Entry("nil", nil, ErrorCategoryUnknown),
+	)
+
+	It("should categorize the errors returned by the operations", func() {
+		fake := newFakeARM()
+		info := newTestCloudInfo(fake)
+		info.MaxRetries = -1
+
+		fake.failNext(http.MethodGet, nsgPath(info.InfraID+internalSecurityGroupSuffix), http.StatusForbidden)
+
+		err := NewCloud(info).OpenPorts(context.TODO(), []api.PortSpec{{Port: 4800, Protocol: "udp"}}, reporter.Stdout())
+		Expect(CategorizeError(err)).To(Equal(ErrorCategoryUnauthorized))
+	})
+})
+
+var _ = Describe("getSubnet", func() {
+	var (
+		fake *fakeARM
+		info *CloudInfo
+	)
+
+	BeforeEach(func() {
+		fake = newFakeARM()
+		info = newTestCloudInfo(fake)
+		info.SubnetNotFoundTimeout = -1
+		info.MaxRetries = -1
+	})
+
+	getSubnet := func() error {
+		subnetClient, err := info.getSubnetsClient()
+		Expect(err).To(Succeed())
+
+		_, err = info.getSubnet(context.TODO(), "test-vnet", "test-subnet", subnetClient)
+
+		return err
+	}
+
+	It("should return ErrSubnetNotFound if the subnet doesn't exist", func() {
+		err := getSubnet()
+		Expect(errors.Is(err, ErrSubnetNotFound)).To(BeTrue())
+		Expect(errors.Is(err, ErrAuthFailed)).To(BeFalse())
+		Expect(CategorizeError(err)).To(Equal(ErrorCategoryNotFound))
+	})
+
+	It("should return ErrAuthFailed if the credentials aren't authorized", func() {
+		fake.put(subnetPath("test-vnet", "test-subnet"), &armnetwork.Subnet{})
+		fake.failNext(http.MethodGet, subnetPath("test-vnet", "test-subnet"), http.StatusForbidden)
+
+		err := getSubnet()
+		Expect(errors.Is(err, ErrAuthFailed)).To(BeTrue())
+		Expect(errors.Is(err, ErrSubnetNotFound)).To(BeFalse())
+	})
+
+	It("should return other errors as is", func() {
+		fake.put(subnetPath("test-vnet", "test-subnet"), &armnetwork.Subnet{})
+		fake.failNext(http.MethodGet, subnetPath("test-vnet", "test-subnet"), http.StatusBadRequest)
+
+		err := getSubnet()
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, ErrSubnetNotFound)).To(BeFalse())
+		Expect(errors.Is(err, ErrAuthFailed)).To(BeFalse())
+	})
+})
+
+type failureRecorder struct {
+	reporter.Basic
+	failures []string
+}
+
+func (r *failureRecorder) Failure(message string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(message, args...))
+}
+
+func (r *failureRecorder) End() {}
+
+var _ = Describe("Remediation hints", func() {
+	responseError := func(statusCode int, errorCode string) error {
+		return &azcore.ResponseError{StatusCode: statusCode, ErrorCode: errorCode}
+	}
+
+	DescribeTable("should add the hint of the error's category to the reported failure",
+		func(err error, category ErrorCategory) {
+			recorder := &failureRecorder{}
+
+			reported := withRemediationHints(&reporter.Adapter{Basic: recorder}).Error(err, "Failed to open the ports")
+			Expect(CategorizeError(reported)).To(Equal(category))
+
+			Expect(RemediationHint(category)).ToNot(BeEmpty())
+			Expect(recorder.failures).To(HaveLen(1))
+			Expect(recorder.failures[0]).To(ContainSubstring(RemediationHint(category)))
+		},
+		Entry("unauthorized", responseError(http.StatusForbidden, "AuthorizationFailed"), ErrorCategoryUnauthorized),
+		Entry("not found", responseError(http.StatusNotFound, "ResourceNotFound"), ErrorCategoryNotFound),
+		Entry("throttled", responseError(http.StatusTooManyRequests, "TooManyRequests"), ErrorCategoryThrottled),
+		Entry("quota", responseError(http.StatusConflict, "QuotaExceeded"), ErrorCategoryQuota),
+		Entry("locked", responseError(http.StatusConflict, "ScopeLocked"), ErrorCategoryLocked),
+	)
+
+	It("should not add a hint to errors without one", func() {
+		recorder := &failureRecorder{}
+
+		Expect(withRemediationHints(&reporter.Adapter{Basic: recorder}).Error(errors.New("mock error"), "Failed")).To(
+			MatchError("Failed: mock error"))
+		Expect(recorder.failures).To(Equal([]string{"Failed: mock error"}))
+	})
+
+	It("should add the hint only once", func() {
+		status := withRemediationHints(withRemediationHints(&reporter.Adapter{Basic: &failureRecorder{}}))
+
+		err := status.Error(responseError(http.StatusForbidden, "AuthorizationFailed"), "Failed")
+		Expect(strings.Count(err.Error(), RemediationHint(ErrorCategoryUnauthorized))).To(Equal(1))
+	})
+})
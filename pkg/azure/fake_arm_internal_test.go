@@ -0,0 +1,514 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	testSubscriptionID = "test-subscription"
+	testResourceGroup  = "test-rg"
+)
+
+// fakeARM is a policy.Transporter which emulates the subset of the Azure Resource Manager REST API used by this package.
+// Resources are stored as raw JSON keyed by their lower-cased resource path.
+type fakeARM struct {
+	mutex     sync.Mutex
+	resources map[string][]byte
+	failures  map[string][]int
+	codes     map[string]string
+	hangs     map[string]bool
+	latency   time.Duration
+	publicIPs int
+	onPut     map[string]func(obj map[string]any)
+	requests  []string
+	hosts     map[string]bool
+	versions  map[string]bool
+	closed    int
+}
+
+func newFakeARM() *fakeARM {
+	f := &fakeARM{
+		resources: map[string][]byte{},
+		failures:  map[string][]int{},
+		codes:     map[string]string{},
+		hangs:     map[string]bool{},
+		onPut:     map[string]func(obj map[string]any){},
+		hosts:     map[string]bool{},
+		versions:  map[string]bool{},
+	}
+
+	f.setLocations("east", "west")
+
+	return f
+}
+
+// setLocations sets the locations available for the test subscription.
+func (f *fakeARM) setLocations(names ...string) {
+	f.setZonalLocations(nil, names...)
+}
+
+// setZonalLocations sets the locations available for the test subscription, each with the given availability zones.
+func (f *fakeARM) setZonalLocations(zones []string, names ...string) {
+	zoneMappings := []map[string]string{}
+	for _, zone := range zones {
+		zoneMappings = append(zoneMappings, map[string]string{"logicalZone": zone, "physicalZone": "east-az" + zone})
+	}
+
+	locations := []map[string]any{}
+	for _, name := range names {
+		locations = append(locations, map[string]any{"name": name, "availabilityZoneMappings": zoneMappings})
+	}
+
+	data, err := json.Marshal(map[string]any{"value": locations})
+	Expect(err).To(Succeed())
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.resources[strings.ToLower("/subscriptions/"+testSubscriptionID+"/locations")] = data
+}
+
+// setPermissions sets the actions the test credentials are allowed, and not allowed, to perform on the test resource group.
+func (f *fakeARM) setPermissions(actions, notActions []string) {
+	data, err := json.Marshal(map[string]any{"value": []map[string]any{{"actions": actions, "notActions": notActions}}})
+	Expect(err).To(Succeed())
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.resources[strings.ToLower(resourceGroupPath("Microsoft.Authorization/permissions"))] = data
+}
+
+func (f *fakeARM) clientOptions() *arm.ClientOptions {
+	return &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Transport: f,
+			Retry:     policy.RetryOptions{MaxRetries: -1},
+		},
+	}
+}
+
+func resourceGroupPath(provider string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/%s", testSubscriptionID, testResourceGroup, provider)
+}
+
+func nsgPath(name string) string {
+	return resourceGroupPath("Microsoft.Network/networkSecurityGroups/" + name)
+}
+
+func subnetPath(vnet, subnet string) string {
+	return resourceGroupPath("Microsoft.Network/virtualNetworks/" + vnet + "/subnets/" + subnet)
+}
+
+func nicPath(name string) string {
+	return resourceGroupPath("Microsoft.Network/networkInterfaces/" + name)
+}
+
+func publicIPPath(name string) string {
+	return resourceGroupPath("Microsoft.Network/publicIPAddresses/" + name)
+}
+
+func publicIPPathInGroup(group, name string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/publicIPAddresses/%s",
+		testSubscriptionID, group, name)
+}
+
+// put stores the given object at the given path, setting its ID and name as Azure would.
+func (f *fakeARM) put(path string, obj any) {
+	data, err := json.Marshal(obj)
+	Expect(err).To(Succeed())
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.resources[strings.ToLower(path)] = withIdentity(path, data)
+}
+
+// get retrieves the object stored at the given path into obj, returning false if there's none.
+func (f *fakeARM) get(path string, obj any) bool {
+	f.mutex.Lock()
+	data, ok := f.resources[strings.ToLower(path)]
+	f.mutex.Unlock()
+
+	if ok {
+		Expect(json.Unmarshal(data, obj)).To(Succeed())
+	}
+
+	return ok
+}
+
+// failNext causes the next requests with the given method and path to fail with the given HTTP status codes, in order.
+func (f *fakeARM) failNext(method, path string, statusCodes ...int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	key := method + " " + strings.ToLower(path)
+	f.failures[key] = append(f.failures[key], statusCodes...)
+}
+
+// failNextWithCode causes the next request with the given method and path to fail with the given status and error code.
+func (f *fakeARM) failNextWithCode(method, path string, statusCode int, code string) {
+	f.failNext(method, path, statusCode)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.codes[method+" "+strings.ToLower(path)] = code
+}
+
+// hang causes requests with the given method and path to block until their context is done.
+func (f *fakeARM) hang(method, path string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.hangs[method+" "+strings.ToLower(path)] = true
+}
+
+// mutateOnPut causes the given function to modify the objects stored by requests to put the given path, emulating
+// changes made by Azure which aren't reflected in the request.
+func (f *fakeARM) mutateOnPut(path string, mutate func(obj map[string]any)) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.onPut[strings.ToLower(path)] = mutate
+}
+
+// CloseIdleConnections counts the number of times the idle connections are closed.
+func (f *fakeARM) CloseIdleConnections() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.closed++
+}
+
+// requestAPIVersions returns the API versions requested.
+func (f *fakeARM) requestAPIVersions() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	versions := []string{}
+	for version := range f.versions {
+		versions = append(versions, version)
+	}
+
+	return versions
+}
+
+// requestHosts returns the hosts targeted by the requests received.
+func (f *fakeARM) requestHosts() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	hosts := []string{}
+	for host := range f.hosts {
+		hosts = append(hosts, host)
+	}
+
+	return hosts
+}
+
+// requestCountByMethod returns the number of requests received with the given method, for any path.
+func (f *fakeARM) requestCountByMethod(method string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	count := 0
+
+	for _, request := range f.requests {
+		if strings.HasPrefix(request, method+" ") {
+			count++
+		}
+	}
+
+	return count
+}
+
+// requestCount returns the number of requests received with the given method and path.
+func (f *fakeARM) requestCount(method, path string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	count := 0
+
+	for _, r := range f.requests {
+		if r == method+" "+strings.ToLower(path) {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (f *fakeARM) Do(req *http.Request) (*http.Response, error) {
+	path := strings.ToLower(req.URL.Path)
+	key := req.Method + " " + path
+
+	// The latency is outside the lock so that concurrent requests overlap, as they would against Azure.
+	time.Sleep(f.latency)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.requests = append(f.requests, key)
+	f.hosts[req.URL.Host] = true
+	f.versions[req.URL.Query().Get("api-version")] = true
+
+	if f.hangs[key] {
+		f.mutex.Unlock()
+		<-req.Context().Done()
+		f.mutex.Lock()
+
+		return nil, req.Context().Err()
+	}
+
+	if codes := f.failures[key]; len(codes) > 0 {
+		f.failures[key] = codes[1:]
+
+		code := fmt.Sprintf("Fake%d", codes[0])
+		if c, ok := f.codes[key]; ok {
+			code = c
+			delete(f.codes, key)
+		}
+
+		return newResponse(req, codes[0], fmt.Sprintf(`{"error":{"code":%q,"message":"fake failure"}}`, code)), nil
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		if data, ok := f.resources[path]; ok {
+			return newResponse(req, http.StatusOK, string(data)), nil
+		}
+
+		if items, ok := f.list(path); ok {
+			return newResponse(req, http.StatusOK, `{"value":[`+strings.Join(items, ",")+`]}`), nil
+		}
+
+		return newResponse(req, http.StatusNotFound, `{"error":{"code":"NotFound","message":"not found"}}`), nil
+	case http.MethodPut:
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		f.resources[path] = withIdentity(req.URL.Path, body)
+
+		if strings.Contains(path, "/microsoft.network/publicipaddresses/") {
+			f.assignPublicIPAddress(path)
+		}
+
+		if mutate := f.onPut[path]; mutate != nil {
+			obj := map[string]any{}
+			Expect(json.Unmarshal(f.resources[path], &obj)).To(Succeed())
+			mutate(obj)
+
+			f.resources[path], err = json.Marshal(obj)
+			Expect(err).To(Succeed())
+		}
+
+		return newResponse(req, http.StatusOK, string(f.resources[path])), nil
+	case http.MethodPatch:
+		return f.patchTags(req, path)
+	case http.MethodDelete:
+		if _, ok := f.resources[path]; !ok {
+			return newResponse(req, http.StatusNoContent, ""), nil
+		}
+
+		if f.isPublicIPInUse(path) {
+			return newResponse(req, http.StatusBadRequest,
+				`{"error":{"code":"PublicIPAddressInUse","message":"the public IP is in use by a network interface"}}`), nil
+		}
+
+		delete(f.resources, path)
+
+		return newResponse(req, http.StatusOK, ""), nil
+	}
+
+	return newResponse(req, http.StatusMethodNotAllowed, ""), nil
+}
+
+// assignPublicIPAddress assigns an address to the public IP at the given path if it has none, as Azure does when a static
+// public IP is created.
+func (f *fakeARM) assignPublicIPAddress(path string) {
+	obj := map[string]any{}
+	Expect(json.Unmarshal(f.resources[path], &obj)).To(Succeed())
+
+	properties, _ := obj["properties"].(map[string]any)
+	if properties == nil {
+		properties = map[string]any{}
+		obj["properties"] = properties
+	}
+
+	if _, ok := properties["ipAddress"]; ok {
+		return
+	}
+
+	f.publicIPs++
+	properties["ipAddress"] = fmt.Sprintf("20.0.0.%d", f.publicIPs)
+
+	var err error
+
+	f.resources[path], err = json.Marshal(obj)
+	Expect(err).To(Succeed())
+}
+
+// isPublicIPInUse checks whether the public IP at the given path is attached to a stored network interface, as Azure
+// refuses to delete it then.
+func (f *fakeARM) isPublicIPInUse(path string) bool {
+	if !strings.Contains(path, "/microsoft.network/publicipaddresses/") {
+		return false
+	}
+
+	for key, data := range f.resources {
+		if !strings.Contains(key, "/microsoft.network/networkinterfaces/") {
+			continue
+		}
+
+		nwInterface := &armnetwork.Interface{}
+		Expect(json.Unmarshal(data, nwInterface)).To(Succeed())
+
+		if nwInterface.Properties == nil {
+			continue
+		}
+
+		for _, ipConfig := range nwInterface.Properties.IPConfigurations {
+			if ipConfig.Properties != nil && ipConfig.Properties.PublicIPAddress != nil &&
+				strings.EqualFold(ptr.Deref(ipConfig.Properties.PublicIPAddress.ID, ""), path) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// patchTags replaces the tags of the resource at the given path, as the UpdateTags operations do.
+func (f *fakeARM) patchTags(req *http.Request, path string) (*http.Response, error) {
+	data, ok := f.resources[path]
+	if !ok {
+		return newResponse(req, http.StatusNotFound, `{"error":{"code":"NotFound","message":"not found"}}`), nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	patch := map[string]any{}
+	Expect(json.Unmarshal(body, &patch)).To(Succeed())
+
+	obj := map[string]any{}
+	Expect(json.Unmarshal(data, &obj)).To(Succeed())
+
+	obj["tags"] = patch["tags"]
+
+	f.resources[path], err = json.Marshal(obj)
+	Expect(err).To(Succeed())
+
+	return newResponse(req, http.StatusOK, string(f.resources[path])), nil
+}
+
+// list returns the resources directly under the given path if it denotes a resource collection, i.e. it has a resource
+// type but no name after the provider namespace.
+func (f *fakeARM) list(path string) ([]string, bool) {
+	_, resourcePath, ok := strings.Cut(path, "/providers/")
+	if !ok || len(strings.Split(resourcePath, "/"))%2 != 0 {
+		return nil, false
+	}
+
+	items := []string{}
+
+	for key, data := range f.resources {
+		name, ok := strings.CutPrefix(key, path+"/")
+		if ok && !strings.Contains(name, "/") {
+			items = append(items, string(data))
+		}
+	}
+
+	return items, true
+}
+
+func withIdentity(path string, data []byte) []byte {
+	obj := map[string]any{}
+	Expect(json.Unmarshal(data, &obj)).To(Succeed())
+
+	if _, ok := obj["id"]; !ok {
+		obj["id"] = path
+	}
+
+	obj["name"] = path[strings.LastIndex(path, "/")+1:]
+
+	data, err := json.Marshal(obj)
+	Expect(err).To(Succeed())
+
+	return data
+}
+
+func newResponse(req *http.Request, statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Status:     http.StatusText(statusCode),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+		Request:    req,
+	}
+}
+
+type fakeTokenCredential struct {
+	scopes *[]string
+}
+
+func (c fakeTokenCredential) GetToken(_ context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if c.scopes != nil {
+		*c.scopes = append(*c.scopes, options.Scopes...)
+	}
+
+	return azcore.AccessToken{Token: "fake-token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func newTestCloudInfo(fake *fakeARM) *CloudInfo {
+	return &CloudInfo{
+		SubscriptionID:          testSubscriptionID,
+		InfraID:                 "test-infraID",
+		Region:                  "east",
+		BaseGroupName:           testResourceGroup,
+		TokenCredential:         fakeTokenCredential{},
+		SubnetNotFoundTimeout:   50 * time.Millisecond,
+		subnetLookupFrequency:   time.Millisecond,
+		publicIPAssignTimeout:   50 * time.Millisecond,
+		publicIPLookupFrequency: time.Millisecond,
+		ClientOptions:           fake.clientOptions(),
+	}
+}
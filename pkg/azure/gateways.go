@@ -0,0 +1,280 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/utils/ptr"
+)
+
+// GatewayInfo describes a node which has been prepared as a Submariner gateway.
+type GatewayInfo struct {
+	NodeName string
+	// PublicIP is empty if the node's public IP doesn't exist, e.g. because it was deleted out-of-band.
+	PublicIP string
+	// Ports are the ports opened by the gateway security group.
+	Ports []api.PortSpec
+}
+
+// ListGateways returns the nodes labelled as Submariner gateways, along with their public IPs and the ports opened by the
+// gateway security group. Nothing is modified.
+func (c *CloudInfo) ListGateways(ctx context.Context) ([]GatewayInfo, error) {
+	if c.K8sClient == nil {
+		return nil, errors.New("a K8s client is required to list the gateways")
+	}
+
+	nsgClient, err := c.getNsgClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get network security groups client")
+	}
+
+	pubIPClient, err := c.getPublicIPClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get network public IP addresses client")
+	}
+
+	gwNodes, err := c.K8sClient.ListGatewayNodes()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing the gateway nodes")
+	}
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	ports, err := c.gatewayPorts(ctx, nsgClient)
+	if err != nil {
+		return nil, err
+	}
+
+	gateways := make([]GatewayInfo, 0, len(gwNodes.Items))
+
+	for i := range gwNodes.Items {
+		gateway := GatewayInfo{
+			NodeName: gwNodes.Items[i].Name,
+			Ports:    ports,
+		}
+
+		publicIPName := gateway.NodeName + publicIPNameSuffix
+
+		resp, err := pubIPClient.Get(ctx, c.publicIPResourceGroup(), publicIPName, nil)
+		if err != nil && !isNotFound(err) {
+			return nil, errors.Wrapf(err, "error getting public ip: %q", publicIPName)
+		}
+
+		if err == nil && resp.Properties != nil {
+			gateway.PublicIP = ptr.Deref(resp.Properties.IPAddress, "")
+		}
+
+		gateways = append(gateways, gateway)
+	}
+
+	return gateways, nil
+}
+
+// GatewayPublicIPs returns the addresses of the public IPs of the nodes labelled as Submariner gateways, waiting for Azure
+// to assign those which don't have one yet. Gateway nodes without a public IP are skipped. Nothing is modified.
+func (c *CloudInfo) GatewayPublicIPs(ctx context.Context) ([]string, error) {
+	if c.K8sClient == nil {
+		return nil, errors.New("a K8s client is required to list the gateways")
+	}
+
+	pubIPClient, err := c.getPublicIPClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get network public IP addresses client")
+	}
+
+	gwNodes, err := c.K8sClient.ListGatewayNodes()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing the gateway nodes")
+	}
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	addresses := []string{}
+
+	for i := range gwNodes.Items {
+		publicIPName := gwNodes.Items[i].Name + publicIPNameSuffix
+
+		pubIP, err := c.getPublicIP(ctx, publicIPName, pubIPClient)
+		if isNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		address, err := c.waitForPublicIPAddress(ctx, publicIPName, pubIP, pubIPClient)
+		if err != nil {
+			return nil, err
+		}
+
+		addresses = append(addresses, address)
+	}
+
+	return addresses, nil
+}
+
+// gatewayPorts returns the ports opened by the inbound rules of the gateway security group, or none if the group doesn't
+// exist.
+func (c *CloudInfo) gatewayPorts(ctx context.Context, nsgClient *armnetwork.SecurityGroupsClient) ([]api.PortSpec, error) {
+	groupName := c.InfraID + externalSecurityGroupSuffix
+
+	nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
+	if isNotFound(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting the submariner gateway security group %q", groupName)
+	}
+
+	if nwSecurityGroup.Properties == nil {
+		return nil, nil
+	}
+
+	ports := []api.PortSpec{}
+
+	for _, rule := range nwSecurityGroup.Properties.SecurityRules {
+		if rule.Name == nil || !strings.HasPrefix(*rule.Name, externalSecurityRulePrefix) || rule.Properties == nil ||
+			ptr.Deref(rule.Properties.Direction, "") != armnetwork.SecurityRuleDirectionInbound {
+			continue
+		}
+
+		// The rule names end with the protocol, the port or port range, and the direction.
+		parts := strings.Split(*rule.Name, "-")
+		if len(parts) < 3 {
+			continue
+		}
+
+		portSpec, ok := parsePortNameToken(parts[len(parts)-2])
+		if !ok {
+			continue
+		}
+
+		// The IPv6 rules open the same ports as the IPv4 rules.
+		portSpec.Protocol = parts[len(parts)-3]
+		if !slices.Contains(ports, portSpec) {
+			ports = append(ports, portSpec)
+		}
+	}
+
+	return api.SortPorts(ports), nil
+}
+
+// parsePortNameToken parses the port, or port range, part of a security rule name; see portRange.nameToken.
+func parsePortNameToken(token string) (api.PortSpec, bool) {
+	first, last, isRange := strings.Cut(token, "_")
+
+	port, err := strconv.ParseUint(first, 10, 16)
+	if err != nil {
+		return api.PortSpec{}, false
+	}
+
+	portSpec := api.PortSpec{Port: uint16(port)}
+
+	if isRange {
+		endPort, err := strconv.ParseUint(last, 10, 16)
+		if err != nil {
+			return api.PortSpec{}, false
+		}
+
+		portSpec.EndPort = uint16(endPort)
+	}
+
+	return portSpec, true
+}
+
+// RemoveGatewayLabels removes the Submariner gateway label from all the nodes of the cluster and releases their gateway
+// public IPs, to clean up the gateways left behind when the gateway deployer's Cleanup wasn't run. Removing the remaining
+// nodes carries on if one of them fails, and the errors are returned together.
+func (c *CloudInfo) RemoveGatewayLabels(status reporter.Interface) error {
+	status = withRemediationHints(status)
+
+	status.Start("Removing the Submariner gateway labels from the nodes")
+	defer status.End()
+
+	if c.K8sClient == nil {
+		return status.Error(errors.New("a K8s client is required"), "Failed to remove the gateway labels")
+	}
+
+	nwClient, err := c.getInterfacesClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network interfaces client")
+	}
+
+	pubIPClient, err := c.getPublicIPClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network public IP addresses client")
+	}
+
+	if errs := c.removeGatewayLabels(context.Background(), nwClient, pubIPClient, status); len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	status.Success("Removed the Submariner gateway labels from the nodes")
+
+	return nil
+}
+
+// removeGatewayLabels removes the gateway label from the gateway nodes, detaches the gateway security group and public IP
+// from their interfaces, since Azure refuses to delete a public IP which is in use, and deletes their public IPs,
+// returning the errors encountered.
+func (c *CloudInfo) removeGatewayLabels(ctx context.Context, nwClient *armnetwork.InterfacesClient,
+	pubIPClient *armnetwork.PublicIPAddressesClient, status reporter.Interface,
+) []error {
+	gwNodes, err := c.K8sClient.ListGatewayNodes()
+	if err != nil {
+		return []error{status.Error(err, "error listing the Submariner gateway nodes")}
+	}
+
+	var errs []error
+
+	for i := range gwNodes.Items {
+		if err := c.K8sClient.RemoveGWLabelFromWorkerNode(&gwNodes.Items[i]); err != nil {
+			errs = append(errs, status.Error(err, "failed to cleanup node %q", gwNodes.Items[i].Name))
+
+			continue
+		}
+
+		if err := c.detachGWInterface(ctx, gwNodes.Items[i].Name, c.InfraID+externalSecurityGroupSuffix, nwClient); err != nil {
+			errs = append(errs, status.Error(err, "failed to detach the gateway resources from node %q", gwNodes.Items[i].Name))
+
+			continue
+		}
+
+		publicIPName := gwNodes.Items[i].Name + publicIPNameSuffix
+
+		if err := c.deleteGatewayPublicIP(ctx, pubIPClient, publicIPName); err != nil {
+			errs = append(errs, status.Error(err, "failed to delete public-ip %q", publicIPName))
+		}
+	}
+
+	return errs
+}
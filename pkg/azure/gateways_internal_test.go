@@ -0,0 +1,319 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+	"github.com/submariner-io/cloud-prepare/pkg/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("ListGateways", func() {
+	const workerLabel = "node-role.kubernetes.io/worker"
+
+	var (
+		fake *fakeARM
+		info *CloudInfo
+	)
+
+	BeforeEach(func() {
+		fake = newFakeARM()
+		info = newTestCloudInfo(fake)
+
+		gw1 := newNode("worker-1", workerLabel)
+		gw1.Labels[k8s.SubmarinerGatewayLabel] = "true"
+		gw2 := newNode("worker-2", workerLabel)
+		gw2.Labels[k8s.SubmarinerGatewayLabel] = "true"
+
+		info.K8sClient = k8s.NewInterface(kubeFake.NewClientset(gw1, gw2, newNode("worker-3", workerLabel)))
+
+		fake.put(publicIPPath("worker-1"+publicIPNameSuffix), &armnetwork.PublicIPAddress{
+			Properties: &armnetwork.PublicIPAddressPropertiesFormat{IPAddress: ptr.To("1.2.3.4")},
+		})
+
+		fake.put(nsgPath(info.InfraID+externalSecurityGroupSuffix), &armnetwork.SecurityGroup{
+			Properties: &armnetwork.SecurityGroupPropertiesFormat{
+				SecurityRules: []*armnetwork.SecurityRule{
+					info.createSecurityRule(externalSecurityRulePrefix, armnetwork.SecurityRuleProtocolUDP, 4500,
+						baseExternalInternal, armnetwork.SecurityRuleDirectionInbound, []string{allNetworkCIDR}),
+					info.createSecurityRule(externalSecurityRulePrefix, armnetwork.SecurityRuleProtocolUDP, 4500,
+						baseExternalInternal, armnetwork.SecurityRuleDirectionOutbound, []string{allNetworkCIDR}),
+					info.createSecurityRule(externalSecurityRulePrefix, armnetwork.SecurityRuleProtocolTCP, 8080,
+						baseExternalInternal+1, armnetwork.SecurityRuleDirectionInbound, []string{allNetworkCIDR}),
+					info.createPortSecurityRule(externalSecurityRulePrefix, api.PortSpec{Port: 5000, EndPort: 5010, Protocol: "udp"},
+						baseExternalInternal+2, armnetwork.SecurityRuleDirectionInbound, []string{allNetworkCIDR}),
+				},
+			},
+		})
+	})
+
+	listGateways := func() ([]GatewayInfo, error) {
+		return info.ListGateways(context.TODO())
+	}
+
+	It("should return the gateway nodes with their public IPs and opened ports without modifying anything", func() {
+		gateways, err := listGateways()
+		Expect(err).To(Succeed())
+
+		ports := []api.PortSpec{{Port: 8080, Protocol: "Tcp"}, {Port: 4500, Protocol: "Udp"}, {Port: 5000, EndPort: 5010, Protocol: "Udp"}}
+		Expect(gateways).To(ConsistOf(
+			GatewayInfo{NodeName: "worker-1", PublicIP: "1.2.3.4", Ports: ports},
+			GatewayInfo{NodeName: "worker-2", Ports: ports},
+		))
+
+		Expect(fake.requestCountByMethod(http.MethodPut)).To(BeZero())
+		Expect(fake.requestCountByMethod(http.MethodDelete)).To(BeZero())
+	})
+
+	When("the gateway security group doesn't exist", func() {
+		BeforeEach(func() {
+			fake.failNext(http.MethodGet, nsgPath(info.InfraID+externalSecurityGroupSuffix), http.StatusNotFound)
+		})
+
+		It("should return the gateway nodes without ports", func() {
+			gateways, err := listGateways()
+			Expect(err).To(Succeed())
+			Expect(gateways).To(HaveLen(2))
+			Expect(gateways[0].Ports).To(BeEmpty())
+			Expect(gateways[1].Ports).To(BeEmpty())
+		})
+	})
+
+	When("getting a public IP fails", func() {
+		BeforeEach(func() {
+			fake.failNext(http.MethodGet, publicIPPath("worker-1"+publicIPNameSuffix), http.StatusInternalServerError)
+		})
+
+		It("should return an error", func() {
+			_, err := listGateways()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	When("getting a public IP hangs", func() {
+		BeforeEach(func() {
+			info.OperationTimeout = 100 * time.Millisecond
+			fake.hang(http.MethodGet, publicIPPath("worker-1"+publicIPNameSuffix))
+		})
+
+		It("should time out", func() {
+			_, err := listGateways()
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+})
+
+var _ = Describe("GatewayPublicIPs", func() {
+	const workerLabel = "node-role.kubernetes.io/worker"
+
+	var (
+		fake *fakeARM
+		info *CloudInfo
+	)
+
+	BeforeEach(func() {
+		fake = newFakeARM()
+		info = newTestCloudInfo(fake)
+
+		gw1 := newNode("worker-1", workerLabel)
+		gw1.Labels[k8s.SubmarinerGatewayLabel] = "true"
+		gw2 := newNode("worker-2", workerLabel)
+		gw2.Labels[k8s.SubmarinerGatewayLabel] = "true"
+		gw3 := newNode("worker-3", workerLabel)
+		gw3.Labels[k8s.SubmarinerGatewayLabel] = "true"
+
+		info.K8sClient = k8s.NewInterface(kubeFake.NewClientset(gw1, gw2, gw3))
+
+		fake.put(publicIPPath("worker-1"+publicIPNameSuffix), &armnetwork.PublicIPAddress{
+			Properties: &armnetwork.PublicIPAddressPropertiesFormat{IPAddress: ptr.To("1.2.3.4")},
+		})
+		fake.put(publicIPPath("worker-2"+publicIPNameSuffix), &armnetwork.PublicIPAddress{
+			Properties: &armnetwork.PublicIPAddressPropertiesFormat{IPAddress: ptr.To("5.6.7.8")},
+		})
+	})
+
+	gatewayPublicIPs := func() ([]string, error) {
+		return info.GatewayPublicIPs(context.TODO())
+	}
+
+	It("should return the addresses of the gateway public IPs, skipping the gateways without any", func() {
+		addresses, err := gatewayPublicIPs()
+		Expect(err).To(Succeed())
+		Expect(addresses).To(ConsistOf("1.2.3.4", "5.6.7.8"))
+	})
+
+	When("an address hasn't been assigned yet", func() {
+		BeforeEach(func() {
+			info.publicIPAssignTimeout = 5 * time.Second
+
+			fake.put(publicIPPath("worker-2"+publicIPNameSuffix), &armnetwork.PublicIPAddress{
+				Properties: &armnetwork.PublicIPAddressPropertiesFormat{},
+			})
+
+			go func() {
+				defer GinkgoRecover()
+
+				time.Sleep(20 * time.Millisecond)
+				fake.put(publicIPPath("worker-2"+publicIPNameSuffix), &armnetwork.PublicIPAddress{
+					Properties: &armnetwork.PublicIPAddressPropertiesFormat{IPAddress: ptr.To("5.6.7.8")},
+				})
+			}()
+		})
+
+		It("should wait for it", func() {
+			addresses, err := gatewayPublicIPs()
+			Expect(err).To(Succeed())
+			Expect(addresses).To(ConsistOf("1.2.3.4", "5.6.7.8"))
+		})
+	})
+
+	When("an address is never assigned", func() {
+		BeforeEach(func() {
+			fake.put(publicIPPath("worker-2"+publicIPNameSuffix), &armnetwork.PublicIPAddress{
+				Properties: &armnetwork.PublicIPAddressPropertiesFormat{},
+			})
+		})
+
+		It("should return an error", func() {
+			_, err := gatewayPublicIPs()
+			Expect(err).To(MatchError(ContainSubstring(`no address was assigned to public IP "worker-2-pub"`)))
+		})
+	})
+})
+
+var _ = Describe("RemoveGatewayLabels", func() {
+	const workerLabel = "node-role.kubernetes.io/worker"
+
+	var (
+		fake       *fakeARM
+		info       *CloudInfo
+		kubeClient *kubeFake.Clientset
+	)
+
+	BeforeEach(func() {
+		fake = newFakeARM()
+		info = newTestCloudInfo(fake)
+
+		gw1 := newNode("worker-1", workerLabel)
+		gw1.Labels[k8s.SubmarinerGatewayLabel] = "true"
+		gw2 := newNode("worker-2", workerLabel)
+		gw2.Labels[k8s.SubmarinerGatewayLabel] = "true"
+
+		kubeClient = kubeFake.NewClientset(gw1, gw2, newNode("worker-3", workerLabel))
+		info.K8sClient = k8s.NewInterface(kubeClient)
+
+		for _, name := range []string{"worker-1", "worker-2", "worker-3"} {
+			fake.put(publicIPPath(name+publicIPNameSuffix), &armnetwork.PublicIPAddress{})
+		}
+
+		// The gateway public IPs are still attached to the interfaces of the gateway nodes.
+		for _, name := range []string{"worker-1", "worker-2"} {
+			fake.put(nicPath(name+"-nic"), &armnetwork.Interface{
+				Properties: &armnetwork.InterfacePropertiesFormat{
+					NetworkSecurityGroup: &armnetwork.SecurityGroup{ID: ptr.To(nsgPath(info.InfraID + externalSecurityGroupSuffix))},
+					IPConfigurations: []*armnetwork.InterfaceIPConfiguration{{
+						Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
+							Primary:         ptr.To(true),
+							PublicIPAddress: &armnetwork.PublicIPAddress{ID: ptr.To(publicIPPath(name + publicIPNameSuffix))},
+						},
+					}},
+				},
+			})
+		}
+	})
+
+	gatewayLabelled := func(name string) bool {
+		node, err := kubeClient.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).To(Succeed())
+
+		_, ok := node.Labels[k8s.SubmarinerGatewayLabel]
+
+		return ok
+	}
+
+	It("should remove the labels from all the gateway nodes and release their public IPs", func() {
+		Expect(info.RemoveGatewayLabels(reporter.Stdout())).To(Succeed())
+
+		for _, name := range []string{"worker-1", "worker-2"} {
+			Expect(gatewayLabelled(name)).To(BeFalse())
+			Expect(fake.get(publicIPPath(name+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+		}
+
+		Expect(fake.get(publicIPPath("worker-3"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeTrue())
+	})
+
+	It("should detach the gateway security group and public IPs from the gateway interfaces", func() {
+		Expect(info.RemoveGatewayLabels(reporter.Stdout())).To(Succeed())
+
+		for _, name := range []string{"worker-1", "worker-2"} {
+			nwInterface := &armnetwork.Interface{}
+			Expect(fake.get(nicPath(name+"-nic"), nwInterface)).To(BeTrue())
+			Expect(nwInterface.Properties.NetworkSecurityGroup).To(BeNil())
+			Expect(nwInterface.Properties.IPConfigurations[0].Properties.PublicIPAddress).To(BeNil())
+		}
+	})
+
+	When("detaching an interface fails", func() {
+		BeforeEach(func() {
+			fake.failNext(http.MethodPut, nicPath("worker-1-nic"), http.StatusBadRequest)
+		})
+
+		It("should keep its public IP and carry on with the other nodes", func() {
+			Expect(info.RemoveGatewayLabels(reporter.Stdout())).ToNot(Succeed())
+			Expect(fake.get(publicIPPath("worker-1"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeTrue())
+			Expect(fake.get(publicIPPath("worker-2"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+		})
+	})
+
+	When("a public IP was already deleted", func() {
+		BeforeEach(func() {
+			fake = newFakeARM()
+			info = newTestCloudInfo(fake)
+			info.K8sClient = k8s.NewInterface(kubeClient)
+		})
+
+		It("should still remove the labels", func() {
+			Expect(info.RemoveGatewayLabels(reporter.Stdout())).To(Succeed())
+			Expect(gatewayLabelled("worker-1")).To(BeFalse())
+			Expect(gatewayLabelled("worker-2")).To(BeFalse())
+		})
+	})
+
+	When("releasing a public IP fails", func() {
+		BeforeEach(func() {
+			fake.failNext(http.MethodDelete, publicIPPath("worker-1"+publicIPNameSuffix), http.StatusBadRequest)
+		})
+
+		It("should carry on with the other nodes and return an error", func() {
+			Expect(info.RemoveGatewayLabels(reporter.Stdout())).ToNot(Succeed())
+			Expect(gatewayLabelled("worker-2")).To(BeFalse())
+			Expect(fake.get(publicIPPath("worker-2"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+		})
+	})
+})
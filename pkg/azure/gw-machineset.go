@@ -76,10 +76,10 @@ spec:
           resourceGroup: {{.InfraID}}-rg
           sshPrivateKey: ""
           sshPublicKey: ""
-          subnet: {{.InfraID}}-worker-subnet
+          subnet: {{.Subnet}}
           securityGroup: {{.InfraID}}-submariner-external-sg
           userDataSecret:
             name: worker-user-data
           vmSize: {{.InstanceType}}
-          vnet: {{.InfraID}}-vnet
+          vnet: {{.VNet}}
           zone: {{.AZ}}`
@@ -0,0 +1,110 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package azure
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+)
+
+const (
+	// The metrics rules are a subset of the internal rules so that they're removed along with them.
+	metricsSecurityRulePrefix       = internalSecurityRulePrefix + "Metrics-"
+	basePriorityMetrics       int32 = 3000
+)
+
+// OpenMetricsPorts opens the given Submariner metrics ports in the internal security group, allowing them from the
+// cluster's pod network so that the in-cluster Prometheus can scrape them. Any previously opened metrics ports are
+// replaced.
+func (c *CloudInfo) OpenMetricsPorts(ports []api.PortSpec, status reporter.Interface) error {
+	ports = api.SortPorts(ports)
+
+	status = withRemediationHints(status)
+
+	status.Start("Opening the metrics ports %q for Prometheus on Azure", formatPorts(ports))
+
+	podCIDRs, err := c.clusterNetworkCIDRs()
+	if err != nil {
+		return status.Error(err, "Failed to determine the cluster's pod network")
+	}
+
+	nsgClient, err := c.getNsgClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network security groups client")
+	}
+
+	groupName := c.InfraID + internalSecurityGroupSuffix
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.resourceTimeout())
+	defer cancel()
+
+	nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
+	if err != nil {
+		return status.Error(err, "error getting the security group %q", groupName)
+	}
+
+	if nwSecurityGroup.Properties == nil {
+		nwSecurityGroup.Properties = &armnetwork.SecurityGroupPropertiesFormat{}
+	}
+
+	securityRules := []*armnetwork.SecurityRule{}
+
+	for _, rule := range nwSecurityGroup.Properties.SecurityRules {
+		if rule.Name == nil || !strings.HasPrefix(*rule.Name, metricsSecurityRulePrefix) || !c.ownsSecurityRule(rule) {
+			securityRules = append(securityRules, rule)
+		}
+	}
+
+	priorities, err := nextAvailablePriorities(securityRules, basePriorityMetrics, len(ports))
+	if err != nil {
+		return status.Error(err, "error allocating the priorities of the metrics rules in security group %q", groupName)
+	}
+
+	for i, port := range ports {
+		securityRules = append(securityRules,
+			c.createPortSecurityRule(metricsSecurityRulePrefix, port, priorities[i], armnetwork.SecurityRuleDirectionInbound,
+				podCIDRs),
+			c.createPortSecurityRule(metricsSecurityRulePrefix, port, priorities[i], armnetwork.SecurityRuleDirectionOutbound,
+				podCIDRs))
+	}
+
+	if err := validateSecurityRules(securityRules); err != nil {
+		return status.Error(err, "invalid security rules for security group %q", groupName)
+	}
+
+	nwSecurityGroup.Properties.SecurityRules = securityRules
+	stampRulesModified(&nwSecurityGroup.SecurityGroup)
+
+	poller, err := nsgClient.BeginCreateOrUpdate(ctx, c.BaseGroupName, groupName, nwSecurityGroup.SecurityGroup, nil)
+	if err != nil {
+		return status.Error(err, "updating security group %q with the metrics rules failed", groupName)
+	}
+
+	_, err = pollUntilDone(ctx, poller, c.pollOptions())
+	if err != nil {
+		return status.Error(err, "error updating security group %q with the metrics rules", groupName)
+	}
+
+	status.Success("Opened the metrics ports %q from the pod network %v", formatPorts(ports), podCIDRs)
+
+	return nil
+}
@@ -0,0 +1,98 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package azure
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+	"github.com/submariner-io/cloud-prepare/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("OpenMetricsPorts", func() {
+	var (
+		fake          *fakeARM
+		info          *CloudInfo
+		clusterConfig *corev1.ConfigMap
+		retErr        error
+	)
+
+	BeforeEach(func() {
+		fake = newFakeARM()
+		info = newTestCloudInfo(fake)
+
+		clusterConfig = newClusterConfig("10.0.0.0/16")
+		clusterConfig.Data[installConfigKey] += "  clusterNetwork:\n  - cidr: 10.128.0.0/14\n    hostPrefix: 23\n"
+
+		fake.put(nsgPath(info.InfraID+internalSecurityGroupSuffix), &armnetwork.SecurityGroup{
+			Properties: &armnetwork.SecurityGroupPropertiesFormat{
+				SecurityRules: []*armnetwork.SecurityRule{{
+					Name:       ptr.To(metricsSecurityRulePrefix + "Tcp-9999-Inbound"),
+					Properties: &armnetwork.SecurityRulePropertiesFormat{},
+				}},
+			},
+		})
+	})
+
+	JustBeforeEach(func() {
+		info.K8sClient = k8s.NewInterface(kubeFake.NewClientset(clusterConfig))
+		retErr = info.OpenMetricsPorts([]api.PortSpec{{Port: 32780, Protocol: "tcp"}}, reporter.Stdout())
+	})
+
+	getRules := func() []*armnetwork.SecurityRule {
+		nsg := &armnetwork.SecurityGroup{}
+		Expect(fake.get(nsgPath(info.InfraID+internalSecurityGroupSuffix), nsg)).To(BeTrue())
+
+		return nsg.Properties.SecurityRules
+	}
+
+	It("should add rules for the metrics ports scoped to the pod network", func() {
+		Expect(retErr).To(Succeed())
+
+		rules := getRules()
+		Expect(rules).To(HaveLen(2))
+
+		for _, rule := range rules {
+			Expect(*rule.Name).To(HavePrefix(metricsSecurityRulePrefix + "Tcp-32780-"))
+			Expect(*rule.Properties.SourceAddressPrefix).To(Equal("10.128.0.0/14"))
+			Expect(*rule.Properties.DestinationPortRange).To(Equal("32780-32780"))
+			Expect(*rule.Properties.Priority).To(Equal(basePriorityMetrics))
+		}
+	})
+
+	It("should not prevent the internal ports from being opened", func() {
+		Expect(retErr).To(Succeed())
+		Expect(getRules()).ToNot(ContainElement(Satisfy(info.isInternalSecurityRule)))
+	})
+
+	When("the pod network can't be determined", func() {
+		BeforeEach(func() {
+			clusterConfig = newClusterConfig("10.0.0.0/16")
+		})
+
+		It("should return an error without opening the ports", func() {
+			Expect(retErr).To(MatchError(ContainSubstring("no cluster network CIDR")))
+			Expect(getRules()).To(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,388 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package azure
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	"k8s.io/utils/set"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	clusterConfigNamespace = "kube-system"
+	clusterConfigName      = "cluster-config-v1"
+	installConfigKey       = "install-config"
+)
+
+type networkCIDR struct {
+	CIDR string `json:"cidr"`
+}
+
+type installConfig struct {
+	Networking struct {
+		MachineNetwork []networkCIDR `json:"machineNetwork"`
+		ClusterNetwork []networkCIDR `json:"clusterNetwork"`
+	} `json:"networking"`
+}
+
+func (c *CloudInfo) readInstallConfig() (*installConfig, error) {
+	configMaps, ok := c.K8sClient.(k8s.ConfigMapInterface)
+	if !ok {
+		return nil, errors.New("a K8s client supporting ConfigMaps is required to read the cluster network config")
+	}
+
+	data, err := configMaps.GetConfigMapData(clusterConfigNamespace, clusterConfigName)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading the cluster network config")
+	}
+
+	config := &installConfig{}
+
+	if err := yaml.Unmarshal([]byte(data[installConfigKey]), config); err != nil {
+		return nil, errors.Wrap(err, "error parsing the cluster install config")
+	}
+
+	return config, nil
+}
+
+// machineNetworkCIDRs returns the machine network CIDRs from the cluster's install config.
+func (c *CloudInfo) machineNetworkCIDRs() ([]string, error) {
+	config, err := c.readInstallConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return networkCIDRs(config.Networking.MachineNetwork, "machine")
+}
+
+// clusterNetworkCIDRs returns the pod network CIDRs from the cluster's install config.
+func (c *CloudInfo) clusterNetworkCIDRs() ([]string, error) {
+	config, err := c.readInstallConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return networkCIDRs(config.Networking.ClusterNetwork, "cluster")
+}
+
+func networkCIDRs(networks []networkCIDR, kind string) ([]string, error) {
+	cidrs := []string{}
+
+	for _, network := range networks {
+		if network.CIDR != "" {
+			cidrs = append(cidrs, network.CIDR)
+		}
+	}
+
+	if len(cidrs) == 0 {
+		return nil, errors.Errorf("the cluster install config has no %s network CIDR", kind)
+	}
+
+	return cidrs, nil
+}
+
+// internalSourceAddressPrefixes returns the source address prefixes for the internal security rules: the configured
+// service tag if any, otherwise the cluster's machine network CIDRs along with those of the peered VNets. If the machine
+// network can't be determined, it falls back to allowing all sources.
+func (c *CloudInfo) internalSourceAddressPrefixes(ctx context.Context, status reporter.Interface) []string {
+	if c.InternalSourceServiceTag != "" {
+		return []string{c.InternalSourceServiceTag}
+	}
+
+	if c.K8sClient == nil {
+		return []string{allNetworkCIDR}
+	}
+
+	cidrs, err := c.machineNetworkCIDRs()
+	if err != nil {
+		status.Warning("Unable to determine the machine network CIDR, allowing internal traffic from %q: %v", allNetworkCIDR, err)
+		return []string{allNetworkCIDR}
+	}
+
+	cidrs = append(cidrs, c.PeerVNetCIDRs...)
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	gwSubnets, err := c.discoverGatewaySubnets(ctx)
+	if err != nil {
+		status.Warning("Unable to discover the gateway subnets: %v", err)
+	}
+
+	for _, gwSubnet := range gwSubnets {
+		cidrs = append(cidrs, gwSubnet.addressPrefixes...)
+	}
+
+	if c.DiscoverPeerVNetCIDRs {
+		peerCIDRs, err := c.peerVNetCIDRs(ctx)
+		if err != nil {
+			status.Warning("Unable to discover the CIDRs of the peered VNets: %v", err)
+		}
+
+		cidrs = append(cidrs, peerCIDRs...)
+	}
+
+	slices.Sort(cidrs)
+
+	return slices.Compact(cidrs)
+}
+
+func (c *CloudInfo) discoverGatewaySubnets(ctx context.Context) ([]gatewaySubnet, error) {
+	gwNodes, err := c.K8sClient.ListGatewayNodes()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing the gateway nodes")
+	}
+
+	return c.gatewaySubnets(ctx, gwNodes.Items)
+}
+
+// peerVNetCIDRs returns the address prefixes of the VNets peered with the cluster VNet.
+func (c *CloudInfo) peerVNetCIDRs(ctx context.Context) ([]string, error) {
+	peeringsClient, err := c.getPeeringsClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the VNet peerings client")
+	}
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	vnetName := c.vnetName(c.InfraID)
+	cidrs := []string{}
+
+	pager := peeringsClient.NewListPager(c.BaseGroupName, vnetName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error listing the peerings of VNet %q", vnetName)
+		}
+
+		for _, peering := range page.Value {
+			if peering.Properties == nil || peering.Properties.RemoteAddressSpace == nil {
+				continue
+			}
+
+			for _, prefix := range peering.Properties.RemoteAddressSpace.AddressPrefixes {
+				cidrs = append(cidrs, ptr.Deref(prefix, ""))
+			}
+		}
+	}
+
+	return cidrs, nil
+}
+
+// GatewayPrivateIPs returns the primary private IP of each gateway node, keyed by node name, for topologies in which
+// peers reach the gateways privately. The node's internal address is used if it has one, otherwise the private IP of the
+// primary IP configuration of its interface.
+func (c *CloudInfo) GatewayPrivateIPs(ctx context.Context) (map[string]string, error) {
+	gwNodes, err := c.K8sClient.ListGatewayNodes()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing the gateway nodes")
+	}
+
+	nwClient, err := c.getInterfacesClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the interfaces client")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.resourceTimeout())
+	defer cancel()
+
+	privateIPs := map[string]string{}
+
+	for i := range gwNodes.Items {
+		node := &gwNodes.Items[i]
+
+		privateIP := nodeInternalIP(node)
+		if privateIP == "" {
+			privateIP, err = c.interfacePrivateIP(ctx, node.Name+"-nic", nwClient)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		privateIPs[node.Name] = privateIP
+	}
+
+	return privateIPs, nil
+}
+
+func nodeInternalIP(node *corev1.Node) string {
+	for _, address := range node.Status.Addresses {
+		if address.Type == corev1.NodeInternalIP {
+			return address.Address
+		}
+	}
+
+	return ""
+}
+
+func (c *CloudInfo) interfacePrivateIP(ctx context.Context, interfaceName string, nwClient *armnetwork.InterfacesClient,
+) (string, error) {
+	nwInterface, err := nwClient.Get(ctx, c.BaseGroupName, interfaceName, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "error getting the interface %q", interfaceName)
+	}
+
+	if nwInterface.Properties != nil {
+		for _, ipConfig := range nwInterface.Properties.IPConfigurations {
+			if ipConfig.Properties != nil && ptr.Deref(ipConfig.Properties.Primary, false) {
+				return ptr.Deref(ipConfig.Properties.PrivateIPAddress, ""), nil
+			}
+		}
+	}
+
+	return "", errors.Errorf("interface %q has no primary IP configuration", interfaceName)
+}
+
+// NATGatewayEgressIPs returns the public IPs of the NAT gateways associated with the subnets of the cluster nodes and the
+// subnets dedicated to the gateway nodes, if any. Gateway nodes without a public IP egress through them so peers need to
+// allow these IPs. If none of the subnets has a NAT gateway, nil is returned.
+func (c *CloudInfo) NATGatewayEgressIPs(ctx context.Context) ([]string, error) {
+	subnetClient, err := c.getSubnetsClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the subnets client")
+	}
+
+	natClient, err := c.getNatGatewaysClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the NAT gateways client")
+	}
+
+	pubIPClient, err := c.getPublicIPClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the public IP addresses client")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.resourceTimeout())
+	defer cancel()
+
+	natIDs, err := c.egressNATGateways(ctx, subnetClient)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(natIDs) == 0 {
+		return nil, nil
+	}
+
+	egressIPs := []string{}
+
+	for _, natID := range natIDs {
+		natIPs, err := natGatewayPublicIPs(ctx, natID, natClient, pubIPClient)
+		if err != nil {
+			return nil, err
+		}
+
+		egressIPs = append(egressIPs, natIPs...)
+	}
+
+	return egressIPs, nil
+}
+
+// egressNATGateways returns the IDs of the NAT gateways associated with the subnets of the cluster nodes and the subnets
+// dedicated to the gateway nodes, without duplicates.
+func (c *CloudInfo) egressNATGateways(ctx context.Context, subnetClient *armnetwork.SubnetsClient) ([]*arm.ResourceID, error) {
+	nodeSubnetNames, _, err := c.nodeSubnetNames(c.InfraID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error determining the subnets of the cluster nodes")
+	}
+
+	subnets := []gatewaySubnet{}
+	for _, name := range nodeSubnetNames {
+		subnets = append(subnets, gatewaySubnet{vnetName: c.vnetName(c.InfraID), name: name})
+	}
+
+	if c.K8sClient != nil {
+		gwSubnets, err := c.discoverGatewaySubnets(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		subnets = append(subnets, gwSubnets...)
+	}
+
+	seen := set.New[string]()
+	natIDs := []*arm.ResourceID{}
+
+	for _, subnet := range subnets {
+		resp, err := c.getSubnet(ctx, subnet.vnetName, subnet.name, subnetClient)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting the subnet %q", subnet.name)
+		}
+
+		if resp.Properties == nil || resp.Properties.NatGateway == nil || resp.Properties.NatGateway.ID == nil {
+			continue
+		}
+
+		natID, err := arm.ParseResourceID(*resp.Properties.NatGateway.ID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing the NAT gateway ID of subnet %q", subnet.name)
+		}
+
+		if !seen.Has(strings.ToLower(natID.String())) {
+			seen.Insert(strings.ToLower(natID.String()))
+			natIDs = append(natIDs, natID)
+		}
+	}
+
+	return natIDs, nil
+}
+
+// natGatewayPublicIPs returns the addresses of the public IPs of the given NAT gateway.
+func natGatewayPublicIPs(ctx context.Context, natID *arm.ResourceID, natClient *armnetwork.NatGatewaysClient,
+	pubIPClient *armnetwork.PublicIPAddressesClient,
+) ([]string, error) {
+	natGateway, err := natClient.Get(ctx, natID.ResourceGroupName, natID.Name, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting the NAT gateway %q", natID.Name)
+	}
+
+	if natGateway.Properties == nil {
+		return nil, nil
+	}
+
+	egressIPs := []string{}
+
+	for _, ref := range natGateway.Properties.PublicIPAddresses {
+		pubIPID, err := arm.ParseResourceID(ptr.Deref(ref.ID, ""))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing a public IP ID of NAT gateway %q", natID.Name)
+		}
+
+		pubIP, err := pubIPClient.Get(ctx, pubIPID.ResourceGroupName, pubIPID.Name, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting the public IP %q of NAT gateway %q", pubIPID.Name, natID.Name)
+		}
+
+		if pubIP.Properties != nil && pubIP.Properties.IPAddress != nil {
+			egressIPs = append(egressIPs, *pubIP.Properties.IPAddress)
+		}
+	}
+
+	return egressIPs, nil
+}
@@ -0,0 +1,422 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+	"github.com/submariner-io/cloud-prepare/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/utils/set"
+)
+
+// defaultGateways is the number of gateway nodes dedicated if the deploy input doesn't request a number and there are no
+// gateway nodes yet.
+const defaultGateways = 1
+
+type nodeGatewayDeployer struct {
+	CloudInfo
+}
+
+// NewNodeGatewayDeployer returns a GatewayDeployer which dedicates existing worker nodes as gateways, rather than
+// deploying new nodes: the nodes are labelled as gateways, spread across availability zones, and a public IP and the
+// gateway security group are attached to their interfaces. If the supplied cloud, or the Cloud it wraps, e.g. with
+// api.ObserveCloud, is not an azureCloud, an error is returned.
+func NewNodeGatewayDeployer(info *CloudInfo, cloud api.Cloud) (api.GatewayDeployer, error) {
+	if _, ok := api.UnwrapCloud(cloud).(*azureCloud); !ok {
+		return nil, errors.New("the cloud must be Azure")
+	}
+
+	if info.K8sClient == nil {
+		return nil, errors.New("a K8s client is required to dedicate existing nodes as gateways")
+	}
+
+	if info.DryRun {
+		return nil, errors.New("dry runs aren't supported when deploying gateways")
+	}
+
+	info.initPolicies()
+
+	return &nodeGatewayDeployer{
+		CloudInfo: *info,
+	}, nil
+}
+
+func (d *nodeGatewayDeployer) Deploy(ctx context.Context, input api.GatewayDeployInput, status reporter.Interface) (retErr error) {
+	input.PublicPorts = api.SortPorts(input.PublicPorts)
+
+	status = withRemediationHints(status)
+
+	status.Start("Dedicating existing nodes as gateways")
+	defer status.End()
+
+	ctx = d.cacheReads(ctx)
+
+	if err := k8s.CheckReachable(d.K8sClient); err != nil {
+		return status.Error(err, "Invalid cluster configuration")
+	}
+
+	nsgClient, err := d.getNsgClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network security groups client")
+	}
+
+	nwClient, err := d.getInterfacesClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network interfaces client")
+	}
+
+	pubIPClient, err := d.getPublicIPClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network public IP addresses client")
+	}
+
+	var changes *rollback
+	if d.RollbackOnFailure {
+		changes = &rollback{}
+	}
+
+	defer func() {
+		if retErr != nil {
+			changes.run(status)
+		}
+	}()
+
+	groupName := d.InfraID + externalSecurityGroupSuffix
+
+	gwNodes, labelled, err := d.selectGatewayNodes(input.Gateways, status)
+
+	for i := range labelled {
+		node := &labelled[i]
+		changes.add(fmt.Sprintf("the preparation of gateway node %q", node.Name), func() error {
+			return d.unprepareGatewayNode(ctx, node, groupName, nwClient, pubIPClient)
+		})
+	}
+
+	if err != nil {
+		return status.Error(err, "Failed to select the gateway nodes")
+	}
+
+	if changes != nil {
+		if err := d.recordSecurityGroupCreation(ctx, changes, groupName, nsgClient, nwClient); err != nil {
+			return status.Error(err, "creating gateway security group failed")
+		}
+	}
+
+	if err := d.createGWSecurityGroup(ctx, groupName, input.PublicPorts, nsgClient); err != nil {
+		return status.Error(err, "creating gateway security group failed")
+	}
+
+	gatewayIPs := []string{}
+	progress := api.NewProgress(status, len(gwNodes), nil)
+
+	for i := range gwNodes {
+		publicIP, err := d.prepareGWInterface(ctx, gwNodes[i].Name, groupName, input.AirGapped, nsgClient, nwClient, pubIPClient,
+			status)
+		if err != nil {
+			return status.Error(err, "failed to open the Submariner gateway ports on node %q", gwNodes[i].Name)
+		}
+
+		if publicIP == "" {
+			progress.Success("Prepared gateway node %q", gwNodes[i].Name)
+			continue
+		}
+
+		gatewayIPs = append(gatewayIPs, publicIP)
+		progress.Success("Prepared gateway node %q with public IP %s", gwNodes[i].Name, publicIP)
+	}
+
+	if err := d.associateGatewaySubnets(ctx, groupName, gwNodes, nsgClient, status); err != nil {
+		return status.Error(err, "failed to associate the gateway security group with the gateway subnets")
+	}
+
+	if err := d.recordState(map[string]string{
+		StateExternalSecurityGroupKey: groupName,
+		StatePublicPortsKey:           formatPorts(input.PublicPorts),
+		StateGatewayIPsKey:            strings.Join(gatewayIPs, ","),
+	}); err != nil {
+		return status.Error(err, "failed to record the prepared state")
+	}
+
+	if err := d.postPrepare(PreparedResult{
+		GatewayIPs:    gatewayIPs,
+		PublicPorts:   input.PublicPorts,
+		SecurityGroup: groupName,
+	}, status); err != nil {
+		return err
+	}
+
+	if input.AirGapped {
+		status.Success("Dedicated %d existing nodes as gateways without public IPs", len(gwNodes))
+	} else {
+		status.Success("Dedicated %d existing nodes as gateways with public IPs %s", len(gwNodes), strings.Join(gatewayIPs, ", "))
+	}
+
+	return nil
+}
+
+// selectGatewayNodes labels worker nodes as gateways until there are the requested number of gateway nodes, and returns
+// the gateway nodes along with the nodes it labelled, which are also returned on failure. If no number is requested, the
+// existing gateway nodes are kept, or defaultGateways are labelled if there are none. The nodes are spread across
+// availability zones, see spreadAcrossZones. Decreasing the number of gateways isn't supported, so as not to disrupt the
+// datapath, so existing gateway nodes are kept.
+func (d *nodeGatewayDeployer) selectGatewayNodes(gateways int, status reporter.Interface) ([]corev1.Node, []corev1.Node, error) {
+	gwNodes, err := d.K8sClient.ListGatewayNodes()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error listing the gateway nodes")
+	}
+
+	if gateways == 0 {
+		gateways = max(len(gwNodes.Items), defaultGateways)
+	}
+
+	needed := gateways - len(gwNodes.Items)
+	if needed < 0 {
+		status.Warning("There are %d gateway nodes; decreasing the number of gateway nodes is not currently supported",
+			len(gwNodes.Items))
+	}
+
+	if needed <= 0 {
+		return gwNodes.Items, nil, nil
+	}
+
+	candidates, err := d.candidateGatewayNodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(candidates) < needed {
+		if len(d.GatewayNodeSelector) > 0 {
+			selector := labels.SelectorFromSet(d.GatewayNodeSelector).String()
+			if len(candidates) == 0 {
+				return nil, nil, errors.Errorf("no nodes matching the gateway node selector %q are available to become gateways", selector)
+			}
+
+			return nil, nil, errors.Errorf("%d more gateway nodes are needed but only %d nodes matching the gateway node "+
+				"selector %q are available", needed, len(candidates), selector)
+		}
+
+		return nil, nil, errors.Errorf("%d more gateway nodes are needed but only %d worker nodes are available", needed,
+			len(candidates))
+	}
+
+	zones := nodeZones(gwNodes.Items).Union(nodeZones(candidates))
+	if zones.Len() > 0 && zones.Len() < gateways {
+		status.Warning("There are only %d availability zones for %d gateways; some zones will have more than one gateway",
+			zones.Len(), gateways)
+	}
+
+	labelled := []corev1.Node{}
+
+	for _, name := range spreadAcrossZones(gwNodes.Items, candidates, needed) {
+		// The label may have been applied even if it couldn't be verified.
+		labelled = append(labelled, candidates[slices.IndexFunc(candidates, func(node corev1.Node) bool {
+			return node.Name == name
+		})])
+
+		if err := d.K8sClient.AddGWLabelOnNode(name); err != nil {
+			return nil, labelled, errors.Wrapf(err, "error labelling node %q as a gateway", name)
+		}
+
+		status.Success("Labelled node %q as a gateway", name)
+	}
+
+	gwNodes, err = d.K8sClient.ListGatewayNodes()
+	if err != nil {
+		return nil, labelled, errors.Wrap(err, "error listing the gateway nodes")
+	}
+
+	return gwNodes.Items, labelled, nil
+}
+
+// recordSecurityGroupCreation records the removal of the given gateway security group as a change to roll back, unless it
+// already exists.
+func (d *nodeGatewayDeployer) recordSecurityGroupCreation(ctx context.Context, changes *rollback, groupName string,
+	nsgClient *armnetwork.SecurityGroupsClient, nwClient *armnetwork.InterfacesClient,
+) error {
+	getCtx, cancel := d.opContext(ctx)
+	defer cancel()
+
+	_, err := nsgClient.Get(getCtx, d.BaseGroupName, groupName, nil)
+	if err == nil {
+		return nil
+	}
+
+	if !isNotFound(err) {
+		return errors.Wrapf(err, "error getting the submariner gateway security group %q", groupName)
+	}
+
+	changes.add(fmt.Sprintf("the creation of gateway security group %q", groupName), func() error {
+		return d.cleanupGWInterface(ctx, d.InfraID, nsgClient, nwClient)
+	})
+
+	return nil
+}
+
+// unprepareGatewayNode undoes the preparation of a node labelled as a gateway by a failed deployment: its interface is
+// detached from the gateway security group and public IP, the latter is deleted, and the gateway label is removed.
+func (d *nodeGatewayDeployer) unprepareGatewayNode(ctx context.Context, node *corev1.Node, groupName string,
+	nwClient *armnetwork.InterfacesClient, pubIPClient *armnetwork.PublicIPAddressesClient,
+) error {
+	if err := d.detachGWInterface(ctx, node.Name, groupName, nwClient); err != nil {
+		return err
+	}
+
+	if err := d.deleteGatewayPublicIP(ctx, pubIPClient, node.Name+publicIPNameSuffix); err != nil {
+		return err
+	}
+
+	return errors.Wrapf(d.K8sClient.RemoveGWLabelFromWorkerNode(node), "error removing the gateway label from node %q", node.Name)
+}
+
+// candidateGatewayNodes returns the nodes matching the gateway node selector, or the worker nodes if there's none, which
+// aren't gateway nodes, sorted by name.
+func (d *nodeGatewayDeployer) candidateGatewayNodes() ([]corev1.Node, error) {
+	candidates := map[string]corev1.Node{}
+
+	selectors := labelsOrDefault(d.WorkerRoleLabels, defaultWorkerRoleLabels)
+	if len(d.GatewayNodeSelector) > 0 {
+		selectors = []string{labels.SelectorFromSet(d.GatewayNodeSelector).String()}
+	}
+
+	for _, label := range selectors {
+		nodes, err := d.K8sClient.ListNodesWithLabel(label)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error listing the nodes with label %q", label)
+		}
+
+		for i := range nodes.Items {
+			if nodes.Items[i].Labels[k8s.SubmarinerGatewayLabel] != "true" {
+				candidates[nodes.Items[i].Name] = nodes.Items[i]
+			}
+		}
+	}
+
+	sorted := make([]corev1.Node, 0, len(candidates))
+	for name := range candidates {
+		sorted = append(sorted, candidates[name])
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	return sorted, nil
+}
+
+// spreadAcrossZones returns the names of the needed number of candidate nodes to turn into gateways, picking each time
+// a node in the zone with the fewest gateways so far (ties go to the lowest zone, then the lowest node name). Gateways
+// are thus spread over as many zones as possible, and once every zone has one, the remaining gateways are packed into
+// the existing zones in the same way. Nodes without a zone label are treated as sharing a single zone.
+func spreadAcrossZones(gwNodes, candidates []corev1.Node, needed int) []string {
+	gatewaysPerZone := map[string]int{}
+	for i := range gwNodes {
+		gatewaysPerZone[nodeZone(&gwNodes[i])]++
+	}
+
+	remaining := make([]corev1.Node, len(candidates))
+	copy(remaining, candidates)
+
+	selected := make([]string, 0, needed)
+
+	for len(selected) < needed && len(remaining) > 0 {
+		best := 0
+
+		for i := 1; i < len(remaining); i++ {
+			zone, bestZone := nodeZone(&remaining[i]), nodeZone(&remaining[best])
+			if gatewaysPerZone[zone] < gatewaysPerZone[bestZone] ||
+				(gatewaysPerZone[zone] == gatewaysPerZone[bestZone] && zone < bestZone) {
+				best = i
+			}
+		}
+
+		gatewaysPerZone[nodeZone(&remaining[best])]++
+		selected = append(selected, remaining[best].Name)
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+
+	return selected
+}
+
+func nodeZone(node *corev1.Node) string {
+	return node.Labels[corev1.LabelTopologyZone]
+}
+
+// nodeZones returns the availability zones of the given nodes, ignoring nodes without a zone label.
+func nodeZones(nodes []corev1.Node) set.Set[string] {
+	zones := set.New[string]()
+
+	for i := range nodes {
+		if zone := nodeZone(&nodes[i]); zone != "" {
+			zones.Insert(zone)
+		}
+	}
+
+	return zones
+}
+
+func (d *nodeGatewayDeployer) Cleanup(ctx context.Context, status reporter.Interface) error {
+	status = withRemediationHints(status)
+
+	status.Start("Removing the gateway configuration from the dedicated nodes")
+	defer status.End()
+
+	nsgClient, err := d.getNsgClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network security groups client")
+	}
+
+	nwClient, err := d.getInterfacesClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network interfaces client")
+	}
+
+	pubIPClient, err := d.getPublicIPClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network public IP addresses client")
+	}
+
+	var errs []error
+
+	// Carry on with the nodes if the security group can't be removed, so that one stuck resource doesn't prevent the
+	// others from being cleaned up.
+	if err := d.cleanupGWInterface(ctx, d.InfraID, nsgClient, nwClient); err != nil {
+		errs = append(errs, status.Error(err, "deleting gateway security group failed"))
+	}
+
+	errs = append(errs, d.removeGatewayLabels(ctx, nwClient, pubIPClient, status)...)
+
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	status.Success("Removed the gateway configuration from the dedicated nodes")
+
+	return nil
+}
@@ -0,0 +1,423 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+	"github.com/submariner-io/cloud-prepare/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Node Gateway Deployer", func() {
+	const workerLabel = "node-role.kubernetes.io/worker"
+
+	var (
+		fake       *fakeARM
+		kubeClient *kubeFake.Clientset
+		info       *CloudInfo
+		gateways   int
+		airGapped  bool
+		tracker    *reporter.Tracker
+		metrics    api.Metrics
+		err        error
+	)
+
+	setZone := func(name, zone string) {
+		node, err := kubeClient.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).To(Succeed())
+
+		node.Labels[corev1.LabelTopologyZone] = zone
+		_, err = kubeClient.CoreV1().Nodes().Update(context.TODO(), node, metav1.UpdateOptions{})
+		Expect(err).To(Succeed())
+	}
+
+	gatewayNodeNames := func() []string {
+		nodes, err := kubeClient.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{
+			LabelSelector: k8s.SubmarinerGatewayLabel + "=true",
+		})
+		Expect(err).To(Succeed())
+
+		names := []string{}
+		for i := range nodes.Items {
+			names = append(names, nodes.Items[i].Name)
+		}
+
+		return names
+	}
+
+	newDeployer := func() api.GatewayDeployer {
+		deployer, err := NewNodeGatewayDeployer(info, api.ObserveCloud(NewCloud(info), metricsBackend, metrics))
+		Expect(err).To(Succeed())
+
+		return deployer
+	}
+
+	BeforeEach(func() {
+		fake = newFakeARM()
+		info = newTestCloudInfo(fake)
+		gateways = 2
+		airGapped = false
+		tracker = reporter.NewTracker(reporter.Stdout())
+		metrics = nil
+
+		kubeClient = kubeFake.NewClientset(newNode("worker-2", workerLabel), newNode("worker-1", workerLabel),
+			newNode("worker-3", workerLabel), newNode("master-1", "node-role.kubernetes.io/master"))
+		info.K8sClient = k8s.NewInterface(kubeClient)
+
+		for _, name := range []string{"worker-1", "worker-2", "worker-3"} {
+			fake.put(nicPath(name+"-nic"), &armnetwork.Interface{
+				Properties: &armnetwork.InterfacePropertiesFormat{
+					EnableIPForwarding: ptr.To(true),
+					IPConfigurations: []*armnetwork.InterfaceIPConfiguration{{
+						Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{Primary: ptr.To(true)},
+					}},
+				},
+			})
+		}
+	})
+
+	JustBeforeEach(func() {
+		err = newDeployer().Deploy(context.TODO(), api.GatewayDeployInput{
+			Gateways:    gateways,
+			PublicPorts: []api.PortSpec{{Port: 4500, Protocol: "udp"}},
+			AirGapped:   airGapped,
+		}, tracker)
+	})
+
+	It("should label the requested number of worker nodes as gateways", func() {
+		Expect(err).To(Succeed())
+		Expect(gatewayNodeNames()).To(ConsistOf("worker-1", "worker-2"))
+	})
+
+	It("should attach the gateway security group and a public IP to the gateway nodes", func() {
+		Expect(err).To(Succeed())
+
+		nwSecurityGroup := &armnetwork.SecurityGroup{}
+		Expect(fake.get(nsgPath(info.InfraID+externalSecurityGroupSuffix), nwSecurityGroup)).To(BeTrue())
+		Expect(nwSecurityGroup.Tags).To(HaveKeyWithValue(ManagedTag, ptr.To("true")))
+
+		for _, name := range []string{"worker-1", "worker-2"} {
+			nwInterface := &armnetwork.Interface{}
+			Expect(fake.get(nicPath(name+"-nic"), nwInterface)).To(BeTrue())
+			Expect(nwInterface.Properties.NetworkSecurityGroup).ToNot(BeNil())
+			Expect(nwInterface.Properties.IPConfigurations[0].Properties.PublicIPAddress).ToNot(BeNil())
+			Expect(fake.get(publicIPPath(name+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeTrue())
+		}
+
+		Expect(fake.get(publicIPPath("worker-3"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+	})
+
+	When("no number of gateways is requested", func() {
+		BeforeEach(func() {
+			gateways = 0
+		})
+
+		It("should label the default number of worker nodes as gateways", func() {
+			Expect(err).To(Succeed())
+			Expect(gatewayNodeNames()).To(ConsistOf("worker-1"))
+		})
+
+		Context("and there are gateway nodes already", func() {
+			BeforeEach(func() {
+				Expect(info.K8sClient.AddGWLabelOnNode("worker-2")).To(Succeed())
+				Expect(info.K8sClient.AddGWLabelOnNode("worker-3")).To(Succeed())
+			})
+
+			It("should keep them without warning", func() {
+				Expect(err).To(Succeed())
+				Expect(gatewayNodeNames()).To(ConsistOf("worker-2", "worker-3"))
+				Expect(tracker.HasWarnings()).To(BeFalse())
+				Expect(fake.get(publicIPPath("worker-2"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeTrue())
+			})
+		})
+	})
+
+	When("air-gapped", func() {
+		var results []PreparedResult
+
+		BeforeEach(func() {
+			airGapped = true
+			results = nil
+
+			info.PostPrepare = func(r PreparedResult) error {
+				results = append(results, r)
+				return nil
+			}
+		})
+
+		It("should attach the gateway security group without a public IP to the gateway nodes", func() {
+			Expect(err).To(Succeed())
+			Expect(gatewayNodeNames()).To(ConsistOf("worker-1", "worker-2"))
+
+			for _, name := range []string{"worker-1", "worker-2"} {
+				nwInterface := &armnetwork.Interface{}
+				Expect(fake.get(nicPath(name+"-nic"), nwInterface)).To(BeTrue())
+				Expect(nwInterface.Properties.NetworkSecurityGroup).ToNot(BeNil())
+				Expect(nwInterface.Properties.IPConfigurations[0].Properties.PublicIPAddress).To(BeNil())
+				Expect(fake.get(publicIPPath(name+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+			}
+
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].GatewayIPs).To(BeEmpty())
+		})
+	})
+
+	When("a state ConfigMap is configured", func() {
+		BeforeEach(func() {
+			info.StateConfigMapName = "cloud-prepare-state"
+			info.StateConfigMapNamespace = "test-ns"
+		})
+
+		It("should record the public IPs of the gateway nodes", func() {
+			Expect(err).To(Succeed())
+
+			cm, err := kubeClient.CoreV1().ConfigMaps("test-ns").Get(context.TODO(), "cloud-prepare-state", metav1.GetOptions{})
+			Expect(err).To(Succeed())
+			Expect(cm.Data).To(HaveKeyWithValue(StateGatewayIPsKey, "20.0.0.1,20.0.0.2"))
+			Expect(cm.Data).To(HaveKeyWithValue(StateExternalSecurityGroupKey, info.InfraID+externalSecurityGroupSuffix))
+		})
+	})
+
+	When("a post-prepare hook is configured", func() {
+		var results []PreparedResult
+
+		BeforeEach(func() {
+			results = nil
+
+			info.PostPrepare = func(r PreparedResult) error {
+				results = append(results, r)
+				return nil
+			}
+		})
+
+		It("should call it once with the public IPs of all the gateway nodes", func() {
+			Expect(err).To(Succeed())
+			Expect(results).To(Equal([]PreparedResult{{
+				GatewayIPs:    []string{"20.0.0.1", "20.0.0.2"},
+				PublicPorts:   []api.PortSpec{{Port: 4500, Protocol: "udp"}},
+				SecurityGroup: info.InfraID + externalSecurityGroupSuffix,
+			}}))
+		})
+
+		Context("and preparing a gateway node fails", func() {
+			BeforeEach(func() {
+				fake.failNext("PUT", nicPath("worker-2-nic"), 500)
+			})
+
+			It("should not call it", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(results).To(BeEmpty())
+			})
+		})
+	})
+
+	When("the cloud is observed", func() {
+		BeforeEach(func() {
+			metrics = &fakeMetrics{}
+		})
+
+		It("should accept it and deploy the gateways", func() {
+			Expect(err).To(Succeed())
+			Expect(gatewayNodeNames()).To(ConsistOf("worker-1", "worker-2"))
+		})
+	})
+
+	When("a node is already a gateway", func() {
+		BeforeEach(func() {
+			Expect(info.K8sClient.AddGWLabelOnNode("worker-3")).To(Succeed())
+		})
+
+		It("should only label the remaining number of nodes", func() {
+			Expect(err).To(Succeed())
+			Expect(gatewayNodeNames()).To(ConsistOf("worker-1", "worker-3"))
+		})
+	})
+
+	When("the worker nodes are in different availability zones", func() {
+		BeforeEach(func() {
+			setZone("worker-1", "eastus-1")
+			setZone("worker-2", "eastus-1")
+			setZone("worker-3", "eastus-2")
+		})
+
+		It("should spread the gateways across the zones", func() {
+			Expect(err).To(Succeed())
+			Expect(gatewayNodeNames()).To(ConsistOf("worker-1", "worker-3"))
+			Expect(tracker.HasWarnings()).To(BeFalse())
+		})
+
+		Context("and a gateway already covers a zone", func() {
+			BeforeEach(func() {
+				Expect(info.K8sClient.AddGWLabelOnNode("worker-1")).To(Succeed())
+			})
+
+			It("should select a node in another zone", func() {
+				Expect(err).To(Succeed())
+				Expect(gatewayNodeNames()).To(ConsistOf("worker-1", "worker-3"))
+			})
+		})
+
+		Context("and there are fewer zones than gateways", func() {
+			BeforeEach(func() {
+				gateways = 3
+			})
+
+			It("should warn and pack the remaining gateways into the existing zones", func() {
+				Expect(err).To(Succeed())
+				Expect(gatewayNodeNames()).To(ConsistOf("worker-1", "worker-2", "worker-3"))
+				Expect(tracker.HasWarnings()).To(BeTrue())
+			})
+		})
+	})
+
+	When("there aren't enough worker nodes", func() {
+		BeforeEach(func() {
+			gateways = 4
+		})
+
+		It("should return an error without labelling any node", func() {
+			Expect(err).To(MatchError(ContainSubstring("only 3 worker nodes are available")))
+			Expect(gatewayNodeNames()).To(BeEmpty())
+		})
+	})
+
+	When("a gateway node selector is specified", func() {
+		BeforeEach(func() {
+			setZone("worker-1", "eastus-1")
+			setZone("worker-2", "eastus-2")
+			setZone("worker-3", "eastus-2")
+
+			info.GatewayNodeSelector = map[string]string{corev1.LabelTopologyZone: "eastus-2"}
+		})
+
+		It("should only label the matching nodes", func() {
+			Expect(err).To(Succeed())
+			Expect(gatewayNodeNames()).To(ConsistOf("worker-2", "worker-3"))
+		})
+
+		Context("and fewer nodes match than the requested number of gateways", func() {
+			BeforeEach(func() {
+				gateways = 3
+			})
+
+			It("should return an error without labelling any node", func() {
+				Expect(err).To(MatchError(ContainSubstring("only 2 nodes matching the gateway node selector")))
+				Expect(gatewayNodeNames()).To(BeEmpty())
+			})
+		})
+
+		Context("and no nodes match", func() {
+			BeforeEach(func() {
+				info.GatewayNodeSelector = map[string]string{corev1.LabelTopologyZone: "westus-1"}
+			})
+
+			It("should return an error without labelling any node", func() {
+				Expect(err).To(MatchError(ContainSubstring("no nodes matching the gateway node selector")))
+				Expect(gatewayNodeNames()).To(BeEmpty())
+			})
+		})
+	})
+
+	When("preparing a gateway node fails", func() {
+		BeforeEach(func() {
+			fake.failNext("PUT", nicPath("worker-2-nic"), 500)
+		})
+
+		It("should leave the changes made before the failure in place", func() {
+			Expect(err).To(HaveOccurred())
+			Expect(gatewayNodeNames()).To(ConsistOf("worker-1", "worker-2"))
+			Expect(fake.get(nsgPath(info.InfraID+externalSecurityGroupSuffix), &armnetwork.SecurityGroup{})).To(BeTrue())
+			Expect(fake.get(publicIPPath("worker-1"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeTrue())
+		})
+
+		Context("and rolling back on failure is enabled", func() {
+			BeforeEach(func() {
+				info.RollbackOnFailure = true
+			})
+
+			It("should undo the changes made before the failure and return the original error", func() {
+				Expect(err).To(MatchError(ContainSubstring("worker-2")))
+				Expect(tracker.HasWarnings()).To(BeFalse())
+
+				Expect(gatewayNodeNames()).To(BeEmpty())
+				Expect(fake.get(nsgPath(info.InfraID+externalSecurityGroupSuffix), &armnetwork.SecurityGroup{})).To(BeFalse())
+
+				for _, name := range []string{"worker-1", "worker-2"} {
+					Expect(fake.get(publicIPPath(name+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+
+					nwInterface := &armnetwork.Interface{}
+					Expect(fake.get(nicPath(name+"-nic"), nwInterface)).To(BeTrue())
+					Expect(nwInterface.Properties.NetworkSecurityGroup).To(BeNil())
+					Expect(nwInterface.Properties.IPConfigurations[0].Properties.PublicIPAddress).To(BeNil())
+				}
+			})
+
+			Context("and a gateway was deployed before", func() {
+				BeforeEach(func() {
+					Expect(newDeployer().Deploy(context.TODO(), api.GatewayDeployInput{
+						Gateways:    1,
+						PublicPorts: []api.PortSpec{{Port: 4500, Protocol: "udp"}},
+					}, reporter.Stdout())).To(Succeed())
+				})
+
+				It("should only undo the changes made by the failed deployment", func() {
+					Expect(err).To(HaveOccurred())
+
+					Expect(gatewayNodeNames()).To(ConsistOf("worker-1"))
+					Expect(fake.get(nsgPath(info.InfraID+externalSecurityGroupSuffix), &armnetwork.SecurityGroup{})).To(BeTrue())
+					Expect(fake.get(publicIPPath("worker-1"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeTrue())
+					Expect(fake.get(publicIPPath("worker-2"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+
+					nwInterface := &armnetwork.Interface{}
+					Expect(fake.get(nicPath("worker-1-nic"), nwInterface)).To(BeTrue())
+					Expect(nwInterface.Properties.NetworkSecurityGroup).ToNot(BeNil())
+				})
+			})
+		})
+	})
+
+	Describe("Cleanup", func() {
+		JustBeforeEach(func() {
+			Expect(err).To(Succeed())
+			Expect(newDeployer().Cleanup(context.TODO(), reporter.Stdout())).To(Succeed())
+		})
+
+		It("should remove the gateway configuration from the nodes", func() {
+			Expect(gatewayNodeNames()).To(BeEmpty())
+			Expect(fake.get(nsgPath(info.InfraID+externalSecurityGroupSuffix), &armnetwork.SecurityGroup{})).To(BeFalse())
+
+			for _, name := range []string{"worker-1", "worker-2"} {
+				Expect(fake.get(publicIPPath(name+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+			}
+		})
+
+		It("should succeed when run again", func() {
+			Expect(newDeployer().Cleanup(context.TODO(), reporter.Stdout())).To(Succeed())
+		})
+	})
+})
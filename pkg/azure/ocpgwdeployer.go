@@ -22,17 +22,20 @@ import (
 	"bytes"
 	"context"
 	"strconv"
+	"strings"
 	"text/template"
-	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/pkg/errors"
 	"github.com/submariner-io/admiral/pkg/reporter"
 	"github.com/submariner-io/cloud-prepare/pkg/api"
+	"github.com/submariner-io/cloud-prepare/pkg/k8s"
 	"github.com/submariner-io/cloud-prepare/pkg/ocp"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/utils/ptr"
 	"k8s.io/utils/set"
@@ -52,14 +55,20 @@ type ocpGatewayDeployer struct {
 }
 
 // NewOcpGatewayDeployer returns a GatewayDeployer capable deploying gateways using OCP.
-// If the supplied cloud is not an azureCloud, an error is returned.
+// If the supplied cloud, or the Cloud it wraps, e.g. with api.ObserveCloud, is not an azureCloud, an error is returned.
 func NewOcpGatewayDeployer(info *CloudInfo, cloud api.Cloud, msDeployer ocp.MachineSetDeployer, instanceType string,
 ) (api.GatewayDeployer, error) {
-	azure, ok := cloud.(*azureCloud)
+	azure, ok := api.UnwrapCloud(cloud).(*azureCloud)
 	if !ok {
 		return nil, errors.New("the cloud must be Azure")
 	}
 
+	if info.DryRun {
+		return nil, errors.New("dry runs aren't supported when deploying gateways")
+	}
+
+	info.initPolicies()
+
 	return &ocpGatewayDeployer{
 		CloudInfo:    *info,
 		azure:        azure,
@@ -68,13 +77,27 @@ func NewOcpGatewayDeployer(info *CloudInfo, cloud api.Cloud, msDeployer ocp.Mach
 	}, nil
 }
 
-func (d *ocpGatewayDeployer) Deploy(input api.GatewayDeployInput, status reporter.Interface) error {
+func (d *ocpGatewayDeployer) Deploy(ctx context.Context, input api.GatewayDeployInput, status reporter.Interface) error {
+	input.PublicPorts = api.SortPorts(input.PublicPorts)
+
 	if input.Gateways == 0 {
 		return nil
 	}
 
+	status = withRemediationHints(status)
+
 	status.Start("Deploying gateway node")
 
+	ctx = d.cacheReads(ctx)
+
+	if err := k8s.CheckReachable(d.azure.K8sClient); err != nil {
+		return status.Error(err, "Invalid cluster configuration")
+	}
+
+	if err := d.validateRegion(ctx, status); err != nil {
+		return status.Error(err, "Invalid Azure region")
+	}
+
 	nsgClient, nwClient, pubIPClient, err := d.getClients(status)
 	if err != nil {
 		return err
@@ -97,18 +120,72 @@ func (d *ocpGatewayDeployer) Deploy(input api.GatewayDeployInput, status reporte
 	gatewayNodesToDeploy := input.Gateways - len(machineSets) - len(taggedExistingNodes)
 
 	if len(machineSets) != 0 || gatewayNodesToDeploy != 0 {
-		if err := d.createGWSecurityGroup(groupName, input.PublicPorts, nsgClient); err != nil {
+		if err := d.createGWSecurityGroup(ctx, groupName, input.PublicPorts, nsgClient); err != nil {
 			return status.Error(err, "creating gateway security group failed")
 		}
 	}
 
+	gatewayIPs := []string{}
+
 	// Open the g/w ports and assign public-ip if not already done for manually tagged nodes if any
 	for i := range gwNodeItems {
-		if err = d.prepareGWInterface(gwNodeItems[i].GetName(), groupName, nsgClient, nwClient, pubIPClient); err != nil {
+		d.checkInstanceType(&gwNodeItems[i], status)
+
+		publicIP, err := d.prepareGWInterface(ctx, gwNodeItems[i].GetName(), groupName, input.AirGapped, nsgClient, nwClient,
+			pubIPClient, status)
+		if err != nil {
 			return status.Error(err, "failed to open the Submariner gateway port for already existing nodes")
 		}
+
+		if publicIP != "" {
+			gatewayIPs = append(gatewayIPs, publicIP)
+		}
+	}
+
+	if len(gwNodeItems) > 0 {
+		if err := d.associateGatewaySubnets(ctx, groupName, gwNodeItems, nsgClient, status); err != nil {
+			return status.Error(err, "failed to associate the gateway security group with the gateway subnets")
+		}
+	}
+
+	var egressIPs []string
+
+	if input.AirGapped {
+		egressIPs, err = d.NATGatewayEgressIPs(ctx)
+		if err != nil {
+			return status.Error(err, "error determining the gateway egress IPs")
+		}
+
+		if len(egressIPs) == 0 {
+			status.Warning("The gateway nodes have no public IP and their subnet has no NAT gateway; outbound tunnel traffic may fail")
+		}
+	}
+
+	if err := d.recordState(map[string]string{
+		StateExternalSecurityGroupKey: groupName,
+		StatePublicPortsKey:           formatPorts(input.PublicPorts),
+		StateGatewayIPsKey:            strings.Join(gatewayIPs, ","),
+		StateEgressIPsKey:             strings.Join(egressIPs, ","),
+	}); err != nil {
+		return status.Error(err, "failed to record the prepared state")
+	}
+
+	if err := d.deployGatewayNodes(ctx, machineSets, gatewayNodesToDeploy, input.AirGapped, status); err != nil {
+		return err
 	}
 
+	return d.postPrepare(PreparedResult{
+		GatewayIPs:    gatewayIPs,
+		EgressIPs:     egressIPs,
+		PublicPorts:   input.PublicPorts,
+		SecurityGroup: groupName,
+	}, status)
+}
+
+// deployGatewayNodes deploys the given number of additional gateway nodes, if any.
+func (d *ocpGatewayDeployer) deployGatewayNodes(ctx context.Context, machineSets []unstructured.Unstructured,
+	gatewayNodesToDeploy int, airGapped bool, status reporter.Interface,
+) error {
 	if gatewayNodesToDeploy == 0 {
 		status.Success("Current gateways match the required number of gateways")
 		return nil
@@ -122,23 +199,30 @@ func (d *ocpGatewayDeployer) Deploy(input api.GatewayDeployInput, status reporte
 		return nil
 	}
 
-	image, imageErr := d.msDeployer.GetWorkerNodeImage(nil, d.InfraID)
-	if imageErr != nil {
-		return errors.Wrap(imageErr, "error retrieving worker node image")
+	image, err := d.msDeployer.GetWorkerNodeImage(nil, d.InfraID)
+	if err != nil {
+		return errors.Wrap(err, "error retrieving worker node image")
 	}
 
-	err = d.deployDedicatedGWNode(machineSets, gatewayNodesToDeploy, input.AirGapped, image, status)
-	if err != nil {
-		status.Success("Deployed gateway node")
+	return d.deployDedicatedGWNode(ctx, machineSets, gatewayNodesToDeploy, airGapped, image, status)
+}
+
+// checkInstanceType warns if the given existing gateway node doesn't have the requested instance type, since it can't be
+// changed by the deployer.
+func (d *ocpGatewayDeployer) checkInstanceType(node *corev1.Node, status reporter.Interface) {
+	if d.instanceType == "" {
+		return
 	}
 
-	return err
+	if instanceType := node.Labels[corev1.LabelInstanceTypeStable]; !strings.EqualFold(instanceType, d.instanceType) {
+		status.Warning("Gateway node %q has instance type %q instead of the requested %q", node.Name, instanceType, d.instanceType)
+	}
 }
 
-func (d *ocpGatewayDeployer) deployDedicatedGWNode(gwNodes []unstructured.Unstructured, gatewayNodesToDeploy int,
+func (d *ocpGatewayDeployer) deployDedicatedGWNode(ctx context.Context, gwNodes []unstructured.Unstructured, gatewayNodesToDeploy int,
 	airGapped bool, image string, status reporter.Interface,
 ) error {
-	az, err := d.getAvailabilityZones(gwNodes)
+	az, err := d.getAvailabilityZones(ctx, gwNodes)
 	if err != nil || az.Len() == 0 {
 		return status.Error(err, "error getting the availability zones for region %q", d.Region)
 	}
@@ -173,6 +257,8 @@ type machineSetConfig struct {
 	Region       string
 	Image        string
 	PublicIP     string
+	VNet         string
+	Subnet       string
 }
 
 func (d *ocpGatewayDeployer) loadGatewayYAML(name, zone, image string, airGapped bool) ([]byte, error) {
@@ -191,6 +277,8 @@ func (d *ocpGatewayDeployer) loadGatewayYAML(name, zone, image string, airGapped
 		AZ:           zone,
 		Image:        image,
 		PublicIP:     strconv.FormatBool(!airGapped),
+		VNet:         d.azure.vnetName(d.azure.InfraID),
+		Subnet:       d.azure.workerSubnetName(d.azure.InfraID),
 	}
 
 	err = tpl.Execute(&buf, tplVars)
@@ -242,7 +330,7 @@ func MachineName(region string) string {
 	return submarinerGatewayGW + region + "-" + string(uuid.NewUUID())[0:6]
 }
 
-func (d *ocpGatewayDeployer) getAvailabilityZones(gwNodes []unstructured.Unstructured) (set.Set[string], error) {
+func (d *ocpGatewayDeployer) getAvailabilityZones(ctx context.Context, gwNodes []unstructured.Unstructured) (set.Set[string], error) {
 	zonesWithSubmarinerGW := set.New[string]()
 
 	for i := range gwNodes {
@@ -254,7 +342,7 @@ func (d *ocpGatewayDeployer) getAvailabilityZones(gwNodes []unstructured.Unstruc
 		zonesWithSubmarinerGW.Insert(zone)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
+	ctx, cancel := d.opContext(ctx)
 	defer cancel()
 
 	resourceSKUClient, err := d.getResourceSKUClient()
@@ -288,7 +376,9 @@ func (d *ocpGatewayDeployer) getAvailabilityZones(gwNodes []unstructured.Unstruc
 	return eligibleZonesForSubmarinerGW, nil
 }
 
-func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
+func (d *ocpGatewayDeployer) Cleanup(ctx context.Context, status reporter.Interface) error {
+	status = withRemediationHints(status)
+
 	status.Start("Removing gateway node")
 
 	nsgClient, err := d.getNsgClient()
@@ -301,13 +391,20 @@ func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
 		return status.Error(err, "Failed to get network interfaces client")
 	}
 
-	if err := d.cleanupGWInterface(d.InfraID, nsgClient, nwClient); err != nil {
-		return status.Error(err, "deleting gateway security group failed")
+	var errs []error
+
+	// Carry on removing the gateways if the security group can't be removed, so that one stuck resource doesn't
+	// prevent the others from being cleaned up.
+	if err := d.cleanupGWInterface(ctx, d.InfraID, nsgClient, nwClient); err != nil {
+		errs = append(errs, status.Error(err, "deleting gateway security group failed"))
 	}
 
-	err = d.deleteGateway(status)
-	if err != nil {
-		return err
+	if err := d.deleteGateway(ctx, status); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
 	}
 
 	status.Success("Removed gateway node")
@@ -315,7 +412,7 @@ func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
 	return nil
 }
 
-func (d *ocpGatewayDeployer) deleteGateway(status reporter.Interface) error {
+func (d *ocpGatewayDeployer) deleteGateway(ctx context.Context, status reporter.Interface) error {
 	machineSetList, err := d.msDeployer.List()
 	if err != nil {
 		return status.Error(err, "error listing the Submariner gateway nodes")
@@ -326,32 +423,39 @@ func (d *ocpGatewayDeployer) deleteGateway(status reporter.Interface) error {
 		return errors.Wrapf(err, "Failed to get network public IP addresses client")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
-	defer cancel()
+	var errs []error
+
+	progress := api.NewProgress(status, len(machineSetList), nil)
 
 	for i := range machineSetList {
 		status.Start("Deleting the gateway instance %q", machineSetList[i].GetName())
 
 		err = d.msDeployer.DeleteByName(machineSetList[i].GetName(), machineSetList[i].GetNamespace())
 		if err != nil {
-			return status.Error(err, "error deleting the gateway instance from node: %q",
-				machineSetList[i].GetName())
+			progress.Done()
+			errs = append(errs, status.Error(err, "error deleting the gateway instance from node: %q",
+				machineSetList[i].GetName()))
+
+			continue
 		}
 
 		publicIPName := machineSetList[i].GetName() + publicIPNameSuffix
 
-		err = d.deletePublicIP(ctx, pubIPClient, publicIPName)
+		err = d.deleteGatewayPublicIP(ctx, pubIPClient, publicIPName)
 		if err != nil {
-			return status.Error(err, "failed to delete public-ip %q", publicIPName)
+			progress.Done()
+			errs = append(errs, status.Error(err, "failed to delete public-ip %q", publicIPName))
+
+			continue
 		}
 
-		status.Success("Successfully deleted the instance")
+		progress.Success("Successfully deleted the instance")
 	}
 
 	// Cleanup nodes that are not dedicated gateway nodes.
 	gwNodesList, err := d.K8sClient.ListGatewayNodes()
 	if err != nil {
-		return status.Error(err, "error listing the Submariner gateway nodes")
+		return utilerrors.NewAggregate(append(errs, status.Error(err, "error listing the Submariner gateway nodes")))
 	}
 
 	gwNodes := ocp.RemoveDuplicates(machineSetList, gwNodesList.Items)
@@ -359,18 +463,30 @@ func (d *ocpGatewayDeployer) deleteGateway(status reporter.Interface) error {
 	for i := range gwNodes {
 		err = d.K8sClient.RemoveGWLabelFromWorkerNode(&gwNodes[i])
 		if err != nil {
-			return status.Error(err, "failed to cleanup node %q", gwNodes[i].Name)
+			errs = append(errs, status.Error(err, "failed to cleanup node %q", gwNodes[i].Name))
+
+			continue
 		}
 
 		publicIPName := gwNodes[i].Name + publicIPNameSuffix
 
-		err = d.deletePublicIP(ctx, pubIPClient, publicIPName)
+		err = d.deleteGatewayPublicIP(ctx, pubIPClient, publicIPName)
 		if err != nil {
-			return status.Error(err, "failed to delete public-ip")
+			errs = append(errs, status.Error(err, "failed to delete public-ip %q", publicIPName))
 		}
 	}
 
-	return nil
+	return utilerrors.NewAggregate(errs)
+}
+
+// deleteGatewayPublicIP deletes the given public IP, giving up once the resource timeout expires.
+func (c *CloudInfo) deleteGatewayPublicIP(ctx context.Context, pubIPClient *armnetwork.PublicIPAddressesClient,
+	publicIPName string,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, c.resourceTimeout())
+	defer cancel()
+
+	return c.deletePublicIP(ctx, pubIPClient, publicIPName)
 }
 
 func (d *ocpGatewayDeployer) getClients(status reporter.Interface) (
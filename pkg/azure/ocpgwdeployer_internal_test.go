@@ -19,12 +19,25 @@ limitations under the License.
 package azure
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/mock"
+	"github.com/submariner-io/admiral/pkg/reporter"
 	"github.com/submariner-io/admiral/pkg/util"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+	"github.com/submariner-io/cloud-prepare/pkg/k8s"
 	ocpFake "github.com/submariner-io/cloud-prepare/pkg/ocp/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
 )
 
 var _ = Describe("OCP Gateway Deployer", func() {
@@ -60,6 +73,13 @@ var _ = Describe("OCP Gateway Deployer", func() {
 		msDeployer.AssertExpectations(GinkgoT())
 	})
 
+	It("should accept an observed cloud", func() {
+		info := &CloudInfo{InfraID: infraID, Region: region}
+
+		_, err := NewOcpGatewayDeployer(info, api.ObserveCloud(NewCloud(info), metricsBackend, &fakeMetrics{}), msDeployer, instanceType)
+		Expect(err).To(Succeed())
+	})
+
 	Describe("deployGateway", func() {
 		JustBeforeEach(func() {
 			msDeployer.EXPECT().Deploy(mock.Anything).RunAndReturn(func(ms *unstructured.Unstructured) error {
@@ -89,4 +109,441 @@ var _ = Describe("OCP Gateway Deployer", func() {
 			Expect(util.GetNestedField(machineSet, "spec", "template", "spec", "providerSpec", "value", "publicIP")).To(BeFalse())
 		})
 	})
+
+	Describe("deleteGateway", func() {
+		const (
+			hungGateway = "subgw-east-hung"
+			gateway     = "subgw-east-ok"
+		)
+
+		var (
+			fake *fakeARM
+			err  error
+		)
+
+		BeforeEach(func() {
+			fake = newFakeARM()
+
+			gwDeployer.CloudInfo = *newTestCloudInfo(fake)
+			gwDeployer.K8sClient = k8s.NewInterface(kubeFake.NewClientset())
+			gwDeployer.ResourceTimeout = 100 * time.Millisecond
+
+			machineSets := []unstructured.Unstructured{}
+
+			for _, name := range []string{hungGateway, gateway} {
+				fake.put(publicIPPath(name+publicIPNameSuffix), &armnetwork.PublicIPAddress{})
+
+				ms := unstructured.Unstructured{}
+				ms.SetName(name)
+				machineSets = append(machineSets, ms)
+
+				msDeployer.EXPECT().DeleteByName(name, "").Return(nil)
+			}
+
+			msDeployer.EXPECT().List().Return(machineSets, nil)
+
+			fake.hang(http.MethodDelete, publicIPPath(hungGateway+publicIPNameSuffix))
+		})
+
+		JustBeforeEach(func() {
+			err = gwDeployer.deleteGateway(context.TODO(), reporter.Stdout())
+		})
+
+		It("should time out the hung deletion and still delete the remaining resources", func() {
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(err.Error()).To(ContainSubstring(hungGateway + publicIPNameSuffix))
+
+			Expect(fake.get(publicIPPath(gateway+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+			Expect(fake.get(publicIPPath(hungGateway+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeTrue())
+		})
+
+		When("a public IP resource group is configured", func() {
+			const publicIPGroup = "test-ip-rg"
+
+			BeforeEach(func() {
+				gwDeployer.PublicIPResourceGroup = publicIPGroup
+
+				for _, name := range []string{hungGateway, gateway} {
+					fake.put(publicIPPathInGroup(publicIPGroup, name+publicIPNameSuffix), &armnetwork.PublicIPAddress{})
+				}
+			})
+
+			It("should delete the public IPs from that group", func() {
+				Expect(err).To(Succeed())
+
+				for _, name := range []string{hungGateway, gateway} {
+					Expect(fake.get(publicIPPathInGroup(publicIPGroup, name+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).
+						To(BeFalse())
+					Expect(fake.get(publicIPPath(name+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeTrue())
+				}
+			})
+		})
+	})
+
+	Describe("Deploy", func() {
+		const nodeName = "existing-gw"
+
+		var (
+			ctx       context.Context
+			fake      *fakeARM
+			tracker   *reporter.Tracker
+			airGapped bool
+			err       error
+		)
+
+		newGatewayNode := func(instanceType string) *corev1.Node {
+			return &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: nodeName,
+					Labels: map[string]string{
+						k8s.SubmarinerGatewayLabel:       "true",
+						corev1.LabelInstanceTypeStable:   instanceType,
+						"node-role.kubernetes.io/worker": "",
+					},
+				},
+			}
+		}
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			fake = newFakeARM()
+			tracker = reporter.NewTracker(reporter.Stdout())
+			airGapped = false
+
+			gwDeployer.CloudInfo = *newTestCloudInfo(fake)
+
+			fake.put(nsgPath(infraID+externalSecurityGroupSuffix), &armnetwork.SecurityGroup{})
+			fake.put(nicPath(nodeName+"-nic"), &armnetwork.Interface{
+				Properties: &armnetwork.InterfacePropertiesFormat{EnableIPForwarding: ptr.To(true)},
+			})
+
+			msDeployer.EXPECT().List().Return(nil, nil).Maybe()
+		})
+
+		JustBeforeEach(func() {
+			err = gwDeployer.Deploy(ctx, api.GatewayDeployInput{
+				Gateways:    1,
+				PublicPorts: []api.PortSpec{{Port: 4500, Protocol: "udp"}},
+				AirGapped:   airGapped,
+			}, tracker)
+		})
+
+		When("the context is cancelled", func() {
+			BeforeEach(func() {
+				gwDeployer.azure.K8sClient = k8s.NewInterface(kubeFake.NewClientset(newGatewayNode(instanceType)))
+
+				cancelled, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				ctx = cancelled
+			})
+
+			It("should fail without creating the gateway public IP", func() {
+				Expect(err).To(MatchError(context.Canceled))
+				Expect(fake.get(publicIPPath(nodeName+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+			})
+		})
+
+		When("an existing gateway node has the requested instance size", func() {
+			BeforeEach(func() {
+				gwDeployer.azure.K8sClient = k8s.NewInterface(kubeFake.NewClientset(newGatewayNode(instanceType)))
+			})
+
+			It("should not warn", func() {
+				Expect(err).To(Succeed())
+				Expect(tracker.HasWarnings()).To(BeFalse())
+			})
+		})
+
+		When("an existing gateway node has a different instance size", func() {
+			BeforeEach(func() {
+				gwDeployer.azure.K8sClient = k8s.NewInterface(kubeFake.NewClientset(newGatewayNode("small")))
+			})
+
+			It("should warn", func() {
+				Expect(err).To(Succeed())
+				Expect(tracker.HasWarnings()).To(BeTrue())
+			})
+		})
+
+		When("the gateway node is in a dedicated subnet", func() {
+			gatewaySubnetPath := subnetPath(infraID+vnetSuffix, infraID+"-gateway-subnet")
+
+			BeforeEach(func() {
+				gwDeployer.azure.K8sClient = k8s.NewInterface(kubeFake.NewClientset(newGatewayNode(instanceType)))
+				gwDeployer.AssociateSubnets = true
+
+				fake.put(gatewaySubnetPath, &armnetwork.Subnet{
+					Properties: &armnetwork.SubnetPropertiesFormat{AddressPrefix: ptr.To("10.2.0.0/24")},
+				})
+				fake.put(nicPath(nodeName+"-nic"), &armnetwork.Interface{
+					Properties: &armnetwork.InterfacePropertiesFormat{
+						IPConfigurations: []*armnetwork.InterfaceIPConfiguration{{
+							Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
+								Primary: ptr.To(true),
+								Subnet:  &armnetwork.Subnet{ID: ptr.To(gatewaySubnetPath)},
+							},
+						}},
+					},
+				})
+			})
+
+			It("should associate the gateway security group with the subnet", func() {
+				Expect(err).To(Succeed())
+
+				subnet := &armnetwork.Subnet{}
+				Expect(fake.get(gatewaySubnetPath, subnet)).To(BeTrue())
+				Expect(subnet.Properties.NetworkSecurityGroup).ToNot(BeNil())
+				Expect(*subnet.Properties.NetworkSecurityGroup.ID).To(Equal(nsgPath(infraID + externalSecurityGroupSuffix)))
+			})
+
+			Context("and subnet association isn't enabled", func() {
+				BeforeEach(func() {
+					gwDeployer.AssociateSubnets = false
+				})
+
+				It("should leave the subnet as it is", func() {
+					Expect(err).To(Succeed())
+
+					subnet := &armnetwork.Subnet{}
+					Expect(fake.get(gatewaySubnetPath, subnet)).To(BeTrue())
+					Expect(subnet.Properties.NetworkSecurityGroup).To(BeNil())
+				})
+			})
+		})
+
+		When("public IP zones are configured", func() {
+			BeforeEach(func() {
+				gwDeployer.azure.K8sClient = k8s.NewInterface(kubeFake.NewClientset(newGatewayNode(instanceType)))
+				gwDeployer.PublicIPZones = []string{"1", "2", "3"}
+				fake.setZonalLocations([]string{"1", "2", "3"}, "east")
+			})
+
+			It("should create the gateway public IP in those zones", func() {
+				Expect(err).To(Succeed())
+
+				publicIP := &armnetwork.PublicIPAddress{}
+				Expect(fake.get(publicIPPath(nodeName+publicIPNameSuffix), publicIP)).To(BeTrue())
+				Expect(publicIP.Zones).To(Equal([]*string{ptr.To("1"), ptr.To("2"), ptr.To("3")}))
+			})
+		})
+
+		When("a public IP resource group is configured", func() {
+			BeforeEach(func() {
+				gwDeployer.azure.K8sClient = k8s.NewInterface(kubeFake.NewClientset(newGatewayNode(instanceType)))
+				gwDeployer.PublicIPResourceGroup = "test-ip-rg"
+			})
+
+			It("should create the gateway public IP in that group", func() {
+				Expect(err).To(Succeed())
+				Expect(fake.get(publicIPPathInGroup("test-ip-rg", nodeName+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).
+					To(BeTrue())
+				Expect(fake.get(publicIPPath(nodeName+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+			})
+		})
+
+		When("public IP zones aren't configured", func() {
+			BeforeEach(func() {
+				gwDeployer.azure.K8sClient = k8s.NewInterface(kubeFake.NewClientset(newGatewayNode(instanceType)))
+			})
+
+			It("should create a regional gateway public IP", func() {
+				Expect(err).To(Succeed())
+
+				publicIP := &armnetwork.PublicIPAddress{}
+				Expect(fake.get(publicIPPath(nodeName+publicIPNameSuffix), publicIP)).To(BeTrue())
+				Expect(publicIP.Zones).To(BeEmpty())
+			})
+		})
+
+		When("a post-prepare hook is configured", func() {
+			var result *PreparedResult
+
+			BeforeEach(func() {
+				result = nil
+
+				gwDeployer.azure.K8sClient = k8s.NewInterface(kubeFake.NewClientset(newGatewayNode(instanceType)))
+				gwDeployer.PostPrepare = func(r PreparedResult) error {
+					result = &r
+					return nil
+				}
+
+				fake.put(publicIPPath(nodeName+publicIPNameSuffix), &armnetwork.PublicIPAddress{
+					Properties: &armnetwork.PublicIPAddressPropertiesFormat{IPAddress: ptr.To("1.2.3.4")},
+				})
+				fake.put(nicPath(nodeName+"-nic"), &armnetwork.Interface{
+					Properties: &armnetwork.InterfacePropertiesFormat{
+						EnableIPForwarding: ptr.To(true),
+						IPConfigurations: []*armnetwork.InterfaceIPConfiguration{{
+							Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{Primary: ptr.To(true)},
+						}},
+					},
+				})
+			})
+
+			It("should call it with the prepared result", func() {
+				Expect(err).To(Succeed())
+				Expect(result).To(Equal(&PreparedResult{
+					GatewayIPs:    []string{"1.2.3.4"},
+					PublicPorts:   []api.PortSpec{{Port: 4500, Protocol: "udp"}},
+					SecurityGroup: infraID + externalSecurityGroupSuffix,
+				}))
+			})
+		})
+
+		When("a gateway node needs to be deployed and a post-prepare hook is configured", func() {
+			var (
+				deployErr error
+				deployed  bool
+				called    bool
+			)
+
+			BeforeEach(func() {
+				deployErr = nil
+				deployed = false
+				called = false
+
+				gwDeployer.azure.K8sClient = k8s.NewInterface(kubeFake.NewClientset())
+				gwDeployer.PostPrepare = func(_ PreparedResult) error {
+					Expect(deployed).To(BeTrue())
+
+					called = true
+
+					return nil
+				}
+
+				fake.put("/subscriptions/"+testSubscriptionID+"/providers/Microsoft.Compute/skus", map[string]any{
+					"value": []map[string]any{{
+						"resourceType": azureVirtualMachines,
+						"name":         instanceType,
+						"locationInfo": []map[string]any{{"zones": []string{"1"}}},
+					}},
+				})
+
+				msDeployer.EXPECT().GetWorkerNodeImage(mock.Anything, mock.Anything).Return(image, nil)
+				msDeployer.EXPECT().Deploy(mock.Anything).RunAndReturn(func(_ *unstructured.Unstructured) error {
+					deployed = deployErr == nil
+					return deployErr
+				})
+			})
+
+			It("should call it once the gateway node is deployed", func() {
+				Expect(err).To(Succeed())
+				Expect(called).To(BeTrue())
+			})
+
+			Context("and the deployment fails", func() {
+				BeforeEach(func() {
+					deployErr = errors.New("fake deploy failure")
+				})
+
+				It("should not call it", func() {
+					Expect(err).To(HaveOccurred())
+					Expect(called).To(BeFalse())
+				})
+			})
+		})
+
+		When("air-gapped", func() {
+			var result *PreparedResult
+
+			BeforeEach(func() {
+				airGapped = true
+				result = nil
+
+				gwDeployer.azure.K8sClient = k8s.NewInterface(kubeFake.NewClientset(newGatewayNode(instanceType)))
+				gwDeployer.K8sClient = gwDeployer.azure.K8sClient
+				gwDeployer.PostPrepare = func(r PreparedResult) error {
+					result = &r
+					return nil
+				}
+
+				fake.put(subnetPath(infraID+vnetSuffix, infraID+workerSubnetSuffix), &armnetwork.Subnet{
+					Properties: &armnetwork.SubnetPropertiesFormat{},
+				})
+			})
+
+			putNATGateway := func(name, address string) string {
+				natPath := resourceGroupPath("Microsoft.Network/natGateways/" + name)
+
+				fake.put(natPath, &armnetwork.NatGateway{
+					Properties: &armnetwork.NatGatewayPropertiesFormat{
+						PublicIPAddresses: []*armnetwork.SubResource{{ID: ptr.To(publicIPPath(name + "-ip"))}},
+					},
+				})
+				fake.put(publicIPPath(name+"-ip"), &armnetwork.PublicIPAddress{
+					Properties: &armnetwork.PublicIPAddressPropertiesFormat{IPAddress: ptr.To(address)},
+				})
+
+				return natPath
+			}
+
+			putSubnetWithNATGateway := func(subnet, natPath string) {
+				fake.put(subnetPath(infraID+vnetSuffix, subnet), &armnetwork.Subnet{
+					Properties: &armnetwork.SubnetPropertiesFormat{
+						NatGateway: &armnetwork.SubResource{ID: ptr.To(natPath)},
+					},
+				})
+			}
+
+			Context("and the gateway subnet egresses through a NAT gateway", func() {
+				BeforeEach(func() {
+					putSubnetWithNATGateway(infraID+workerSubnetSuffix, putNATGateway("test-nat", "5.6.7.8"))
+				})
+
+				It("should report the NAT gateway's public IP as the egress IP", func() {
+					Expect(err).To(Succeed())
+					Expect(tracker.HasWarnings()).To(BeFalse())
+					Expect(result.EgressIPs).To(Equal([]string{"5.6.7.8"}))
+				})
+
+				It("should not create a public IP for the existing gateway node", func() {
+					Expect(err).To(Succeed())
+					Expect(result.GatewayIPs).To(BeEmpty())
+					Expect(fake.get(publicIPPath(nodeName+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+				})
+			})
+
+			Context("and the gateway nodes' subnets egress through several NAT gateways", func() {
+				const gatewaySubnet = infraID + "-gateway-subnet"
+
+				BeforeEach(func() {
+					workerNAT := putNATGateway("worker-nat", "5.6.7.8")
+					gatewayNAT := putNATGateway("gateway-nat", "6.7.8.9")
+
+					gwDeployer.AdditionalWorkerSubnetNames = []string{infraID + "-worker-2-subnet"}
+
+					putSubnetWithNATGateway(infraID+workerSubnetSuffix, workerNAT)
+					putSubnetWithNATGateway(infraID+"-worker-2-subnet", workerNAT)
+					putSubnetWithNATGateway(gatewaySubnet, gatewayNAT)
+
+					fake.put(nicPath(nodeName+"-nic"), &armnetwork.Interface{
+						Properties: &armnetwork.InterfacePropertiesFormat{
+							EnableIPForwarding: ptr.To(true),
+							IPConfigurations: []*armnetwork.InterfaceIPConfiguration{{
+								Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
+									Primary: ptr.To(true),
+									Subnet:  &armnetwork.Subnet{ID: ptr.To(subnetPath(infraID+vnetSuffix, gatewaySubnet))},
+								},
+							}},
+						},
+					})
+				})
+
+				It("should report the public IPs of each NAT gateway once", func() {
+					Expect(err).To(Succeed())
+					Expect(tracker.HasWarnings()).To(BeFalse())
+					Expect(result.EgressIPs).To(Equal([]string{"5.6.7.8", "6.7.8.9"}))
+				})
+			})
+
+			Context("and the gateway subnet has no NAT gateway", func() {
+				It("should warn", func() {
+					Expect(err).To(Succeed())
+					Expect(tracker.HasWarnings()).To(BeTrue())
+					Expect(result.EgressIPs).To(BeEmpty())
+				})
+			})
+		})
+	})
 })
@@ -0,0 +1,247 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"crypto/tls"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+)
+
+const (
+	// TimeoutEnvVar is the environment variable which provides the default resource and operation timeouts, as a
+	// duration such as "2m", if CloudInfo.ResourceTimeout and CloudInfo.OperationTimeout respectively aren't set.
+	TimeoutEnvVar = "CLOUD_PREPARE_TIMEOUT"
+
+	// MaxRetriesEnvVar is the environment variable which provides the default maximum number of retries of failed Azure
+	// requests if CloudInfo.MaxRetries isn't set.
+	MaxRetriesEnvVar = "CLOUD_PREPARE_MAX_RETRIES"
+)
+
+func (c *CloudInfo) resourceTimeout() time.Duration {
+	if c.ResourceTimeout > 0 {
+		return c.ResourceTimeout
+	}
+
+	if timeout, ok := envTimeout(); ok {
+		return timeout
+	}
+
+	return defaultResourceTimeout
+}
+
+func (c *CloudInfo) operationTimeout() time.Duration {
+	if c.OperationTimeout > 0 {
+		return c.OperationTimeout
+	}
+
+	if timeout, ok := envTimeout(); ok {
+		return timeout
+	}
+
+	return defaultOperationTimeout
+}
+
+// envTimeout returns the timeout provided by the environment, if it's set to a valid, positive duration.
+func envTimeout() (time.Duration, bool) {
+	timeout, err := time.ParseDuration(os.Getenv(TimeoutEnvVar))
+
+	return timeout, err == nil && timeout > 0
+}
+
+func (c *CloudInfo) subnetNotFoundTimeout() time.Duration {
+	if c.SubnetNotFoundTimeout != 0 {
+		return c.SubnetNotFoundTimeout
+	}
+
+	return defaultSubnetNotFoundTimeout
+}
+
+// defaultMaxSourceCIDRPorts is the maximum number of source CIDRs multiplied by the number of ports of the internal rules
+// if CloudInfo.MaxSourceCIDRPorts isn't set.
+const defaultMaxSourceCIDRPorts = 4000
+
+func (c *CloudInfo) maxSourceCIDRPorts() int {
+	if c.MaxSourceCIDRPorts != 0 {
+		return c.MaxSourceCIDRPorts
+	}
+
+	return defaultMaxSourceCIDRPorts
+}
+
+// initPolicies creates the pipeline policies shared by the Azure clients created from the CloudInfo, or from copies of it,
+// unless they've already been created for its current configuration.
+func (c *CloudInfo) initPolicies() {
+	if c.pollLimiter == nil || cap(c.pollLimiter.slots) != c.maxConcurrentPolls() {
+		c.pollLimiter = newPollLimiter(c.maxConcurrentPolls())
+	}
+
+	if c.AZCommandWriter == nil {
+		c.commandRenderer = nil
+	} else if c.commandRenderer == nil {
+		c.commandRenderer = newCommandRenderer(c.AZCommandWriter)
+	}
+}
+
+// opContext returns a context, derived from the given parent so that its cancellation propagates, which is bounded by
+// the operation timeout.
+func (c *CloudInfo) opContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, c.operationTimeout())
+}
+
+// defaultMaxRetries is the maximum number of retries of failed Azure requests if neither CloudInfo.MaxRetries nor the
+// environment variable are set. It's higher than the Azure SDK default since busy subscriptions are regularly throttled.
+const defaultMaxRetries int32 = 5
+
+// maxRetries returns the configured maximum number of retries of failed Azure requests, if any, as expected by the
+// Azure SDK, where zero selects its own default and a negative value disables retries.
+func (c *CloudInfo) maxRetries() (int32, bool) {
+	if c.MaxRetries != 0 {
+		return c.MaxRetries, true
+	}
+
+	maxRetries, err := strconv.ParseInt(os.Getenv(MaxRetriesEnvVar), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	if maxRetries <= 0 {
+		return -1, true
+	}
+
+	return int32(maxRetries), true
+}
+
+// defaultNetworkAPIVersion is the version of the network API used by the armnetwork module, unless overridden by
+// CloudInfo.NetworkAPIVersion.
+const defaultNetworkAPIVersion = "2022-01-01"
+
+// espAHMinNetworkAPIVersion is the earliest network API version known to accept the Esp and Ah security rule protocols.
+const espAHMinNetworkAPIVersion = "2020-11-01"
+
+func (c *CloudInfo) networkAPIVersion() string {
+	if c.NetworkAPIVersion != "" {
+		return c.NetworkAPIVersion
+	}
+
+	return defaultNetworkAPIVersion
+}
+
+// supportsESPAndAH checks whether the network API version in use accepts the Esp and Ah security rule protocols. API
+// versions are dates, optionally followed by a suffix such as "-preview", so they're ordered lexically.
+func (c *CloudInfo) supportsESPAndAH() bool {
+	return c.networkAPIVersion() >= espAHMinNetworkAPIVersion
+}
+
+// networkClientOptions returns the options with which to create the Azure network clients.
+func (c *CloudInfo) networkClientOptions() *arm.ClientOptions {
+	options := c.armClientOptions()
+	if c.NetworkAPIVersion != "" {
+		options.APIVersion = c.NetworkAPIVersion
+	}
+
+	return options
+}
+
+// armClientOptions returns the options with which to create the Azure clients.
+func (c *CloudInfo) armClientOptions() *arm.ClientOptions {
+	options := &arm.ClientOptions{}
+	if c.ClientOptions != nil {
+		*options = *c.ClientOptions
+	}
+
+	if maxRetries, ok := c.maxRetries(); ok {
+		options.Retry.MaxRetries = maxRetries
+	} else if options.Retry.MaxRetries == 0 {
+		options.Retry.MaxRetries = defaultMaxRetries
+	}
+
+	// The CloudInfo isn't modified here since its clients may be created concurrently; without shared policies, which are
+	// created by the constructors, each client gets its own.
+	limiter := c.pollLimiter
+	if limiter == nil {
+		limiter = newPollLimiter(c.maxConcurrentPolls())
+	}
+
+	options.PerRetryPolicies = append(slices.Clone(options.PerRetryPolicies), limiter)
+
+	options.PerCallPolicies = slices.Clone(options.PerCallPolicies)
+
+	if c.AZCommandWriter != nil {
+		renderer := c.commandRenderer
+		if renderer == nil {
+			renderer = newCommandRenderer(c.AZCommandWriter)
+		}
+
+		options.PerCallPolicies = append(options.PerCallPolicies, renderer)
+	}
+
+	options.PerCallPolicies = append(options.PerCallPolicies, cachedReads{})
+	options.PerRetryPolicies = append(options.PerRetryPolicies, apiCallCounting{})
+
+	if c.Metrics != nil {
+		options.PerRetryPolicies = append(options.PerRetryPolicies, metricsPolicy{metrics: c.Metrics})
+	}
+
+	if c.ResourceManagerEndpoint != "" {
+		options.Cloud = c.resourceManagerCloud(options.Cloud)
+	}
+
+	return options
+}
+
+// resourceManagerCloud returns a copy of the given cloud configuration with the Resource Manager service targeting the
+// configured endpoint.
+func (c *CloudInfo) resourceManagerCloud(base cloud.Configuration) cloud.Configuration {
+	if base.Services == nil {
+		base = cloud.AzurePublic
+	}
+
+	audience := c.ResourceManagerAudience
+	if audience == "" {
+		audience = cloud.AzurePublic.Services[cloud.ResourceManager].Audience
+	}
+
+	services := maps.Clone(base.Services)
+	services[cloud.ResourceManager] = cloud.ServiceConfiguration{
+		Endpoint: c.ResourceManagerEndpoint,
+		Audience: audience,
+	}
+
+	base.Services = services
+
+	return base
+}
+
+// newHTTPClient returns an HTTP client with a dedicated transport, configured as the Azure SDK's default one, so that
+// its connections can be released independently.
+func newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // It's always an *http.Transport
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,289 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CloudInfo options", func() {
+	var info *CloudInfo
+
+	BeforeEach(func() {
+		info = &CloudInfo{}
+	})
+
+	When("neither the fields nor the environment variables are set", func() {
+		It("should use the defaults", func() {
+			Expect(info.resourceTimeout()).To(Equal(defaultResourceTimeout))
+			Expect(info.operationTimeout()).To(Equal(defaultOperationTimeout))
+			Expect(info.armClientOptions().Retry.MaxRetries).To(Equal(defaultMaxRetries))
+		})
+	})
+
+	When("an operation timeout is set", func() {
+		BeforeEach(func() {
+			info.OperationTimeout = time.Minute
+		})
+
+		It("should bound the operation contexts by it", func() {
+			ctx, cancel := info.opContext(context.Background())
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			Expect(ok).To(BeTrue())
+			Expect(time.Until(deadline)).To(BeNumerically("~", time.Minute, time.Second))
+		})
+
+		It("should propagate the cancellation of the parent context", func() {
+			parent, cancelParent := context.WithCancel(context.Background())
+
+			ctx, cancel := info.opContext(parent)
+			defer cancel()
+
+			cancelParent()
+			Expect(ctx.Err()).To(MatchError(context.Canceled))
+		})
+	})
+
+	When("the environment variables are set", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv(TimeoutEnvVar, "2m")
+			GinkgoT().Setenv(MaxRetriesEnvVar, "7")
+		})
+
+		It("should use them if the fields aren't set", func() {
+			Expect(info.resourceTimeout()).To(Equal(2 * time.Minute))
+			Expect(info.operationTimeout()).To(Equal(2 * time.Minute))
+			Expect(info.armClientOptions().Retry.MaxRetries).To(Equal(int32(7)))
+		})
+
+		It("should use the fields if they're set", func() {
+			info.ResourceTimeout = 30 * time.Second
+			info.OperationTimeout = 45 * time.Second
+			info.MaxRetries = -1
+
+			Expect(info.resourceTimeout()).To(Equal(30 * time.Second))
+			Expect(info.operationTimeout()).To(Equal(45 * time.Second))
+			Expect(info.armClientOptions().Retry.MaxRetries).To(Equal(int32(-1)))
+		})
+	})
+
+	When("the environment variables are invalid", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv(TimeoutEnvVar, "soon")
+			GinkgoT().Setenv(MaxRetriesEnvVar, "many")
+		})
+
+		It("should use the defaults", func() {
+			Expect(info.resourceTimeout()).To(Equal(defaultResourceTimeout))
+			Expect(info.operationTimeout()).To(Equal(defaultOperationTimeout))
+			Expect(info.armClientOptions().Retry.MaxRetries).To(Equal(defaultMaxRetries))
+		})
+	})
+
+	When("the maximum number of retries environment variable is zero", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv(MaxRetriesEnvVar, "0")
+		})
+
+		It("should disable retries", func() {
+			Expect(info.armClientOptions().Retry.MaxRetries).To(Equal(int32(-1)))
+		})
+	})
+
+	When("a Resource Manager endpoint is configured", func() {
+		var (
+			fake   *fakeARM
+			scopes []string
+		)
+
+		BeforeEach(func() {
+			fake = newFakeARM()
+			info = newTestCloudInfo(fake)
+			info.TokenCredential = fakeTokenCredential{scopes: &scopes}
+			info.ResourceManagerEndpoint = "https://management.privatelink.example.com"
+		})
+
+		It("should target the endpoint with the public cloud audience", func() {
+			nsgClient, err := info.getNsgClient()
+			Expect(err).To(Succeed())
+
+			_, _ = nsgClient.Get(context.TODO(), info.BaseGroupName, "test-nsg", nil)
+
+			Expect(fake.requestHosts()).To(Equal([]string{"management.privatelink.example.com"}))
+			Expect(scopes).To(ContainElement("https://management.core.windows.net//.default"))
+		})
+
+		It("should use the configured audience", func() {
+			info.ResourceManagerAudience = "https://management.example.com/"
+
+			nsgClient, err := info.getNsgClient()
+			Expect(err).To(Succeed())
+
+			_, _ = nsgClient.Get(context.TODO(), info.BaseGroupName, "test-nsg", nil)
+
+			Expect(scopes).To(ContainElement("https://management.example.com//.default"))
+		})
+	})
+
+	When("a sovereign cloud is configured in the client options", func() {
+		var (
+			fake   *fakeARM
+			scopes []string
+		)
+
+		BeforeEach(func() {
+			fake = newFakeARM()
+			info = newTestCloudInfo(fake)
+			info.TokenCredential = fakeTokenCredential{scopes: &scopes}
+			info.ClientOptions.Cloud = cloud.AzureChina
+		})
+
+		It("should target its Resource Manager endpoint and audience", func() {
+			nsgClient, err := NewCloud(info).(*azureCloud).getNsgClient()
+			Expect(err).To(Succeed())
+
+			_, _ = nsgClient.Get(context.TODO(), info.BaseGroupName, "test-nsg", nil)
+
+			Expect(fake.requestHosts()).To(Equal([]string{"management.chinacloudapi.cn"}))
+			Expect(scopes).To(ContainElement("https://management.core.chinacloudapi.cn/.default"))
+		})
+	})
+
+	When("metrics are configured", func() {
+		var (
+			fake    *fakeARM
+			metrics *fakeMetrics
+		)
+
+		BeforeEach(func() {
+			fake = newFakeARM()
+			info = newTestCloudInfo(fake)
+			metrics = &fakeMetrics{}
+			info.Metrics = metrics
+		})
+
+		It("should observe each request with its outcome", func() {
+			nsgClient, err := info.getNsgClient()
+			Expect(err).To(Succeed())
+
+			fake.put(nsgPath("test-nsg"), &armnetwork.SecurityGroup{})
+
+			_, err = nsgClient.Get(context.TODO(), info.BaseGroupName, "test-nsg", nil)
+			Expect(err).To(Succeed())
+
+			_, err = nsgClient.Get(context.TODO(), info.BaseGroupName, "missing-nsg", nil)
+			Expect(err).To(HaveOccurred())
+
+			Expect(metrics.operations).To(Equal([]string{"GET networkSecurityGroups", "GET networkSecurityGroups"}))
+			Expect(metrics.errs[0]).To(Succeed())
+			Expect(metrics.errs[1]).To(HaveOccurred())
+		})
+	})
+
+	When("a network API version is configured", func() {
+		var fake *fakeARM
+
+		BeforeEach(func() {
+			fake = newFakeARM()
+			info = newTestCloudInfo(fake)
+			info.NetworkAPIVersion = "2018-11-01"
+		})
+
+		It("should request it from the network API", func() {
+			nsgClient, err := info.getNsgClient()
+			Expect(err).To(Succeed())
+
+			_, _ = nsgClient.Get(context.TODO(), info.BaseGroupName, "test-nsg", nil)
+
+			Expect(fake.requestAPIVersions()).To(Equal([]string{"2018-11-01"}))
+		})
+	})
+
+	When("Azure throttles the requests", func() {
+		var (
+			fake      *fakeARM
+			groupPath string
+			getErr    error
+			failures  []int
+		)
+
+		BeforeEach(func() {
+			fake = newFakeARM()
+			info = newTestCloudInfo(fake)
+			info.ClientOptions.Retry = policy.RetryOptions{RetryDelay: time.Millisecond, MaxRetryDelay: 5 * time.Millisecond}
+
+			groupPath = nsgPath("test-nsg")
+			fake.put(groupPath, &armnetwork.SecurityGroup{})
+
+			failures = []int{http.StatusTooManyRequests, http.StatusTooManyRequests}
+		})
+
+		JustBeforeEach(func() {
+			fake.failNext(http.MethodGet, groupPath, failures...)
+
+			nsgClient, err := info.getNsgClient()
+			Expect(err).To(Succeed())
+
+			_, getErr = nsgClient.Get(context.TODO(), info.BaseGroupName, "test-nsg", nil)
+		})
+
+		It("should retry until the request succeeds", func() {
+			Expect(getErr).To(Succeed())
+			Expect(fake.requestCount(http.MethodGet, groupPath)).To(Equal(3))
+		})
+
+		When("the request is forbidden", func() {
+			BeforeEach(func() {
+				failures = []int{http.StatusForbidden}
+			})
+
+			It("should fail without retrying", func() {
+				Expect(getErr).To(HaveOccurred())
+				Expect(fake.requestCount(http.MethodGet, groupPath)).To(Equal(1))
+			})
+		})
+	})
+})
+
+type fakeMetrics struct {
+	mutex      sync.Mutex
+	operations []string
+	errs       []error
+}
+
+func (m *fakeMetrics) ObserveOperation(backend, operation string, _ time.Duration, err error) {
+	Expect(backend).To(Equal(metricsBackend))
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.operations = append(m.operations, operation)
+	m.errs = append(m.errs, err)
+}
@@ -0,0 +1,328 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// OrphanedSecurityGroup is the kind of an orphaned Submariner gateway security group.
+	OrphanedSecurityGroup = "NetworkSecurityGroup"
+	// OrphanedSecurityRules is the kind of the orphaned Submariner rules in the internal security group of a cluster. The
+	// group itself isn't created by Submariner, so only the rules are deleted.
+	OrphanedSecurityRules = "SecurityRules"
+	// OrphanedPublicIP is the kind of an orphaned Submariner gateway public IP.
+	OrphanedPublicIP = "PublicIPAddress"
+)
+
+// OrphanedResource describes a resource created by Submariner which no longer belongs to a cluster.
+type OrphanedResource struct {
+	// Kind is OrphanedSecurityGroup, OrphanedSecurityRules or OrphanedPublicIP.
+	Kind          string
+	ResourceGroup string
+	Name          string
+	// Reason explains why the resource is considered orphaned.
+	Reason string
+}
+
+// FindOrphanedResources returns the Submariner resources left behind by clusters which no longer exist: the gateway security
+// groups created, and the Submariner rules added to the internal security groups, for an infra ID whose virtual network is
+// gone, and the unattached gateway public IPs created by Submariner for such an infra ID, or for this cluster's nodes
+// whose network interface is gone. Nothing is modified.
+func (c *CloudInfo) FindOrphanedResources(ctx context.Context) ([]OrphanedResource, error) {
+	nsgClient, err := c.getNsgClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get network security groups client")
+	}
+
+	vnetClient, err := c.getVirtualNetworksClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get virtual networks client")
+	}
+
+	nwClient, err := c.getInterfacesClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get network interfaces client")
+	}
+
+	pubIPClient, err := c.getPublicIPClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get network public IP addresses client")
+	}
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	orphans, err := c.findOrphanedSecurityGroups(ctx, nsgClient, vnetClient)
+	if err != nil {
+		return nil, err
+	}
+
+	orphanedIPs, err := c.findOrphanedPublicIPs(ctx, pubIPClient, vnetClient, nwClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(orphans, orphanedIPs...), nil
+}
+
+// staleInfraIDReason returns why the given infra ID is considered stale, i.e. its virtual network doesn't exist, or an
+// empty string if it's the current infra ID or its virtual network exists.
+func (c *CloudInfo) staleInfraIDReason(ctx context.Context, infraID string, vnetClient *armnetwork.VirtualNetworksClient,
+) (string, error) {
+	if infraID == c.InfraID {
+		return "", nil
+	}
+
+	vnetName := infraID + vnetSuffix
+
+	_, err := vnetClient.Get(ctx, c.BaseGroupName, vnetName, nil)
+	if err == nil {
+		return "", nil
+	}
+
+	if !isNotFound(err) {
+		return "", errors.Wrapf(err, "error getting the virtual network %q", vnetName)
+	}
+
+	return "the virtual network " + vnetName + " of infra ID " + infraID + " doesn't exist", nil
+}
+
+func (c *CloudInfo) findOrphanedSecurityGroups(ctx context.Context, nsgClient *armnetwork.SecurityGroupsClient,
+	vnetClient *armnetwork.VirtualNetworksClient,
+) ([]OrphanedResource, error) {
+	orphans := []OrphanedResource{}
+
+	pager := nsgClient.NewListPager(c.BaseGroupName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error listing the security groups in resource group %q", c.BaseGroupName)
+		}
+
+		for _, nwSecurityGroup := range page.Value {
+			groupName := ptr.Deref(nwSecurityGroup.Name, "")
+
+			var kind, suffix string
+
+			switch {
+			case strings.HasSuffix(groupName, externalSecurityGroupSuffix) && isManagedSecurityGroup(nwSecurityGroup):
+				kind, suffix = OrphanedSecurityGroup, externalSecurityGroupSuffix
+			case strings.HasSuffix(groupName, internalSecurityGroupSuffix) && c.hasOwnedSecurityRules(nwSecurityGroup):
+				kind, suffix = OrphanedSecurityRules, internalSecurityGroupSuffix
+			default:
+				continue
+			}
+
+			// Groups modified before the InfraIDTag was introduced are only identified by their name.
+			infraID := ptr.Deref(nwSecurityGroup.Tags[InfraIDTag], strings.TrimSuffix(groupName, suffix))
+
+			reason, err := c.staleInfraIDReason(ctx, infraID, vnetClient)
+			if err != nil {
+				return nil, err
+			}
+
+			if reason != "" {
+				orphans = append(orphans, OrphanedResource{
+					Kind:          kind,
+					ResourceGroup: c.BaseGroupName,
+					Name:          groupName,
+					Reason:        reason,
+				})
+			}
+		}
+	}
+
+	return orphans, nil
+}
+
+// hasOwnedSecurityRules checks whether the given security group holds Submariner rules belonging to the configured RuleOwner.
+func (c *CloudInfo) hasOwnedSecurityRules(nwSecurityGroup *armnetwork.SecurityGroup) bool {
+	if nwSecurityGroup.Properties == nil {
+		return false
+	}
+
+	for _, rule := range nwSecurityGroup.Properties.SecurityRules {
+		if c.ownsSecurityRule(rule) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *CloudInfo) findOrphanedPublicIPs(ctx context.Context, pubIPClient *armnetwork.PublicIPAddressesClient,
+	vnetClient *armnetwork.VirtualNetworksClient, nwClient *armnetwork.InterfacesClient,
+) ([]OrphanedResource, error) {
+	orphans := []OrphanedResource{}
+	groupName := c.publicIPResourceGroup()
+
+	pager := pubIPClient.NewListPager(groupName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error listing the public IPs in resource group %q", groupName)
+		}
+
+		for _, pubIP := range page.Value {
+			ipName := ptr.Deref(pubIP.Name, "")
+			infraID := ptr.Deref(pubIP.Tags[InfraIDTag], "")
+
+			// Only the public IPs created by Submariner are tagged, other unattached IPs are left alone.
+			if !strings.HasSuffix(ipName, publicIPNameSuffix) || ptr.Deref(pubIP.Tags[ManagedTag], "") != "true" || infraID == "" ||
+				(pubIP.Properties != nil && pubIP.Properties.IPConfiguration != nil) {
+				continue
+			}
+
+			reason, err := c.orphanedPublicIPReason(ctx, ipName, infraID, vnetClient, nwClient)
+			if err != nil {
+				return nil, err
+			}
+
+			if reason != "" {
+				orphans = append(orphans, OrphanedResource{
+					Kind:          OrphanedPublicIP,
+					ResourceGroup: groupName,
+					Name:          ipName,
+					Reason:        "it isn't attached to a network interface and " + reason,
+				})
+			}
+		}
+	}
+
+	return orphans, nil
+}
+
+// orphanedPublicIPReason returns why the given unattached public IP of the given infra ID is considered orphaned, or an
+// empty string if it isn't. A public IP of this cluster is only orphaned once its node's interface is gone, since it's
+// not attached yet right after it's created.
+func (c *CloudInfo) orphanedPublicIPReason(ctx context.Context, ipName, infraID string,
+	vnetClient *armnetwork.VirtualNetworksClient, nwClient *armnetwork.InterfacesClient,
+) (string, error) {
+	if infraID != c.InfraID {
+		return c.staleInfraIDReason(ctx, infraID, vnetClient)
+	}
+
+	interfaceName := strings.TrimSuffix(ipName, publicIPNameSuffix) + "-nic"
+
+	_, err := nwClient.Get(ctx, c.BaseGroupName, interfaceName, nil)
+	if err == nil {
+		return "", nil
+	}
+
+	if !isNotFound(err) {
+		return "", errors.Wrapf(err, "error getting the interface %q", interfaceName)
+	}
+
+	return "the network interface " + interfaceName + " doesn't exist", nil
+}
+
+// PurgeOrphanedResources deletes the resources returned by FindOrphanedResources, provided confirm returns true for them.
+// Nothing is deleted otherwise.
+func (c *CloudInfo) PurgeOrphanedResources(ctx context.Context, confirm func([]OrphanedResource) bool,
+	status reporter.Interface,
+) error {
+	status = withRemediationHints(status)
+
+	status.Start("Looking for orphaned Submariner resources")
+	defer status.End()
+
+	orphans, err := c.FindOrphanedResources(ctx)
+	if err != nil {
+		return status.Error(err, "Failed to find the orphaned Submariner resources")
+	}
+
+	if len(orphans) == 0 {
+		status.Success("No orphaned Submariner resources found")
+		return nil
+	}
+
+	if !confirm(orphans) {
+		status.Warning("Found %d orphaned Submariner resources, which were not deleted", len(orphans))
+		return nil
+	}
+
+	nsgClient, err := c.getNsgClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network security groups client")
+	}
+
+	pubIPClient, err := c.getPublicIPClient()
+	if err != nil {
+		return status.Error(err, "Failed to get network public IP addresses client")
+	}
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	var errs []error
+
+	for _, orphan := range orphans {
+		if err := c.deleteOrphanedResource(ctx, orphan, nsgClient, pubIPClient); err != nil {
+			errs = append(errs, status.Error(err, "Failed to delete the orphaned %s %q", orphan.Kind, orphan.Name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	status.Success("Deleted %d orphaned Submariner resources", len(orphans))
+
+	return nil
+}
+
+func (c *CloudInfo) deleteOrphanedResource(ctx context.Context, orphan OrphanedResource,
+	nsgClient *armnetwork.SecurityGroupsClient, pubIPClient *armnetwork.PublicIPAddressesClient,
+) error {
+	switch orphan.Kind {
+	case OrphanedPublicIP:
+		return c.deletePublicIP(ctx, pubIPClient, orphan.Name)
+	case OrphanedSecurityRules:
+		nwSecurityGroup, err := nsgClient.Get(ctx, orphan.ResourceGroup, orphan.Name, nil)
+		if isNotFound(err) {
+			return nil
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "error getting the security group %q", orphan.Name)
+		}
+
+		return c.removeSubmarinerRules(ctx, &nwSecurityGroup.SecurityGroup, nsgClient)
+	}
+
+	poller, err := nsgClient.BeginDelete(ctx, orphan.ResourceGroup, orphan.Name, nil)
+	if err == nil {
+		_, err = pollUntilDone(ctx, poller, c.pollOptions())
+	}
+
+	if isNotFound(err) {
+		return nil
+	}
+
+	return errors.Wrapf(err, "deleting security group %q failed", orphan.Name)
+}
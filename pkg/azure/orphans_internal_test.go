@@ -0,0 +1,230 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Orphaned resources", func() {
+	const staleInfraID = "stale-infraID"
+
+	var (
+		fake *fakeARM
+		info *CloudInfo
+	)
+
+	managedGroup := func(infraID string) *armnetwork.SecurityGroup {
+		return &armnetwork.SecurityGroup{
+			Tags:       map[string]*string{InfraIDTag: ptr.To(infraID), ManagedTag: ptr.To("true")},
+			Properties: &armnetwork.SecurityGroupPropertiesFormat{},
+		}
+	}
+
+	vnetPath := func(name string) string {
+		return resourceGroupPath("Microsoft.Network/virtualNetworks/" + name)
+	}
+
+	managedPublicIP := func(infraID string) *armnetwork.PublicIPAddress {
+		return &armnetwork.PublicIPAddress{Tags: map[string]*string{InfraIDTag: ptr.To(infraID), ManagedTag: ptr.To("true")}}
+	}
+
+	internalGroup := func(infraID string) *armnetwork.SecurityGroup {
+		return &armnetwork.SecurityGroup{
+			Tags: map[string]*string{InfraIDTag: ptr.To(infraID)},
+			Properties: &armnetwork.SecurityGroupPropertiesFormat{
+				SecurityRules: []*armnetwork.SecurityRule{
+					{Name: ptr.To(internalSecurityRulePrefix + "Udp-4800-Inbound")},
+					{Name: ptr.To("installer-rule")},
+				},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		fake = newFakeARM()
+		info = newTestCloudInfo(fake)
+
+		// The current cluster's resources.
+		fake.put(vnetPath(info.InfraID+vnetSuffix), &armnetwork.VirtualNetwork{})
+		fake.put(nsgPath(info.InfraID+externalSecurityGroupSuffix), managedGroup(info.InfraID))
+		fake.put(nsgPath(info.InfraID+internalSecurityGroupSuffix), internalGroup(info.InfraID))
+		fake.put(publicIPPath("worker-1"+publicIPNameSuffix), &armnetwork.PublicIPAddress{
+			Tags: managedPublicIP(info.InfraID).Tags,
+			Properties: &armnetwork.PublicIPAddressPropertiesFormat{
+				IPConfiguration: &armnetwork.IPConfiguration{ID: ptr.To(nicPath("worker-1-nic") + "/ipConfigurations/pipConfig")},
+			},
+		})
+
+		// A public IP which was just created and isn't attached yet.
+		fake.put(nicPath("worker-2-nic"), &armnetwork.Interface{})
+		fake.put(publicIPPath("worker-2"+publicIPNameSuffix), managedPublicIP(info.InfraID))
+
+		// Another live cluster sharing the resource group.
+		fake.put(vnetPath("other-infraID"+vnetSuffix), &armnetwork.VirtualNetwork{})
+		fake.put(nsgPath("other-infraID"+externalSecurityGroupSuffix), managedGroup("other-infraID"))
+		fake.put(nsgPath("other-infraID"+internalSecurityGroupSuffix), internalGroup("other-infraID"))
+		fake.put(publicIPPath("other-worker"+publicIPNameSuffix), managedPublicIP("other-infraID"))
+
+		// An unmanaged group which happens to have a Submariner name.
+		fake.put(nsgPath("gone-infraID"+externalSecurityGroupSuffix), &armnetwork.SecurityGroup{
+			Tags: map[string]*string{InfraIDTag: ptr.To("gone-infraID")},
+			Properties: &armnetwork.SecurityGroupPropertiesFormat{
+				SecurityRules: []*armnetwork.SecurityRule{{Name: ptr.To("user-rule")}},
+			},
+		})
+
+		// The stale resources.
+		fake.put(nsgPath(staleInfraID+externalSecurityGroupSuffix), managedGroup(staleInfraID))
+		fake.put(nsgPath(staleInfraID+internalSecurityGroupSuffix), internalGroup(staleInfraID))
+		fake.put(publicIPPath("stale-worker"+publicIPNameSuffix), managedPublicIP(staleInfraID))
+		fake.put(publicIPPath("deleted-worker"+publicIPNameSuffix), managedPublicIP(info.InfraID))
+
+		// Unattached public IPs which weren't created by Submariner.
+		fake.put(publicIPPath("unrelated-ip"), &armnetwork.PublicIPAddress{})
+		fake.put(publicIPPath("user"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})
+	})
+
+	expectedOrphans := func() []OrphanedResource {
+		return []OrphanedResource{
+			{
+				Kind:          OrphanedSecurityGroup,
+				ResourceGroup: info.BaseGroupName,
+				Name:          staleInfraID + externalSecurityGroupSuffix,
+				Reason:        "the virtual network " + staleInfraID + vnetSuffix + " of infra ID " + staleInfraID + " doesn't exist",
+			},
+			{
+				Kind:          OrphanedSecurityRules,
+				ResourceGroup: info.BaseGroupName,
+				Name:          staleInfraID + internalSecurityGroupSuffix,
+				Reason:        "the virtual network " + staleInfraID + vnetSuffix + " of infra ID " + staleInfraID + " doesn't exist",
+			},
+			{
+				Kind:          OrphanedPublicIP,
+				ResourceGroup: info.BaseGroupName,
+				Name:          "stale-worker" + publicIPNameSuffix,
+				Reason: "it isn't attached to a network interface and the virtual network " + staleInfraID + vnetSuffix +
+					" of infra ID " + staleInfraID + " doesn't exist",
+			},
+			{
+				Kind:          OrphanedPublicIP,
+				ResourceGroup: info.BaseGroupName,
+				Name:          "deleted-worker" + publicIPNameSuffix,
+				Reason:        "it isn't attached to a network interface and the network interface deleted-worker-nic doesn't exist",
+			},
+		}
+	}
+
+	Describe("FindOrphanedResources", func() {
+		It("should return only the stale resources without modifying anything", func() {
+			orphans, err := info.FindOrphanedResources(context.TODO())
+			Expect(err).To(Succeed())
+			Expect(orphans).To(ConsistOf(expectedOrphans()))
+
+			Expect(fake.requestCountByMethod("PUT")).To(BeZero())
+			Expect(fake.requestCountByMethod("DELETE")).To(BeZero())
+		})
+
+		When("getting a virtual network fails", func() {
+			It("should return an error", func() {
+				fake.failNext("GET", vnetPath(staleInfraID+vnetSuffix), 500)
+
+				_, err := info.FindOrphanedResources(context.TODO())
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("PurgeOrphanedResources", func() {
+		var (
+			tracker   *reporter.Tracker
+			confirmed []OrphanedResource
+		)
+
+		purge := func(confirm bool) error {
+			tracker = reporter.NewTracker(reporter.Stdout())
+
+			return info.PurgeOrphanedResources(context.TODO(), func(orphans []OrphanedResource) bool {
+				confirmed = orphans
+				return confirm
+			}, tracker)
+		}
+
+		It("should delete the stale resources once confirmed", func() {
+			Expect(purge(true)).To(Succeed())
+			Expect(confirmed).To(ConsistOf(expectedOrphans()))
+
+			Expect(fake.get(nsgPath(staleInfraID+externalSecurityGroupSuffix), &armnetwork.SecurityGroup{})).To(BeFalse())
+			Expect(fake.get(publicIPPath("stale-worker"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+			Expect(fake.get(publicIPPath("deleted-worker"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+
+			staleInternalGroup := &armnetwork.SecurityGroup{}
+			Expect(fake.get(nsgPath(staleInfraID+internalSecurityGroupSuffix), staleInternalGroup)).To(BeTrue())
+			Expect(ruleNames(staleInternalGroup.Properties.SecurityRules).UnsortedList()).To(ConsistOf("installer-rule"))
+
+			Expect(fake.get(nsgPath(info.InfraID+externalSecurityGroupSuffix), &armnetwork.SecurityGroup{})).To(BeTrue())
+			Expect(fake.get(nsgPath("other-infraID"+externalSecurityGroupSuffix), &armnetwork.SecurityGroup{})).To(BeTrue())
+			Expect(fake.get(nsgPath("gone-infraID"+externalSecurityGroupSuffix), &armnetwork.SecurityGroup{})).To(BeTrue())
+			Expect(fake.get(publicIPPath("worker-1"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeTrue())
+			Expect(fake.get(publicIPPath("worker-2"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeTrue())
+			Expect(fake.get(publicIPPath("other-worker"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeTrue())
+			Expect(fake.get(publicIPPath("unrelated-ip"), &armnetwork.PublicIPAddress{})).To(BeTrue())
+			Expect(fake.get(publicIPPath("user"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeTrue())
+			Expect(fake.requestCountByMethod("DELETE")).To(Equal(3))
+		})
+
+		When("not confirmed", func() {
+			It("should delete nothing and warn", func() {
+				Expect(purge(false)).To(Succeed())
+				Expect(tracker.HasWarnings()).To(BeTrue())
+				Expect(fake.requestCountByMethod("DELETE")).To(BeZero())
+			})
+		})
+
+		When("there are no stale resources", func() {
+			BeforeEach(func() {
+				fake.put(vnetPath(staleInfraID+vnetSuffix), &armnetwork.VirtualNetwork{})
+				fake.put(nicPath("deleted-worker-nic"), &armnetwork.Interface{})
+			})
+
+			It("should not ask for confirmation", func() {
+				confirmed = nil
+
+				Expect(purge(true)).To(Succeed())
+				Expect(confirmed).To(BeNil())
+				Expect(fake.requestCountByMethod("DELETE")).To(BeZero())
+			})
+		})
+
+		When("a deletion fails", func() {
+			It("should still delete the other resources and return an error", func() {
+				fake.failNext("DELETE", nsgPath(staleInfraID+externalSecurityGroupSuffix), 500)
+
+				Expect(purge(true)).NotTo(Succeed())
+				Expect(fake.get(publicIPPath("stale-worker"+publicIPNameSuffix), &armnetwork.PublicIPAddress{})).To(BeFalse())
+			})
+		})
+	})
+})
@@ -0,0 +1,179 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package azure
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+const (
+	defaultMaxConcurrentPolls = 4
+	defaultMaxPollRetries     = 3
+	defaultPollFrequency      = 30 * time.Second
+)
+
+// PollError is returned when the status of a long-running operation couldn't be determined, as opposed to the operation
+// failing; the operation may still be in progress, or even have succeeded.
+type PollError struct {
+	Err error
+}
+
+func (e *PollError) Error() string {
+	return "error polling the status of the operation: " + e.Err.Error()
+}
+
+func (e *PollError) Unwrap() error {
+	return e.Err
+}
+
+type pollOptions struct {
+	maxRetries  int
+	interval    time.Duration
+	maxInterval time.Duration
+	multiplier  float64
+}
+
+func (c *CloudInfo) pollOptions() pollOptions {
+	options := pollOptions{
+		maxRetries:  c.MaxPollRetries,
+		interval:    c.PollInterval,
+		maxInterval: c.MaxPollInterval,
+		multiplier:  c.PollMultiplier,
+	}
+
+	if options.maxRetries == 0 {
+		options.maxRetries = defaultMaxPollRetries
+	}
+
+	if options.interval <= 0 {
+		options.interval = defaultPollFrequency
+	}
+
+	if options.multiplier < 1 {
+		options.multiplier = 1
+	}
+
+	if options.maxInterval <= 0 {
+		options.maxInterval = max(options.interval, defaultPollFrequency)
+	}
+
+	return options
+}
+
+// nextInterval returns the interval to wait after the poll following one preceded by the given interval.
+func (o pollOptions) nextInterval(interval time.Duration) time.Duration {
+	return min(time.Duration(float64(interval)*o.multiplier), max(o.maxInterval, o.interval))
+}
+
+// pollUntilDone waits for the given long-running operation to complete, like Poller.PollUntilDone, but retries the polls
+// which fail transiently. If the operation's status still can't be determined, a PollError is returned; if the operation
+// itself fails, its error is returned as is.
+func pollUntilDone[T any](ctx context.Context, poller *runtime.Poller[T], options pollOptions) (T, error) {
+	failures := 0
+	interval := options.interval
+
+	for !poller.Done() {
+		resp, err := poller.Poll(ctx)
+		if poller.Done() {
+			break
+		}
+
+		if err != nil {
+			category := CategorizeError(err)
+			if failures >= options.maxRetries || ctx.Err() != nil ||
+				(category != ErrorCategoryTransient && category != ErrorCategoryThrottled) {
+				var zero T
+				return zero, &PollError{Err: err}
+			}
+
+			failures++
+		} else {
+			failures = 0
+		}
+
+		timer := time.NewTimer(retryAfter(resp, interval))
+		interval = options.nextInterval(interval)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			var zero T
+
+			return zero, &PollError{Err: ctx.Err()}
+		case <-timer.C:
+		}
+	}
+
+	return poller.Result(ctx) //nolint:wrapcheck // Let the caller wrap it.
+}
+
+// retryAfter returns the delay requested by the Retry-After header of the given response, if any, otherwise the default.
+func retryAfter(resp *http.Response, defaultDelay time.Duration) time.Duration {
+	if resp == nil {
+		return defaultDelay
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return defaultDelay
+}
+
+// pollLimiter is a pipeline policy which limits the number of concurrent polls of long-running operations.
+type pollLimiter struct {
+	slots chan struct{}
+}
+
+func newPollLimiter(maxConcurrent int) *pollLimiter {
+	return &pollLimiter{slots: make(chan struct{}, maxConcurrent)}
+}
+
+func (p *pollLimiter) Do(req *policy.Request) (*http.Response, error) {
+	if req.Raw().Method != http.MethodGet || !isOperationPath(strings.ToLower(req.Raw().URL.Path)) {
+		return req.Next() //nolint:wrapcheck // Let the caller wrap it.
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-req.Raw().Context().Done():
+		return nil, req.Raw().Context().Err() //nolint:wrapcheck // Let the caller wrap it.
+	}
+
+	defer func() {
+		<-p.slots
+	}()
+
+	return req.Next() //nolint:wrapcheck // Let the caller wrap it.
+}
+
+func (c *CloudInfo) maxConcurrentPolls() int {
+	if c.MaxConcurrentPolls > 0 {
+		return c.MaxConcurrentPolls
+	}
+
+	return defaultMaxConcurrentPolls
+}
@@ -0,0 +1,291 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// blockingTransport holds each request until released, recording the maximum number of requests in flight.
+type blockingTransport struct {
+	release  chan struct{}
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+}
+
+func (t *blockingTransport) Do(req *http.Request) (*http.Response, error) {
+	n := t.inFlight.Add(1)
+	defer t.inFlight.Add(-1)
+
+	for {
+		seen := t.maxSeen.Load()
+		if n <= seen || t.maxSeen.CompareAndSwap(seen, n) {
+			break
+		}
+	}
+
+	<-t.release
+
+	return newResponse(req, http.StatusOK, `{"status":"Succeeded"}`), nil
+}
+
+// asyncTransport emulates a long-running security group update, whose polls respond with the given status codes in turn
+// and then with the given final operation status.
+type asyncTransport struct {
+	mutex       sync.Mutex
+	pollCodes   []int
+	inProgress  int
+	finalStatus string
+	polls       int
+	pollTimes   []time.Time
+}
+
+const testOperationURL = "https://management.azure.com/subscriptions/test-subscription/providers/Microsoft.Network/locations/east/" +
+	"operations/op?api-version=2022-01-01"
+
+func (t *asyncTransport) Do(req *http.Request) (*http.Response, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	switch {
+	case req.Method == http.MethodPut:
+		resp := newResponse(req, http.StatusCreated, `{"properties":{"provisioningState":"Updating"}}`)
+		resp.Header.Set("Azure-AsyncOperation", testOperationURL)
+
+		return resp, nil
+	case isOperationPath(req.URL.Path):
+		t.polls++
+		t.pollTimes = append(t.pollTimes, time.Now())
+
+		if len(t.pollCodes) > 0 {
+			code := t.pollCodes[0]
+			t.pollCodes = t.pollCodes[1:]
+
+			return newResponse(req, code, `{"error":{"code":"Fake","message":"fake poll failure"}}`), nil
+		}
+
+		if t.inProgress > 0 {
+			t.inProgress--
+
+			return newResponse(req, http.StatusOK, `{"status":"InProgress"}`), nil
+		}
+
+		return newResponse(req, http.StatusOK, `{"status":"`+t.finalStatus+`","error":{"code":"Fake","message":"fake failure"}}`), nil
+	default:
+		return newResponse(req, http.StatusOK, `{"name":"test-nsg","properties":{"provisioningState":"Succeeded"}}`), nil
+	}
+}
+
+var _ = Describe("Polling long-running operations", func() {
+	var (
+		transport *asyncTransport
+		info      *CloudInfo
+		err       error
+	)
+
+	BeforeEach(func() {
+		transport = &asyncTransport{finalStatus: "Succeeded"}
+		info = &CloudInfo{
+			SubscriptionID:  testSubscriptionID,
+			BaseGroupName:   testResourceGroup,
+			TokenCredential: fakeTokenCredential{},
+			ClientOptions: &arm.ClientOptions{ClientOptions: policy.ClientOptions{
+				Transport: transport,
+				Retry:     policy.RetryOptions{MaxRetries: -1},
+			}},
+			PollInterval: time.Millisecond,
+		}
+	})
+
+	JustBeforeEach(func() {
+		nsgClient, nsgErr := info.getNsgClient()
+		Expect(nsgErr).To(Succeed())
+
+		poller, beginErr := nsgClient.BeginCreateOrUpdate(context.TODO(), info.BaseGroupName, "test-nsg", armnetwork.SecurityGroup{}, nil)
+		Expect(beginErr).To(Succeed())
+
+		_, err = pollUntilDone(context.TODO(), poller, info.pollOptions())
+	})
+
+	When("a poll fails transiently", func() {
+		BeforeEach(func() {
+			transport.pollCodes = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+		})
+
+		It("should retry it", func() {
+			Expect(err).To(Succeed())
+			Expect(transport.polls).To(Equal(3))
+		})
+	})
+
+	When("the polls keep failing transiently", func() {
+		BeforeEach(func() {
+			transport.pollCodes = []int{
+				http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable,
+				http.StatusServiceUnavailable,
+			}
+		})
+
+		It("should return a poll error once the retries are exhausted", func() {
+			pollErr := &PollError{}
+			Expect(errors.As(err, &pollErr)).To(BeTrue())
+			Expect(transport.polls).To(Equal(defaultMaxPollRetries + 1))
+		})
+	})
+
+	When("a poll fails permanently", func() {
+		BeforeEach(func() {
+			transport.pollCodes = []int{http.StatusForbidden}
+		})
+
+		It("should return a poll error without retrying", func() {
+			pollErr := &PollError{}
+			Expect(errors.As(err, &pollErr)).To(BeTrue())
+			Expect(transport.polls).To(Equal(1))
+		})
+	})
+
+	When("the poll interval grows", func() {
+		BeforeEach(func() {
+			transport.inProgress = 4
+			info.PollInterval = 5 * time.Millisecond
+			info.PollMultiplier = 2
+			info.MaxPollInterval = 20 * time.Millisecond
+		})
+
+		It("should wait longer between polls, up to the maximum interval", func() {
+			Expect(err).To(Succeed())
+			Expect(transport.pollTimes).To(HaveLen(5))
+
+			for i, minInterval := range []time.Duration{5, 10, 20, 20} {
+				Expect(transport.pollTimes[i+1].Sub(transport.pollTimes[i])).To(BeNumerically(">=", minInterval*time.Millisecond))
+			}
+		})
+	})
+
+	When("the operation fails", func() {
+		BeforeEach(func() {
+			transport.finalStatus = "Failed"
+		})
+
+		It("should return the operation's error rather than a poll error", func() {
+			Expect(err).To(HaveOccurred())
+
+			pollErr := &PollError{}
+			Expect(errors.As(err, &pollErr)).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("Poll options", func() {
+	It("should poll at a constant default interval", func() {
+		options := (&CloudInfo{}).pollOptions()
+		Expect(options.interval).To(Equal(defaultPollFrequency))
+		Expect(options.nextInterval(options.interval)).To(Equal(defaultPollFrequency))
+	})
+
+	It("should grow the configured interval up to the default maximum", func() {
+		options := (&CloudInfo{PollInterval: 10 * time.Second, PollMultiplier: 2}).pollOptions()
+		Expect(options.nextInterval(10 * time.Second)).To(Equal(20 * time.Second))
+		Expect(options.nextInterval(20 * time.Second)).To(Equal(defaultPollFrequency))
+	})
+
+	It("should not shrink the interval below the configured one", func() {
+		options := (&CloudInfo{PollInterval: time.Minute, MaxPollInterval: time.Second, PollMultiplier: 2}).pollOptions()
+		Expect(options.nextInterval(time.Minute)).To(Equal(time.Minute))
+	})
+})
+
+var _ = Describe("Poll limiter", func() {
+	const polls = 10
+
+	var (
+		transport *blockingTransport
+		info      *CloudInfo
+	)
+
+	BeforeEach(func() {
+		transport = &blockingTransport{release: make(chan struct{})}
+		info = &CloudInfo{
+			SubscriptionID:  testSubscriptionID,
+			TokenCredential: fakeTokenCredential{},
+			ClientOptions:   &arm.ClientOptions{ClientOptions: policy.ClientOptions{Transport: transport}},
+		}
+	})
+
+	// runPolls issues concurrent requests to the given path and verifies that the expected number of them are in flight at
+	// once before releasing them.
+	runPolls := func(path string, expected int) {
+		client, err := arm.NewClient(armModuleName, armModuleVersion, info.TokenCredential, info.armClientOptions())
+		Expect(err).To(Succeed())
+
+		var wg sync.WaitGroup
+
+		for range polls {
+			wg.Add(1)
+
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				req, err := runtime.NewRequest(context.TODO(), http.MethodGet, "https://management.azure.com"+path)
+				Expect(err).To(Succeed())
+
+				resp, err := client.Pipeline().Do(req)
+				Expect(err).To(Succeed())
+				resp.Body.Close()
+			}()
+		}
+
+		Eventually(transport.inFlight.Load).Should(BeEquivalentTo(expected))
+		Consistently(transport.maxSeen.Load, "50ms").Should(BeEquivalentTo(expected))
+		close(transport.release)
+		wg.Wait()
+	}
+
+	It("should limit the concurrent polls to the default", func() {
+		runPolls("/subscriptions/test-subscription/providers/Microsoft.Network/locations/east/operations/op",
+			defaultMaxConcurrentPolls)
+	})
+
+	When("a maximum is configured", func() {
+		BeforeEach(func() {
+			info.MaxConcurrentPolls = 2
+		})
+
+		It("should limit the concurrent polls to it", func() {
+			runPolls("/subscriptions/test-subscription/providers/Microsoft.Network/locations/east/operations/op", 2)
+		})
+	})
+
+	It("should not limit other requests", func() {
+		runPolls(nsgPath("test-nsg"), polls)
+	})
+})
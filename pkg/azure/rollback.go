@@ -0,0 +1,60 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"github.com/submariner-io/admiral/pkg/reporter"
+)
+
+// rollback records how to undo the changes made by an operation, so that they can be undone if it fails. A nil rollback
+// records nothing, so that callers don't need to check whether rolling back is enabled.
+type rollback struct {
+	steps []rollbackStep
+}
+
+type rollbackStep struct {
+	description string
+	undo        func() error
+}
+
+func (r *rollback) add(description string, undo func() error) {
+	if r == nil {
+		return
+	}
+
+	r.steps = append(r.steps, rollbackStep{description: description, undo: undo})
+}
+
+// run undoes the recorded changes, most recent first, carrying on if one of them can't be undone since the rollback is
+// best-effort.
+func (r *rollback) run(status reporter.Interface) {
+	if r == nil {
+		return
+	}
+
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		if err := r.steps[i].undo(); err != nil {
+			status.Warning("Failed to roll back %s: %v", r.steps[i].description, err)
+		} else {
+			status.Success("Rolled back %s", r.steps[i].description)
+		}
+	}
+
+	r.steps = nil
+}
@@ -0,0 +1,319 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+	"github.com/submariner-io/cloud-prepare/pkg/k8s"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	DefaultStateConfigMapNamespace = "submariner-operator"
+
+	StateInternalSecurityGroupKey = "internalSecurityGroup"
+	StateInternalPortsKey         = "internalPorts"
+	StateExternalSecurityGroupKey = "externalSecurityGroup"
+	StatePublicPortsKey           = "publicPorts"
+	StateGatewayIPsKey            = "gatewayIPs"
+	StateEgressIPsKey             = "egressIPs"
+	StateSkippedSubnetsKey        = "skippedSubnets"
+
+	// LastPreparedAtTag is the tag on the internal security group holding the time, in RFC 3339 format, at which the
+	// ports were last successfully opened.
+	LastPreparedAtTag = "submariner-io-last-prepared-at"
+
+	// RulesModifiedAtTag is the tag on the Submariner security groups holding the time, in RFC 3339 format, at which their
+	// Submariner rules were last modified.
+	RulesModifiedAtTag = "submariner-io-rules-modified-at"
+
+	// InfraIDTag is the tag on the security groups managed by Submariner to which it adds rules, and on the gateway public
+	// IPs it creates, holding the infra ID of the cluster.
+	InfraIDTag = "submariner-io-infra-id"
+
+	// ManagedTag is the tag, set to "true", on the security groups and public IPs created by Submariner. Only the groups
+	// with this tag are deleted on cleanup, and only the resources with this tag are considered orphans.
+	ManagedTag = "submariner-io-managed"
+)
+
+// PreparedResult describes the resources prepared by a gateway deployment.
+type PreparedResult struct {
+	// GatewayIPs are the public IPs of the existing gateway nodes. The nodes of newly deployed gateway machine sets are
+	// created asynchronously, so their public IPs are only reported by a subsequent deployment.
+	GatewayIPs []string
+
+	// EgressIPs are the public IPs of the NAT gateway through which air-gapped gateway nodes egress, if any.
+	EgressIPs []string
+
+	// PublicPorts are the ports opened on the gateway nodes.
+	PublicPorts []api.PortSpec
+
+	// SecurityGroup is the name of the security group associated with the gateway nodes.
+	SecurityGroup string
+}
+
+// postPrepare calls the PostPrepare hook, if any, with the given result.
+func (c *CloudInfo) postPrepare(result PreparedResult, status reporter.Interface) error {
+	if c.PostPrepare == nil {
+		return nil
+	}
+
+	if err := c.PostPrepare(result); err != nil {
+		return status.Error(err, "post-prepare hook failed")
+	}
+
+	return nil
+}
+
+// recordState writes the given summary of the prepared resources to the state ConfigMap, if one is configured,
+// so that in-cluster consumers can read it without querying Azure.
+func (c *CloudInfo) recordState(data map[string]string) error {
+	if c.StateConfigMapName == "" {
+		return nil
+	}
+
+	configMaps, ok := c.K8sClient.(k8s.ConfigMapInterface)
+	if !ok {
+		return errors.Errorf("a K8s client supporting ConfigMaps is required to record the state in ConfigMap %q",
+			c.StateConfigMapName)
+	}
+
+	namespace := c.StateConfigMapNamespace
+	if namespace == "" {
+		namespace = DefaultStateConfigMapNamespace
+	}
+
+	return errors.Wrap(configMaps.UpdateConfigMapData(namespace, c.StateConfigMapName, data),
+		"error recording the prepared state")
+}
+
+// recordLastPrepared tags the internal security group with the current time.
+func (c *CloudInfo) recordLastPrepared(ctx context.Context, nsgClient *armnetwork.SecurityGroupsClient) error {
+	groupName := c.InfraID + internalSecurityGroupSuffix
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
+	if err != nil {
+		return errors.Wrapf(err, "error getting the security group %q", groupName)
+	}
+
+	// UpdateTags replaces all the tags so preserve the existing ones.
+	tags := map[string]*string{}
+	for key, value := range nwSecurityGroup.Tags {
+		tags[key] = value
+	}
+
+	tags[LastPreparedAtTag] = ptr.To(time.Now().UTC().Format(time.RFC3339))
+
+	_, err = nsgClient.UpdateTags(ctx, c.BaseGroupName, groupName, armnetwork.TagsObject{Tags: tags}, nil)
+
+	return errors.Wrapf(err, "error tagging the security group %q", groupName)
+}
+
+// LastPreparedAt returns the time at which the ports were last successfully opened, or the zero time if they never were.
+func (c *CloudInfo) LastPreparedAt(ctx context.Context) (time.Time, error) {
+	groupName := c.InfraID + internalSecurityGroupSuffix
+
+	nsgClient, err := c.getNsgClient()
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "error getting the network security groups client")
+	}
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "error getting the security group %q", groupName)
+	}
+
+	value := nwSecurityGroup.Tags[LastPreparedAtTag]
+	if value == nil {
+		return time.Time{}, nil
+	}
+
+	lastPreparedAt, err := time.Parse(time.RFC3339, *value)
+
+	return lastPreparedAt, errors.Wrapf(err, "error parsing the %q tag of security group %q", LastPreparedAtTag, groupName)
+}
+
+// stampRulesModified tags the given security group, before it's written, with the current time as the time at which its
+// Submariner rules were last modified. Security groups which aren't managed by Submariner are left untagged.
+func stampRulesModified(nwSecurityGroup *armnetwork.SecurityGroup) {
+	if !isManagedSecurityGroup(nwSecurityGroup) {
+		return
+	}
+
+	if nwSecurityGroup.Tags == nil {
+		nwSecurityGroup.Tags = map[string]*string{}
+	}
+
+	nwSecurityGroup.Tags[RulesModifiedAtTag] = ptr.To(time.Now().UTC().Format(time.RFC3339))
+}
+
+// tagSecurityGroup tags the given security group, before it's written, with the infra ID and the configured Tags, and as
+// managed by Submariner if it's created by Submariner. Existing security groups which aren't managed by Submariner are
+// left untagged.
+func (c *CloudInfo) tagSecurityGroup(nwSecurityGroup *armnetwork.SecurityGroup, created bool) {
+	if !created && !isManagedSecurityGroup(nwSecurityGroup) {
+		return
+	}
+
+	if nwSecurityGroup.Tags == nil {
+		nwSecurityGroup.Tags = map[string]*string{}
+	}
+
+	c.addTags(nwSecurityGroup.Tags, created)
+}
+
+// addTags adds the configured Tags and the infra ID to the given tags, and ManagedTag if the resource is created by
+// Submariner.
+func (c *CloudInfo) addTags(tags map[string]*string, managed bool) {
+	for key, value := range c.Tags {
+		tags[key] = value
+	}
+
+	tags[InfraIDTag] = ptr.To(c.InfraID)
+
+	if managed {
+		tags[ManagedTag] = ptr.To("true")
+	}
+}
+
+// isManagedSecurityGroup checks whether the given security group was created by Submariner. Groups created before the
+// ManagedTag was introduced are recognized by holding only Submariner rules.
+func isManagedSecurityGroup(nwSecurityGroup *armnetwork.SecurityGroup) bool {
+	if ptr.Deref(nwSecurityGroup.Tags[ManagedTag], "") == "true" {
+		return true
+	}
+
+	if nwSecurityGroup.Tags[InfraIDTag] != nil || nwSecurityGroup.Properties == nil {
+		return false
+	}
+
+	for _, rule := range nwSecurityGroup.Properties.SecurityRules {
+		if !isSubmarinerSecurityRule(rule) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RulesLastModified returns, for each of the Submariner security groups, the time at which its Submariner rules were last
+// modified. Security groups which don't exist, or whose rules were modified by a version which didn't record the time,
+// are omitted.
+func (c *CloudInfo) RulesLastModified(ctx context.Context) (map[string]time.Time, error) {
+	securityGroups, err := c.getSubmarinerSecurityGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lastModified := map[string]time.Time{}
+
+	for groupName, nwSecurityGroup := range securityGroups {
+		value := nwSecurityGroup.Tags[RulesModifiedAtTag]
+		if value == nil {
+			continue
+		}
+
+		modifiedAt, err := time.Parse(time.RFC3339, *value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing the %q tag of security group %q", RulesModifiedAtTag, groupName)
+		}
+
+		lastModified[groupName] = modifiedAt
+	}
+
+	return lastModified, nil
+}
+
+// SecurityRuleCount is the number of rules in a security group.
+type SecurityRuleCount struct {
+	// Submariner is the number of rules created by Submariner.
+	Submariner int
+
+	// Total is the number of rules in the security group, which is limited to MaxSecurityRules.
+	Total int
+}
+
+// SecurityRuleCounts returns the number of rules in each of the Submariner security groups, e.g. to monitor how close they
+// are to the limit. Security groups which don't exist are omitted.
+func (c *CloudInfo) SecurityRuleCounts(ctx context.Context) (map[string]SecurityRuleCount, error) {
+	securityGroups, err := c.getSubmarinerSecurityGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]SecurityRuleCount{}
+
+	for groupName, nwSecurityGroup := range securityGroups {
+		count := SecurityRuleCount{}
+
+		if nwSecurityGroup.Properties != nil {
+			for _, rule := range nwSecurityGroup.Properties.SecurityRules {
+				if isSubmarinerSecurityRule(rule) {
+					count.Submariner++
+				}
+			}
+
+			count.Total = len(nwSecurityGroup.Properties.SecurityRules)
+		}
+
+		counts[groupName] = count
+	}
+
+	return counts, nil
+}
+
+// getSubmarinerSecurityGroups returns the internal and gateway security groups which exist, keyed by name.
+func (c *CloudInfo) getSubmarinerSecurityGroups(ctx context.Context) (map[string]*armnetwork.SecurityGroup, error) {
+	nsgClient, err := c.getNsgClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the network security groups client")
+	}
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	securityGroups := map[string]*armnetwork.SecurityGroup{}
+
+	for _, groupName := range []string{c.InfraID + internalSecurityGroupSuffix, c.InfraID + externalSecurityGroupSuffix} {
+		nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
+		if isNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting the security group %q", groupName)
+		}
+
+		securityGroups[groupName] = &nwSecurityGroup.SecurityGroup
+	}
+
+	return securityGroups, nil
+}
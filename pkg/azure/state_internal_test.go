@@ -0,0 +1,99 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/submariner-io/cloud-prepare/pkg/api"
+	"github.com/submariner-io/cloud-prepare/pkg/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("recordState", func() {
+	var (
+		kubeClient *kubeFake.Clientset
+		info       *CloudInfo
+	)
+
+	BeforeEach(func() {
+		kubeClient = kubeFake.NewClientset()
+		info = &CloudInfo{
+			InfraID:   "test-infraID",
+			K8sClient: k8s.NewInterface(kubeClient),
+		}
+	})
+
+	recordInternalState := func() {
+		Expect(info.recordState(map[string]string{
+			StateInternalSecurityGroupKey: info.InfraID + internalSecurityGroupSuffix,
+			StateInternalPortsKey:         formatPorts([]api.PortSpec{{Port: 4800, Protocol: "udp"}}),
+		})).To(Succeed())
+	}
+
+	When("no state ConfigMap is configured", func() {
+		It("should not write anything", func() {
+			recordInternalState()
+			Expect(kubeClient.Actions()).To(BeEmpty())
+		})
+	})
+
+	When("a state ConfigMap is configured", func() {
+		BeforeEach(func() {
+			info.StateConfigMapName = "cloud-prepare-state"
+			info.StateConfigMapNamespace = "test-ns"
+		})
+
+		It("should write the expected keys", func() {
+			recordInternalState()
+
+			cm, err := kubeClient.CoreV1().ConfigMaps("test-ns").Get(context.TODO(), "cloud-prepare-state", metav1.GetOptions{})
+			Expect(err).To(Succeed())
+			Expect(cm.Data).To(HaveKeyWithValue(StateInternalSecurityGroupKey, "test-infraID-nsg"))
+			Expect(cm.Data).To(HaveKeyWithValue(StateInternalPortsKey, "4800/udp"))
+		})
+
+		Context("without a K8s client", func() {
+			BeforeEach(func() {
+				info.K8sClient = nil
+			})
+
+			It("should fail validation", func() {
+				Expect(info.validate()).To(MatchError(ContainSubstring("a K8s client supporting ConfigMaps is required")))
+			})
+
+			It("should return an error rather than panic", func() {
+				Expect(info.recordState(map[string]string{StateInternalPortsKey: "4800/udp"})).ToNot(Succeed())
+			})
+		})
+
+		Context("with a K8s client which doesn't support ConfigMaps", func() {
+			BeforeEach(func() {
+				info.K8sClient = struct{ k8s.Interface }{info.K8sClient}
+			})
+
+			It("should fail validation", func() {
+				Expect(info.validate()).To(MatchError(ContainSubstring("a K8s client supporting ConfigMaps is required")))
+			})
+		})
+	})
+})
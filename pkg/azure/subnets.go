@@ -0,0 +1,468 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	"k8s.io/utils/set"
+)
+
+const (
+	vnetSuffix         = "-vnet"
+	workerSubnetSuffix = "-worker-subnet"
+	masterSubnetSuffix = "-master-subnet"
+
+	defaultSubnetNotFoundTimeout = 15 * time.Second
+	defaultSubnetLookupFrequency = 2 * time.Second
+)
+
+var (
+	defaultWorkerRoleLabels       = []string{"node-role.kubernetes.io/worker"}
+	defaultControlPlaneRoleLabels = []string{"node-role.kubernetes.io/control-plane", "node-role.kubernetes.io/master"}
+)
+
+// nsgIncompatibleDelegations are the subnet delegations whose services reject the association of a network security group.
+var nsgIncompatibleDelegations = map[string]bool{
+	"microsoft.netapp/volumes": true,
+}
+
+func (c *CloudInfo) clusterSubnetNames(infraID string) []string {
+	return append(c.workerSubnetNames(infraID), c.masterSubnetName(infraID))
+}
+
+// workerSubnetNames returns the names of the subnets of the worker nodes, the main one first.
+func (c *CloudInfo) workerSubnetNames(infraID string) []string {
+	return append([]string{c.workerSubnetName(infraID)}, c.AdditionalWorkerSubnetNames...)
+}
+
+func (c *CloudInfo) vnetName(infraID string) string {
+	return nameOrDefault(c.VNetName, infraID+vnetSuffix)
+}
+
+func (c *CloudInfo) workerSubnetName(infraID string) string {
+	return nameOrDefault(c.WorkerSubnetName, infraID+workerSubnetSuffix)
+}
+
+func (c *CloudInfo) masterSubnetName(infraID string) string {
+	return nameOrDefault(c.MasterSubnetName, infraID+masterSubnetSuffix)
+}
+
+func nameOrDefault(name, defaultName string) string {
+	if name != "" {
+		return name
+	}
+
+	return defaultName
+}
+
+// validateNamedSubnets checks that the explicitly named cluster subnets exist. Unlike the subnets named after the infra ID,
+// which are skipped if they don't exist, a named subnet which can't be found is most likely a configuration error.
+func (c *CloudInfo) validateNamedSubnets(ctx context.Context, infraID string, subnetClient *armnetwork.SubnetsClient) error {
+	vnetName := c.vnetName(infraID)
+
+	for _, subnetName := range []string{c.WorkerSubnetName, c.MasterSubnetName} {
+		if subnetName == "" {
+			continue
+		}
+
+		_, err := c.getSubnet(ctx, vnetName, subnetName, subnetClient)
+
+		switch {
+		case errors.Is(err, ErrSubnetNotFound):
+			return errors.Wrapf(err, "subnet %q was not found in virtual network %q of resource group %q, check the configured "+
+				"subnet and VNet names", subnetName, vnetName, c.BaseGroupName)
+		case errors.Is(err, ErrAuthFailed):
+			return errors.Wrapf(err, "the credentials can't read subnet %q, check that they're authorized on resource group %q",
+				subnetName, c.BaseGroupName)
+		case err != nil:
+			return errors.Wrapf(err, "error getting the subnet %q", subnetName)
+		}
+	}
+
+	return nil
+}
+
+// skippedSubnet is a cluster subnet with which the internal security group wasn't associated, and why.
+type skippedSubnet struct {
+	name   string
+	reason string
+}
+
+func formatSkippedSubnets(skipped []skippedSubnet) string {
+	skippedStrs := []string{}
+	for _, subnet := range skipped {
+		skippedStrs = append(skippedStrs, fmt.Sprintf("%s (%s)", subnet.name, subnet.reason))
+	}
+
+	return strings.Join(skippedStrs, ", ")
+}
+
+// nodeSubnetNames returns the names of the cluster subnets which host nodes, along with the subnets skipped because they
+// don't. The nodes' roles are discovered using the configured role labels; if there's no K8s client, all the cluster
+// subnets are returned.
+func (c *CloudInfo) nodeSubnetNames(infraID string) ([]string, []skippedSubnet, error) {
+	if c.K8sClient == nil {
+		return c.clusterSubnetNames(infraID), nil, nil
+	}
+
+	roles := []struct {
+		name    string
+		labels  []string
+		subnets []string
+	}{
+		{"worker", labelsOrDefault(c.WorkerRoleLabels, defaultWorkerRoleLabels), c.workerSubnetNames(infraID)},
+		{"control plane", labelsOrDefault(c.ControlPlaneRoleLabels, defaultControlPlaneRoleLabels), []string{c.masterSubnetName(infraID)}},
+	}
+
+	subnetNames := []string{}
+	skipped := []skippedSubnet{}
+
+	for _, role := range roles {
+		found, err := c.hasNodesWithAnyLabel(role.labels)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !found {
+			for _, subnet := range role.subnets {
+				skipped = append(skipped, skippedSubnet{
+					name:   subnet,
+					reason: fmt.Sprintf("no %s nodes with any of the labels %v", role.name, role.labels),
+				})
+			}
+
+			continue
+		}
+
+		subnetNames = append(subnetNames, role.subnets...)
+	}
+
+	return subnetNames, skipped, nil
+}
+
+func (c *CloudInfo) hasNodesWithAnyLabel(labels []string) (bool, error) {
+	for _, label := range labels {
+		nodes, err := c.K8sClient.ListNodesWithLabel(label)
+		if err != nil {
+			return false, errors.Wrapf(err, "error listing the nodes with label %q", label)
+		}
+
+		if len(nodes.Items) > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func labelsOrDefault(labels, defaultLabels []string) []string {
+	if len(labels) > 0 {
+		return labels
+	}
+
+	return defaultLabels
+}
+
+// associateSubnets ensures the given security group is associated with the cluster subnets. Subnets which have no nodes
+// or can't be associated, as determined by associateSubnet, are skipped and returned along with the reason, as are the
+// additional worker subnets which fail. Up to Concurrency subnets are associated at a time; the first failure cancels the
+// remaining associations.
+func (c *CloudInfo) associateSubnets(ctx context.Context, infraID string, nwSecurityGroup *armnetwork.SecurityGroup,
+	subnetClient *armnetwork.SubnetsClient, status reporter.Interface,
+) ([]skippedSubnet, error) {
+	subnetNames, skipped, err := c.nodeSubnetNames(infraID)
+	if err != nil {
+		return nil, err
+	}
+
+	additionalSubnets := set.New(c.AdditionalWorkerSubnetNames...)
+	status = newSyncReporter(status)
+	reasons := make([]string, len(subnetNames))
+
+	err = forEachConcurrently(ctx, len(subnetNames), c.concurrency(), func(ctx context.Context, i int) error {
+		reason, err := c.associateSubnet(ctx, c.vnetName(infraID), subnetNames[i], nwSecurityGroup, subnetClient, status)
+		if err != nil && additionalSubnets.Has(subnetNames[i]) {
+			reason = err.Error()
+		} else if err != nil {
+			return err
+		}
+
+		reasons[i] = reason
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, reason := range reasons {
+		if reason != "" {
+			skipped = append(skipped, skippedSubnet{name: subnetNames[i], reason: reason})
+		}
+	}
+
+	return skipped, nil
+}
+
+// associateSubnet ensures the given security group is associated with the given subnet. If the subnet doesn't exist, is
+// delegated to a service which doesn't support network security groups, is already associated with another security
+// group or is locked, it's left as is and the reason is returned. In a dry run, the association is only reported.
+func (c *CloudInfo) associateSubnet(ctx context.Context, vnetName, subnetName string, nwSecurityGroup *armnetwork.SecurityGroup,
+	subnetClient *armnetwork.SubnetsClient, status reporter.Interface,
+) (string, error) {
+	if nwSecurityGroup.ID == nil {
+		return "", errors.Errorf("the security group %q has no ID", ptr.Deref(nwSecurityGroup.Name, ""))
+	}
+
+	groupName := ptr.Deref(nwSecurityGroup.Name, *nwSecurityGroup.ID)
+
+	resp, err := c.getSubnet(ctx, vnetName, subnetName, subnetClient)
+	if isNotFound(err) {
+		return fmt.Sprintf("not found in virtual network %q", vnetName), nil
+	}
+
+	if err != nil {
+		return "", errors.Wrapf(err, "error getting the subnet %q", subnetName)
+	}
+
+	subnet := resp.Subnet
+	if subnet.Properties == nil {
+		subnet.Properties = &armnetwork.SubnetPropertiesFormat{}
+	}
+
+	if delegation := incompatibleDelegation(subnet.Properties.Delegations); delegation != "" {
+		return fmt.Sprintf("delegated to %q which doesn't support network security groups", delegation), nil
+	}
+
+	if existing := subnet.Properties.NetworkSecurityGroup; existing != nil && existing.ID != nil {
+		if !strings.EqualFold(*existing.ID, *nwSecurityGroup.ID) {
+			return fmt.Sprintf("already associated with security group %q", *existing.ID), nil
+		}
+
+		return "", nil
+	}
+
+	if c.DryRun {
+		status.Success("Would associate security group %q with subnet %q", groupName, subnetName)
+		return "", nil
+	}
+
+	subnet.Properties.NetworkSecurityGroup = &armnetwork.SecurityGroup{ID: nwSecurityGroup.ID}
+
+	poller, err := subnetClient.BeginCreateOrUpdate(ctx, c.BaseGroupName, vnetName, subnetName, subnet, nil)
+	if err == nil {
+		_, err = pollUntilDone(ctx, poller, c.pollOptions())
+	}
+
+	if isScopeLocked(err) {
+		return "locked by a management lock", nil
+	}
+
+	return "", errors.Wrapf(err, "error associating security group %q with subnet %q", groupName, subnetName)
+}
+
+// getSubnet gets the given subnet, looking it up again if it isn't found until the SubnetNotFoundTimeout elapses, to
+// tolerate the eventual consistency of Azure right after the cluster's network is created. Errors caused by a missing
+// subnet or by the credentials not being authorized are classified as ErrSubnetNotFound or ErrAuthFailed respectively.
+func (c *CloudInfo) getSubnet(ctx context.Context, vnetName, subnetName string, subnetClient *armnetwork.SubnetsClient,
+) (armnetwork.SubnetsClientGetResponse, error) {
+	frequency := c.subnetLookupFrequency
+	if frequency <= 0 {
+		frequency = defaultSubnetLookupFrequency
+	}
+
+	deadline := time.Now().Add(c.subnetNotFoundTimeout())
+
+	for {
+		resp, err := subnetClient.Get(ctx, c.BaseGroupName, vnetName, subnetName, nil)
+		if !isNotFound(err) || time.Now().Add(frequency).After(deadline) {
+			return resp, classifySubnetError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return resp, classifySubnetError(err)
+		case <-time.After(frequency):
+		}
+	}
+}
+
+// classifySubnetError adds ErrSubnetNotFound or ErrAuthFailed to the given error, if either applies, keeping the Azure
+// error so that it can still be inspected.
+func classifySubnetError(err error) error {
+	switch CategorizeError(err) {
+	case ErrorCategoryNotFound:
+		return fmt.Errorf("%w: %w", ErrSubnetNotFound, err)
+	case ErrorCategoryUnauthorized:
+		return fmt.Errorf("%w: %w", ErrAuthFailed, err)
+	default:
+		return err //nolint:wrapcheck // Let the caller wrap it.
+	}
+}
+
+// gatewaySubnet is a subnet dedicated to gateway nodes, i.e. a subnet hosting gateway nodes other than the cluster subnets.
+type gatewaySubnet struct {
+	vnetName        string
+	name            string
+	addressPrefixes []string
+}
+
+// gatewaySubnets discovers the subnets dedicated to the given gateway nodes, from the primary IP configuration of their
+// interfaces. Subnets in other resource groups aren't considered.
+func (c *CloudInfo) gatewaySubnets(ctx context.Context, gwNodes []corev1.Node) ([]gatewaySubnet, error) {
+	if len(gwNodes) == 0 {
+		return nil, nil
+	}
+
+	nwClient, err := c.getInterfacesClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the interfaces client")
+	}
+
+	subnetClient, err := c.getSubnetsClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the subnets client")
+	}
+
+	clusterSubnets := set.New(c.clusterSubnetNames(c.InfraID)...)
+	seen := set.New[string]()
+	subnets := []gatewaySubnet{}
+
+	for i := range gwNodes {
+		interfaceName := gwNodes[i].Name + "-nic"
+
+		nwInterface, err := nwClient.Get(ctx, c.BaseGroupName, interfaceName, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting the interface %q", interfaceName)
+		}
+
+		id := primarySubnetID(&nwInterface.Interface)
+		if id == nil || !strings.EqualFold(id.ResourceGroupName, c.BaseGroupName) || clusterSubnets.Has(id.Name) ||
+			seen.Has(strings.ToLower(id.String())) {
+			continue
+		}
+
+		seen.Insert(strings.ToLower(id.String()))
+
+		subnet, err := subnetClient.Get(ctx, c.BaseGroupName, id.Parent.Name, id.Name, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting the gateway subnet %q", id.Name)
+		}
+
+		gwSubnet := gatewaySubnet{vnetName: id.Parent.Name, name: id.Name}
+
+		if subnet.Properties != nil {
+			if subnet.Properties.AddressPrefix != nil {
+				gwSubnet.addressPrefixes = append(gwSubnet.addressPrefixes, *subnet.Properties.AddressPrefix)
+			}
+
+			for _, prefix := range subnet.Properties.AddressPrefixes {
+				gwSubnet.addressPrefixes = append(gwSubnet.addressPrefixes, ptr.Deref(prefix, ""))
+			}
+		}
+
+		subnets = append(subnets, gwSubnet)
+	}
+
+	return subnets, nil
+}
+
+func primarySubnetID(nwInterface *armnetwork.Interface) *arm.ResourceID {
+	if nwInterface.Properties == nil {
+		return nil
+	}
+
+	for _, ipConfig := range nwInterface.Properties.IPConfigurations {
+		if ipConfig.Properties == nil || !ptr.Deref(ipConfig.Properties.Primary, false) || ipConfig.Properties.Subnet == nil {
+			continue
+		}
+
+		id, err := arm.ParseResourceID(ptr.Deref(ipConfig.Properties.Subnet.ID, ""))
+		if err != nil {
+			return nil
+		}
+
+		return id
+	}
+
+	return nil
+}
+
+// associateGatewaySubnets associates the given gateway security group with the subnets dedicated to the given gateway
+// nodes, if any and if AssociateSubnets is set, warning about those which can't be associated.
+func (c *CloudInfo) associateGatewaySubnets(ctx context.Context, groupName string, gwNodes []corev1.Node,
+	nsgClient *armnetwork.SecurityGroupsClient, status reporter.Interface,
+) error {
+	if !c.AssociateSubnets {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.resourceTimeout())
+	defer cancel()
+
+	gwSubnets, err := c.gatewaySubnets(ctx, gwNodes)
+	if err != nil || len(gwSubnets) == 0 {
+		return err
+	}
+
+	nwSecurityGroup, err := nsgClient.Get(ctx, c.BaseGroupName, groupName, nil)
+	if err != nil {
+		return errors.Wrapf(err, "error getting the security group %q", groupName)
+	}
+
+	subnetClient, err := c.getSubnetsClient()
+	if err != nil {
+		return errors.Wrap(err, "error getting the subnets client")
+	}
+
+	for _, gwSubnet := range gwSubnets {
+		reason, err := c.associateSubnet(ctx, gwSubnet.vnetName, gwSubnet.name, &nwSecurityGroup.SecurityGroup, subnetClient,
+			status)
+		if err != nil {
+			return err
+		}
+
+		if reason != "" {
+			status.Warning("The gateway security group wasn't associated with gateway subnet %q: %s", gwSubnet.name, reason)
+		}
+	}
+
+	return nil
+}
+
+func incompatibleDelegation(delegations []*armnetwork.Delegation) string {
+	for _, delegation := range delegations {
+		if delegation.Properties != nil && delegation.Properties.ServiceName != nil &&
+			nsgIncompatibleDelegations[strings.ToLower(*delegation.Properties.ServiceName)] {
+			return *delegation.Properties.ServiceName
+		}
+	}
+
+	return ""
+}
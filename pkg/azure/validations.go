@@ -0,0 +1,382 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/pkg/errors"
+	"github.com/submariner-io/admiral/pkg/reporter"
+	"github.com/submariner-io/cloud-prepare/pkg/k8s"
+	"k8s.io/utils/ptr"
+	"k8s.io/utils/set"
+)
+
+const (
+	// MaxSecurityRules is the maximum number of rules Azure allows in a network security group.
+	MaxSecurityRules = 1000
+
+	// securityRulesWarningThreshold is the number of rules in a security group above which a warning is reported.
+	securityRulesWarningThreshold = MaxSecurityRules * 9 / 10
+
+	armModuleName            = "github.com/submariner-io/cloud-prepare/pkg/azure"
+	armModuleVersion         = "v0.0.0"
+	locationsAPIVersion      = "2022-12-01"
+	resourceGroupsAPIVersion = "2021-04-01"
+	permissionsAPIVersion    = "2022-04-01"
+
+	// nsgWriteAction and subnetWriteAction are the actions needed to create the security groups and, if AssociateSubnets
+	// is set, associate them with the subnets.
+	nsgWriteAction    = "Microsoft.Network/networkSecurityGroups/write"
+	subnetWriteAction = "Microsoft.Network/virtualNetworks/subnets/write"
+)
+
+// ruleOwnerPattern limits the rule owner so that the rule names remain valid and within Azure's 80 character limit.
+var ruleOwnerPattern = regexp.MustCompile(`^[A-Za-z0-9]{1,20}$`)
+
+// serviceTags are the Azure service tags that may be used as the source of the internal security rules. Regional
+// variants, e.g. "AzureCloud.eastus", are also accepted.
+var serviceTags = map[string]bool{
+	"ApiManagement":       true,
+	"AzureCloud":          true,
+	"AzureLoadBalancer":   true,
+	"AzureTrafficManager": true,
+	"GatewayManager":      true,
+	"Internet":            true,
+	"Storage":             true,
+	"VirtualNetwork":      true,
+}
+
+// maxSecurityRuleNameLength is the maximum length of a security rule name allowed by Azure.
+const maxSecurityRuleNameLength = 80
+
+// validateSecurityRules checks that the given security rules don't exceed the maximum number of rules in a security group,
+// that their names are unique and short enough and that their priorities are unique per direction, as Azure requires.
+func validateSecurityRules(securityRules []*armnetwork.SecurityRule) error {
+	if len(securityRules) > MaxSecurityRules {
+		return errors.Errorf("%d security rules exceed the maximum of %d per security group", len(securityRules), MaxSecurityRules)
+	}
+
+	names := map[string]bool{}
+	priorities := map[string]string{}
+
+	for _, rule := range securityRules {
+		name := ptr.Deref(rule.Name, "")
+		if len(name) > maxSecurityRuleNameLength {
+			return errors.Errorf("security rule name %q exceeds the maximum length of %d", name, maxSecurityRuleNameLength)
+		}
+
+		if names[strings.ToLower(name)] {
+			return errors.Errorf("duplicate security rule name %q", name)
+		}
+
+		names[strings.ToLower(name)] = true
+
+		if rule.Properties == nil || rule.Properties.Priority == nil || rule.Properties.Direction == nil {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%d", *rule.Properties.Direction, *rule.Properties.Priority)
+		if other, found := priorities[key]; found {
+			return errors.Errorf("security rules %q and %q have the same %s priority %d", other, name,
+				*rule.Properties.Direction, *rule.Properties.Priority)
+		}
+
+		priorities[key] = name
+	}
+
+	return nil
+}
+
+func validateServiceTag(tag string) error {
+	name, _, _ := strings.Cut(tag, ".")
+	if !serviceTags[name] {
+		return errors.Errorf("%q is not a supported Azure service tag", tag)
+	}
+
+	return nil
+}
+
+func (c *CloudInfo) validate() error {
+	if c.InternalSourceServiceTag != "" {
+		if err := validateServiceTag(c.InternalSourceServiceTag); err != nil {
+			return errors.Wrap(err, "invalid internal source service tag")
+		}
+	}
+
+	if _, ok := c.K8sClient.(k8s.ConfigMapInterface); c.StateConfigMapName != "" && !ok {
+		return errors.Errorf("a K8s client supporting ConfigMaps is required to record the state in ConfigMap %q",
+			c.StateConfigMapName)
+	}
+
+	if c.RuleOwner != "" && !ruleOwnerPattern.MatchString(c.RuleOwner) {
+		return errors.Errorf("rule owner %q must be alphanumeric and at most 20 characters long", c.RuleOwner)
+	}
+
+	for _, family := range c.IPFamilies {
+		if family != ipFamilyIPv4 && family != ipFamilyIPv6 {
+			return errors.Errorf("IP family %q must be %q or %q", family, ipFamilyIPv4, ipFamilyIPv6)
+		}
+	}
+
+	return nil
+}
+
+// validateRegion checks that the configured region is available for the subscription, and supports the configured public IP
+// zones, so that a mistyped or disabled region is reported clearly instead of causing confusing failures later. Since
+// listing the locations requires access to the subscription, the check is skipped with a warning if the credentials are
+// only authorized on the resource group.
+func (c *CloudInfo) validateRegion(ctx context.Context, status reporter.Interface) error {
+	if c.Region == "" {
+		return nil
+	}
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	locations := struct {
+		Value []struct {
+			Name                     *string `json:"name"`
+			AvailabilityZoneMappings []struct {
+				LogicalZone *string `json:"logicalZone"`
+			} `json:"availabilityZoneMappings"`
+		} `json:"value"`
+	}{}
+
+	err := c.armGet(ctx, "/locations", locationsAPIVersion, &locations)
+	if CategorizeError(err) == ErrorCategoryUnauthorized {
+		status.Warning("Unable to list the locations of subscription %q, so region %q can't be validated: %v", c.SubscriptionID,
+			c.Region, err)
+
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "error listing the locations of subscription %q", c.SubscriptionID)
+	}
+
+	for _, location := range locations.Value {
+		if location.Name == nil || !strings.EqualFold(*location.Name, c.Region) {
+			continue
+		}
+
+		zones := set.New[string]()
+		for _, mapping := range location.AvailabilityZoneMappings {
+			if mapping.LogicalZone != nil {
+				zones.Insert(*mapping.LogicalZone)
+			}
+		}
+
+		for _, zone := range c.PublicIPZones {
+			if !zones.Has(zone) {
+				return errors.Errorf("region %q does not support availability zone %q", c.Region, zone)
+			}
+		}
+
+		return nil
+	}
+
+	return errors.Errorf("region %q is not available for subscription %q", c.Region, c.SubscriptionID)
+}
+
+// armGet gets the given path, relative to the subscription, from the Azure Resource Manager with the given API version,
+// reading the JSON response into result unless it's nil. Azure errors are returned as is so that they can be inspected.
+func (c *CloudInfo) armGet(ctx context.Context, path, apiVersion string, result any) error {
+	client, err := arm.NewClient(armModuleName, armModuleVersion, c.TokenCredential, c.armClientOptions())
+	if err != nil {
+		return errors.Wrap(err, "error creating the Azure client")
+	}
+
+	req, err := runtime.NewRequest(ctx, http.MethodGet,
+		runtime.JoinPaths(client.Endpoint(), "/subscriptions/"+url.PathEscape(c.SubscriptionID)+path))
+	if err != nil {
+		return errors.Wrap(err, "error creating the request")
+	}
+
+	query := req.Raw().URL.Query()
+	query.Set("api-version", apiVersion)
+	req.Raw().URL.RawQuery = query.Encode()
+
+	resp, err := client.Pipeline().Do(req)
+	if err != nil {
+		return err //nolint:wrapcheck // Let the caller wrap it.
+	}
+
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return runtime.NewResponseError(resp) //nolint:wrapcheck // Let the caller wrap it.
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return errors.Wrap(runtime.UnmarshalAsJSON(resp, result), "error reading the response")
+}
+
+// checkPrerequisites runs the read-only checks of Validate and returns the errors of all the failed checks. The checks
+// which depend on a failed one, such as those of the resources in a missing resource group, are skipped.
+func (c *CloudInfo) checkPrerequisites(ctx context.Context, infraID string, status reporter.Interface) []error {
+	errs := []error{}
+
+	if err := c.validate(); err != nil {
+		errs = append(errs, errors.Wrap(err, "invalid Azure configuration"))
+	}
+
+	if err := k8s.CheckReachable(c.K8sClient); err != nil {
+		errs = append(errs, errors.Wrap(err, "invalid cluster configuration"))
+	}
+
+	if err := c.validateRegion(ctx, status); err != nil {
+		errs = append(errs, errors.Wrap(err, "invalid Azure region"))
+	}
+
+	err := c.armGet(ctx, "/resourceGroups/"+url.PathEscape(c.BaseGroupName), resourceGroupsAPIVersion, nil)
+	if isNotFound(err) {
+		return append(errs, errors.Wrapf(err, "resource group %q doesn't exist in subscription %q", c.BaseGroupName,
+			c.SubscriptionID))
+	}
+
+	if err != nil {
+		return append(errs, errors.Wrapf(err, "error getting the resource group %q", c.BaseGroupName))
+	}
+
+	errs = append(errs, c.checkNetwork(ctx, infraID, status)...)
+
+	actions := []string{nsgWriteAction}
+	if c.AssociateSubnets {
+		actions = append(actions, subnetWriteAction)
+	}
+
+	if err := c.checkPermissions(ctx, actions...); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// checkNetwork checks that the cluster virtual network and the explicitly named subnets exist. The missing subnets named
+// after the infra ID, and the missing additional worker subnets, are only reported as warnings since they're skipped when
+// opening the ports.
+func (c *CloudInfo) checkNetwork(ctx context.Context, infraID string, status reporter.Interface) []error {
+	vnetClient, err := c.getVirtualNetworksClient()
+	if err != nil {
+		return []error{errors.Wrap(err, "failed to get virtual networks client")}
+	}
+
+	vnetName := c.vnetName(infraID)
+
+	_, err = vnetClient.Get(ctx, c.BaseGroupName, vnetName, nil)
+	if isNotFound(err) {
+		return []error{errors.Wrapf(err, "virtual network %q doesn't exist in resource group %q", vnetName, c.BaseGroupName)}
+	}
+
+	if err != nil {
+		return []error{errors.Wrapf(err, "error getting the virtual network %q", vnetName)}
+	}
+
+	subnetClient, err := c.getSubnetsClient()
+	if err != nil {
+		return []error{errors.Wrap(err, "failed to get subnets client")}
+	}
+
+	errs := []error{}
+
+	if err := c.validateNamedSubnets(ctx, infraID, subnetClient); err != nil {
+		errs = append(errs, err)
+	}
+
+	namedSubnets := set.New(c.WorkerSubnetName, c.MasterSubnetName)
+
+	for _, subnetName := range c.clusterSubnetNames(infraID) {
+		if namedSubnets.Has(subnetName) {
+			continue
+		}
+
+		_, err := subnetClient.Get(ctx, c.BaseGroupName, vnetName, subnetName, nil)
+		if isNotFound(err) {
+			status.Warning("Subnet %q doesn't exist in virtual network %q, it will be skipped", subnetName, vnetName)
+		} else if err != nil {
+			errs = append(errs, errors.Wrapf(err, "error getting the subnet %q", subnetName))
+		}
+	}
+
+	return errs
+}
+
+// checkPermissions checks that the credentials are allowed to perform the given actions on the resource group. Azure
+// has no dry run of resource changes, so this relies on the permissions it reports for the caller instead.
+func (c *CloudInfo) checkPermissions(ctx context.Context, actions ...string) error {
+	permissions := struct {
+		Value []struct {
+			Actions    []string `json:"actions"`
+			NotActions []string `json:"notActions"`
+		} `json:"value"`
+	}{}
+
+	err := c.armGet(ctx, "/resourceGroups/"+url.PathEscape(c.BaseGroupName)+"/providers/Microsoft.Authorization/permissions",
+		permissionsAPIVersion, &permissions)
+	if err != nil {
+		return errors.Wrapf(err, "error reading the permissions on resource group %q", c.BaseGroupName)
+	}
+
+	missing := []string{}
+
+	for _, action := range actions {
+		allowed := false
+
+		for _, permission := range permissions.Value {
+			if matchesAnyAction(permission.Actions, action) && !matchesAnyAction(permission.NotActions, action) {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			missing = append(missing, action)
+		}
+	}
+
+	if len(missing) > 0 {
+		return errors.Errorf("the credentials aren't allowed to perform %s on resource group %q", strings.Join(missing, ", "),
+			c.BaseGroupName)
+	}
+
+	return nil
+}
+
+// matchesAnyAction checks whether the given action matches any of the given Azure action patterns, in which "*" matches
+// any characters. Actions are case-insensitive.
+func matchesAnyAction(patterns []string, action string) bool {
+	for _, pattern := range patterns {
+		expr := "(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+		if matched, err := regexp.MatchString(expr, action); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,42 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/pkg/errors"
+)
+
+// NewWorkloadIdentityCredential returns a credential, to set with WithTokenCredential, which exchanges the projected
+// service account token in the given file for Azure tokens, as configured by Azure Workload Identity. Empty arguments
+// default to the environment variables set by the Workload Identity webhook. The exchange, the rotation of the service
+// account token and the refresh of the Azure tokens are handled by azidentity.NewWorkloadIdentityCredential.
+func NewWorkloadIdentityCredential(tenantID, clientID, tokenFilePath string) (azcore.TokenCredential, error) {
+	credential, err := azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+		TenantID:      tenantID,
+		ClientID:      clientID,
+		TokenFilePath: tokenFilePath,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating the workload identity credential")
+	}
+
+	return credential, nil
+}
@@ -0,0 +1,64 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+
+Copyright Contributors to the Submariner project.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NewWorkloadIdentityCredential", func() {
+	var tokenFilePath string
+
+	BeforeEach(func() {
+		tokenFilePath = filepath.Join(GinkgoT().TempDir(), "token")
+		Expect(os.WriteFile(tokenFilePath, []byte("service-account-token\n"), 0o600)).To(Succeed())
+	})
+
+	It("should return an Azure Workload Identity credential", func() {
+		credential, err := NewWorkloadIdentityCredential("test-tenant", "test-client", tokenFilePath)
+		Expect(err).To(Succeed())
+		Expect(credential).To(BeAssignableToTypeOf(&azidentity.WorkloadIdentityCredential{}))
+	})
+
+	When("the arguments are empty", func() {
+		It("should use the environment variables", func() {
+			GinkgoT().Setenv("AZURE_TENANT_ID", "env-tenant")
+			GinkgoT().Setenv("AZURE_CLIENT_ID", "env-client")
+			GinkgoT().Setenv("AZURE_FEDERATED_TOKEN_FILE", tokenFilePath)
+
+			_, err := NewWorkloadIdentityCredential("", "", "")
+			Expect(err).To(Succeed())
+		})
+	})
+
+	When("no tenant ID is given or set in the environment", func() {
+		It("should return an error", func() {
+			GinkgoT().Setenv("AZURE_TENANT_ID", "")
+			Expect(os.Unsetenv("AZURE_TENANT_ID")).To(Succeed())
+
+			_, err := NewWorkloadIdentityCredential("", "test-client", tokenFilePath)
+			Expect(err).To(MatchError(ContainSubstring("no tenant ID specified")))
+		})
+	})
+})
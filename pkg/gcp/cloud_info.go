@@ -19,6 +19,8 @@ limitations under the License.
 package gcp
 
 import (
+	"fmt"
+
 	"github.com/pkg/errors"
 	"github.com/submariner-io/admiral/pkg/reporter"
 	gcpclient "github.com/submariner-io/cloud-prepare/pkg/gcp/client"
@@ -30,6 +32,22 @@ type CloudInfo struct {
 	Region    string
 	ProjectID string
 	Client    gcpclient.Interface
+
+	// NetworkName is the name of the cluster's VPC network, on which the firewall rules are created. If not set,
+	// the OpenShift installer's "{InfraID}-network" is used.
+	NetworkName string
+}
+
+func (c *CloudInfo) networkName() string {
+	if c.NetworkName != "" {
+		return c.NetworkName
+	}
+
+	return c.InfraID + "-network"
+}
+
+func (c *CloudInfo) networkURL() string {
+	return fmt.Sprintf("projects/%s/global/networks/%s", c.ProjectID, c.networkName())
 }
 
 // Open expected ports by creating related firewall rule.
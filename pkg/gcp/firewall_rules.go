@@ -33,13 +33,13 @@ const (
 	submarinerGatewayNodeTag = "submariner-io-gateway-node"
 )
 
-func newExternalFirewallRules(projectID, infraID string, ports []api.PortSpec) *compute.Firewall {
+func newExternalFirewallRules(network, infraID string, ports []api.PortSpec) *compute.Firewall {
 	ingressName := generateRuleName(infraID, publicPortsRuleName)
 
 	// We want the external firewall rules to be applied only to Gateway nodes. So, we use the TargetTags
 	// field and include submarinerGatewayNodeTag for selection of Gateway nodes. All the Submariner Gateway
 	// instances will be tagged with submarinerGatewayNodeTag.
-	ingressRule := newFirewallRule(projectID, infraID, ingressName, ingressDirection, ports)
+	ingressRule := newFirewallRule(network, ingressName, ingressDirection, ports)
 	ingressRule.TargetTags = []string{
 		submarinerGatewayNodeTag,
 	}
@@ -47,10 +47,10 @@ func newExternalFirewallRules(projectID, infraID string, ports []api.PortSpec) *
 	return ingressRule
 }
 
-func newInternalFirewallRule(projectID, infraID string, ports []api.PortSpec) *compute.Firewall {
+func newInternalFirewallRule(network, infraID string, ports []api.PortSpec) *compute.Firewall {
 	ingressName := generateRuleName(infraID, internalPortsRuleName)
 
-	rule := newFirewallRule(projectID, infraID, ingressName, ingressDirection, ports)
+	rule := newFirewallRule(network, ingressName, ingressDirection, ports)
 	rule.TargetTags = []string{
 		infraID + "-worker",
 		infraID + "-master",
@@ -63,15 +63,18 @@ func newInternalFirewallRule(projectID, infraID string, ports []api.PortSpec) *c
 	return rule
 }
 
-func newFirewallRule(projectID, infraID, name, direction string, ports []api.PortSpec) *compute.Firewall {
+func newFirewallRule(network, name, direction string, ports []api.PortSpec) *compute.Firewall {
 	allowedPorts := []*compute.FirewallAllowed{}
 
 	for _, port := range ports {
 		fwRule := &compute.FirewallAllowed{
-			IPProtocol: port.Protocol,
+			IPProtocol: api.IPProtocol(port.Protocol),
 		}
-		if port.Port != 0 {
+		if port.Port != 0 && api.UsesPorts(port.Protocol) {
 			fwRule.Ports = []string{strconv.Itoa(int(port.Port))}
+			if port.IsRange() {
+				fwRule.Ports[0] += "-" + strconv.Itoa(int(port.EndPort))
+			}
 		}
 
 		allowedPorts = append(allowedPorts, fwRule)
@@ -79,7 +82,7 @@ func newFirewallRule(projectID, infraID, name, direction string, ports []api.Por
 
 	return &compute.Firewall{
 		Name:      name,
-		Network:   fmt.Sprintf("projects/%s/global/networks/%s-network", projectID, infraID),
+		Network:   network,
 		Direction: direction,
 		Allowed:   allowedPorts,
 	}
@@ -19,11 +19,14 @@ limitations under the License.
 package gcp
 
 import (
-	"fmt"
+	"context"
 	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/submariner-io/admiral/pkg/reporter"
 	"github.com/submariner-io/cloud-prepare/pkg/api"
+	gcpclient "github.com/submariner-io/cloud-prepare/pkg/gcp/client"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 type gcpCloud struct {
@@ -35,12 +38,23 @@ func NewCloud(info CloudInfo) api.Cloud {
 	return &gcpCloud{CloudInfo: info}
 }
 
-func (gc *gcpCloud) OpenPorts(ports []api.PortSpec, status reporter.Interface) error {
+func (gc *gcpCloud) OpenPorts(ctx context.Context, ports []api.PortSpec, status reporter.Interface) error {
+	ports, err := api.NormalizePorts(ports)
+	if err != nil {
+		return errors.Wrap(err, "invalid ports")
+	}
+
+	api.SetTotalSteps(status, 1)
+
 	// Create the inbound firewall rule for submariner internal ports.
 	status.Start("Opening internal ports %q for intra-cluster communications on GCP", formatPorts(ports))
 	defer status.End()
 
-	internalIngress := newInternalFirewallRule(gc.ProjectID, gc.InfraID, ports)
+	if err := ctx.Err(); err != nil {
+		return status.Error(err, "unable to open ports")
+	}
+
+	internalIngress := newInternalFirewallRule(gc.networkURL(), gc.InfraID, ports)
 	if err := gc.openPorts(internalIngress); err != nil {
 		return status.Error(err, "unable to open ports")
 	}
@@ -51,17 +65,53 @@ func (gc *gcpCloud) OpenPorts(ports []api.PortSpec, status reporter.Interface) e
 	return nil
 }
 
-func (gc *gcpCloud) ClosePorts(status reporter.Interface) error {
+func (gc *gcpCloud) ClosePorts(ctx context.Context, status reporter.Interface) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "unable to close ports")
+	}
+
 	// Delete the inbound and outbound firewall rules to close submariner internal ports.
 	internalIngressName := generateRuleName(gc.InfraID, internalPortsRuleName)
 
 	return gc.deleteFirewallRule(internalIngressName, status)
 }
 
+func (gc *gcpCloud) Validate(ctx context.Context, status reporter.Interface) error {
+	api.SetTotalSteps(status, 1)
+
+	status.Start("Validating the GCP prerequisites")
+	defer status.End()
+
+	if err := ctx.Err(); err != nil {
+		return status.Error(err, "unable to validate the prerequisites")
+	}
+
+	errs := []error{}
+
+	// Listing the zones checks both the credentials and the project.
+	if _, err := gc.Client.ListZones(); err != nil {
+		errs = append(errs, errors.Wrapf(err, "unable to list the zones of project %q", gc.ProjectID))
+	}
+
+	internalIngressName := generateRuleName(gc.InfraID, internalPortsRuleName)
+
+	if _, err := gc.Client.GetFirewallRule(gc.ProjectID, internalIngressName); err != nil && !gcpclient.IsGCPNotFoundError(err) {
+		errs = append(errs, errors.Wrapf(err, "unable to read the firewall rule %q", internalIngressName))
+	}
+
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		return status.Error(err, "the GCP prerequisites aren't met")
+	}
+
+	status.Success("Validated the GCP prerequisites")
+
+	return nil
+}
+
 func formatPorts(ports []api.PortSpec) string {
 	portStrs := []string{}
 	for _, port := range ports {
-		portStrs = append(portStrs, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+		portStrs = append(portStrs, port.String())
 	}
 
 	return strings.Join(portStrs, ", ")
@@ -19,6 +19,7 @@ limitations under the License.
 package gcp_test
 
 import (
+	"context"
 	"errors"
 	"net/http"
 
@@ -37,15 +38,19 @@ const ingressRuleName = "test-infraID-submariner-internal-ports-ingress"
 var _ = Describe("Cloud", func() {
 	Describe("OpenPorts", testOpenPorts)
 	Describe("ClosePorts", testClosePorts)
+	Describe("Validate", testValidate)
 })
 
 func testOpenPorts() {
 	t := newCloudTestDriver()
 
-	var retError error
+	var (
+		ports    []api.PortSpec
+		retError error
+	)
 
-	JustBeforeEach(func() {
-		retError = t.cloud.OpenPorts([]api.PortSpec{
+	BeforeEach(func() {
+		ports = []api.PortSpec{
 			{
 				Port:     100,
 				Protocol: "TCP",
@@ -54,7 +59,11 @@ func testOpenPorts() {
 				Port:     200,
 				Protocol: "UDP",
 			},
-		}, reporter.Stdout())
+		}
+	})
+
+	JustBeforeEach(func() {
+		retError = t.cloud.OpenPorts(context.TODO(), ports, reporter.Stdout())
 	})
 
 	When("the firewall rule doesn't exist", func() {
@@ -80,6 +89,88 @@ func testOpenPorts() {
 			})
 		})
 
+		Context("and a network name is specified", func() {
+			var actualRule *compute.Firewall
+
+			BeforeEach(func() {
+				t.networkName = "shared-vpc"
+
+				t.gcpClient.EXPECT().InsertFirewallRule(projectID, mock.Anything).RunAndReturn(func(_ string, rule *compute.Firewall) error {
+					actualRule = rule
+					return nil
+				})
+			})
+
+			It("should create the rule on that network", func() {
+				Expect(retError).To(Succeed())
+
+				Expect(actualRule).ToNot(BeNil(), "InsertFirewallRule was not called")
+				Expect(actualRule.Network).To(Equal("projects/" + projectID + "/global/networks/shared-vpc"))
+			})
+		})
+
+		Context("and a port range is requested", func() {
+			var actualRule *compute.Firewall
+
+			BeforeEach(func() {
+				ports = append(ports, api.PortSpec{Port: 4500, EndPort: 4510, Protocol: "UDP"})
+
+				t.gcpClient.EXPECT().InsertFirewallRule(projectID, mock.Anything).RunAndReturn(func(_ string, rule *compute.Firewall) error {
+					actualRule = rule
+					return nil
+				})
+			})
+
+			It("should allow the range", func() {
+				Expect(retError).To(Succeed())
+
+				Expect(actualRule).ToNot(BeNil(), "InsertFirewallRule was not called")
+				Expect(actualRule.Allowed).To(HaveLen(3))
+				Expect(actualRule.Allowed[2]).To(Equal(&compute.FirewallAllowed{IPProtocol: "udp", Ports: []string{"4500-4510"}}))
+			})
+		})
+
+		Context("and an ESP port is requested", func() {
+			var actualRule *compute.Firewall
+
+			BeforeEach(func() {
+				ports = append(ports, api.PortSpec{Port: 4500, Protocol: "esp"})
+
+				t.gcpClient.EXPECT().InsertFirewallRule(projectID, mock.Anything).RunAndReturn(func(_ string, rule *compute.Firewall) error {
+					actualRule = rule
+					return nil
+				})
+			})
+
+			It("should allow IP protocol 50 without ports", func() {
+				Expect(retError).To(Succeed())
+
+				Expect(actualRule).ToNot(BeNil(), "InsertFirewallRule was not called")
+				Expect(actualRule.Allowed).To(HaveLen(3))
+				Expect(actualRule.Allowed[0]).To(Equal(&compute.FirewallAllowed{IPProtocol: "50"}))
+			})
+		})
+
+		Context("and the ports are requested in a different order", func() {
+			var actualRule *compute.Firewall
+
+			BeforeEach(func() {
+				ports = []api.PortSpec{ports[1], ports[0]}
+
+				t.gcpClient.EXPECT().InsertFirewallRule(projectID, mock.Anything).RunAndReturn(func(_ string, rule *compute.Firewall) error {
+					actualRule = rule
+					return nil
+				})
+			})
+
+			It("should insert the same rule", func() {
+				Expect(retError).To(Succeed())
+
+				Expect(actualRule).ToNot(BeNil(), "InsertFirewallRule was not called")
+				assertIngressRule(actualRule)
+			})
+		})
+
 		Context("and insertion fails", func() {
 			BeforeEach(func() {
 				t.gcpClient.EXPECT().InsertFirewallRule(projectID, mock.Anything).Return(errors.New("fake insert error"))
@@ -145,7 +236,7 @@ func testClosePorts() {
 	var retError error
 
 	JustBeforeEach(func() {
-		retError = t.cloud.ClosePorts(reporter.Stdout())
+		retError = t.cloud.ClosePorts(context.TODO(), reporter.Stdout())
 	})
 
 	Context("on success", func() {
@@ -179,9 +270,43 @@ func testClosePorts() {
 	})
 }
 
+func testValidate() {
+	t := newCloudTestDriver()
+
+	var retError error
+
+	JustBeforeEach(func() {
+		retError = t.cloud.Validate(context.TODO(), reporter.Stdout())
+	})
+
+	When("the project and the firewall rules can be read", func() {
+		BeforeEach(func() {
+			t.gcpClient.EXPECT().ListZones().Return(&compute.ZoneList{}, nil)
+			t.gcpClient.EXPECT().GetFirewallRule(projectID, ingressRuleName).Return(nil, &googleapi.Error{Code: http.StatusNotFound})
+		})
+
+		It("should succeed", func() {
+			Expect(retError).To(Succeed())
+		})
+	})
+
+	When("neither the zones nor the firewall rules can be read", func() {
+		BeforeEach(func() {
+			t.gcpClient.EXPECT().ListZones().Return(nil, &googleapi.Error{Code: http.StatusForbidden})
+			t.gcpClient.EXPECT().GetFirewallRule(projectID, ingressRuleName).Return(nil, &googleapi.Error{Code: http.StatusForbidden})
+		})
+
+		It("should return both errors", func() {
+			Expect(retError).To(MatchError(ContainSubstring("unable to list the zones")))
+			Expect(retError).To(MatchError(ContainSubstring("unable to read the firewall rule")))
+		})
+	})
+}
+
 type cloudTestDriver struct {
 	fakeGCPClientBase
-	cloud api.Cloud
+	cloud       api.Cloud
+	networkName string
 }
 
 func newCloudTestDriver() *cloudTestDriver {
@@ -189,12 +314,16 @@ func newCloudTestDriver() *cloudTestDriver {
 
 	BeforeEach(func() {
 		t.beforeEach()
+		t.networkName = ""
+	})
 
+	JustBeforeEach(func() {
 		t.cloud = gcp.NewCloud(gcp.CloudInfo{
-			InfraID:   infraID,
-			Region:    region,
-			ProjectID: projectID,
-			Client:    t.gcpClient,
+			InfraID:     infraID,
+			Region:      region,
+			ProjectID:   projectID,
+			Client:      t.gcpClient,
+			NetworkName: t.networkName,
 		})
 	})
 
@@ -205,14 +334,15 @@ func newCloudTestDriver() *cloudTestDriver {
 
 func assertIngressRule(rule *compute.Firewall) {
 	Expect(rule.Name).To(Equal(ingressRuleName))
+	Expect(rule.Network).To(Equal("projects/" + projectID + "/global/networks/" + infraID + "-network"))
 	Expect(rule.Direction).To(Equal("INGRESS"))
 	Expect(rule.Allowed).To(HaveLen(2))
 	Expect(rule.Allowed[0]).To(Equal(&compute.FirewallAllowed{
-		IPProtocol: "TCP",
+		IPProtocol: "tcp",
 		Ports:      []string{"100"},
 	}))
 	Expect(rule.Allowed[1]).To(Equal(&compute.FirewallAllowed{
-		IPProtocol: "UDP",
+		IPProtocol: "udp",
 		Ports:      []string{"200"},
 	}))
 }
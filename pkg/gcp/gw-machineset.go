@@ -64,7 +64,7 @@ spec:
           machineType: {{.InstanceType}}
           metadata:
           networkInterfaces:
-          - network: {{.InfraID}}-network
+          - network: {{.NetworkName}}
             subnetwork: {{.InfraID}}-worker-subnet
             publicIP: true
           projectID: {{.ProjectID}}
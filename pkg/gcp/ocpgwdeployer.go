@@ -20,6 +20,7 @@ package gcp
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strings"
 	"text/template"
@@ -56,11 +57,17 @@ func NewOcpGatewayDeployer(info CloudInfo, msDeployer ocp.MachineSetDeployer, in
 	}
 }
 
-func (d *ocpGatewayDeployer) Deploy(input api.GatewayDeployInput, status reporter.Interface) error {
+func (d *ocpGatewayDeployer) Deploy(ctx context.Context, input api.GatewayDeployInput, status reporter.Interface) error {
+	input.PublicPorts = api.SortPorts(input.PublicPorts)
+
 	status.Start("Configuring the required firewall rules for inter-cluster traffic")
 	defer status.End()
 
-	externalIngress := newExternalFirewallRules(d.ProjectID, d.InfraID, input.PublicPorts)
+	if err := ctx.Err(); err != nil {
+		return status.Error(err, "unable to deploy the gateways")
+	}
+
+	externalIngress := newExternalFirewallRules(d.networkURL(), d.InfraID, input.PublicPorts)
 	if err := d.openPorts(externalIngress); err != nil {
 		return status.Error(err, "error creating firewall rule %q", externalIngress.Name)
 	}
@@ -161,6 +168,7 @@ func (d *ocpGatewayDeployer) parseCurrentGatewayInstances(status reporter.Interf
 type machineSetConfig struct {
 	AZ                  string
 	InfraID             string
+	NetworkName         string
 	ProjectID           string
 	InstanceType        string
 	Region              string
@@ -179,6 +187,7 @@ func (d *ocpGatewayDeployer) loadGatewayYAML(zone, image string) ([]byte, error)
 	tplVars := machineSetConfig{
 		AZ:                  zone,
 		InfraID:             d.InfraID,
+		NetworkName:         d.networkName(),
 		ProjectID:           d.ProjectID,
 		InstanceType:        d.instanceType,
 		Region:              d.Region,
@@ -233,10 +242,14 @@ func (d *ocpGatewayDeployer) deployGateway(zone string) error {
 	return errors.Wrapf(d.msDeployer.Deploy(machineSet), "error deploying machine set %q", machineSet.GetName())
 }
 
-func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
+func (d *ocpGatewayDeployer) Cleanup(ctx context.Context, status reporter.Interface) error {
 	status.Start("Retrieving the Submariner gateway firewall rules")
 	defer status.End()
 
+	if err := ctx.Err(); err != nil {
+		return status.Error(err, "unable to clean up the gateways")
+	}
+
 	err := d.deleteExternalFWRules(status)
 	if err != nil {
 		return status.Error(err, "failed to delete the gateway firewall rules in the project %q", d.ProjectID)
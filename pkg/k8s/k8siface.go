@@ -21,12 +21,17 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/submariner-io/admiral/pkg/resource"
 	"github.com/submariner-io/admiral/pkg/util"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -34,6 +39,13 @@ const (
 	SubmarinerGatewayLabel = "submariner.io/gateway"
 )
 
+// labelVerificationBackoff is the backoff used to re-read a node until the gateway label added to it is visible.
+var labelVerificationBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: 100 * time.Millisecond,
+	Factor:   2,
+}
+
 type Interface interface {
 	ListNodesWithLabel(labelSelector string) (*v1.NodeList, error)
 	ListGatewayNodes() (*v1.NodeList, error)
@@ -42,16 +54,96 @@ type Interface interface {
 	RemoveGWLabelFromWorkerNode(node *v1.Node) error
 }
 
+// ConfigMapInterface is optionally implemented by an Interface, such as those returned by NewInterface and
+// NewInterfaceWithNodes, which can read and write ConfigMaps.
+type ConfigMapInterface interface {
+	UpdateConfigMapData(namespace, name string, data map[string]string) error
+	GetConfigMapData(namespace, name string) (map[string]string, error)
+}
+
+// ReachabilityChecker is optionally implemented by an Interface, such as those returned by NewInterface and
+// NewInterfaceWithNodes, which can check that the cluster's API server can be reached.
+type ReachabilityChecker interface {
+	CheckReachable() error
+}
+
+// CheckReachable verifies that the cluster's API server can be reached, if the given Interface implements
+// ReachabilityChecker; otherwise it assumes it can be.
+func CheckReachable(client Interface) error {
+	if checker, ok := client.(ReachabilityChecker); ok {
+		return checker.CheckReachable() //nolint:wrapcheck // Let the caller wrap it.
+	}
+
+	return nil
+}
+
 type k8sIface struct {
 	clientSet kubernetes.Interface
+
+	// nodes, if set, holds the pre-fetched nodes of the cluster which are listed instead of querying the API server.
+	nodes     []v1.Node
+	nodesLock sync.Mutex
 }
 
 func NewInterface(clientSet kubernetes.Interface) Interface {
 	return &k8sIface{clientSet: clientSet}
 }
 
+// NewInterfaceWithNodes returns an Interface which lists the given pre-fetched nodes rather than querying the API server
+// each time, so that the nodes can be retrieved once and reused by the internal, gateway and load balancer preparation.
+// The gateway label changes made through the returned Interface are applied to the given nodes too. If nodes is nil, the
+// nodes are listed from the API server, as with NewInterface.
+func NewInterfaceWithNodes(clientSet kubernetes.Interface, nodes []v1.Node) Interface {
+	k := &k8sIface{clientSet: clientSet}
+
+	if nodes != nil {
+		k.nodes = make([]v1.Node, len(nodes))
+		for i := range nodes {
+			nodes[i].DeepCopyInto(&k.nodes[i])
+		}
+	}
+
+	return k
+}
+
+func (k *k8sIface) listNodes(labelSelector string) (*v1.NodeList, error) {
+	k.nodesLock.Lock()
+	defer k.nodesLock.Unlock()
+
+	if k.nodes == nil {
+		return k.clientSet.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: labelSelector})
+	}
+
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid label selector %q", labelSelector)
+	}
+
+	list := &v1.NodeList{Items: []v1.Node{}}
+
+	for i := range k.nodes {
+		if selector.Matches(labels.Set(k.nodes[i].Labels)) {
+			list.Items = append(list.Items, *k.nodes[i].DeepCopy())
+		}
+	}
+
+	return list, nil
+}
+
+// updateCachedLabels applies the given label change to the pre-fetched node with the given name, if any.
+func (k *k8sIface) updateCachedLabels(nodeName string, mutate func(existing *v1.Node)) {
+	k.nodesLock.Lock()
+	defer k.nodesLock.Unlock()
+
+	for i := range k.nodes {
+		if k.nodes[i].Name == nodeName {
+			mutate(&k.nodes[i])
+		}
+	}
+}
+
 func (k *k8sIface) ListNodesWithLabel(labelSelector string) (*v1.NodeList, error) {
-	nodes, err := k.clientSet.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: labelSelector})
+	nodes, err := k.listNodes(labelSelector)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to list the nodes in the cluster")
 	}
@@ -60,9 +152,7 @@ func (k *k8sIface) ListNodesWithLabel(labelSelector string) (*v1.NodeList, error
 }
 
 func (k *k8sIface) ListGatewayNodes() (*v1.NodeList, error) {
-	labelSelector := SubmarinerGatewayLabel + "=true"
-
-	nodes, err := k.clientSet.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: labelSelector})
+	nodes, err := k.listNodes(SubmarinerGatewayLabel + "=true")
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to list the Gateway nodes in the cluster")
 	}
@@ -80,30 +170,80 @@ func (k *k8sIface) updateLabel(nodeName string, mutate func(existing *v1.Node))
 		},
 	}
 
-	return errors.Wrap(util.Update[*v1.Node](context.TODO(), client, &v1.Node{
+	err := util.Update[*v1.Node](context.TODO(), client, &v1.Node{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: nodeName,
 		},
 	}, func(existing *v1.Node) (*v1.Node, error) {
 		mutate(existing)
 		return existing, nil
-	}), "error updating node")
+	})
+	if err != nil {
+		return errors.Wrap(err, "error updating node")
+	}
+
+	k.updateCachedLabels(nodeName, mutate)
+
+	return nil
 }
 
 func (k *k8sIface) AddGWLabelOnNode(nodeName string) error {
-	return k.updateLabel(nodeName, func(existing *v1.Node) {
-		labels := existing.GetLabels()
-		if labels == nil {
-			labels = map[string]string{}
+	found := false
+
+	err := k.updateLabel(nodeName, func(existing *v1.Node) {
+		found = true
+
+		nodeLabels := existing.GetLabels()
+		if nodeLabels == nil {
+			nodeLabels = map[string]string{}
 		}
 
-		labels[SubmarinerGatewayLabel] = "true"
-		existing.SetLabels(labels)
+		nodeLabels[SubmarinerGatewayLabel] = "true"
+		existing.SetLabels(nodeLabels)
 	})
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return apierrors.NewNotFound(v1.Resource("nodes"), nodeName)
+	}
+
+	return k.verifyGWLabel(nodeName)
+}
+
+// verifyGWLabel re-reads the given node until it has the gateway label, to catch updates which silently didn't apply. A
+// node deleted since it was labelled is reported as an error.
+func (k *k8sIface) verifyGWLabel(nodeName string) error {
+	var lastErr error
+
+	err := wait.ExponentialBackoff(labelVerificationBackoff, func() (bool, error) {
+		node, err := k.clientSet.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, errors.Errorf("node %q was deleted after the gateway label was applied", nodeName)
+		}
+
+		if err != nil {
+			lastErr = err
+			return false, nil
+		}
+
+		return node.Labels[SubmarinerGatewayLabel] == "true", nil
+	})
+
+	if wait.Interrupted(err) {
+		if lastErr != nil {
+			return errors.Wrapf(lastErr, "error verifying the gateway label on node %q", nodeName)
+		}
+
+		return errors.Errorf("the gateway label wasn't applied to node %q", nodeName)
+	}
+
+	return errors.Wrapf(err, "error verifying the gateway label on node %q", nodeName)
 }
 
 func (k *k8sIface) RemoveGWLabelFromWorkerNodes() error {
-	gwNodeList, err := k.clientSet.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: SubmarinerGatewayLabel})
+	gwNodeList, err := k.listNodes(SubmarinerGatewayLabel)
 	if err != nil {
 		return errors.Wrap(err, "error listing submariner gateway nodes")
 	}
@@ -119,6 +259,46 @@ func (k *k8sIface) RemoveGWLabelFromWorkerNodes() error {
 	return nil
 }
 
+// UpdateConfigMapData creates the given ConfigMap if it doesn't exist and merges the given data into it.
+func (k *k8sIface) UpdateConfigMapData(namespace, name string, data map[string]string) error {
+	_, err := util.CreateOrUpdate[*v1.ConfigMap](context.TODO(), resource.ForConfigMap(k.clientSet, namespace), &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Data: data,
+	}, func(existing *v1.ConfigMap) (*v1.ConfigMap, error) {
+		if existing.Data == nil {
+			existing.Data = map[string]string{}
+		}
+
+		for key, value := range data {
+			existing.Data[key] = value
+		}
+
+		return existing, nil
+	})
+
+	return errors.Wrapf(err, "error updating ConfigMap %s/%s", namespace, name)
+}
+
+// GetConfigMapData returns the data of the given ConfigMap.
+func (k *k8sIface) GetConfigMapData(namespace, name string) (map[string]string, error) {
+	cm, err := k.clientSet.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting ConfigMap %s/%s", namespace, name)
+	}
+
+	return cm.Data, nil
+}
+
+// CheckReachable verifies that the cluster's API server can be reached by retrieving its version.
+func (k *k8sIface) CheckReachable() error {
+	_, err := k.clientSet.Discovery().ServerVersion()
+
+	return errors.Wrap(err, "cluster API unreachable")
+}
+
 func (k *k8sIface) RemoveGWLabelFromWorkerNode(node *v1.Node) error {
 	return k.updateLabel(node.Name, func(existing *v1.Node) {
 		delete(existing.Labels, SubmarinerGatewayLabel)
@@ -27,8 +27,11 @@ import (
 	"github.com/submariner-io/admiral/pkg/fake"
 	"github.com/submariner-io/cloud-prepare/pkg/k8s"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	kubeFake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/testing"
 )
 
 var _ = Describe("Interface", func() {
@@ -36,8 +39,172 @@ var _ = Describe("Interface", func() {
 	Describe("ListGatewayNodes", testListGatewayNodes)
 	Describe("AddGWLabelOnNode", testAddGWLabelOnNode)
 	Describe("RemoveGWLabelFromWorkerNodes", testRemoveGWLabelFromWorkerNodes)
+	Describe("UpdateConfigMapData", testUpdateConfigMapData)
+	Describe("GetConfigMapData", testGetConfigMapData)
+	Describe("CheckReachable", testCheckReachable)
+	Describe("NewInterfaceWithNodes", testWithPrefetchedNodes)
 })
 
+func testWithPrefetchedNodes() {
+	t := newInterfaceTestDriver()
+
+	var nodes []corev1.Node
+
+	BeforeEach(func() {
+		t.nodes = []*corev1.Node{
+			newNode("node-1", map[string]string{k8s.SubmarinerGatewayLabel: "true"}),
+			newNode("node-2", map[string]string{"label1": "true"}),
+		}
+
+		nodes = []corev1.Node{*t.nodes[0], *t.nodes[1]}
+	})
+
+	JustBeforeEach(func() {
+		t.client = k8s.NewInterfaceWithNodes(t.kubeClient, nodes)
+	})
+
+	assertNoListCalls := func() {
+		for _, action := range t.kubeClient.Fake.Actions() {
+			Expect(action.GetVerb()).ToNot(Equal("list"), "Unexpected %s of %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+
+	It("should list the provided nodes without querying the API server", func() {
+		list, err := t.client.ListGatewayNodes()
+		Expect(err).To(Succeed())
+		assertNodeNames(list, "node-1")
+
+		t.testListNodesWithLabel("label1=true", "node-2")
+		assertNoListCalls()
+	})
+
+	It("should reflect the gateway label changes in the provided nodes", func() {
+		Expect(t.client.AddGWLabelOnNode("node-2")).To(Succeed())
+		t.assertLabel("node-2", k8s.SubmarinerGatewayLabel, "true")
+
+		list, err := t.client.ListGatewayNodes()
+		Expect(err).To(Succeed())
+		assertNodeNames(list, "node-1", "node-2")
+
+		Expect(t.client.RemoveGWLabelFromWorkerNodes()).To(Succeed())
+		t.assertNoLabel("node-1", k8s.SubmarinerGatewayLabel)
+
+		list, err = t.client.ListGatewayNodes()
+		Expect(err).To(Succeed())
+		assertNodeNames(list)
+		assertNoListCalls()
+	})
+
+	When("no nodes are provided", func() {
+		BeforeEach(func() {
+			nodes = nil
+		})
+
+		It("should list the nodes from the API server", func() {
+			list, err := t.client.ListGatewayNodes()
+			Expect(err).To(Succeed())
+			assertNodeNames(list, "node-1")
+		})
+	})
+}
+
+func testCheckReachable() {
+	t := newInterfaceTestDriver()
+
+	It("should succeed if the API server responds", func() {
+		Expect(k8s.CheckReachable(t.client)).To(Succeed())
+	})
+
+	When("the Interface doesn't support reachability checks", func() {
+		It("should succeed", func() {
+			Expect(k8s.CheckReachable(struct{ k8s.Interface }{t.client})).To(Succeed())
+		})
+	})
+
+	When("the API server is unreachable", func() {
+		BeforeEach(func() {
+			t.kubeClient.PrependReactor("get", "version", func(_ testing.Action) (bool, runtime.Object, error) {
+				return true, nil, errors.New("connection refused")
+			})
+		})
+
+		It("should return an error", func() {
+			Expect(k8s.CheckReachable(t.client)).To(MatchError(ContainSubstring("cluster API unreachable")))
+		})
+	})
+}
+
+func testGetConfigMapData() {
+	const (
+		namespace = "test-ns"
+		name      = "test-config"
+	)
+
+	t := newInterfaceTestDriver()
+
+	When("the ConfigMap exists", func() {
+		BeforeEach(func() {
+			_, err := t.kubeClient.CoreV1().ConfigMaps(namespace).Create(context.TODO(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Data:       map[string]string{"foo": "bar"},
+			}, metav1.CreateOptions{})
+			Expect(err).To(Succeed())
+		})
+
+		It("should return its data", func() {
+			Expect(t.client.(k8s.ConfigMapInterface).GetConfigMapData(namespace, name)).To(Equal(map[string]string{"foo": "bar"}))
+		})
+	})
+
+	When("the ConfigMap doesn't exist", func() {
+		It("should return a NotFound error", func() {
+			_, err := t.client.(k8s.ConfigMapInterface).GetConfigMapData(namespace, name)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+}
+
+func testUpdateConfigMapData() {
+	const (
+		namespace = "test-ns"
+		name      = "test-state"
+	)
+
+	t := newInterfaceTestDriver()
+
+	getData := func() map[string]string {
+		cm, err := t.kubeClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).To(Succeed())
+
+		return cm.Data
+	}
+
+	When("the ConfigMap doesn't exist", func() {
+		It("should create it with the data", func() {
+			Expect(t.client.(k8s.ConfigMapInterface).UpdateConfigMapData(namespace, name, map[string]string{"foo": "bar"})).To(Succeed())
+			Expect(getData()).To(Equal(map[string]string{"foo": "bar"}))
+		})
+	})
+
+	When("the ConfigMap already exists", func() {
+		It("should merge the data", func() {
+			Expect(t.client.(k8s.ConfigMapInterface).UpdateConfigMapData(namespace, name, map[string]string{"foo": "bar", "baz": "1"})).To(Succeed())
+			Expect(t.client.(k8s.ConfigMapInterface).UpdateConfigMapData(namespace, name, map[string]string{"baz": "2"})).To(Succeed())
+			Expect(getData()).To(Equal(map[string]string{"foo": "bar", "baz": "2"}))
+		})
+	})
+
+	Context("on failure", func() {
+		BeforeEach(func() {
+			fake.NewFailingReactorForResource(&t.kubeClient.Fake, "configmaps").SetFailOnCreate(errors.New("fake error"))
+		})
+
+		It("should return an error", func() {
+			Expect(t.client.(k8s.ConfigMapInterface).UpdateConfigMapData(namespace, name, map[string]string{"foo": "bar"})).ToNot(Succeed())
+		})
+	})
+}
+
 func testRemoveGWLabelFromWorkerNodes() {
 	t := newInterfaceTestDriver()
 
@@ -127,8 +294,68 @@ func testAddGWLabelOnNode() {
 			t.nodes = nil
 		})
 
-		It("should not return an error", func() {
+		It("should return a NotFound error", func() {
+			err := t.client.AddGWLabelOnNode("node")
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	When("the first read after the update doesn't show the gateway label", func() {
+		JustBeforeEach(func() {
+			updated, staleReads := false, 0
+
+			t.kubeClient.PrependReactor("update", "nodes", func(_ testing.Action) (bool, runtime.Object, error) {
+				updated = true
+				return false, nil, nil
+			})
+
+			t.kubeClient.PrependReactor("get", "nodes", func(_ testing.Action) (bool, runtime.Object, error) {
+				if !updated || staleReads > 0 {
+					return false, nil, nil
+				}
+
+				staleReads++
+
+				return true, newNode("node", map[string]string{"foo": "bar"}), nil
+			})
+		})
+
+		It("should retry until the label is confirmed", func() {
 			Expect(t.client.AddGWLabelOnNode("node")).To(Succeed())
+			t.assertLabel(t.nodes[0].Name, k8s.SubmarinerGatewayLabel, "true")
+
+			gets := 0
+
+			for _, action := range t.kubeClient.Fake.Actions() {
+				if action.GetResource().Resource == "nodes" && action.GetVerb() == "get" {
+					gets++
+				}
+			}
+
+			Expect(gets).To(BeNumerically(">=", 3))
+		})
+	})
+
+	When("the node is deleted after the gateway label is applied", func() {
+		JustBeforeEach(func() {
+			updated := false
+
+			t.kubeClient.PrependReactor("update", "nodes", func(_ testing.Action) (bool, runtime.Object, error) {
+				updated = true
+				return false, nil, nil
+			})
+
+			t.kubeClient.PrependReactor("get", "nodes", func(_ testing.Action) (bool, runtime.Object, error) {
+				if !updated {
+					return false, nil, nil
+				}
+
+				return true, nil, apierrors.NewNotFound(corev1.Resource("nodes"), "node")
+			})
+		})
+
+		It("should return an error", func() {
+			Expect(t.client.AddGWLabelOnNode("node")).To(MatchError(ContainSubstring(`node "node" was deleted`)))
 		})
 	})
 
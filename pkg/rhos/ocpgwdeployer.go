@@ -20,6 +20,7 @@ package rhos
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -132,10 +133,16 @@ func (d *ocpGatewayDeployer) deployGateway(useInternalSG bool) error {
 	return errors.Wrap(d.msDeployer.Deploy(machineSet), "failed to deploy submariner gateway node")
 }
 
-func (d *ocpGatewayDeployer) Deploy(input api.GatewayDeployInput, status reporter.Interface) error {
+func (d *ocpGatewayDeployer) Deploy(ctx context.Context, input api.GatewayDeployInput, status reporter.Interface) error {
+	input.PublicPorts = api.SortPorts(input.PublicPorts)
+
 	status.Start("Configuring the required firewall rules for inter-cluster traffic")
 	defer status.End()
 
+	if err := ctx.Err(); err != nil {
+		return status.Error(err, "unable to deploy the gateways")
+	}
+
 	computeClient, err := openstack.NewComputeV2(d.Client, gophercloud.EndpointOpts{Region: d.Region})
 	if err != nil {
 		return status.Error(err, "error creating the compute client")
@@ -230,7 +237,11 @@ func (d *ocpGatewayDeployer) deployDedicatedGWNode(gatewayNodesToDeploy int, use
 	return nil
 }
 
-func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
+func (d *ocpGatewayDeployer) Cleanup(ctx context.Context, status reporter.Interface) error {
+	if err := ctx.Err(); err != nil {
+		return status.Error(err, "unable to clean up the gateways")
+	}
+
 	computeClient, err := openstack.NewComputeV2(d.Client, gophercloud.EndpointOpts{Region: d.Region})
 	if err != nil {
 		return status.Error(err, "error creating the compute client for the region: %q", d.Region)
@@ -311,7 +322,7 @@ func (d *ocpGatewayDeployer) Cleanup(status reporter.Interface) error {
 func formatPorts(ports []api.PortSpec) string {
 	portStrs := []string{}
 	for _, port := range ports {
-		portStrs = append(portStrs, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+		portStrs = append(portStrs, port.String())
 	}
 
 	return strings.Join(portStrs, ", ")
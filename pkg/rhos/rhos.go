@@ -19,10 +19,14 @@ limitations under the License.
 package rhos
 
 import (
+	"context"
+
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/pkg/errors"
 	"github.com/submariner-io/admiral/pkg/reporter"
 	"github.com/submariner-io/cloud-prepare/pkg/api"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 const (
@@ -43,10 +47,21 @@ func NewCloud(info CloudInfo) api.Cloud {
 	}
 }
 
-func (rc *rhosCloud) OpenPorts(ports []api.PortSpec, status reporter.Interface) error {
+func (rc *rhosCloud) OpenPorts(ctx context.Context, ports []api.PortSpec, status reporter.Interface) error {
+	ports, err := api.NormalizePorts(ports)
+	if err != nil {
+		return errors.Wrap(err, "invalid ports")
+	}
+
+	api.SetTotalSteps(status, 1)
+
 	status.Start("Opening internal ports for intra-cluster communications on RHOS")
 	defer status.End()
 
+	if err := ctx.Err(); err != nil {
+		return status.Error(err, "unable to open ports")
+	}
+
 	computeClient, err := openstack.NewComputeV2(rc.Client, gophercloud.EndpointOpts{Region: rc.Region})
 	if err != nil {
 		return status.Error(err, "error creating the compute client")
@@ -66,9 +81,15 @@ func (rc *rhosCloud) OpenPorts(ports []api.PortSpec, status reporter.Interface)
 	return nil
 }
 
-func (rc *rhosCloud) ClosePorts(status reporter.Interface) error {
+func (rc *rhosCloud) ClosePorts(ctx context.Context, status reporter.Interface) error {
+	api.SetTotalSteps(status, 1)
+
 	status.Start("Revoking intra-cluster communication permissions")
 
+	if err := ctx.Err(); err != nil {
+		return status.Error(err, "unable to remove firewall rules")
+	}
+
 	computeClient, err := openstack.NewComputeV2(rc.Client, gophercloud.EndpointOpts{Region: rc.Region})
 	if err != nil {
 		return status.Error(err, "creating compute client failed for region %q", rc.Region)
@@ -86,3 +107,35 @@ func (rc *rhosCloud) ClosePorts(status reporter.Interface) error {
 
 	return nil
 }
+
+func (rc *rhosCloud) Validate(ctx context.Context, status reporter.Interface) error {
+	api.SetTotalSteps(status, 1)
+
+	status.Start("Validating the RHOS prerequisites")
+	defer status.End()
+
+	if err := ctx.Err(); err != nil {
+		return status.Error(err, "unable to validate the prerequisites")
+	}
+
+	errs := []error{}
+
+	computeClient, err := openstack.NewComputeV2(rc.Client, gophercloud.EndpointOpts{Region: rc.Region})
+	if err != nil {
+		errs = append(errs, errors.Wrapf(err, "creating compute client failed for region %q", rc.Region))
+	} else if _, err := checkIfSecurityGroupPresent(rc.InfraID+internalSecurityGroupSuffix, computeClient); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := openstack.NewNetworkV2(rc.Client, gophercloud.EndpointOpts{Region: rc.Region}); err != nil {
+		errs = append(errs, errors.Wrapf(err, "creating network client failed for region %q", rc.Region))
+	}
+
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		return status.Error(err, "the RHOS prerequisites aren't met")
+	}
+
+	status.Success("Validated the RHOS prerequisites")
+
+	return nil
+}
@@ -58,7 +58,7 @@ func (c *CloudInfo) openInternalPorts(infraID string, ports []api.PortSpec,
 		}
 
 		for _, port := range ports {
-			err = c.createSGRule(group.ID, group.ID, "", port.Port, port.Protocol, networkClient)
+			err = c.createSGRule(group.ID, group.ID, "", port, networkClient)
 			if err != nil {
 				return errors.WithMessage(err, "creating security group rule failed")
 			}
@@ -152,7 +152,7 @@ func (c *CloudInfo) createGWSecurityGroup(ports []api.PortSpec, groupName string
 	}
 
 	for _, port := range ports {
-		err = c.createSGRule(group.ID, "", allNetworkCIDR, port.Port, port.Protocol, networkClient)
+		err = c.createSGRule(group.ID, "", allNetworkCIDR, port, networkClient)
 		if err != nil {
 			return errors.WithMessagef(err, "creating security group rule failed")
 		}
@@ -271,22 +271,25 @@ func (c *CloudInfo) deleteSG(groupName string, computeClient *gophercloud.Servic
 	return errors.WithMessagef(err, "error deleting the security group %q", groupName)
 }
 
-func (c *CloudInfo) createSGRule(group, remoteGroupID, remoteIPPrefix string, port uint16,
-	protocol string, networkClient *gophercloud.ServiceClient,
+func (c *CloudInfo) createSGRule(group, remoteGroupID, remoteIPPrefix string, port api.PortSpec,
+	networkClient *gophercloud.ServiceClient,
 ) error {
 	opts := rules.CreateOpts{
 		Direction:      "ingress",
 		EtherType:      rules.EtherType4,
 		SecGroupID:     group,
-		PortRangeMax:   int(port),
-		PortRangeMin:   int(port),
-		Protocol:       rules.RuleProtocol(protocol),
+		Protocol:       rules.RuleProtocol(api.IPProtocol(port.Protocol)),
 		RemoteGroupID:  remoteGroupID,
 		RemoteIPPrefix: remoteIPPrefix,
 	}
 
+	if api.UsesPorts(port.Protocol) {
+		opts.PortRangeMax = int(port.LastPort())
+		opts.PortRangeMin = int(port.Port)
+	}
+
 	_, err := rules.Create(networkClient, opts).Extract()
 
-	return errors.WithMessagef(err, "failed creating security group rule with port %d , protocol %q,"+
-		"remotegroupID %q, remoteIPprefix %q , in security group %q", port, protocol, remoteGroupID, remoteIPPrefix, group)
+	return errors.WithMessagef(err, "failed creating security group rule with port %s,"+
+		"remotegroupID %q, remoteIPprefix %q , in security group %q", port, remoteGroupID, remoteIPPrefix, group)
 }